@@ -1,7 +1,11 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"gounter/api/problem"
+	"gounter/internal/model"
 	"net/http"
 	"strings"
 	"time"
@@ -14,35 +18,81 @@ var JWTSecret = []byte("my-secret-key")
 
 const bearerPrefix = "Bearer "
 
+// codeUnauthorized is the problem code of requests without a valid token
+const codeUnauthorized = "unauthorized"
+
+// codeForbidden is the problem code of requests whose token lacks the role they need
+const codeForbidden = "forbidden"
+
+// AdminRole is the value of the role claim of the tokens allowed on the admin routes
+const AdminRole = "admin"
+
+type adminKey struct{}
+
+// Errors of the requests without a valid token, safe to show to the client
+var (
+	errMissingToken = errors.New("Authorization header missing")
+	errTokenFormat  = errors.New("Invalid token format")
+	errInvalidToken = errors.New("Invalid or expired token")
+)
+
 // AuthorizationMiddleware checks for a valid token in the Authorization header
 func AuthorizationMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get the Authorization header
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Authorization header missing", http.StatusUnauthorized)
+		ctx, err := authenticate(r.Context(), r.Header.Get("Authorization"))
+		if err != nil {
+			problem.Write(w, r, http.StatusUnauthorized, codeUnauthorized, err.Error())
 			return
 		}
 
-		token := strings.TrimSpace(authHeader)
-		if !strings.HasPrefix(token, bearerPrefix) {
-			http.Error(w, "Invalid token format", http.StatusUnauthorized)
-			return
-		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
-		token = strings.TrimPrefix(token, bearerPrefix)
-		if !isValidToken(token) {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+// AdminMiddleware only lets through the requests authenticated by
+// AuthorizationMiddleware with a token holding the admin role
+func AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if admin, _ := r.Context().Value(adminKey{}).(bool); !admin {
+			problem.Write(w, r, http.StatusForbidden, codeForbidden, "admin role required")
 			return
 		}
 
-		// Token is valid, proceed to the next handler
 		next.ServeHTTP(w, r)
 	})
 }
 
-// isValidToken validates the JWT token
-func isValidToken(tokenStr string) bool {
+// authenticate checks the bearer token of an Authorization header, and passes
+// its subject on in the returned context so changes can be attributed to it
+func authenticate(ctx context.Context, authHeader string) (context.Context, error) {
+	if authHeader == "" {
+		return nil, errMissingToken
+	}
+
+	token := strings.TrimSpace(authHeader)
+	if !strings.HasPrefix(token, bearerPrefix) {
+		return nil, errTokenFormat
+	}
+
+	token = strings.TrimPrefix(token, bearerPrefix)
+	claims, ok := isValidToken(token)
+	if !ok {
+		return nil, errInvalidToken
+	}
+
+	if subject, ok := claims["sub"].(string); ok && subject != "" {
+		ctx = model.WithSubject(ctx, subject)
+	}
+
+	if role, _ := claims["role"].(string); role == AdminRole {
+		ctx = context.WithValue(ctx, adminKey{}, true)
+	}
+
+	return ctx, nil
+}
+
+// isValidToken validates the JWT token and returns its claims
+func isValidToken(tokenStr string) (jwt.MapClaims, bool) {
 	// Parse the token
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
 		// Validate the signing method
@@ -54,7 +104,7 @@ func isValidToken(tokenStr string) bool {
 
 	if err != nil {
 		fmt.Println("Error parsing token:", err)
-		return false
+		return nil, false
 	}
 
 	// Check the claims (e.g., expiration)
@@ -62,14 +112,12 @@ func isValidToken(tokenStr string) bool {
 		if exp, ok := claims["exp"].(float64); ok {
 			if time.Unix(int64(exp), 0).Before(time.Now()) {
 				fmt.Println("Token is expired")
-				return false
+				return nil, false
 			}
 		}
 
-		// We can add other claim checks here (e.g., issuer, subject, roles)
-
-		return true // Token is valid
+		return claims, true // Token is valid
 	}
 
-	return false // Token is invalid
+	return nil, false // Token is invalid
 }
@@ -3,6 +3,7 @@ package auth_test
 import (
 	"fmt"
 	"gounter/api/auth"
+	"gounter/internal/model"
 	"gounter/util"
 	"net/http"
 	"net/http/httptest"
@@ -71,3 +72,66 @@ func TestAuthorizationMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthorizationMiddlewareSubject(t *testing.T) {
+	var subject string
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject, _ = model.SubjectFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	validJWT, err := util.GenerateValidJWT()
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", validJWT))
+
+	rr := httptest.NewRecorder()
+	auth.AuthorizationMiddleware(testHandler).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, util.TokenSubject, subject)
+}
+
+func TestAdminMiddleware(t *testing.T) {
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	validJWT, err := util.GenerateValidJWT()
+	assert.NoError(t, err)
+
+	adminJWT, err := util.GenerateAdminJWT()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+	}{
+		{
+			name:           "Admin token",
+			token:          adminJWT,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Token without admin role",
+			token:          validJWT,
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/counters/purge", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			rr := httptest.NewRecorder()
+
+			handler := auth.AuthorizationMiddleware(auth.AdminMiddleware(testHandler))
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package auth_test
+
+import (
+	"context"
+	"fmt"
+	"gounter/api/auth"
+	"gounter/internal/model"
+	"gounter/util"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	validJWT, err := util.GenerateValidJWT()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		authMetadata    string
+		expectedCode    codes.Code
+		expectedSubject string
+	}{
+		{
+			name:            "Valid token",
+			authMetadata:    fmt.Sprintf("Bearer %s", validJWT),
+			expectedCode:    codes.OK,
+			expectedSubject: util.TokenSubject,
+		},
+		{
+			name:         "Missing authorization metadata",
+			authMetadata: "",
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			name:         "Invalid token format",
+			authMetadata: "InvalidTokenFormat",
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			name:         "Expired or Invalid token",
+			authMetadata: "Bearer invalid-token",
+			expectedCode: codes.Unauthenticated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.authMetadata != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", tt.authMetadata))
+			}
+
+			var subject string
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				subject, _ = model.SubjectFromContext(ctx)
+				return req, nil
+			}
+
+			_, err := auth.UnaryServerInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/test"}, handler)
+
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+			assert.Equal(t, tt.expectedSubject, subject)
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package deprecation
+
+import (
+	"fmt"
+	"gounter/api/requestid"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// DocsLink documents the versions of the API, and what replaces their deprecated
+// routes and fields
+const DocsLink = "https://github.com/ambareeshb/gounter#api-versions"
+
+// Notice announces the deprecation of a route or field to its clients with the
+// Deprecation (RFC 9745) and Sunset (RFC 8594) headers
+type Notice struct {
+	// Since is when the route or field was deprecated
+	Since time.Time
+	// Sunset is when it stops working, zero while no date is planned
+	Sunset time.Time
+	// Link points to the documentation of the replacement, if any
+	Link string
+}
+
+// WriteHeaders sets the deprecation headers of the notice on the response
+func (n Notice) WriteHeaders(h http.Header) {
+	h.Set("Deprecation", fmt.Sprintf("@%d", n.Since.Unix()))
+	if !n.Sunset.IsZero() {
+		h.Set("Sunset", n.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if n.Link != "" {
+		h.Add("Link", fmt.Sprintf("<%s>; rel=\"deprecation\"", n.Link))
+	}
+}
+
+// Middleware marks every request to the routes it wraps as using a deprecated
+// route, and logs it so the remaining clients can be tracked down
+func (n Notice) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.WriteHeaders(w.Header())
+		log.Printf("Deprecated route %s %s used by %q (request %s)", r.Method, routeName(r), r.UserAgent(), requestid.FromContext(r.Context()))
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Field marks the response to a request using a deprecated field, and logs it.
+// It must be called before the response is written.
+func (n Notice) Field(w http.ResponseWriter, r *http.Request, field string) {
+	n.WriteHeaders(w.Header())
+	log.Printf("Deprecated field %s used on %s %s by %q (request %s)", field, r.Method, routeName(r), r.UserAgent(), requestid.FromContext(r.Context()))
+}
+
+// routeName returns the path template of the matched route, so the usage of a
+// route is logged the same way whatever the IDs in the path
+func routeName(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+
+	return r.URL.Path
+}
@@ -0,0 +1,85 @@
+package deprecation_test
+
+import (
+	"bytes"
+	"gounter/api/deprecation"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoticeHeaders(t *testing.T) {
+	since := time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name           string
+		notice         deprecation.Notice
+		expectedSunset string
+		expectedLink   string
+	}{
+		{
+			name:   "Without Sunset",
+			notice: deprecation.Notice{Since: since},
+		},
+		{
+			name:           "With Sunset And Link",
+			notice:         deprecation.Notice{Since: since, Sunset: time.Date(2027, time.April, 30, 2, 0, 0, 0, time.FixedZone("CEST", 2*60*60)), Link: "https://example.com/docs"},
+			expectedSunset: "Fri, 30 Apr 2027 00:00:00 GMT",
+			expectedLink:   `<https://example.com/docs>; rel="deprecation"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			header := http.Header{}
+			tc.notice.WriteHeaders(header)
+
+			assert.Equal(t, "@1792281600", header.Get("Deprecation"))
+			assert.Equal(t, tc.expectedSunset, header.Get("Sunset"))
+			assert.Equal(t, tc.expectedLink, header.Get("Link"))
+		})
+	}
+}
+
+func TestNoticeMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	notice := deprecation.Notice{Since: time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)}
+
+	router := mux.NewRouter()
+	router.Use(notice.Middleware)
+	router.HandleFunc("/counter/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/counter/42", nil)
+	req.Header.Set("User-Agent", "billing-sync/1.2")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "@1792281600", rr.Header().Get("Deprecation"))
+	assert.Contains(t, logs.String(), `Deprecated route GET /counter/{id} used by "billing-sync/1.2"`)
+}
+
+func TestNoticeField(t *testing.T) {
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	notice := deprecation.Notice{Since: time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)}
+
+	req := httptest.NewRequest(http.MethodPost, "/counters/42/increment", nil)
+	rr := httptest.NewRecorder()
+	notice.Field(rr, req, "id")
+
+	assert.Equal(t, "@1792281600", rr.Header().Get("Deprecation"))
+	assert.Contains(t, logs.String(), "Deprecated field id used on POST /counters/42/increment")
+}
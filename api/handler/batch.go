@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"gounter/api/problem"
+	"gounter/internal/model"
+	"gounter/internal/validation"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Batch modes
+const (
+	// batchAtomic applies every operation or none, it is the default
+	batchAtomic = "atomic"
+	// batchBestEffort applies the operations that succeed and reports the others
+	batchBestEffort = "best_effort"
+)
+
+// batchRequest is the body of the batch request
+type batchRequest struct {
+	Mode       string                  `json:"mode"`
+	Operations []batchOperationRequest `json:"operations"`
+}
+
+// batchOperationRequest is a single operation of a batch. A create takes the
+// fields of the create request, the other operations the id of their counter.
+// Delta defaults to 1 for an increment, a set needs both value and expected_version.
+type batchOperationRequest struct {
+	Op string    `json:"op"`
+	ID uuid.UUID `json:"id"`
+	model.CreateCounterParams
+	Delta           *int64 `json:"delta"`
+	Value           *int64 `json:"value"`
+	ExpectedVersion *int64 `json:"expected_version"`
+}
+
+// batchResult is the outcome of an operation of a batch, with the status the
+// operation would have been answered with on its own
+type batchResult struct {
+	Status  int            `json:"status"`
+	Counter *model.Counter `json:"counter,omitempty"`
+	// Code is the stable identifier of the error, as in the problem details of a single request
+	Code  string `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Errors lists the invalid fields of the operation
+	Errors []problem.FieldError `json:"errors,omitempty"`
+}
+
+// BatchCounters handles applying many counter operations at once.
+// In atomic mode a failed operation fails the request and nothing is applied,
+// in best_effort mode the result of every operation is returned.
+func (h *Handler) BatchCounters(w http.ResponseWriter, r *http.Request) {
+	var request batchRequest
+	err := decodeJSON(w, r, &request)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+
+	var atomic bool
+	switch request.Mode {
+	case "", batchAtomic:
+		atomic = true
+	case batchBestEffort:
+	default:
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidBody, "mode must be atomic or best_effort")
+		return
+	}
+
+	ops := make([]model.BatchOperation, len(request.Operations))
+	for i, operation := range request.Operations {
+		if ops[i], err = operation.toModel(); err != nil {
+			problem.WriteError(w, r, &model.BatchError{Index: i, Err: err})
+			return
+		}
+	}
+
+	results, err := h.service.ApplyBatch(r.Context(), ops, atomic)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	response := make([]batchResult, len(results))
+	for i, result := range results {
+		if result.Err != nil {
+			details := problem.Describe(result.Err)
+			response[i] = batchResult{Status: details.Status, Code: details.Code, Error: details.Detail, Errors: details.Errors}
+			continue
+		}
+
+		response[i] = batchResult{Status: http.StatusOK, Counter: result.Counter}
+		if ops[i].Type == model.BatchCreate {
+			response[i].Status = http.StatusCreated
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string][]batchResult{"results": response})
+}
+
+// toModel checks the fields the operation needs and returns it as the service takes it
+func (o batchOperationRequest) toModel() (model.BatchOperation, error) {
+	op := model.BatchOperation{Type: model.BatchOperationType(o.Op), CounterID: o.ID}
+
+	switch op.Type {
+	case model.BatchCreate:
+		op.Create = o.CreateCounterParams
+	case model.BatchIncrement:
+		op.Delta = 1
+		if o.Delta != nil {
+			op.Delta = *o.Delta
+		}
+	case model.BatchSet:
+		var v validation.Validator
+		v.Check(o.Value != nil, "value", validation.ErrRequired)
+		v.Check(o.ExpectedVersion != nil, "expected_version", validation.ErrRequired)
+		if err := v.Err(); err != nil {
+			return op, err
+		}
+		op.Value, op.ExpectedVersion = *o.Value, *o.ExpectedVersion
+	}
+
+	return op, nil
+}
@@ -0,0 +1,145 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"gounter/api/handler"
+	"gounter/internal/model"
+	"gounter/internal/service"
+	"gounter/test/mocks"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBatchCounters(t *testing.T) {
+	id := uuid.New()
+
+	testCases := []struct {
+		name             string
+		requestBody      interface{}
+		mockFunc         func(*mocks.Service)
+		expectedStatus   int
+		expectedStatuses []int
+	}{
+		{
+			name: "BatchCounters Atomic",
+			requestBody: map[string]interface{}{"operations": []map[string]interface{}{
+				{"op": "create", "name": "created", "max": 10},
+				{"op": "increment", "id": id},
+				{"op": "set", "id": id, "value": 3, "expected_version": 2},
+				{"op": "delete", "id": id},
+			}},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("ApplyBatch", mock.Anything, mock.MatchedBy(func(ops []model.BatchOperation) bool {
+					return len(ops) == 4 &&
+						ops[0].Type == model.BatchCreate && ops[0].Create.Name == "created" && *ops[0].Create.Max == 10 &&
+						assert.ObjectsAreEqual(model.BatchOperation{Type: model.BatchIncrement, CounterID: id, Delta: 1}, ops[1]) &&
+						assert.ObjectsAreEqual(model.BatchOperation{Type: model.BatchSet, CounterID: id, Value: 3, ExpectedVersion: 2}, ops[2]) &&
+						assert.ObjectsAreEqual(model.BatchOperation{Type: model.BatchDelete, CounterID: id}, ops[3])
+				}), true).Return([]model.BatchResult{
+					{Counter: &model.Counter{Name: "created"}},
+					{Counter: &model.Counter{ID: id, Value: 1}},
+					{Counter: &model.Counter{ID: id, Value: 3}},
+					{},
+				}, nil)
+			},
+			expectedStatus:   http.StatusOK,
+			expectedStatuses: []int{http.StatusCreated, http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+		{
+			name: "BatchCounters Best Effort",
+			requestBody: map[string]interface{}{"mode": "best_effort", "operations": []map[string]interface{}{
+				{"op": "increment", "id": id, "delta": 5},
+				{"op": "increment", "id": id, "delta": 50},
+				{"op": "delete", "id": id},
+			}},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("ApplyBatch", mock.Anything, mock.Anything, false).Return([]model.BatchResult{
+					{Counter: &model.Counter{ID: id, Value: 5}},
+					{Err: &service.OutOfBoundsError{ID: id, Delta: 50}},
+					{Err: service.ErrCounterNotFound},
+				}, nil)
+			},
+			expectedStatus:   http.StatusOK,
+			expectedStatuses: []int{http.StatusOK, http.StatusConflict, http.StatusNotFound},
+		},
+		{
+			name: "BatchCounters Atomic Failure",
+			requestBody: map[string]interface{}{"operations": []map[string]interface{}{
+				{"op": "set", "id": id, "value": 3, "expected_version": 2},
+			}},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("ApplyBatch", mock.Anything, mock.Anything, true).
+					Return(nil, &model.BatchError{Index: 0, Err: service.ErrVersionMismatch})
+			},
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name: "BatchCounters Set Without Version",
+			requestBody: map[string]interface{}{"operations": []map[string]interface{}{
+				{"op": "set", "id": id, "value": 3},
+			}},
+			mockFunc:       func(mockService *mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "BatchCounters Unknown Mode",
+			requestBody:    map[string]interface{}{"mode": "eventually", "operations": []map[string]interface{}{{"op": "delete", "id": id}}},
+			mockFunc:       func(mockService *mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "BatchCounters Unsupported Storage",
+			requestBody: map[string]interface{}{"operations": []map[string]interface{}{{"op": "delete", "id": id}}},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("ApplyBatch", mock.Anything, mock.Anything, true).Return(nil, service.ErrBatchUnsupported)
+			},
+			expectedStatus: http.StatusNotImplemented,
+		},
+		{
+			name:           "BatchCounters Invalid JSON",
+			requestBody:    "invalid",
+			mockFunc:       func(mockService *mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockService := new(mocks.Service)
+			h := handler.NewHandler(mockService)
+
+			b, _ := json.Marshal(tc.requestBody)
+			req, err := http.NewRequest("POST", "/counters/batch", bytes.NewBuffer(b))
+			assert.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+
+			tc.mockFunc(mockService)
+
+			h.BatchCounters(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			if tc.expectedStatuses != nil {
+				var response struct {
+					Results []struct {
+						Status int `json:"status"`
+					} `json:"results"`
+				}
+				assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+
+				statuses := []int{}
+				for _, result := range response.Results {
+					statuses = append(statuses, result.Status)
+				}
+				assert.Equal(t, tc.expectedStatuses, statuses)
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
@@ -1,20 +1,81 @@
 package handler
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"gounter/api/deprecation"
+	"gounter/api/problem"
 	"gounter/internal/model"
+	"gounter/internal/service"
+	"gounter/internal/validation"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
 type Service interface {
-	CreateCounter(ctx context.Context, name string) (*model.Counter, error)
-	IncrementCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error)
+	CreateCounter(ctx context.Context, params model.CreateCounterParams) (*model.Counter, error)
+	GetCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error)
+	ListCounters(ctx context.Context, query model.ListCountersQuery) (*model.CounterPage, error)
+	CounterHistory(ctx context.Context, query model.CounterHistoryQuery) (*model.CounterEventPage, error)
+	CounterSeries(ctx context.Context, query model.CounterSeriesQuery) (*model.CounterSeries, error)
+	CounterRate(ctx context.Context, id uuid.UUID, window time.Duration) (*model.CounterRate, error)
+	AggregateSeries(ctx context.Context, query model.AggregateSeriesQuery) (*model.AggregateSeries, error)
+	AggregateRate(ctx context.Context, labels string, window time.Duration) (*model.AggregateRate, error)
+	IncrementCounter(ctx context.Context, id uuid.UUID, delta int64) (*model.Counter, error)
+	IncrementCounterByName(ctx context.Context, namespace, name string, delta int64) (*model.Counter, error)
+	SetCounter(ctx context.Context, id uuid.UUID, value int64, expectedVersion int64) (*model.Counter, error)
+	UpdateCounter(ctx context.Context, id uuid.UUID, params model.UpdateCounterParams) (*model.Counter, error)
 	SoftDeleteCounter(ctx context.Context, id uuid.UUID) (int64, error)
+	RestoreCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error)
+	PurgeDeletedCounters(ctx context.Context, retention time.Duration) (int64, error)
+	ApplyBatch(ctx context.Context, ops []model.BatchOperation, atomic bool) ([]model.BatchResult, error)
+	WatchCounters(ctx context.Context, query model.WatchQuery) (<-chan model.CounterChange, error)
 }
 
+// incrementRequest is the body of the increment and decrement requests.
+// Delta defaults to 1 when it is omitted.
+type incrementRequest struct {
+	ID    uuid.UUID `json:"id"`
+	Delta *int64    `json:"delta"`
+}
+
+// bodyIDNotice deprecates the ID in the body of an increment whose path holds
+// the ID, only the legacy route needs it
+var bodyIDNotice = deprecation.Notice{
+	Since: time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC),
+	Link:  deprecation.DocsLink,
+}
+
+// setRequest is the body of the set request. The expected version can be given
+// either here or as an ETag in the If-Match header.
+type setRequest struct {
+	Value           *int64 `json:"value"`
+	ExpectedVersion *int64 `json:"expected_version"`
+}
+
+// Codes of the problems found in a request before it reaches the service,
+// the service errors carry their own
+const (
+	codeInvalidID            = "invalid_id"
+	codeInvalidBody          = "invalid_body"
+	codeInvalidParameter     = "invalid_parameter"
+	codeInvalidPrecondition  = "invalid_precondition"
+	codePreconditionRequired = "precondition_required"
+)
+
+// maxBodySize bounds the request bodies, a batch of the largest size fits easily
+const maxBodySize = 1 << 20
+
 type Handler struct {
 	service Service
 }
@@ -28,58 +89,589 @@ func NewHandler(service Service) *Handler {
 
 // CreateCounter handles counter creation
 func (h *Handler) CreateCounter(w http.ResponseWriter, r *http.Request) {
-	var counter *model.Counter
-	err := json.NewDecoder(r.Body).Decode(&counter)
+	var params model.CreateCounterParams
+	err := decodeJSON(w, r, &params)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+
+	counter, err := h.service.CreateCounter(r.Context(), params)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", "/counters/"+counter.ID.String())
+	writeJSON(w, http.StatusCreated, counter)
+}
+
+// GetCounter handles reading a single counter
+func (h *Handler) GetCounter(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidID, "Please provide valid uuid")
+		return
+	}
+
+	counter, err := h.service.GetCounter(r.Context(), id)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(counter))
+	writeJSON(w, http.StatusOK, counter)
+}
+
+// ListCounters handles listing counters.
+// Supported query parameters are prefix, id (repeatable or comma separated),
+// labels (a selector like team=payments,env=prod), sort (name, value or
+// created_at), order (asc or desc), cursor and limit.
+func (h *Handler) ListCounters(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	query := model.ListCountersQuery{
+		NamePrefix: params.Get("prefix"),
+		Labels:     params.Get("labels"),
+		SortBy:     model.CounterSort(params.Get("sort")),
+		Cursor:     params.Get("cursor"),
+	}
+
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidParameter, "order must be asc or desc")
+		return
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			problem.Write(w, r, http.StatusBadRequest, codeInvalidParameter, "limit must be a positive integer")
+			return
+		}
+		query.Limit = n
+	}
+
+	for _, value := range params["id"] {
+		for _, idString := range strings.Split(value, ",") {
+			id, err := uuid.Parse(strings.TrimSpace(idString))
+			if err != nil {
+				problem.Write(w, r, http.StatusBadRequest, codeInvalidID, "Please provide valid uuid")
+				return
+			}
+			query.IDs = append(query.IDs, id)
+		}
+	}
+
+	page, err := h.service.ListCounters(r.Context(), query)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// CounterHistory handles reading the changes made to a counter.
+// Supported query parameters are from and to (RFC 3339 timestamps), cursor and limit.
+func (h *Handler) CounterHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidID, "Please provide valid uuid")
+		return
+	}
+
+	params := r.URL.Query()
+
+	query := model.CounterHistoryQuery{
+		CounterID: id,
+		Cursor:    params.Get("cursor"),
+	}
+
+	if query.From, err = parseTimeParam(params, "from"); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+
+	if query.To, err = parseTimeParam(params, "to"); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			problem.Write(w, r, http.StatusBadRequest, codeInvalidParameter, "limit must be a positive integer")
+			return
+		}
+		query.Limit = n
+	}
+
+	page, err := h.service.CounterHistory(r.Context(), query)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// CounterSeries handles reading the tally of a counter per time bucket.
+// Supported query parameters are granularity (minute, hour or day, defaults to
+// hour) and from and to (RFC 3339 timestamps).
+func (h *Handler) CounterSeries(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidID, "Please provide valid uuid")
+		return
+	}
+
+	params := r.URL.Query()
+
+	query := model.CounterSeriesQuery{
+		CounterID:   id,
+		Granularity: model.GranularityHour,
+	}
+
+	if granularity := params.Get("granularity"); granularity != "" {
+		query.Granularity = model.Granularity(granularity)
+	}
+
+	if query.From, err = parseTimeParam(params, "from"); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+
+	if query.To, err = parseTimeParam(params, "to"); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+
+	series, err := h.service.CounterSeries(r.Context(), query)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		problem.WriteError(w, r, err)
 		return
 	}
 
-	counter, err = h.service.CreateCounter(r.Context(), counter.Name)
+	writeJSON(w, http.StatusOK, series)
+}
+
+// CounterRate handles reading the increments per second of a counter over the
+// sliding window given as a duration in the window query parameter (defaults to 5m)
+func (h *Handler) CounterRate(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidID, "Please provide valid uuid")
+		return
+	}
+
+	window := 5 * time.Minute
+	if value := r.URL.Query().Get("window"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, codeInvalidParameter, "window must be a duration like 5m")
+			return
+		}
+		window = d
+	}
+
+	rate, err := h.service.CounterRate(r.Context(), id, window)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		problem.WriteError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(counter)
+	writeJSON(w, http.StatusOK, rate)
 }
 
-// IncrementCounter handles incrementing a counter
+// AggregateSeries handles reading the tally per time bucket of the counters
+// matching the labels selector, summed up. The other query parameters are the
+// ones of CounterSeries.
+func (h *Handler) AggregateSeries(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	query := model.AggregateSeriesQuery{
+		Labels:      params.Get("labels"),
+		Granularity: model.GranularityHour,
+	}
+
+	if granularity := params.Get("granularity"); granularity != "" {
+		query.Granularity = model.Granularity(granularity)
+	}
+
+	var err error
+	if query.From, err = parseTimeParam(params, "from"); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+
+	if query.To, err = parseTimeParam(params, "to"); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidParameter, err.Error())
+		return
+	}
+
+	series, err := h.service.AggregateSeries(r.Context(), query)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, series)
+}
+
+// AggregateRate handles reading the increments per second of the counters matching
+// the labels selector, summed up, over the sliding window (defaults to 5m)
+func (h *Handler) AggregateRate(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	window := 5 * time.Minute
+	if value := params.Get("window"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, codeInvalidParameter, "window must be a duration like 5m")
+			return
+		}
+		window = d
+	}
+
+	rate, err := h.service.AggregateRate(r.Context(), params.Get("labels"), window)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rate)
+}
+
+// parseTimeParam reads an optional RFC 3339 timestamp from the query parameters
+func parseTimeParam(params url.Values, name string) (*time.Time, error) {
+	value := params.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+	}
+
+	return &t, nil
+}
+
+// IncrementCounter handles incrementing a counter by an optional signed delta.
+// The counter is identified by the path, or by the body on the legacy route.
 func (h *Handler) IncrementCounter(w http.ResponseWriter, r *http.Request) {
-	var counter *model.Counter
-	err := json.NewDecoder(r.Body).Decode(&counter)
+	idString, inPath := mux.Vars(r)["id"]
+
+	var request incrementRequest
+	err := decodeJSON(w, r, &request)
+	// The body is optional when the path holds the ID, an empty one increments by 1
+	if err != nil && !(inPath && err == io.EOF) {
+		writeBodyError(w, r, err)
+		return
+	}
+
+	id := request.ID
+	if inPath {
+		id, err = uuid.Parse(idString)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, codeInvalidID, "Please provide valid uuid")
+			return
+		}
+		if request.ID != uuid.Nil {
+			if request.ID != id {
+				problem.Write(w, r, http.StatusBadRequest, codeInvalidID, "id of the body does not match the path")
+				return
+			}
+			bodyIDNotice.Field(w, r, "id")
+		}
+	}
+
+	delta := int64(1)
+	if request.Delta != nil {
+		delta = *request.Delta
+	}
+
+	h.changeCounter(w, r, id, delta)
+}
+
+// DecrementCounter handles decrementing a counter by an optional positive delta
+func (h *Handler) DecrementCounter(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidID, "Please provide valid uuid")
+		return
+	}
+
+	// The body is optional, an empty one decrements by 1
+	var request incrementRequest
+	err = decodeJSON(w, r, &request)
+	if err != nil && err != io.EOF {
+		writeBodyError(w, r, err)
 		return
 	}
 
-	counter, err = h.service.IncrementCounter(r.Context(), counter.ID)
+	delta := int64(1)
+	if request.Delta != nil {
+		if *request.Delta <= 0 {
+			problem.WriteError(w, r, validation.Errors{{Field: "delta", Err: validation.ErrNotPositive}})
+			return
+		}
+		delta = *request.Delta
+	}
+
+	h.changeCounter(w, r, id, -delta)
+}
+
+// IncrementCounterByName handles incrementing the counter with the name in
+// the namespace query parameter, creating the counter on first use. The body
+// with the delta is optional, an empty one increments by 1.
+func (h *Handler) IncrementCounterByName(w http.ResponseWriter, r *http.Request) {
+	var request incrementRequest
+	err := decodeJSON(w, r, &request)
+	if err != nil && err != io.EOF {
+		writeBodyError(w, r, err)
+		return
+	}
+
+	delta := int64(1)
+	if request.Delta != nil {
+		delta = *request.Delta
+	}
+
+	namespace := r.URL.Query().Get("namespace")
+	counter, err := h.service.IncrementCounterByName(r.Context(), namespace, mux.Vars(r)["name"], delta)
+	writeChangedCounter(w, r, counter, err)
+}
+
+// changeCounter applies delta to the counter and writes the updated counter
+func (h *Handler) changeCounter(w http.ResponseWriter, r *http.Request, id uuid.UUID, delta int64) {
+	counter, err := h.service.IncrementCounter(r.Context(), id, delta)
+	writeChangedCounter(w, r, counter, err)
+}
+
+// writeChangedCounter writes the counter an increment returned, or its error
+func writeChangedCounter(w http.ResponseWriter, r *http.Request, counter *model.Counter, err error) {
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		problem.WriteError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(counter)
+	w.Header().Set("ETag", etag(counter))
+	writeJSON(w, http.StatusOK, counter)
+}
+
+// SetCounter handles setting a counter to an absolute value.
+// The write only happens when the If-Match header or the expected_version
+// field matches the current version of the counter.
+func (h *Handler) SetCounter(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidID, "Please provide valid uuid")
+		return
+	}
+
+	var request setRequest
+	err = decodeJSON(w, r, &request)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+
+	if request.Value == nil {
+		problem.WriteError(w, r, validation.Errors{{Field: "value", Err: validation.ErrRequired}})
+		return
+	}
+
+	expectedVersion := request.ExpectedVersion
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		version, err := parseETag(ifMatch)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, codeInvalidPrecondition, err.Error())
+			return
+		}
+
+		if expectedVersion != nil && *expectedVersion != version {
+			problem.Write(w, r, http.StatusBadRequest, codeInvalidPrecondition, "If-Match and expected_version disagree")
+			return
+		}
+		expectedVersion = &version
+	}
+
+	if expectedVersion == nil {
+		problem.Write(w, r, http.StatusPreconditionRequired, codePreconditionRequired, "If-Match header or expected_version is required")
+		return
+	}
+
+	counter, err := h.service.SetCounter(r.Context(), id, *request.Value, *expectedVersion)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(counter))
+	writeJSON(w, http.StatusOK, counter)
+}
+
+// UpdateCounter handles changing the name, description, unit or labels of a
+// counter. Only the fields present in the body are changed, labels replace
+// the current ones as a whole.
+func (h *Handler) UpdateCounter(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidID, "Please provide valid uuid")
+		return
+	}
+
+	var params model.UpdateCounterParams
+	err = decodeJSON(w, r, &params)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+
+	counter, err := h.service.UpdateCounter(r.Context(), id, params)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(counter))
+	writeJSON(w, http.StatusOK, counter)
+}
+
+// decodeJSON reads the JSON body of the request into v, a pointer to a
+// struct. Bodies larger than maxBodySize are rejected, and so are unknown
+// fields, all listed in validation.Errors. An empty body is io.EOF.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return io.EOF
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		if unknown := validation.UnknownFields(data, v); len(unknown) > 0 {
+			return unknown
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// writeBodyError answers a request whose body could not be decoded
+func writeBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	var fields validation.Errors
+	if errors.As(err, &fields) {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	if err == io.EOF {
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidBody, "request body is required")
+		return
+	}
+
+	problem.Write(w, r, http.StatusBadRequest, codeInvalidBody, err.Error())
+}
+
+// writeJSON answers the request with v as a JSON body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// etag returns the entity tag of a counter, which is its quoted version
+func etag(counter *model.Counter) string {
+	return strconv.Quote(strconv.FormatInt(counter.Version, 10))
+}
+
+// parseETag returns the counter version held by an If-Match header
+func parseETag(value string) (int64, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+
+	unquoted, err := strconv.Unquote(value)
+	if err != nil {
+		unquoted = value
+	}
+
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil {
+		return 0, errors.New("If-Match must hold a counter version")
+	}
+
+	return version, nil
 }
 
 // DeleteCounter handles deleting a counter
 func (h *Handler) DeleteCounter(w http.ResponseWriter, r *http.Request) {
-	// Extract ID from URL (this would require a URL parameter setup)
-	idString := r.URL.Query().Get("id")
+	// The legacy route takes the ID as a query parameter
+	idString, ok := mux.Vars(r)["id"]
+	if !ok {
+		idString = r.URL.Query().Get("id")
+	}
 
 	uuid, err := uuid.Parse(idString)
 	if err != nil {
-		http.Error(w, "Please provide valid uuid", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidID, "Please provide valid uuid")
 		return
 	}
 
 	_, err = h.service.SoftDeleteCounter(r.Context(), uuid)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		problem.WriteError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// RestoreCounter handles restoring a soft deleted counter
+func (h *Handler) RestoreCounter(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidID, "Please provide valid uuid")
+		return
+	}
+
+	counter, err := h.service.RestoreCounter(r.Context(), id)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, counter)
+}
+
+// PurgeDeletedCounters handles permanently removing old soft deleted counters.
+// The retention period can be given as a duration in the older_than query parameter.
+func (h *Handler) PurgeDeletedCounters(w http.ResponseWriter, r *http.Request) {
+	retention := service.DefaultPurgeRetention
+	if olderThan := r.URL.Query().Get("older_than"); olderThan != "" {
+		d, err := time.ParseDuration(olderThan)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, codeInvalidParameter, "older_than must be a duration like 720h")
+			return
+		}
+		retention = d
+	}
+
+	purged, err := h.service.PurgeDeletedCounters(r.Context(), retention)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int64{"purged": purged})
+}
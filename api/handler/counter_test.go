@@ -5,11 +5,15 @@ import (
 	"encoding/json"
 	"errors"
 	"gounter/api/handler"
+	"gounter/api/problem"
 	"gounter/internal/model"
+	"gounter/internal/service"
+	"gounter/internal/validation"
 	"gounter/test/mocks"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/brianvoe/gofakeit"
 	"github.com/google/uuid"
@@ -27,22 +31,73 @@ func TestCreateCounter(t *testing.T) {
 		requestBody    interface{}
 		mockFunc       func()
 		expectedStatus int
+		expectedFields []problem.FieldError
 	}{
 		{
 			name:        "CreateCounter Success",
 			requestBody: map[string]string{"name": "testCounter"},
 			mockFunc: func() {
-				mockService.On("CreateCounter", mock.Anything, "testCounter").
+				mockService.On("CreateCounter", mock.Anything, model.CreateCounterParams{Name: "testCounter"}).
 					Return(&model.Counter{ID: uuid.New(), Name: "testCounter"}, nil)
 			},
 			expectedStatus: http.StatusCreated,
 		},
+		{
+			name:        "CreateCounter Bounded",
+			requestBody: map[string]interface{}{"name": "seats", "min": 0, "max": 100, "overflow_policy": "saturate"},
+			mockFunc: func() {
+				mockService.On("CreateCounter", mock.Anything, mock.MatchedBy(func(params model.CreateCounterParams) bool {
+					return params.Name == "seats" && *params.Min == 0 && *params.Max == 100 && params.OverflowPolicy == model.OverflowSaturate
+				})).Return(&model.Counter{ID: uuid.New(), Name: "seats"}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:        "CreateCounter Name Taken",
+			requestBody: map[string]string{"name": "signups", "namespace": "growth"},
+			mockFunc: func() {
+				mockService.On("CreateCounter", mock.Anything, model.CreateCounterParams{Name: "signups", Namespace: "growth"}).
+					Return(nil, service.ErrNameTaken)
+			},
+			expectedStatus: http.StatusConflict,
+		},
 		{
 			name:           "CreateCounter Invalid JSON",
 			requestBody:    "invalid",
 			mockFunc:       func() {},
 			expectedStatus: http.StatusBadRequest,
 		},
+		{
+			name:           "CreateCounter Empty Body",
+			mockFunc:       func() {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "CreateCounter Unknown Fields",
+			requestBody:    map[string]interface{}{"nmae": "signups", "maximum": 10},
+			mockFunc:       func() {},
+			expectedStatus: http.StatusBadRequest,
+			expectedFields: []problem.FieldError{
+				{Field: "maximum", Code: "unknown_field", Message: "is not a known field"},
+				{Field: "nmae", Code: "unknown_field", Message: "is not a known field"},
+			},
+		},
+		{
+			name:        "CreateCounter Invalid Fields",
+			requestBody: map[string]interface{}{"name": "", "shards": 100},
+			mockFunc: func() {
+				mockService.On("CreateCounter", mock.Anything, model.CreateCounterParams{Shards: 100}).
+					Return(nil, validation.Errors{
+						{Field: "name", Err: validation.ErrRequired},
+						{Field: "shards", Err: service.ErrInvalidShards},
+					})
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedFields: []problem.FieldError{
+				{Field: "name", Code: "required", Message: "is required"},
+				{Field: "shards", Code: "invalid_shards", Message: service.ErrInvalidShards.Error()},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -65,41 +120,112 @@ func TestCreateCounter(t *testing.T) {
 			h.CreateCounter(rr, req)
 
 			assert.Equal(t, tc.expectedStatus, rr.Code)
+			if tc.expectedFields != nil {
+				var details problem.Details
+				assert.NoError(t, json.NewDecoder(rr.Body).Decode(&details))
+				assert.Equal(t, service.CodeValidationFailed, details.Code)
+				assert.Equal(t, tc.expectedFields, details.Errors)
+			}
 			mockService.AssertExpectations(t)
 		})
 	}
 }
 
 func TestIncrementCounter(t *testing.T) {
+	pathID := uuid.New()
+
 	testCases := []struct {
 		name           string
+		urlVars        map[string]string
 		requestBody    interface{}
 		mockFunc       func(*mocks.Service)
 		expectedStatus int
+		expectedCode   string
 	}{
 		{
 			name:        "IncrementCounter Success",
 			requestBody: map[string]uuid.UUID{"id": uuid.New()},
 			mockFunc: func(mockService *mocks.Service) {
-				mockService.On("IncrementCounter", mock.Anything, mock.Anything).
+				mockService.On("IncrementCounter", mock.Anything, mock.Anything, int64(1)).
 					Return(&model.Counter{ID: uuid.New(), Name: "testCounter"}, nil)
 			},
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:        "IncrementCounter With Delta",
+			requestBody: map[string]interface{}{"id": uuid.New(), "delta": -500},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("IncrementCounter", mock.Anything, mock.Anything, int64(-500)).
+					Return(&model.Counter{ID: uuid.New(), Name: "testCounter", Value: -500}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
 		{
 			name:           "IncrementCounter Invalid JSON",
 			requestBody:    "invalid",
 			mockFunc:       func(mockService *mocks.Service) {},
 			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "invalid_body",
 		},
 		{
 			name:        "IncrementCounter Service Error",
 			requestBody: map[string]uuid.UUID{"id": uuid.New()},
 			mockFunc: func(mockService *mocks.Service) {
-				mockService.On("IncrementCounter", mock.Anything, mock.Anything).
-					Return(nil, errors.New("Service error"))
+				mockService.On("IncrementCounter", mock.Anything, mock.Anything, mock.Anything).
+					Return(nil, errors.New("pq: connection refused"))
 			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   "internal",
+		},
+		{
+			name:        "IncrementCounter Not Found",
+			requestBody: map[string]uuid.UUID{"id": uuid.New()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("IncrementCounter", mock.Anything, mock.Anything, mock.Anything).
+					Return(nil, service.ErrCounterNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   "counter_not_found",
+		},
+		{
+			name:    "IncrementCounter By Path Without Body",
+			urlVars: map[string]string{"id": pathID.String()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("IncrementCounter", mock.Anything, pathID, int64(1)).
+					Return(&model.Counter{ID: pathID, Name: "testCounter", Value: 1}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:        "IncrementCounter By Path With Delta",
+			urlVars:     map[string]string{"id": pathID.String()},
+			requestBody: map[string]interface{}{"delta": 7},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("IncrementCounter", mock.Anything, pathID, int64(7)).
+					Return(&model.Counter{ID: pathID, Name: "testCounter", Value: 7}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "IncrementCounter By Path Mismatched Body ID",
+			urlVars:        map[string]string{"id": pathID.String()},
+			requestBody:    map[string]uuid.UUID{"id": uuid.New()},
+			mockFunc:       func(mockService *mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "invalid_id",
+		},
+		{
+			name:           "IncrementCounter By Path Invalid ID",
+			urlVars:        map[string]string{"id": "invalid"},
+			mockFunc:       func(mockService *mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "invalid_id",
+		},
+		{
+			name:           "IncrementCounter Without Body",
+			mockFunc:       func(mockService *mocks.Service) {},
 			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "invalid_body",
 		},
 	}
 
@@ -119,6 +245,10 @@ func TestIncrementCounter(t *testing.T) {
 			req, err := http.NewRequest("POST", "/counter/increment", body)
 			assert.NoError(t, err)
 
+			if tc.urlVars != nil {
+				req = mux.SetURLVars(req, tc.urlVars)
+			}
+
 			rr := httptest.NewRecorder()
 
 			tc.mockFunc(mockService)
@@ -126,49 +256,252 @@ func TestIncrementCounter(t *testing.T) {
 			h.IncrementCounter(rr, req)
 
 			assert.Equal(t, tc.expectedStatus, rr.Code)
+			if tc.expectedCode != "" {
+				var details problem.Details
+				assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+				assert.NoError(t, json.NewDecoder(rr.Body).Decode(&details))
+				assert.Equal(t, tc.expectedCode, details.Code)
+				assert.NotContains(t, details.Detail, "pq:")
+			}
 			mockService.AssertExpectations(t)
 		})
 	}
 }
 
-func TestDeleteCounter(t *testing.T) {
+func TestDecrementCounter(t *testing.T) {
 	testCases := []struct {
 		name           string
 		urlVars        map[string]string
+		requestBody    string
 		mockFunc       func(*mocks.Service)
 		expectedStatus int
 	}{
 		{
-			name:    "DeleteCounter Success",
-			urlVars: map[string]string{"id": gofakeit.UUID()},
+			name:        "DecrementCounter Without Body",
+			urlVars:     map[string]string{"id": gofakeit.UUID()},
+			requestBody: "",
 			mockFunc: func(mockService *mocks.Service) {
-				mockService.On("SoftDeleteCounter", mock.Anything, mock.Anything).
-					Return(int64(1), nil)
+				mockService.On("IncrementCounter", mock.Anything, mock.Anything, int64(-1)).
+					Return(&model.Counter{ID: uuid.New(), Name: "testCounter", Value: -1}, nil)
 			},
 			expectedStatus: http.StatusOK,
 		},
 		{
-			name:           "DeleteCounter Invalid ID",
+			name:        "DecrementCounter With Delta",
+			urlVars:     map[string]string{"id": gofakeit.UUID()},
+			requestBody: `{"delta": 5}`,
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("IncrementCounter", mock.Anything, mock.Anything, int64(-5)).
+					Return(&model.Counter{ID: uuid.New(), Name: "testCounter", Value: -5}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "DecrementCounter Negative Delta",
+			urlVars:        map[string]string{"id": gofakeit.UUID()},
+			requestBody:    `{"delta": -5}`,
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "DecrementCounter Invalid ID",
 			urlVars:        map[string]string{"id": "invalid"},
 			mockFunc:       func(*mocks.Service) {},
 			expectedStatus: http.StatusBadRequest,
 		},
 		{
-			name:    "DeleteCounter Service Error",
+			name:    "DecrementCounter Not Found",
 			urlVars: map[string]string{"id": gofakeit.UUID()},
 			mockFunc: func(mockService *mocks.Service) {
-				mockService.On("SoftDeleteCounter", mock.Anything, mock.Anything).
-					Return(int64(0), errors.New("Service error"))
+				mockService.On("IncrementCounter", mock.Anything, mock.Anything, int64(-1)).
+					Return(nil, service.ErrCounterNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:    "DecrementCounter Out Of Bounds",
+			urlVars: map[string]string{"id": gofakeit.UUID()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("IncrementCounter", mock.Anything, mock.Anything, int64(-1)).
+					Return(nil, &service.OutOfBoundsError{ID: uuid.New(), Delta: -1})
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/counter/"+tc.urlVars["id"]+"/decrement", bytes.NewBufferString(tc.requestBody))
+			assert.NoError(t, err)
+
+			req = mux.SetURLVars(req, tc.urlVars)
+
+			mockService := new(mocks.Service)
+			tc.mockFunc(mockService)
+
+			h := handler.NewHandler(mockService)
+
+			rr := httptest.NewRecorder()
+			h.DecrementCounter(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestIncrementCounterByName(t *testing.T) {
+	testCases := []struct {
+		name           string
+		url            string
+		requestBody    string
+		mockFunc       func(*mocks.Service)
+		expectedStatus int
+	}{
+		{
+			name: "IncrementCounterByName Without Body",
+			url:  "/counter/by-name/signups/increment",
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("IncrementCounterByName", mock.Anything, "", "signups", int64(1)).
+					Return(&model.Counter{ID: uuid.New(), Name: "signups", Namespace: model.DefaultNamespace, Value: 1}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:        "IncrementCounterByName With Namespace And Delta",
+			url:         "/counter/by-name/signups/increment?namespace=growth",
+			requestBody: `{"delta": 3}`,
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("IncrementCounterByName", mock.Anything, "growth", "signups", int64(3)).
+					Return(&model.Counter{ID: uuid.New(), Name: "signups", Namespace: "growth", Value: 3}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "IncrementCounterByName Invalid JSON",
+			url:            "/counter/by-name/signups/increment",
+			requestBody:    "invalid",
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "IncrementCounterByName Invalid Namespace",
+			url:  "/counter/by-name/signups/increment?namespace=growth%20eu",
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("IncrementCounterByName", mock.Anything, "growth eu", "signups", int64(1)).
+					Return(nil, service.ErrInvalidNamespace)
 			},
 			expectedStatus: http.StatusBadRequest,
 		},
+		{
+			name: "IncrementCounterByName Out Of Bounds",
+			url:  "/counter/by-name/signups/increment",
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("IncrementCounterByName", mock.Anything, "", "signups", int64(1)).
+					Return(nil, &service.OutOfBoundsError{ID: uuid.New(), Delta: 1})
+			},
+			expectedStatus: http.StatusConflict,
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			req, err := http.NewRequest("DELETE", "/counter/delete?id="+tc.urlVars["id"], nil)
+			req, err := http.NewRequest("POST", tc.url, bytes.NewBufferString(tc.requestBody))
+			assert.NoError(t, err)
+
+			req = mux.SetURLVars(req, map[string]string{"name": "signups"})
+
+			mockService := new(mocks.Service)
+			tc.mockFunc(mockService)
+
+			h := handler.NewHandler(mockService)
+
+			rr := httptest.NewRecorder()
+			h.IncrementCounterByName(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSetCounter(t *testing.T) {
+	testCases := []struct {
+		name           string
+		urlVars        map[string]string
+		ifMatch        string
+		requestBody    string
+		mockFunc       func(*mocks.Service)
+		expectedStatus int
+		expectedETag   string
+	}{
+		{
+			name:        "SetCounter With If-Match",
+			urlVars:     map[string]string{"id": gofakeit.UUID()},
+			ifMatch:     `"3"`,
+			requestBody: `{"value": 10}`,
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("SetCounter", mock.Anything, mock.Anything, int64(10), int64(3)).
+					Return(&model.Counter{ID: uuid.New(), Value: 10, Version: 4}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedETag:   `"4"`,
+		},
+		{
+			name:        "SetCounter With Expected Version",
+			urlVars:     map[string]string{"id": gofakeit.UUID()},
+			requestBody: `{"value": 0, "expected_version": 7}`,
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("SetCounter", mock.Anything, mock.Anything, int64(0), int64(7)).
+					Return(&model.Counter{ID: uuid.New(), Value: 0, Version: 8}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedETag:   `"8"`,
+		},
+		{
+			name:           "SetCounter Without Precondition",
+			urlVars:        map[string]string{"id": gofakeit.UUID()},
+			requestBody:    `{"value": 10}`,
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusPreconditionRequired,
+		},
+		{
+			name:           "SetCounter Conflicting Preconditions",
+			urlVars:        map[string]string{"id": gofakeit.UUID()},
+			ifMatch:        `"3"`,
+			requestBody:    `{"value": 10, "expected_version": 4}`,
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "SetCounter Missing Value",
+			urlVars:        map[string]string{"id": gofakeit.UUID()},
+			ifMatch:        `"3"`,
+			requestBody:    `{}`,
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "SetCounter Version Mismatch",
+			urlVars:     map[string]string{"id": gofakeit.UUID()},
+			ifMatch:     `"3"`,
+			requestBody: `{"value": 10}`,
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("SetCounter", mock.Anything, mock.Anything, int64(10), int64(3)).
+					Return(nil, service.ErrVersionMismatch)
+			},
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("PUT", "/counter/"+tc.urlVars["id"], bytes.NewBufferString(tc.requestBody))
 			assert.NoError(t, err)
 
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
 			req = mux.SetURLVars(req, tc.urlVars)
 
 			mockService := new(mocks.Service)
@@ -177,7 +510,755 @@ func TestDeleteCounter(t *testing.T) {
 			h := handler.NewHandler(mockService)
 
 			rr := httptest.NewRecorder()
-			h.DeleteCounter(rr, req)
+			h.SetCounter(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			assert.Equal(t, tc.expectedETag, rr.Header().Get("ETag"))
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUpdateCounter(t *testing.T) {
+	id := uuid.New()
+	name := "renamed"
+
+	testCases := []struct {
+		name           string
+		urlVars        map[string]string
+		requestBody    string
+		mockFunc       func(*mocks.Service)
+		expectedStatus int
+		expectedETag   string
+	}{
+		{
+			name:        "UpdateCounter Success",
+			urlVars:     map[string]string{"id": id.String()},
+			requestBody: `{"name": "renamed", "labels": {"team": "payments"}}`,
+			mockFunc: func(mockService *mocks.Service) {
+				labels := model.Labels{"team": "payments"}
+				mockService.On("UpdateCounter", mock.Anything, id, model.UpdateCounterParams{Name: &name, Labels: &labels}).
+					Return(&model.Counter{ID: id, Name: name, Labels: labels, Version: 2}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedETag:   `"2"`,
+		},
+		{
+			name:           "UpdateCounter Invalid ID",
+			urlVars:        map[string]string{"id": "invalid"},
+			requestBody:    `{"name": "renamed"}`,
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "UpdateCounter Not Found",
+			urlVars:     map[string]string{"id": id.String()},
+			requestBody: `{"name": "renamed"}`,
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("UpdateCounter", mock.Anything, id, mock.Anything).Return(nil, service.ErrCounterNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:        "UpdateCounter Name Taken",
+			urlVars:     map[string]string{"id": id.String()},
+			requestBody: `{"name": "renamed"}`,
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("UpdateCounter", mock.Anything, id, mock.Anything).Return(nil, service.ErrNameTaken)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:        "UpdateCounter Empty Update",
+			urlVars:     map[string]string{"id": id.String()},
+			requestBody: `{}`,
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("UpdateCounter", mock.Anything, id, model.UpdateCounterParams{}).Return(nil, service.ErrEmptyUpdate)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("PATCH", "/counter/"+tc.urlVars["id"], bytes.NewBufferString(tc.requestBody))
+			assert.NoError(t, err)
+			req = mux.SetURLVars(req, tc.urlVars)
+
+			mockService := new(mocks.Service)
+			tc.mockFunc(mockService)
+
+			h := handler.NewHandler(mockService)
+
+			rr := httptest.NewRecorder()
+			h.UpdateCounter(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			assert.Equal(t, tc.expectedETag, rr.Header().Get("ETag"))
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDeleteCounter(t *testing.T) {
+	testCases := []struct {
+		name           string
+		urlVars        map[string]string
+		mockFunc       func(*mocks.Service)
+		expectedStatus int
+	}{
+		{
+			name:    "DeleteCounter Success",
+			urlVars: map[string]string{"id": gofakeit.UUID()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("SoftDeleteCounter", mock.Anything, mock.Anything).
+					Return(int64(1), nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "DeleteCounter Invalid ID",
+			urlVars:        map[string]string{"id": "invalid"},
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "DeleteCounter Service Error",
+			urlVars: map[string]string{"id": gofakeit.UUID()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("SoftDeleteCounter", mock.Anything, mock.Anything).
+					Return(int64(0), errors.New("Service error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:    "DeleteCounter Not Found",
+			urlVars: map[string]string{"id": gofakeit.UUID()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("SoftDeleteCounter", mock.Anything, mock.Anything).
+					Return(int64(0), service.ErrCounterNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("DELETE", "/counter/delete?id="+tc.urlVars["id"], nil)
+			assert.NoError(t, err)
+
+			req = mux.SetURLVars(req, tc.urlVars)
+
+			mockService := new(mocks.Service)
+			tc.mockFunc(mockService)
+
+			h := handler.NewHandler(mockService)
+
+			rr := httptest.NewRecorder()
+			h.DeleteCounter(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetCounter(t *testing.T) {
+	testCases := []struct {
+		name           string
+		urlVars        map[string]string
+		mockFunc       func(*mocks.Service)
+		expectedStatus int
+	}{
+		{
+			name:    "GetCounter Success",
+			urlVars: map[string]string{"id": gofakeit.UUID()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("GetCounter", mock.Anything, mock.Anything).
+					Return(&model.Counter{ID: uuid.New(), Name: "testCounter", Value: 2, Version: 5}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "GetCounter Invalid ID",
+			urlVars:        map[string]string{"id": "invalid"},
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "GetCounter Not Found",
+			urlVars: map[string]string{"id": gofakeit.UUID()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("GetCounter", mock.Anything, mock.Anything).
+					Return(nil, service.ErrCounterNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/counter/"+tc.urlVars["id"], nil)
+			assert.NoError(t, err)
+
+			req = mux.SetURLVars(req, tc.urlVars)
+
+			mockService := new(mocks.Service)
+			tc.mockFunc(mockService)
+
+			h := handler.NewHandler(mockService)
+
+			rr := httptest.NewRecorder()
+			h.GetCounter(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			if tc.expectedStatus == http.StatusOK {
+				assert.Equal(t, `"5"`, rr.Header().Get("ETag"))
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestListCounters(t *testing.T) {
+	id := uuid.New()
+
+	testCases := []struct {
+		name           string
+		url            string
+		mockFunc       func(*mocks.Service)
+		expectedStatus int
+	}{
+		{
+			name: "ListCounters Success",
+			url:  "/counters?prefix=test&sort=value&order=desc&limit=5&labels=team%3Dpayments&id=" + id.String(),
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("ListCounters", mock.Anything, model.ListCountersQuery{
+					NamePrefix: "test",
+					IDs:        []uuid.UUID{id},
+					Labels:     "team=payments",
+					SortBy:     model.SortByValue,
+					Descending: true,
+					Limit:      5,
+				}).Return(&model.CounterPage{Counters: []*model.Counter{{ID: id, Name: "testCounter"}}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "ListCounters Invalid Limit",
+			url:            "/counters?limit=abc",
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "ListCounters Invalid Order",
+			url:            "/counters?order=up",
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "ListCounters Invalid ID",
+			url:            "/counters?id=invalid",
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "ListCounters Service Error",
+			url:  "/counters?cursor=bad",
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("ListCounters", mock.Anything, mock.Anything).
+					Return(nil, service.ErrInvalidCursor)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tc.url, nil)
+			assert.NoError(t, err)
+
+			mockService := new(mocks.Service)
+			tc.mockFunc(mockService)
+
+			h := handler.NewHandler(mockService)
+
+			rr := httptest.NewRecorder()
+			h.ListCounters(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCounterHistory(t *testing.T) {
+	id := uuid.New()
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	testCases := []struct {
+		name           string
+		url            string
+		urlVars        map[string]string
+		mockFunc       func(*mocks.Service)
+		expectedStatus int
+	}{
+		{
+			name:    "CounterHistory Success",
+			url:     "/counter/" + id.String() + "/history?from=2026-10-01T00:00:00Z&to=2026-10-02T00:00:00Z&limit=5&cursor=Mg",
+			urlVars: map[string]string{"id": id.String()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("CounterHistory", mock.Anything, model.CounterHistoryQuery{
+					CounterID: id,
+					From:      &from,
+					To:        &to,
+					Cursor:    "Mg",
+					Limit:     5,
+				}).Return(&model.CounterEventPage{Events: []*model.CounterEvent{{ID: 3, CounterID: id, Type: model.EventIncrement, Delta: 1, Value: 1}}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "CounterHistory Invalid ID",
+			url:            "/counter/invalid/history",
+			urlVars:        map[string]string{"id": "invalid"},
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "CounterHistory Invalid From",
+			url:            "/counter/" + id.String() + "/history?from=yesterday",
+			urlVars:        map[string]string{"id": id.String()},
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "CounterHistory Invalid Limit",
+			url:            "/counter/" + id.String() + "/history?limit=0",
+			urlVars:        map[string]string{"id": id.String()},
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "CounterHistory Not Found",
+			url:     "/counter/" + id.String() + "/history",
+			urlVars: map[string]string{"id": id.String()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("CounterHistory", mock.Anything, mock.Anything).
+					Return(nil, service.ErrCounterNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:    "CounterHistory Service Error",
+			url:     "/counter/" + id.String() + "/history?from=2026-10-02T00:00:00Z&to=2026-10-01T00:00:00Z",
+			urlVars: map[string]string{"id": id.String()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("CounterHistory", mock.Anything, mock.Anything).
+					Return(nil, service.ErrInvalidTimeRange)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tc.url, nil)
+			assert.NoError(t, err)
+			req = mux.SetURLVars(req, tc.urlVars)
+
+			mockService := new(mocks.Service)
+			tc.mockFunc(mockService)
+
+			h := handler.NewHandler(mockService)
+
+			rr := httptest.NewRecorder()
+			h.CounterHistory(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCounterSeries(t *testing.T) {
+	id := uuid.New()
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name           string
+		url            string
+		urlVars        map[string]string
+		mockFunc       func(*mocks.Service)
+		expectedStatus int
+	}{
+		{
+			name:    "CounterSeries Success",
+			url:     "/counter/" + id.String() + "/series?granularity=minute&from=2026-10-01T00:00:00Z",
+			urlVars: map[string]string{"id": id.String()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("CounterSeries", mock.Anything, model.CounterSeriesQuery{
+					CounterID:   id,
+					Granularity: model.GranularityMinute,
+					From:        &from,
+				}).Return(&model.CounterSeries{CounterID: id, Granularity: model.GranularityMinute}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:    "CounterSeries Defaults To Hours",
+			url:     "/counter/" + id.String() + "/series",
+			urlVars: map[string]string{"id": id.String()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("CounterSeries", mock.Anything, model.CounterSeriesQuery{CounterID: id, Granularity: model.GranularityHour}).
+					Return(&model.CounterSeries{CounterID: id, Granularity: model.GranularityHour}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "CounterSeries Invalid To",
+			url:            "/counter/" + id.String() + "/series?to=now",
+			urlVars:        map[string]string{"id": id.String()},
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "CounterSeries Invalid Granularity",
+			url:     "/counter/" + id.String() + "/series?granularity=week",
+			urlVars: map[string]string{"id": id.String()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("CounterSeries", mock.Anything, mock.Anything).
+					Return(nil, service.ErrInvalidGranularity)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "CounterSeries Not Found",
+			url:     "/counter/" + id.String() + "/series",
+			urlVars: map[string]string{"id": id.String()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("CounterSeries", mock.Anything, mock.Anything).
+					Return(nil, service.ErrCounterNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tc.url, nil)
+			assert.NoError(t, err)
+			req = mux.SetURLVars(req, tc.urlVars)
+
+			mockService := new(mocks.Service)
+			tc.mockFunc(mockService)
+
+			h := handler.NewHandler(mockService)
+
+			rr := httptest.NewRecorder()
+			h.CounterSeries(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCounterRate(t *testing.T) {
+	id := uuid.New()
+
+	testCases := []struct {
+		name           string
+		url            string
+		urlVars        map[string]string
+		mockFunc       func(*mocks.Service)
+		expectedStatus int
+	}{
+		{
+			name:    "CounterRate Success",
+			url:     "/counter/" + id.String() + "/rate?window=15m",
+			urlVars: map[string]string{"id": id.String()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("CounterRate", mock.Anything, id, 15*time.Minute).
+					Return(&model.CounterRate{CounterID: id, Window: "15m0s", Delta: 90, PerSecond: 0.1}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:    "CounterRate Default Window",
+			url:     "/counter/" + id.String() + "/rate",
+			urlVars: map[string]string{"id": id.String()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("CounterRate", mock.Anything, id, 5*time.Minute).
+					Return(&model.CounterRate{CounterID: id, Window: "5m0s"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "CounterRate Invalid Window",
+			url:            "/counter/" + id.String() + "/rate?window=often",
+			urlVars:        map[string]string{"id": id.String()},
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "CounterRate Window Out Of Range",
+			url:     "/counter/" + id.String() + "/rate?window=1s",
+			urlVars: map[string]string{"id": id.String()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("CounterRate", mock.Anything, id, time.Second).
+					Return(nil, service.ErrInvalidWindow)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "CounterRate Not Found",
+			url:     "/counter/" + id.String() + "/rate",
+			urlVars: map[string]string{"id": id.String()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("CounterRate", mock.Anything, id, 5*time.Minute).
+					Return(nil, service.ErrCounterNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tc.url, nil)
+			assert.NoError(t, err)
+			req = mux.SetURLVars(req, tc.urlVars)
+
+			mockService := new(mocks.Service)
+			tc.mockFunc(mockService)
+
+			h := handler.NewHandler(mockService)
+
+			rr := httptest.NewRecorder()
+			h.CounterRate(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAggregateSeries(t *testing.T) {
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name           string
+		url            string
+		mockFunc       func(*mocks.Service)
+		expectedStatus int
+	}{
+		{
+			name: "AggregateSeries Success",
+			url:  "/counters/series?labels=team%3Dpayments&granularity=day&from=2026-10-01T00:00:00Z",
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("AggregateSeries", mock.Anything, model.AggregateSeriesQuery{
+					Labels:      "team=payments",
+					Granularity: model.GranularityDay,
+					From:        &from,
+				}).Return(&model.AggregateSeries{Labels: model.Labels{"team": "payments"}, Counters: 2}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "AggregateSeries Invalid Time",
+			url:            "/counters/series?to=yesterday",
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "AggregateSeries Too Many Counters",
+			url:  "/counters/series",
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("AggregateSeries", mock.Anything, mock.Anything).Return(nil, service.ErrTooManyCounters)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tc.url, nil)
+			assert.NoError(t, err)
+
+			mockService := new(mocks.Service)
+			tc.mockFunc(mockService)
+
+			h := handler.NewHandler(mockService)
+
+			rr := httptest.NewRecorder()
+			h.AggregateSeries(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAggregateRate(t *testing.T) {
+	testCases := []struct {
+		name           string
+		url            string
+		mockFunc       func(*mocks.Service)
+		expectedStatus int
+	}{
+		{
+			name: "AggregateRate Success",
+			url:  "/counters/rate?labels=team%3Dpayments&window=15m",
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("AggregateRate", mock.Anything, "team=payments", 15*time.Minute).
+					Return(&model.AggregateRate{Labels: model.Labels{"team": "payments"}, Window: "15m0s"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "AggregateRate Invalid Window",
+			url:            "/counters/rate?window=often",
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "AggregateRate Invalid Selector",
+			url:  "/counters/rate?labels=team",
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("AggregateRate", mock.Anything, "team", 5*time.Minute).Return(nil, service.ErrInvalidLabelSelector)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tc.url, nil)
+			assert.NoError(t, err)
+
+			mockService := new(mocks.Service)
+			tc.mockFunc(mockService)
+
+			h := handler.NewHandler(mockService)
+
+			rr := httptest.NewRecorder()
+			h.AggregateRate(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRestoreCounter(t *testing.T) {
+	testCases := []struct {
+		name           string
+		urlVars        map[string]string
+		mockFunc       func(*mocks.Service)
+		expectedStatus int
+	}{
+		{
+			name:    "RestoreCounter Success",
+			urlVars: map[string]string{"id": gofakeit.UUID()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("RestoreCounter", mock.Anything, mock.Anything).
+					Return(&model.Counter{ID: uuid.New(), Name: "testCounter"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "RestoreCounter Invalid ID",
+			urlVars:        map[string]string{"id": "invalid"},
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:    "RestoreCounter Not Found",
+			urlVars: map[string]string{"id": gofakeit.UUID()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("RestoreCounter", mock.Anything, mock.Anything).
+					Return(nil, service.ErrCounterNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:    "RestoreCounter Name Taken",
+			urlVars: map[string]string{"id": gofakeit.UUID()},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("RestoreCounter", mock.Anything, mock.Anything).
+					Return(nil, service.ErrNameTaken)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/counter/"+tc.urlVars["id"]+"/restore", nil)
+			assert.NoError(t, err)
+
+			req = mux.SetURLVars(req, tc.urlVars)
+
+			mockService := new(mocks.Service)
+			tc.mockFunc(mockService)
+
+			h := handler.NewHandler(mockService)
+
+			rr := httptest.NewRecorder()
+			h.RestoreCounter(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPurgeDeletedCounters(t *testing.T) {
+	testCases := []struct {
+		name           string
+		url            string
+		mockFunc       func(*mocks.Service)
+		expectedStatus int
+	}{
+		{
+			name: "PurgeDeletedCounters Default Retention",
+			url:  "/admin/counters/purge",
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("PurgeDeletedCounters", mock.Anything, service.DefaultPurgeRetention).
+					Return(int64(3), nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "PurgeDeletedCounters Custom Retention",
+			url:  "/admin/counters/purge?older_than=24h",
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("PurgeDeletedCounters", mock.Anything, 24*time.Hour).
+					Return(int64(0), nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "PurgeDeletedCounters Invalid Retention",
+			url:            "/admin/counters/purge?older_than=month",
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", tc.url, nil)
+			assert.NoError(t, err)
+
+			mockService := new(mocks.Service)
+			tc.mockFunc(mockService)
+
+			h := handler.NewHandler(mockService)
+
+			rr := httptest.NewRecorder()
+			h.PurgeDeletedCounters(rr, req)
 
 			assert.Equal(t, tc.expectedStatus, rr.Code)
 			mockService.AssertExpectations(t)
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"gounter/api/problem"
+	"gounter/internal/model"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// keepAliveInterval is how often an idle stream sends a comment, so proxies
+// and clients do not take it for a dead connection
+const keepAliveInterval = 15 * time.Second
+
+// Names of the events of the watch streams
+const (
+	// eventCounter carries the counter after a change, or its current state
+	eventCounter = "counter"
+	// eventDeleted carries the ID of a deleted counter
+	eventDeleted = "deleted"
+)
+
+// deletedEvent is the data of the eventDeleted events
+type deletedEvent struct {
+	ID uuid.UUID `json:"id"`
+}
+
+// WatchCounter handles streaming the changes of a counter as Server-Sent Events.
+// A client reconnecting with the Last-Event-ID header resumes after that event.
+func (h *Handler) WatchCounter(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidID, "Please provide valid uuid")
+		return
+	}
+
+	h.watch(w, r, model.WatchQuery{CounterID: id})
+}
+
+// WatchCounters handles streaming the changes of the counters matching the
+// labels query parameter, a selector like team=payments,env=prod, as
+// Server-Sent Events. Without a selector every counter is watched.
+func (h *Handler) WatchCounters(w http.ResponseWriter, r *http.Request) {
+	h.watch(w, r, model.WatchQuery{Labels: r.URL.Query().Get("labels")})
+}
+
+// watch streams the changes of the watched counters until the client goes away
+func (h *Handler) watch(w http.ResponseWriter, r *http.Request, query model.WatchQuery) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		problem.Write(w, r, http.StatusInternalServerError, "streaming_unsupported", "the server cannot stream responses")
+		return
+	}
+
+	query.LastEventID = r.Header.Get("Last-Event-ID")
+
+	changes, err := h.service.WatchCounters(r.Context(), query)
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keep proxies like nginx from buffering the events
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case change, ok := <-changes:
+			if !ok {
+				// The client fell behind or went away, it resumes from its last event
+				return
+			}
+
+			if err := writeEvent(w, change); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes a change as a Server-Sent Event
+func writeEvent(w http.ResponseWriter, change model.CounterChange) error {
+	event, data := eventCounter, interface{}(change.Counter)
+	if change.Deleted {
+		event, data = eventDeleted, deletedEvent{ID: change.Counter.ID}
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", change.ID, event, encoded)
+	return err
+}
@@ -0,0 +1,155 @@
+package handler_test
+
+import (
+	"gounter/api/handler"
+	"gounter/internal/model"
+	"gounter/internal/service"
+	"gounter/test/mocks"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// stream returns a finished watch holding the given changes
+func stream(changes ...model.CounterChange) <-chan model.CounterChange {
+	ch := make(chan model.CounterChange, len(changes))
+	for _, change := range changes {
+		ch <- change
+	}
+	close(ch)
+
+	return ch
+}
+
+func TestWatchCounter(t *testing.T) {
+	id := uuid.New()
+
+	testCases := []struct {
+		name           string
+		id             string
+		lastEventID    string
+		mockFunc       func(*mocks.Service)
+		expectedStatus int
+		expectedEvents []string
+	}{
+		{
+			name: "WatchCounter Success",
+			id:   id.String(),
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("WatchCounters", mock.Anything, model.WatchQuery{CounterID: id}).Return(stream(
+					model.CounterChange{ID: "a-1", Counter: &model.Counter{ID: id, Value: 4, Version: 2}},
+					model.CounterChange{ID: "a-2", Counter: &model.Counter{ID: id}, Deleted: true},
+				), nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedEvents: []string{
+				"id: a-1\nevent: counter\ndata: {\"id\":\"" + id.String() + "\",\"name\":\"\",\"value\":4,",
+				"id: a-2\nevent: deleted\ndata: {\"id\":\"" + id.String() + "\"}\n\n",
+			},
+		},
+		{
+			name:        "WatchCounter Resumes After Last Event",
+			id:          id.String(),
+			lastEventID: "a-1",
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("WatchCounters", mock.Anything, model.WatchQuery{CounterID: id, LastEventID: "a-1"}).Return(stream(), nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "WatchCounter Invalid ID",
+			id:             "invalid",
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "WatchCounter Not Found",
+			id:   id.String(),
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("WatchCounters", mock.Anything, model.WatchQuery{CounterID: id}).Return(nil, service.ErrCounterNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockService := new(mocks.Service)
+			tc.mockFunc(mockService)
+			h := handler.NewHandler(mockService)
+
+			req := httptest.NewRequest(http.MethodGet, "/counters/"+tc.id+"/watch", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": tc.id})
+			if tc.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tc.lastEventID)
+			}
+
+			rr := httptest.NewRecorder()
+			h.WatchCounter(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			if tc.expectedStatus == http.StatusOK {
+				assert.Equal(t, "text/event-stream", rr.Header().Get("Content-Type"))
+			}
+			for _, event := range tc.expectedEvents {
+				assert.Contains(t, rr.Body.String(), event)
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestWatchCounters(t *testing.T) {
+	testCases := []struct {
+		name           string
+		query          string
+		mockFunc       func(*mocks.Service)
+		expectedStatus int
+	}{
+		{
+			name:  "WatchCounters Success",
+			query: "?labels=team%3Dpayments",
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("WatchCounters", mock.Anything, model.WatchQuery{Labels: "team=payments"}).
+					Return(stream(model.CounterChange{ID: "a-1", Counter: &model.Counter{ID: uuid.New()}}), nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:  "WatchCounters Invalid Selector",
+			query: "?labels=team",
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("WatchCounters", mock.Anything, model.WatchQuery{Labels: "team"}).Return(nil, service.ErrInvalidLabelSelector)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "WatchCounters Too Many Counters",
+			query: "",
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("WatchCounters", mock.Anything, model.WatchQuery{}).Return(nil, service.ErrTooManyCounters)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockService := new(mocks.Service)
+			tc.mockFunc(mockService)
+			h := handler.NewHandler(mockService)
+
+			req := httptest.NewRequest(http.MethodGet, "/counters/watch"+tc.query, nil)
+			rr := httptest.NewRecorder()
+			h.WatchCounters(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
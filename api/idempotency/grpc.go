@@ -0,0 +1,32 @@
+package idempotency
+
+import (
+	"context"
+	"gounter/internal/service"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MetadataKey is the gRPC metadata carrying the client supplied idempotency key
+const MetadataKey = "idempotency-key"
+
+// UnaryServerInterceptor makes the gRPC calls idempotent when they carry an
+// idempotency-key metadata, the same way Middleware does. Only the mutations
+// of the service use the key.
+func UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(MetadataKey)
+	if len(values) == 0 || values[0] == "" {
+		return handler(ctx, req)
+	}
+
+	key := values[0]
+	if len(key) > maxKeyLength {
+		return nil, status.Error(codes.InvalidArgument, "idempotency-key must be at most 255 characters")
+	}
+
+	return handler(service.WithIdempotencyKey(ctx, key), req)
+}
@@ -0,0 +1,58 @@
+package idempotency_test
+
+import (
+	"context"
+	"gounter/api/idempotency"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name         string
+		key          string
+		expectedCode codes.Code
+	}{
+		{
+			name:         "Without key",
+			key:          "",
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "With key",
+			key:          "retry-1",
+			expectedCode: codes.OK,
+		},
+		{
+			name:         "Key too long",
+			key:          strings.Repeat("k", 256),
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				called = true
+				return req, nil
+			}
+
+			ctx := context.Background()
+			if tt.key != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(idempotency.MetadataKey, tt.key))
+			}
+
+			_, err := idempotency.UnaryServerInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/test"}, handler)
+
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+			assert.Equal(t, tt.expectedCode == codes.OK, called)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package idempotency
+
+import (
+	"gounter/api/problem"
+	"gounter/internal/service"
+	"net/http"
+)
+
+// HeaderName is the request header carrying the client supplied idempotency key
+const HeaderName = "Idempotency-Key"
+
+// maxKeyLength bounds the size of the keys we are willing to store
+const maxKeyLength = 255
+
+// Middleware makes the wrapped mutating handler idempotent when the request carries an Idempotency-Key header
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(HeaderName)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > maxKeyLength {
+			problem.Write(w, r, http.StatusBadRequest, "invalid_idempotency_key", "Idempotency-Key must be at most 255 characters")
+			return
+		}
+
+		// The service replays the stored result when the key was already used
+		next.ServeHTTP(w, r.WithContext(service.WithIdempotencyKey(r.Context(), key)))
+	})
+}
@@ -0,0 +1,56 @@
+package idempotency_test
+
+import (
+	"gounter/api/idempotency"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		key            string
+		expectedStatus int
+	}{
+		{
+			name:           "Without key",
+			key:            "",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "With key",
+			key:            "retry-1",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Key too long",
+			key:            strings.Repeat("k", 256),
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/counter/increment", nil)
+			if tt.key != "" {
+				req.Header.Set(idempotency.HeaderName, tt.key)
+			}
+
+			rr := httptest.NewRecorder()
+			idempotency.Middleware(next).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedStatus == http.StatusOK, called)
+		})
+	}
+}
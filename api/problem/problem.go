@@ -0,0 +1,110 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"gounter/api/requestid"
+	"gounter/internal/service"
+	"gounter/internal/validation"
+	"log"
+	"net/http"
+)
+
+// ContentType is the media type of the problem details of RFC 7807
+const ContentType = "application/problem+json"
+
+// internalDetail replaces the message of internal errors, which may hold
+// storage details clients must not see
+const internalDetail = "the request could not be processed, retry later or report the request ID"
+
+// Details is the body of every error response, following RFC 7807.
+// Code, RequestID and Errors are extensions: Code is a stable identifier
+// clients can branch on, RequestID ties the response to the server logs and
+// Errors lists every invalid field of the request.
+type Details struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is an invalid field of the request
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Write answers the request with a problem of the given status and code
+func Write(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	write(w, r, Details{Status: status, Code: code, Detail: detail})
+}
+
+// WriteError answers the request with the problem matching an error of the
+// service. Internal errors are logged with the request ID instead of being sent.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	details := Describe(err)
+	if details.Status == http.StatusInternalServerError {
+		log.Printf("request %s: %s %s: %v", requestid.FromContext(r.Context()), r.Method, r.URL.Path, err)
+	}
+
+	write(w, r, details)
+}
+
+// write fills in the fields of the problem coming from the request and sends it
+func write(w http.ResponseWriter, r *http.Request, details Details) {
+	details.Type = "about:blank"
+	details.Title = http.StatusText(details.Status)
+	details.Instance = r.URL.Path
+	details.RequestID = requestid.FromContext(r.Context())
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(details.Status)
+	json.NewEncoder(w).Encode(details)
+}
+
+// Describe returns the status, code, client safe message and invalid fields of an error of the service
+func Describe(err error) Details {
+	kind, code := service.Classify(err)
+
+	details := Details{Status: Status(kind), Code: code, Detail: err.Error()}
+	if details.Status == http.StatusInternalServerError {
+		details.Detail = internalDetail
+	}
+
+	var fields validation.Errors
+	if errors.As(err, &fields) {
+		for _, field := range fields {
+			fieldCode := service.CodeValidationFailed
+			if coded, ok := field.Err.(interface{ Code() string }); ok {
+				fieldCode = coded.Code()
+			}
+			details.Errors = append(details.Errors, FieldError{Field: field.Field, Code: fieldCode, Message: field.Err.Error()})
+		}
+	}
+
+	return details
+}
+
+// Status returns the status code the errors of a kind are answered with
+func Status(kind service.ErrorKind) int {
+	switch kind {
+	case service.KindValidation:
+		return http.StatusBadRequest
+	case service.KindNotFound:
+		return http.StatusNotFound
+	case service.KindConflict:
+		return http.StatusConflict
+	case service.KindPreconditionFailed:
+		return http.StatusPreconditionFailed
+	case service.KindUnsupported:
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,97 @@
+package problem_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"gounter/api/problem"
+	"gounter/api/requestid"
+	"gounter/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedCode   string
+		expectedDetail string
+	}{
+		{
+			name:           "Validation",
+			err:            service.ErrInvalidDelta,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "invalid_delta",
+			expectedDetail: service.ErrInvalidDelta.Error(),
+		},
+		{
+			name:           "Not Found",
+			err:            service.ErrCounterNotFound,
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   "counter_not_found",
+			expectedDetail: "counter not found",
+		},
+		{
+			name:           "Conflict",
+			err:            &service.OutOfBoundsError{ID: uuid.Nil, Delta: 1},
+			expectedStatus: http.StatusConflict,
+			expectedCode:   "out_of_bounds",
+			expectedDetail: "changing counter 00000000-0000-0000-0000-000000000000 by 1 would exceed its bounds",
+		},
+		{
+			name:           "Precondition Failed",
+			err:            service.ErrVersionMismatch,
+			expectedStatus: http.StatusPreconditionFailed,
+			expectedCode:   "version_mismatch",
+			expectedDetail: "counter version does not match",
+		},
+		{
+			name:           "Internal",
+			err:            errors.New(`pq: relation "counter" does not exist`),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   service.CodeInternal,
+		},
+		{
+			name:           "Internal Wrapped",
+			err:            sql.ErrConnDone,
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   service.CodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/counter/42", nil)
+			req.Header.Set(requestid.HeaderName, "req-1")
+
+			rr := httptest.NewRecorder()
+			requestid.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				problem.WriteError(w, r, tt.err)
+			})).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+
+			var details problem.Details
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&details))
+			assert.Equal(t, tt.expectedStatus, details.Status)
+			assert.Equal(t, http.StatusText(tt.expectedStatus), details.Title)
+			assert.Equal(t, tt.expectedCode, details.Code)
+			assert.Equal(t, "/counter/42", details.Instance)
+			assert.Equal(t, "req-1", details.RequestID)
+			if tt.expectedDetail != "" {
+				assert.Equal(t, tt.expectedDetail, details.Detail)
+			} else {
+				// Storage errors must not reach the client
+				assert.NotContains(t, details.Detail, tt.err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.23.4
+// source: counter/v1/counter.proto
+
+package counterv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	CounterService_CreateCounter_FullMethodName    = "/gounter.counter.v1.CounterService/CreateCounter"
+	CounterService_GetCounter_FullMethodName       = "/gounter.counter.v1.CounterService/GetCounter"
+	CounterService_IncrementCounter_FullMethodName = "/gounter.counter.v1.CounterService/IncrementCounter"
+	CounterService_DeleteCounter_FullMethodName    = "/gounter.counter.v1.CounterService/DeleteCounter"
+	CounterService_ListCounters_FullMethodName     = "/gounter.counter.v1.CounterService/ListCounters"
+)
+
+// CounterServiceClient is the client API for CounterService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CounterServiceClient interface {
+	// CreateCounter creates a counter, failing with ALREADY_EXISTS when the
+	// name is taken in the namespace
+	CreateCounter(ctx context.Context, in *CreateCounterRequest, opts ...grpc.CallOption) (*Counter, error)
+	// GetCounter returns a live counter
+	GetCounter(ctx context.Context, in *GetCounterRequest, opts ...grpc.CallOption) (*Counter, error)
+	// IncrementCounter adds a signed delta to a counter
+	IncrementCounter(ctx context.Context, in *IncrementCounterRequest, opts ...grpc.CallOption) (*Counter, error)
+	// DeleteCounter soft deletes a counter
+	DeleteCounter(ctx context.Context, in *DeleteCounterRequest, opts ...grpc.CallOption) (*DeleteCounterResponse, error)
+	// ListCounters returns a page of the live counters
+	ListCounters(ctx context.Context, in *ListCountersRequest, opts ...grpc.CallOption) (*ListCountersResponse, error)
+}
+
+type counterServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCounterServiceClient(cc grpc.ClientConnInterface) CounterServiceClient {
+	return &counterServiceClient{cc}
+}
+
+func (c *counterServiceClient) CreateCounter(ctx context.Context, in *CreateCounterRequest, opts ...grpc.CallOption) (*Counter, error) {
+	out := new(Counter)
+	err := c.cc.Invoke(ctx, CounterService_CreateCounter_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *counterServiceClient) GetCounter(ctx context.Context, in *GetCounterRequest, opts ...grpc.CallOption) (*Counter, error) {
+	out := new(Counter)
+	err := c.cc.Invoke(ctx, CounterService_GetCounter_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *counterServiceClient) IncrementCounter(ctx context.Context, in *IncrementCounterRequest, opts ...grpc.CallOption) (*Counter, error) {
+	out := new(Counter)
+	err := c.cc.Invoke(ctx, CounterService_IncrementCounter_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *counterServiceClient) DeleteCounter(ctx context.Context, in *DeleteCounterRequest, opts ...grpc.CallOption) (*DeleteCounterResponse, error) {
+	out := new(DeleteCounterResponse)
+	err := c.cc.Invoke(ctx, CounterService_DeleteCounter_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *counterServiceClient) ListCounters(ctx context.Context, in *ListCountersRequest, opts ...grpc.CallOption) (*ListCountersResponse, error) {
+	out := new(ListCountersResponse)
+	err := c.cc.Invoke(ctx, CounterService_ListCounters_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CounterServiceServer is the server API for CounterService service.
+// All implementations must embed UnimplementedCounterServiceServer
+// for forward compatibility
+type CounterServiceServer interface {
+	// CreateCounter creates a counter, failing with ALREADY_EXISTS when the
+	// name is taken in the namespace
+	CreateCounter(context.Context, *CreateCounterRequest) (*Counter, error)
+	// GetCounter returns a live counter
+	GetCounter(context.Context, *GetCounterRequest) (*Counter, error)
+	// IncrementCounter adds a signed delta to a counter
+	IncrementCounter(context.Context, *IncrementCounterRequest) (*Counter, error)
+	// DeleteCounter soft deletes a counter
+	DeleteCounter(context.Context, *DeleteCounterRequest) (*DeleteCounterResponse, error)
+	// ListCounters returns a page of the live counters
+	ListCounters(context.Context, *ListCountersRequest) (*ListCountersResponse, error)
+	mustEmbedUnimplementedCounterServiceServer()
+}
+
+// UnimplementedCounterServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedCounterServiceServer struct {
+}
+
+func (UnimplementedCounterServiceServer) CreateCounter(context.Context, *CreateCounterRequest) (*Counter, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateCounter not implemented")
+}
+func (UnimplementedCounterServiceServer) GetCounter(context.Context, *GetCounterRequest) (*Counter, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCounter not implemented")
+}
+func (UnimplementedCounterServiceServer) IncrementCounter(context.Context, *IncrementCounterRequest) (*Counter, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method IncrementCounter not implemented")
+}
+func (UnimplementedCounterServiceServer) DeleteCounter(context.Context, *DeleteCounterRequest) (*DeleteCounterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteCounter not implemented")
+}
+func (UnimplementedCounterServiceServer) ListCounters(context.Context, *ListCountersRequest) (*ListCountersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListCounters not implemented")
+}
+func (UnimplementedCounterServiceServer) mustEmbedUnimplementedCounterServiceServer() {}
+
+// UnsafeCounterServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CounterServiceServer will
+// result in compilation errors.
+type UnsafeCounterServiceServer interface {
+	mustEmbedUnimplementedCounterServiceServer()
+}
+
+func RegisterCounterServiceServer(s grpc.ServiceRegistrar, srv CounterServiceServer) {
+	s.RegisterService(&CounterService_ServiceDesc, srv)
+}
+
+func _CounterService_CreateCounter_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateCounterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CounterServiceServer).CreateCounter(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CounterService_CreateCounter_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CounterServiceServer).CreateCounter(ctx, req.(*CreateCounterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CounterService_GetCounter_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCounterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CounterServiceServer).GetCounter(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CounterService_GetCounter_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CounterServiceServer).GetCounter(ctx, req.(*GetCounterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CounterService_IncrementCounter_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IncrementCounterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CounterServiceServer).IncrementCounter(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CounterService_IncrementCounter_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CounterServiceServer).IncrementCounter(ctx, req.(*IncrementCounterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CounterService_DeleteCounter_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteCounterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CounterServiceServer).DeleteCounter(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CounterService_DeleteCounter_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CounterServiceServer).DeleteCounter(ctx, req.(*DeleteCounterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CounterService_ListCounters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListCountersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CounterServiceServer).ListCounters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CounterService_ListCounters_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CounterServiceServer).ListCounters(ctx, req.(*ListCountersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CounterService_ServiceDesc is the grpc.ServiceDesc for CounterService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CounterService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gounter.counter.v1.CounterService",
+	HandlerType: (*CounterServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateCounter",
+			Handler:    _CounterService_CreateCounter_Handler,
+		},
+		{
+			MethodName: "GetCounter",
+			Handler:    _CounterService_GetCounter_Handler,
+		},
+		{
+			MethodName: "IncrementCounter",
+			Handler:    _CounterService_IncrementCounter_Handler,
+		},
+		{
+			MethodName: "DeleteCounter",
+			Handler:    _CounterService_DeleteCounter_Handler,
+		},
+		{
+			MethodName: "ListCounters",
+			Handler:    _CounterService_ListCounters_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "counter/v1/counter.proto",
+}
@@ -0,0 +1,38 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+// HeaderName is the header carrying the ID of a request, taken from the
+// client when it sends one and returned on every response
+const HeaderName = "X-Request-ID"
+
+// pattern matches the client supplied IDs we are willing to log and echo back
+var pattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+type requestIDKey struct{}
+
+// Middleware gives every request an ID, the one sent by the client if it is
+// well formed, a new UUID otherwise
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(HeaderName)
+		if !pattern.MatchString(id) {
+			id = uuid.NewString()
+		}
+
+		w.Header().Set(HeaderName, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// FromContext returns the ID of the request, empty when the middleware did not run
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,64 @@
+package requestid_test
+
+import (
+	"gounter/api/requestid"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		expectedID func(t *testing.T, id string)
+	}{
+		{
+			name:   "Without ID",
+			header: "",
+			expectedID: func(t *testing.T, id string) {
+				_, err := uuid.Parse(id)
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name:   "With client ID",
+			header: "req-42",
+			expectedID: func(t *testing.T, id string) {
+				assert.Equal(t, "req-42", id)
+			},
+		},
+		{
+			name:   "Malformed client ID",
+			header: "req 42\n",
+			expectedID: func(t *testing.T, id string) {
+				assert.NotEqual(t, "req 42\n", id)
+				_, err := uuid.Parse(id)
+				assert.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = requestid.FromContext(r.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/counters", nil)
+			if tt.header != "" {
+				req.Header.Set(requestid.HeaderName, tt.header)
+			}
+
+			rr := httptest.NewRecorder()
+			requestid.Middleware(next).ServeHTTP(rr, req)
+
+			tt.expectedID(t, seen)
+			assert.Equal(t, seen, rr.Header().Get(requestid.HeaderName))
+		})
+	}
+}
@@ -0,0 +1,524 @@
+package route_test
+
+import (
+	"bytes"
+	"context"
+	"gounter/api/handler"
+	"gounter/api/route"
+	"gounter/docs"
+	"gounter/internal/model"
+	"gounter/internal/service"
+	"gounter/test/mocks"
+	"gounter/util"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// contractCase is a request to a route and the answer of the mocked service.
+// Its request and response are both validated against the spec.
+type contractCase struct {
+	// route is the method and path template of the spec operation
+	route          string
+	path           string
+	body           string
+	header         map[string]string
+	mockFunc       func(*mocks.Service)
+	expectedStatus int
+}
+
+// serverURL is the server of the spec
+const serverURL = "http://localhost:8081"
+
+// pathVariable matches the path variables of mux, with their optional pattern
+var pathVariable = regexp.MustCompile(`\{(\w+)(:[^}]*)?\}`)
+
+func init() {
+	// The docs page and the event streams are validated as strings
+	decodeString := func(body io.Reader, _ http.Header, _ *openapi3.SchemaRef, _ openapi3filter.EncodingFn) (interface{}, error) {
+		data, err := io.ReadAll(body)
+		return string(data), err
+	}
+	openapi3filter.RegisterBodyDecoder("text/html", decodeString)
+	openapi3filter.RegisterBodyDecoder("text/event-stream", decodeString)
+}
+
+func TestContract(t *testing.T) {
+	spec, err := openapi3.NewLoader().LoadFromData(docs.OpenAPI)
+	require.NoError(t, err)
+	require.NoError(t, spec.Validate(context.Background()))
+
+	specRouter, err := gorillamux.NewRouter(spec)
+	require.NoError(t, err)
+
+	token, err := util.GenerateValidJWT()
+	require.NoError(t, err)
+
+	cases := contractCases()
+
+	// Every route must be documented, and tested by at least one case. The
+	// unversioned routes are documented and tested as their /v1 twins.
+	router := route.InitRoutes(handler.NewHandler(new(mocks.Service)), route.WithDocsPage())
+	served := map[string]bool{}
+	unversioned := map[string]bool{}
+	err = router.Walk(func(r *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := r.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := r.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		path := pathVariable.ReplaceAllString(template, "{$1}")
+		for _, method := range methods {
+			key := method + " " + path
+			if spec.Paths.Find(path) == nil && spec.Paths.Find("/v1"+path) != nil {
+				key = method + " /v1" + path
+				unversioned[key] = true
+			}
+			served[key] = true
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	tested := map[string]bool{}
+	for _, tc := range cases {
+		tested[tc.route] = true
+	}
+	for key := range served {
+		method, path := splitRoute(key)
+		if item := spec.Paths.Find(path); item == nil || item.GetOperation(method) == nil {
+			t.Errorf("%s is served but not documented", key)
+		}
+		assert.True(t, tested[key], "%s has no contract case", key)
+	}
+	for path, item := range spec.Paths {
+		for method := range item.Operations() {
+			assert.True(t, served[method+" "+path], "%s %s is documented but not served", method, path)
+		}
+	}
+
+	for _, tc := range cases {
+		paths := []string{tc.path}
+		if unversioned[tc.route] {
+			paths = append(paths, strings.TrimPrefix(tc.path, "/v1"))
+		}
+
+		for _, path := range paths {
+			method, _ := splitRoute(tc.route)
+			t.Run(method+" "+path, func(t *testing.T) {
+				mockService := new(mocks.Service)
+				tc.mockFunc(mockService)
+				router := route.InitRoutes(handler.NewHandler(mockService), route.WithDocsPage())
+
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, newContractRequest(method, path, tc, token))
+				assert.Equal(t, tc.expectedStatus, rr.Code, rr.Body.String())
+
+				// The unversioned routes are validated against their /v1 operation
+				req := newContractRequest(method, tc.path, tc, token)
+				specRoute, pathParams, err := specRouter.FindRoute(req)
+				require.NoError(t, err)
+				assert.Equal(t, tc.route, specRoute.Method+" "+specRoute.Path)
+
+				input := &openapi3filter.RequestValidationInput{
+					Request:    req,
+					PathParams: pathParams,
+					Route:      specRoute,
+					Options:    &openapi3filter.Options{MultiError: true},
+				}
+				assert.NoError(t, openapi3filter.ValidateRequest(context.Background(), input), "request does not match the spec")
+
+				err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+					RequestValidationInput: input,
+					Status:                 rr.Code,
+					Header:                 rr.Header(),
+					Body:                   io.NopCloser(bytes.NewReader(rr.Body.Bytes())),
+					Options:                &openapi3filter.Options{IncludeResponseStatus: true, MultiError: true},
+				})
+				assert.NoError(t, err, "response does not match the spec")
+				mockService.AssertExpectations(t)
+			})
+		}
+	}
+}
+
+// newContractRequest builds the request of a case on the server of the spec
+func newContractRequest(method, path string, tc contractCase, token string) *http.Request {
+	req := httptest.NewRequest(method, serverURL+path, strings.NewReader(tc.body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	if tc.body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range tc.header {
+		req.Header.Set(name, value)
+	}
+
+	return req
+}
+
+// splitRoute splits a route key into its method and path
+func splitRoute(key string) (string, string) {
+	parts := strings.SplitN(key, " ", 2)
+	return parts[0], parts[1]
+}
+
+func contractCases() []contractCase {
+	adminToken, err := util.GenerateAdminJWT()
+	if err != nil {
+		panic(err)
+	}
+
+	id := uuid.New()
+	at := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	counter := &model.Counter{
+		ID:             id,
+		Name:           "checkout_completed",
+		Value:          5,
+		OverflowPolicy: model.OverflowReject,
+		Namespace:      "payments",
+		Labels:         model.Labels{"team": "payments"},
+		Unit:           "orders",
+		Shards:         1,
+		Version:        2,
+		CreatedAt:      at,
+		UpdatedAt:      at,
+	}
+	bucket := &model.CounterBucket{Start: at, Delta: 5, Increments: 2}
+
+	returnCounter := func(method string, args ...interface{}) func(*mocks.Service) {
+		return func(mockService *mocks.Service) {
+			mockService.On(method, args...).Return(counter, nil)
+		}
+	}
+	failWith := func(method string, err error, args ...interface{}) func(*mocks.Service) {
+		return func(mockService *mocks.Service) {
+			mockService.On(method, args...).Return(nil, err)
+		}
+	}
+	getCounter := returnCounter("GetCounter", mock.Anything, id)
+	setCounter := returnCounter("SetCounter", mock.Anything, id, int64(5), int64(2))
+	updateCounter := returnCounter("UpdateCounter", mock.Anything, id, mock.Anything)
+	deleteCounter := func(mockService *mocks.Service) {
+		mockService.On("SoftDeleteCounter", mock.Anything, id).Return(int64(1), nil)
+	}
+	restoreCounter := returnCounter("RestoreCounter", mock.Anything, id)
+	counterHistory := func(mockService *mocks.Service) {
+		mockService.On("CounterHistory", mock.Anything, mock.Anything).Return(&model.CounterEventPage{
+			Events:     []*model.CounterEvent{{ID: 1, CounterID: id, Type: model.EventIncrement, Delta: 5, Value: 5, Subject: "billing", CreatedAt: at}},
+			NextCursor: "MQ",
+		}, nil)
+	}
+	counterSeries := func(mockService *mocks.Service) {
+		mockService.On("CounterSeries", mock.Anything, mock.Anything).Return(&model.CounterSeries{
+			CounterID: id, Granularity: model.GranularityDay, Buckets: []*model.CounterBucket{bucket},
+		}, nil)
+	}
+	counterRate := func(mockService *mocks.Service) {
+		mockService.On("CounterRate", mock.Anything, id, 5*time.Minute).Return(&model.CounterRate{
+			CounterID: id, Window: "5m0s", From: at.Add(-5 * time.Minute), To: at, Delta: 30, PerSecond: 0.1,
+		}, nil)
+	}
+	watchCounter := func(mockService *mocks.Service) {
+		changes := make(chan model.CounterChange, 1)
+		changes <- model.CounterChange{ID: "m5x2k1q8-42", Counter: counter}
+		close(changes)
+		mockService.On("WatchCounters", mock.Anything, model.WatchQuery{CounterID: id}).Return((<-chan model.CounterChange)(changes), nil)
+	}
+	incrementByName := returnCounter("IncrementCounterByName", mock.Anything, "payments", "checkout_completed", int64(2))
+
+	idPath := "/v1/counters/" + id.String()
+	legacyPath := "/counter/" + id.String()
+	ifMatch := map[string]string{"If-Match": `"2"`}
+
+	return []contractCase{
+		{
+			route:          "POST /v1/counters",
+			path:           "/v1/counters",
+			body:           `{"name": "checkout_completed", "namespace": "payments", "unit": "orders", "labels": {"team": "payments"}}`,
+			mockFunc:       returnCounter("CreateCounter", mock.Anything, mock.Anything),
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			route:          "POST /v1/counters",
+			path:           "/v1/counters",
+			body:           `{"name": "checkout_completed", "namespace": "payments"}`,
+			mockFunc:       failWith("CreateCounter", service.ErrNameTaken, mock.Anything, mock.Anything),
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			route: "GET /v1/counters",
+			path:  "/v1/counters?prefix=checkout&labels=team%3Dpayments&sort=value&order=desc&limit=10",
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("ListCounters", mock.Anything, mock.Anything).
+					Return(&model.CounterPage{Counters: []*model.Counter{counter}, NextCursor: "Y2hlY2tvdXQ"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route: "GET /v1/counters/series",
+			path:  "/v1/counters/series?labels=team%3Dpayments&granularity=hour",
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("AggregateSeries", mock.Anything, mock.Anything).Return(&model.AggregateSeries{
+					Labels: model.Labels{"team": "payments"}, Counters: 1, Granularity: model.GranularityHour, Buckets: []*model.CounterBucket{bucket},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route: "GET /v1/counters/rate",
+			path:  "/v1/counters/rate?window=5m",
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("AggregateRate", mock.Anything, "", 5*time.Minute).Return(&model.AggregateRate{
+					Counters: 3, Window: "5m0s", From: at.Add(-5 * time.Minute), To: at, Delta: 30, PerSecond: 0.1,
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:  "GET /v1/counters/watch",
+			path:   "/v1/counters/watch?labels=team%3Dpayments",
+			header: map[string]string{"Last-Event-ID": "m5x2k1q8-41"},
+			mockFunc: func(mockService *mocks.Service) {
+				changes := make(chan model.CounterChange, 2)
+				changes <- model.CounterChange{ID: "m5x2k1q8-42", Counter: counter}
+				changes <- model.CounterChange{ID: "m5x2k1q8-43", Counter: &model.Counter{ID: id}, Deleted: true}
+				close(changes)
+				mockService.On("WatchCounters", mock.Anything, model.WatchQuery{Labels: "team=payments", LastEventID: "m5x2k1q8-41"}).Return((<-chan model.CounterChange)(changes), nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route: "POST /v1/counters/batch",
+			path:  "/v1/counters/batch",
+			body:  `{"mode": "best_effort", "operations": [{"op": "increment", "id": "` + id.String() + `", "delta": 5}, {"op": "delete", "id": "` + id.String() + `"}]}`,
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("ApplyBatch", mock.Anything, mock.Anything, false).Return([]model.BatchResult{
+					{Counter: counter},
+					{Err: service.ErrCounterNotFound},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "POST /v1/counters/by-name/{name}/increment",
+			path:           "/v1/counters/by-name/checkout_completed/increment?namespace=payments",
+			body:           `{"delta": 2}`,
+			mockFunc:       incrementByName,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "GET /v1/counters/{id}",
+			path:           idPath,
+			mockFunc:       getCounter,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "GET /v1/counters/{id}",
+			path:           idPath,
+			mockFunc:       failWith("GetCounter", service.ErrCounterNotFound, mock.Anything, id),
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			route:          "PUT /v1/counters/{id}",
+			path:           idPath,
+			body:           `{"value": 5}`,
+			header:         ifMatch,
+			mockFunc:       setCounter,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "PUT /v1/counters/{id}",
+			path:           idPath,
+			body:           `{"value": 5}`,
+			header:         ifMatch,
+			mockFunc:       failWith("SetCounter", service.ErrVersionMismatch, mock.Anything, id, int64(5), int64(2)),
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		{
+			route:          "PATCH /v1/counters/{id}",
+			path:           idPath,
+			body:           `{"description": "Completed checkouts", "labels": {"team": "payments", "env": "prod"}}`,
+			mockFunc:       updateCounter,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "DELETE /v1/counters/{id}",
+			path:           idPath,
+			mockFunc:       deleteCounter,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "POST /v1/counters/{id}/increment",
+			path:           idPath + "/increment",
+			body:           `{"delta": 5}`,
+			mockFunc:       returnCounter("IncrementCounter", mock.Anything, id, int64(5)),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "POST /v1/counters/{id}/increment",
+			path:           idPath + "/increment",
+			body:           `{"delta": 50}`,
+			mockFunc:       failWith("IncrementCounter", &service.OutOfBoundsError{ID: id, Delta: 50}, mock.Anything, id, int64(50)),
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			route:          "POST /v1/counters/{id}/decrement",
+			path:           idPath + "/decrement",
+			body:           `{"delta": 2}`,
+			mockFunc:       returnCounter("IncrementCounter", mock.Anything, id, int64(-2)),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "POST /v1/counters/{id}/restore",
+			path:           idPath + "/restore",
+			mockFunc:       restoreCounter,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "GET /v1/counters/{id}/history",
+			path:           idPath + "/history?from=2026-10-01T00:00:00Z&limit=10",
+			mockFunc:       counterHistory,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "GET /v1/counters/{id}/series",
+			path:           idPath + "/series?granularity=day",
+			mockFunc:       counterSeries,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "GET /v1/counters/{id}/rate",
+			path:           idPath + "/rate?window=5m",
+			mockFunc:       counterRate,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "GET /v1/counters/{id}/watch",
+			path:           idPath + "/watch",
+			mockFunc:       watchCounter,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:  "POST /v1/admin/counters/purge",
+			path:   "/v1/admin/counters/purge?older_than=720h",
+			header: map[string]string{"Authorization": "Bearer " + adminToken},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("PurgeDeletedCounters", mock.Anything, 720*time.Hour).Return(int64(3), nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "POST /v1/admin/counters/purge",
+			path:           "/v1/admin/counters/purge",
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			route:          "GET /openapi.json",
+			path:           "/openapi.json",
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "GET /docs",
+			path:           "/docs",
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "POST /counter/create",
+			path:           "/counter/create",
+			body:           `{"name": "checkout_completed"}`,
+			mockFunc:       returnCounter("CreateCounter", mock.Anything, mock.Anything),
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			route:          "POST /counter/increment",
+			path:           "/counter/increment",
+			body:           `{"id": "` + id.String() + `", "delta": 5}`,
+			mockFunc:       returnCounter("IncrementCounter", mock.Anything, id, int64(5)),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "DELETE /counter/delete",
+			path:           "/counter/delete?id=" + id.String(),
+			mockFunc:       deleteCounter,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "POST /counter/by-name/{name}/increment",
+			path:           "/counter/by-name/checkout_completed/increment?namespace=payments",
+			body:           `{"delta": 2}`,
+			mockFunc:       incrementByName,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "GET /counter/{id}",
+			path:           legacyPath,
+			mockFunc:       getCounter,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "PUT /counter/{id}",
+			path:           legacyPath,
+			body:           `{"value": 5}`,
+			header:         ifMatch,
+			mockFunc:       setCounter,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "PATCH /counter/{id}",
+			path:           legacyPath,
+			body:           `{"name": "checkout_completed"}`,
+			mockFunc:       updateCounter,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "POST /counter/{id}/decrement",
+			path:           legacyPath + "/decrement",
+			mockFunc:       returnCounter("IncrementCounter", mock.Anything, id, int64(-1)),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "POST /counter/{id}/restore",
+			path:           legacyPath + "/restore",
+			mockFunc:       restoreCounter,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "GET /counter/{id}/history",
+			path:           legacyPath + "/history",
+			mockFunc:       counterHistory,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "GET /counter/{id}/series",
+			path:           legacyPath + "/series?granularity=day",
+			mockFunc:       counterSeries,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			route:          "GET /counter/{id}/rate",
+			path:           legacyPath + "/rate?window=5m",
+			mockFunc:       counterRate,
+			expectedStatus: http.StatusOK,
+		},
+	}
+}
@@ -0,0 +1,32 @@
+package route
+
+import (
+	"gounter/docs"
+	"net/http"
+)
+
+// Option configures optional routes
+type Option func(*options)
+
+type options struct {
+	docsPage bool
+}
+
+// WithDocsPage serves a page rendering the OpenAPI spec at /docs
+func WithDocsPage() Option {
+	return func(o *options) {
+		o.docsPage = true
+	}
+}
+
+// openAPI serves the OpenAPI spec embedded in the binary
+func openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(docs.OpenAPI)
+}
+
+// docsPage serves the page rendering the OpenAPI spec
+func docsPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docs.Page)
+}
@@ -2,18 +2,144 @@ package route
 
 import (
 	"gounter/api/auth"
+	"gounter/api/deprecation"
 	"gounter/api/handler"
+	"gounter/api/idempotency"
+	"gounter/api/problem"
+	"gounter/api/requestid"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
 )
 
+// legacyNotice deprecates the /counter routes replaced by the /counters ones
+var legacyNotice = deprecation.Notice{
+	Since:  time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC),
+	Sunset: time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC),
+	Link:   deprecation.DocsLink,
+}
+
 // InitRoutes initializes the HTTP routes
-func InitRoutes(handler *handler.Handler) *http.ServeMux {
-	mux := http.NewServeMux()
+func InitRoutes(handler *handler.Handler, opts ...Option) *mux.Router {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	router := mux.NewRouter()
+	router.Use(requestid.Middleware)
+	router.NotFoundHandler = requestid.Middleware(http.HandlerFunc(notFound))
+	router.MethodNotAllowedHandler = requestid.Middleware(methodNotAllowed(router))
+
+	// Define routes for the documentation, readable without a token
+	router.HandleFunc("/openapi.json", openAPI).Methods(http.MethodGet)
+	if o.docsPage {
+		router.HandleFunc("/docs", docsPage).Methods(http.MethodGet)
+	}
+
+	// Each version of the API is a route group under its own prefix. Clients
+	// pinned to a version keep its behavior while later versions evolve. The
+	// groups do not use PathPrefix, whose subrouters answer 404 instead of 405.
+	v1Routes(router.NewRoute().Subrouter(), "/v1", handler)
+
+	// The routes without a prefix are a supported alias of v1, for the clients
+	// written before versioning
+	v1Routes(router.NewRoute().Subrouter(), "", handler)
+
+	legacy := router.NewRoute().Subrouter()
+	legacy.Use(legacyNotice.Middleware)
+	legacyRoutes(legacy, handler)
+
+	return router
+}
+
+// v1Routes defines the routes of the version 1 of the API under the prefix
+func v1Routes(router *mux.Router, prefix string, handler *handler.Handler) {
+	// Define routes for the counters collection. The fixed paths come before
+	// /counters/{id} so they are not taken for an ID.
+	router.Handle(prefix+"/counters", mutating(handler.CreateCounter)).Methods(http.MethodPost)
+	router.Handle(prefix+"/counters", auth.AuthorizationMiddleware(http.HandlerFunc(handler.ListCounters))).Methods(http.MethodGet)
+	router.Handle(prefix+"/counters/series", auth.AuthorizationMiddleware(http.HandlerFunc(handler.AggregateSeries))).Methods(http.MethodGet)
+	router.Handle(prefix+"/counters/rate", auth.AuthorizationMiddleware(http.HandlerFunc(handler.AggregateRate))).Methods(http.MethodGet)
+	router.Handle(prefix+"/counters/batch", mutating(handler.BatchCounters)).Methods(http.MethodPost)
+	router.Handle(prefix+"/counters/by-name/{name}/increment", mutating(handler.IncrementCounterByName)).Methods(http.MethodPost)
+	router.Handle(prefix+"/counters/watch", auth.AuthorizationMiddleware(http.HandlerFunc(handler.WatchCounters))).Methods(http.MethodGet)
+
+	// Define routes for a single counter
+	router.Handle(prefix+"/counters/{id}", auth.AuthorizationMiddleware(http.HandlerFunc(handler.GetCounter))).Methods(http.MethodGet)
+	router.Handle(prefix+"/counters/{id}", mutating(handler.SetCounter)).Methods(http.MethodPut)
+	router.Handle(prefix+"/counters/{id}", mutating(handler.UpdateCounter)).Methods(http.MethodPatch)
+	router.Handle(prefix+"/counters/{id}", mutating(handler.DeleteCounter)).Methods(http.MethodDelete)
+	router.Handle(prefix+"/counters/{id}/increment", mutating(handler.IncrementCounter)).Methods(http.MethodPost)
+	router.Handle(prefix+"/counters/{id}/decrement", mutating(handler.DecrementCounter)).Methods(http.MethodPost)
+	router.Handle(prefix+"/counters/{id}/restore", mutating(handler.RestoreCounter)).Methods(http.MethodPost)
+	router.Handle(prefix+"/counters/{id}/history", auth.AuthorizationMiddleware(http.HandlerFunc(handler.CounterHistory))).Methods(http.MethodGet)
+	router.Handle(prefix+"/counters/{id}/series", auth.AuthorizationMiddleware(http.HandlerFunc(handler.CounterSeries))).Methods(http.MethodGet)
+	router.Handle(prefix+"/counters/{id}/rate", auth.AuthorizationMiddleware(http.HandlerFunc(handler.CounterRate))).Methods(http.MethodGet)
+	router.Handle(prefix+"/counters/{id}/watch", auth.AuthorizationMiddleware(http.HandlerFunc(handler.WatchCounter))).Methods(http.MethodGet)
+
+	// Define admin routes
+	router.Handle(prefix+"/admin/counters/purge", admin(handler.PurgeDeletedCounters)).Methods(http.MethodPost)
+}
+
+// legacyID is the ID variable of the legacy routes. Its pattern tells IDs apart
+// from create, increment and delete, so these answer other methods with 405.
+const legacyID = "{id:[0-9a-fA-F-]+}"
+
+// legacyRoutes defines the deprecated /counter routes, kept as aliases of the
+// /counters routes for the existing clients
+func legacyRoutes(router *mux.Router, handler *handler.Handler) {
+	router.Handle("/counter/create", mutating(handler.CreateCounter)).Methods(http.MethodPost)
+	router.Handle("/counter/increment", mutating(handler.IncrementCounter)).Methods(http.MethodPost)
+	router.Handle("/counter/delete", mutating(handler.DeleteCounter)).Methods(http.MethodDelete)
+	router.Handle("/counter/by-name/{name}/increment", mutating(handler.IncrementCounterByName)).Methods(http.MethodPost)
+
+	router.Handle("/counter/"+legacyID, auth.AuthorizationMiddleware(http.HandlerFunc(handler.GetCounter))).Methods(http.MethodGet)
+	router.Handle("/counter/"+legacyID, mutating(handler.SetCounter)).Methods(http.MethodPut)
+	router.Handle("/counter/"+legacyID, mutating(handler.UpdateCounter)).Methods(http.MethodPatch)
+	router.Handle("/counter/"+legacyID+"/decrement", mutating(handler.DecrementCounter)).Methods(http.MethodPost)
+	router.Handle("/counter/"+legacyID+"/restore", mutating(handler.RestoreCounter)).Methods(http.MethodPost)
+	router.Handle("/counter/"+legacyID+"/history", auth.AuthorizationMiddleware(http.HandlerFunc(handler.CounterHistory))).Methods(http.MethodGet)
+	router.Handle("/counter/"+legacyID+"/series", auth.AuthorizationMiddleware(http.HandlerFunc(handler.CounterSeries))).Methods(http.MethodGet)
+	router.Handle("/counter/"+legacyID+"/rate", auth.AuthorizationMiddleware(http.HandlerFunc(handler.CounterRate))).Methods(http.MethodGet)
+}
+
+// mutating wraps a handler changing counters with authorization and Idempotency-Key support
+func mutating(handlerFunc http.HandlerFunc) http.Handler {
+	return auth.AuthorizationMiddleware(idempotency.Middleware(handlerFunc))
+}
+
+// admin wraps a handler of the admin routes with authorization requiring the admin role
+func admin(handlerFunc http.HandlerFunc) http.Handler {
+	return auth.AuthorizationMiddleware(auth.AdminMiddleware(handlerFunc))
+}
+
+// notFound answers the requests matching no route
+func notFound(w http.ResponseWriter, r *http.Request) {
+	problem.Write(w, r, http.StatusNotFound, "route_not_found", "no route matches "+r.URL.Path)
+}
+
+// methods are the methods tried when listing the ones a path allows
+var methods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// methodNotAllowed answers the requests matching a route with another method,
+// listing the methods the path allows in the Allow header
+func methodNotAllowed(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := []string{}
+		for _, method := range methods {
+			probe := r.Clone(r.Context())
+			probe.Method = method
 
-	// Define routes for create, update, and delete
-	mux.Handle("/counter/create", auth.AuthorizationMiddleware(http.HandlerFunc(handler.CreateCounter)))
-	mux.Handle("/counter/increment", auth.AuthorizationMiddleware(http.HandlerFunc(handler.IncrementCounter)))
-	mux.Handle("/counter/delete", auth.AuthorizationMiddleware(http.HandlerFunc(handler.DeleteCounter)))
+			var match mux.RouteMatch
+			if router.Match(probe, &match) && match.MatchErr == nil {
+				allowed = append(allowed, method)
+			}
+		}
 
-	return mux
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", r.Method+" is not allowed on "+r.URL.Path)
+	})
 }
@@ -0,0 +1,233 @@
+package route_test
+
+import (
+	"encoding/json"
+	"gounter/api/handler"
+	"gounter/api/problem"
+	"gounter/api/route"
+	"gounter/internal/model"
+	"gounter/test/mocks"
+	"gounter/util"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestInitRoutes(t *testing.T) {
+	id := uuid.New()
+	counter := &model.Counter{ID: id, Name: "signups", Value: 1, Version: 1}
+
+	token, err := util.GenerateValidJWT()
+	assert.NoError(t, err)
+
+	adminToken, err := util.GenerateAdminJWT()
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		// token replaces the token without any role
+		token          string
+		mockFunc       func(*mocks.Service)
+		expectedStatus int
+		expectedAllow  string
+		// expectedDeprecation and expectedSunset are the deprecation headers
+		expectedDeprecation string
+		expectedSunset      string
+	}{
+		{
+			name:   "Create",
+			method: http.MethodPost,
+			path:   "/v1/counters",
+			body:   `{"name": "signups"}`,
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("CreateCounter", mock.Anything, model.CreateCounterParams{Name: "signups"}).Return(counter, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:   "Get",
+			method: http.MethodGet,
+			path:   "/v1/counters/" + id.String(),
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("GetCounter", mock.Anything, id).Return(counter, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Delete",
+			method: http.MethodDelete,
+			path:   "/v1/counters/" + id.String(),
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("SoftDeleteCounter", mock.Anything, id).Return(int64(1), nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Increment",
+			method: http.MethodPost,
+			path:   "/v1/counters/" + id.String() + "/increment",
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("IncrementCounter", mock.Anything, id, int64(1)).Return(counter, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Purge As Admin",
+			method: http.MethodPost,
+			path:   "/v1/admin/counters/purge",
+			token:  adminToken,
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("PurgeDeletedCounters", mock.Anything, 30*24*time.Hour).Return(int64(2), nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Purge Without Admin Role",
+			method:         http.MethodPost,
+			path:           "/v1/admin/counters/purge",
+			mockFunc:       func(mockService *mocks.Service) {},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:   "Aggregate Series Is Not An ID",
+			method: http.MethodGet,
+			path:   "/v1/counters/series?labels=team%3Dpayments",
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("AggregateSeries", mock.Anything, mock.Anything).Return(&model.AggregateSeries{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Increment With Body ID",
+			method: http.MethodPost,
+			path:   "/v1/counters/" + id.String() + "/increment",
+			body:   `{"id": "` + id.String() + `"}`,
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("IncrementCounter", mock.Anything, id, int64(1)).Return(counter, nil)
+			},
+			expectedStatus:      http.StatusOK,
+			expectedDeprecation: "@1792281600",
+		},
+		{
+			name:   "Unversioned Get",
+			method: http.MethodGet,
+			path:   "/counters/" + id.String(),
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("GetCounter", mock.Anything, id).Return(counter, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Unversioned Wrong Method",
+			method:         http.MethodPut,
+			path:           "/counters",
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedAllow:  "GET, POST",
+		},
+		{
+			name:   "Legacy Create",
+			method: http.MethodPost,
+			path:   "/counter/create",
+			body:   `{"name": "signups"}`,
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("CreateCounter", mock.Anything, model.CreateCounterParams{Name: "signups"}).Return(counter, nil)
+			},
+			expectedStatus:      http.StatusCreated,
+			expectedDeprecation: "@1792281600",
+			expectedSunset:      "Fri, 30 Apr 2027 00:00:00 GMT",
+		},
+		{
+			name:   "Legacy Increment",
+			method: http.MethodPost,
+			path:   "/counter/increment",
+			body:   `{"id": "` + id.String() + `", "delta": 2}`,
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("IncrementCounter", mock.Anything, id, int64(2)).Return(counter, nil)
+			},
+			expectedStatus:      http.StatusOK,
+			expectedDeprecation: "@1792281600",
+			expectedSunset:      "Fri, 30 Apr 2027 00:00:00 GMT",
+		},
+		{
+			name:   "Legacy Delete",
+			method: http.MethodDelete,
+			path:   "/counter/delete?id=" + id.String(),
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("SoftDeleteCounter", mock.Anything, id).Return(int64(1), nil)
+			},
+			expectedStatus:      http.StatusOK,
+			expectedDeprecation: "@1792281600",
+			expectedSunset:      "Fri, 30 Apr 2027 00:00:00 GMT",
+		},
+		{
+			name:           "Legacy Create Wrong Method",
+			method:         http.MethodGet,
+			path:           "/counter/create",
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedAllow:  "POST",
+		},
+		{
+			name:           "Counter Wrong Method",
+			method:         http.MethodPost,
+			path:           "/v1/counters/" + id.String(),
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedAllow:  "GET, PUT, PATCH, DELETE",
+		},
+		{
+			name:           "Collection Wrong Method",
+			method:         http.MethodDelete,
+			path:           "/v1/counters",
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedAllow:  "GET, POST",
+		},
+		{
+			name:           "Unknown Route",
+			method:         http.MethodGet,
+			path:           "/gauges",
+			mockFunc:       func(*mocks.Service) {},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockService := new(mocks.Service)
+			tc.mockFunc(mockService)
+			router := route.InitRoutes(handler.NewHandler(mockService))
+
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if tc.token == "" {
+				tc.token = token
+			}
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			assert.Equal(t, tc.expectedAllow, rr.Header().Get("Allow"))
+			assert.Equal(t, tc.expectedDeprecation, rr.Header().Get("Deprecation"))
+			assert.Equal(t, tc.expectedSunset, rr.Header().Get("Sunset"))
+			if rr.Code >= http.StatusBadRequest {
+				var details problem.Details
+				assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+				assert.NoError(t, json.NewDecoder(rr.Body).Decode(&details))
+				assert.NotEmpty(t, details.RequestID)
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
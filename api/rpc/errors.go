@@ -0,0 +1,80 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"gounter/internal/service"
+	"gounter/internal/validation"
+	"log"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain is the domain of the ErrorInfo details attached to the errors
+const errorDomain = "gounter"
+
+// internalMessage replaces the message of the errors outside the taxonomy,
+// which may leak details of the storage
+const internalMessage = "An unexpected error occurred"
+
+// toStatus converts an error of the service to a gRPC status error. The code of
+// the taxonomy is attached as the reason of an ErrorInfo, and the invalid
+// fields as a BadRequest, so clients can branch on them like on the problems
+// of the REST API.
+func toStatus(ctx context.Context, err error) error {
+	kind, code := service.Classify(err)
+
+	message := err.Error()
+	if kind == service.KindInternal {
+		method, _ := grpc.Method(ctx)
+		log.Printf("%s: %v", method, err)
+		message = internalMessage
+	}
+
+	st := status.New(Code(kind, code), message)
+
+	if withInfo, detailsErr := st.WithDetails(&errdetails.ErrorInfo{Reason: code, Domain: errorDomain}); detailsErr == nil {
+		st = withInfo
+	}
+
+	var fields validation.Errors
+	if errors.As(err, &fields) {
+		badRequest := &errdetails.BadRequest{}
+		for _, field := range fields {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       field.Field,
+				Description: field.Err.Error(),
+			})
+		}
+		if withFields, detailsErr := st.WithDetails(badRequest); detailsErr == nil {
+			st = withFields
+		}
+	}
+
+	return st.Err()
+}
+
+// Code returns the gRPC code the errors of a kind are answered with.
+// A taken name is the only conflict reported as AlreadyExists.
+func Code(kind service.ErrorKind, code string) codes.Code {
+	switch kind {
+	case service.KindValidation:
+		return codes.InvalidArgument
+	case service.KindNotFound:
+		return codes.NotFound
+	case service.KindConflict:
+		if code == service.ErrNameTaken.Code() {
+			return codes.AlreadyExists
+		}
+		return codes.FailedPrecondition
+	case service.KindPreconditionFailed:
+		return codes.Aborted
+	case service.KindUnsupported:
+		return codes.Unimplemented
+	default:
+		return codes.Internal
+	}
+}
@@ -0,0 +1,168 @@
+package rpc
+
+import (
+	"context"
+	counterv1 "gounter/api/proto/counter/v1"
+	"gounter/internal/model"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Service holds the operations of the counter service the gRPC API serves
+type Service interface {
+	CreateCounter(ctx context.Context, params model.CreateCounterParams) (*model.Counter, error)
+	GetCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error)
+	ListCounters(ctx context.Context, query model.ListCountersQuery) (*model.CounterPage, error)
+	IncrementCounter(ctx context.Context, id uuid.UUID, delta int64) (*model.Counter, error)
+	SoftDeleteCounter(ctx context.Context, id uuid.UUID) (int64, error)
+}
+
+// Server implements the CounterService of the gRPC API on top of the same
+// service as the REST handlers
+type Server struct {
+	counterv1.UnimplementedCounterServiceServer
+	service Service
+}
+
+// NewServer creates a gRPC server for the counters of the service
+func NewServer(service Service) *Server {
+	return &Server{service: service}
+}
+
+// CreateCounter creates a counter
+func (s *Server) CreateCounter(ctx context.Context, req *counterv1.CreateCounterRequest) (*counterv1.Counter, error) {
+	counter, err := s.service.CreateCounter(ctx, model.CreateCounterParams{
+		Name:           req.GetName(),
+		Namespace:      req.GetNamespace(),
+		Labels:         model.Labels(req.GetLabels()),
+		Description:    req.GetDescription(),
+		Unit:           req.GetUnit(),
+		Min:            req.Min,
+		Max:            req.Max,
+		OverflowPolicy: model.OverflowPolicy(req.GetOverflowPolicy()),
+		Shards:         int(req.GetShards()),
+	})
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return toCounter(counter), nil
+}
+
+// GetCounter returns a live counter
+func (s *Server) GetCounter(ctx context.Context, req *counterv1.GetCounterRequest) (*counterv1.Counter, error) {
+	id, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	counter, err := s.service.GetCounter(ctx, id)
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return toCounter(counter), nil
+}
+
+// IncrementCounter adds a delta to a counter, 1 unless the request sets it
+func (s *Server) IncrementCounter(ctx context.Context, req *counterv1.IncrementCounterRequest) (*counterv1.Counter, error) {
+	id, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	delta := int64(1)
+	if req.Delta != nil {
+		delta = req.GetDelta()
+	}
+
+	counter, err := s.service.IncrementCounter(ctx, id, delta)
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return toCounter(counter), nil
+}
+
+// DeleteCounter soft deletes a counter
+func (s *Server) DeleteCounter(ctx context.Context, req *counterv1.DeleteCounterRequest) (*counterv1.DeleteCounterResponse, error) {
+	id, err := parseID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.service.SoftDeleteCounter(ctx, id); err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	return &counterv1.DeleteCounterResponse{}, nil
+}
+
+// ListCounters returns a page of the live counters
+func (s *Server) ListCounters(ctx context.Context, req *counterv1.ListCountersRequest) (*counterv1.ListCountersResponse, error) {
+	query := model.ListCountersQuery{
+		NamePrefix: req.GetPrefix(),
+		Labels:     req.GetLabels(),
+		SortBy:     model.CounterSort(req.GetSort()),
+		Descending: req.GetDescending(),
+		Cursor:     req.GetCursor(),
+		Limit:      int(req.GetLimit()),
+	}
+
+	if query.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit must be a positive integer")
+	}
+
+	for _, idString := range req.GetIds() {
+		id, err := parseID(idString)
+		if err != nil {
+			return nil, err
+		}
+		query.IDs = append(query.IDs, id)
+	}
+
+	page, err := s.service.ListCounters(ctx, query)
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+
+	response := &counterv1.ListCountersResponse{NextCursor: page.NextCursor}
+	for _, counter := range page.Counters {
+		response.Counters = append(response.Counters, toCounter(counter))
+	}
+
+	return response, nil
+}
+
+// parseID parses the id of a counter, failing with InvalidArgument
+func parseID(id string) (uuid.UUID, error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.InvalidArgument, "Please provide valid uuid")
+	}
+
+	return parsed, nil
+}
+
+// toCounter converts a counter to its protobuf message
+func toCounter(counter *model.Counter) *counterv1.Counter {
+	return &counterv1.Counter{
+		Id:             counter.ID.String(),
+		Name:           counter.Name,
+		Value:          counter.Value,
+		Min:            counter.Min,
+		Max:            counter.Max,
+		OverflowPolicy: string(counter.OverflowPolicy),
+		Namespace:      counter.Namespace,
+		Labels:         counter.Labels,
+		Description:    counter.Description,
+		Unit:           counter.Unit,
+		Shards:         int32(counter.Shards),
+		Version:        counter.Version,
+		CreatedAt:      timestamppb.New(counter.CreatedAt),
+		UpdatedAt:      timestamppb.New(counter.UpdatedAt),
+	}
+}
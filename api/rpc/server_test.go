@@ -0,0 +1,251 @@
+package rpc_test
+
+import (
+	"context"
+	"errors"
+	"gounter/api/auth"
+	"gounter/api/idempotency"
+	counterv1 "gounter/api/proto/counter/v1"
+	"gounter/api/rpc"
+	"gounter/internal/model"
+	"gounter/internal/service"
+	"gounter/internal/validation"
+	"gounter/test/mocks"
+	"gounter/util"
+	"net"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dial serves the counters of the mocked service over an in memory connection
+func dial(t *testing.T, mockService *mocks.Service) counterv1.CounterServiceClient {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(auth.UnaryServerInterceptor, idempotency.UnaryServerInterceptor))
+	counterv1.RegisterCounterServiceServer(server, rpc.NewServer(mockService))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return counterv1.NewCounterServiceClient(conn)
+}
+
+// authorized returns a context sending a valid token
+func authorized(t *testing.T) context.Context {
+	token, err := util.GenerateValidJWT()
+	assert.NoError(t, err)
+
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestServer(t *testing.T) {
+	id := uuid.New()
+	counter := &model.Counter{ID: id, Name: "signups", Value: 3, Labels: model.Labels{"team": "growth"}, Shards: 1, Version: 2}
+
+	testCases := []struct {
+		name         string
+		call         func(context.Context, counterv1.CounterServiceClient) (interface{}, error)
+		mockFunc     func(*mocks.Service)
+		expectedCode codes.Code
+	}{
+		{
+			name: "Create",
+			call: func(ctx context.Context, client counterv1.CounterServiceClient) (interface{}, error) {
+				return client.CreateCounter(ctx, &counterv1.CreateCounterRequest{Name: "signups", Labels: map[string]string{"team": "growth"}})
+			},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("CreateCounter", mock.Anything, model.CreateCounterParams{Name: "signups", Labels: model.Labels{"team": "growth"}}).Return(counter, nil)
+			},
+			expectedCode: codes.OK,
+		},
+		{
+			name: "Create Name Taken",
+			call: func(ctx context.Context, client counterv1.CounterServiceClient) (interface{}, error) {
+				return client.CreateCounter(ctx, &counterv1.CreateCounterRequest{Name: "signups"})
+			},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("CreateCounter", mock.Anything, model.CreateCounterParams{Name: "signups"}).Return(nil, service.ErrNameTaken)
+			},
+			expectedCode: codes.AlreadyExists,
+		},
+		{
+			name: "Get",
+			call: func(ctx context.Context, client counterv1.CounterServiceClient) (interface{}, error) {
+				return client.GetCounter(ctx, &counterv1.GetCounterRequest{Id: id.String()})
+			},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("GetCounter", mock.Anything, id).Return(counter, nil)
+			},
+			expectedCode: codes.OK,
+		},
+		{
+			name: "Get Not Found",
+			call: func(ctx context.Context, client counterv1.CounterServiceClient) (interface{}, error) {
+				return client.GetCounter(ctx, &counterv1.GetCounterRequest{Id: id.String()})
+			},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("GetCounter", mock.Anything, id).Return(nil, service.ErrCounterNotFound)
+			},
+			expectedCode: codes.NotFound,
+		},
+		{
+			name: "Get Invalid ID",
+			call: func(ctx context.Context, client counterv1.CounterServiceClient) (interface{}, error) {
+				return client.GetCounter(ctx, &counterv1.GetCounterRequest{Id: "42"})
+			},
+			mockFunc:     func(*mocks.Service) {},
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			name: "Increment Defaults To One",
+			call: func(ctx context.Context, client counterv1.CounterServiceClient) (interface{}, error) {
+				return client.IncrementCounter(ctx, &counterv1.IncrementCounterRequest{Id: id.String()})
+			},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("IncrementCounter", mock.Anything, id, int64(1)).Return(counter, nil)
+			},
+			expectedCode: codes.OK,
+		},
+		{
+			name: "Increment By Delta",
+			call: func(ctx context.Context, client counterv1.CounterServiceClient) (interface{}, error) {
+				delta := int64(-2)
+				return client.IncrementCounter(ctx, &counterv1.IncrementCounterRequest{Id: id.String(), Delta: &delta})
+			},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("IncrementCounter", mock.Anything, id, int64(-2)).Return(counter, nil)
+			},
+			expectedCode: codes.OK,
+		},
+		{
+			name: "Increment Version Mismatch",
+			call: func(ctx context.Context, client counterv1.CounterServiceClient) (interface{}, error) {
+				return client.IncrementCounter(ctx, &counterv1.IncrementCounterRequest{Id: id.String()})
+			},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("IncrementCounter", mock.Anything, id, int64(1)).Return(nil, service.ErrVersionMismatch)
+			},
+			expectedCode: codes.Aborted,
+		},
+		{
+			name: "Delete",
+			call: func(ctx context.Context, client counterv1.CounterServiceClient) (interface{}, error) {
+				return client.DeleteCounter(ctx, &counterv1.DeleteCounterRequest{Id: id.String()})
+			},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("SoftDeleteCounter", mock.Anything, id).Return(int64(1), nil)
+			},
+			expectedCode: codes.OK,
+		},
+		{
+			name: "Delete Storage Failure",
+			call: func(ctx context.Context, client counterv1.CounterServiceClient) (interface{}, error) {
+				return client.DeleteCounter(ctx, &counterv1.DeleteCounterRequest{Id: id.String()})
+			},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("SoftDeleteCounter", mock.Anything, id).Return(int64(0), errors.New("connection refused"))
+			},
+			expectedCode: codes.Internal,
+		},
+		{
+			name: "List",
+			call: func(ctx context.Context, client counterv1.CounterServiceClient) (interface{}, error) {
+				return client.ListCounters(ctx, &counterv1.ListCountersRequest{Ids: []string{id.String()}, Labels: "team=growth", Sort: "value", Descending: true, Limit: 5})
+			},
+			mockFunc: func(mockService *mocks.Service) {
+				query := model.ListCountersQuery{IDs: []uuid.UUID{id}, Labels: "team=growth", SortBy: model.SortByValue, Descending: true, Limit: 5}
+				mockService.On("ListCounters", mock.Anything, query).Return(&model.CounterPage{Counters: []*model.Counter{counter}, NextCursor: "next"}, nil)
+			},
+			expectedCode: codes.OK,
+		},
+		{
+			name: "List Invalid Sort",
+			call: func(ctx context.Context, client counterv1.CounterServiceClient) (interface{}, error) {
+				return client.ListCounters(ctx, &counterv1.ListCountersRequest{Sort: "color"})
+			},
+			mockFunc: func(mockService *mocks.Service) {
+				mockService.On("ListCounters", mock.Anything, model.ListCountersQuery{SortBy: "color"}).Return(nil, service.ErrInvalidSort)
+			},
+			expectedCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockService := new(mocks.Service)
+			tc.mockFunc(mockService)
+			client := dial(t, mockService)
+
+			_, err := tc.call(authorized(t), client)
+
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestServerCounter(t *testing.T) {
+	id := uuid.New()
+	max := int64(10)
+	mockService := new(mocks.Service)
+	mockService.On("GetCounter", mock.Anything, id).Return(&model.Counter{ID: id, Name: "seats", Value: 4, Max: &max, OverflowPolicy: model.OverflowSaturate, Shards: 1, Version: 3}, nil)
+
+	counter, err := dial(t, mockService).GetCounter(authorized(t), &counterv1.GetCounterRequest{Id: id.String()})
+
+	assert.NoError(t, err)
+	assert.Equal(t, id.String(), counter.GetId())
+	assert.Equal(t, int64(4), counter.GetValue())
+	assert.Nil(t, counter.Min)
+	assert.Equal(t, int64(10), counter.GetMax())
+	assert.Equal(t, "saturate", counter.GetOverflowPolicy())
+	assert.Equal(t, int64(3), counter.GetVersion())
+}
+
+func TestServerErrorDetails(t *testing.T) {
+	mockService := new(mocks.Service)
+	mockService.On("CreateCounter", mock.Anything, mock.Anything).
+		Return(nil, validation.Errors{{Field: "name", Err: validation.ErrRequired}})
+
+	_, err := dial(t, mockService).CreateCounter(authorized(t), &counterv1.CreateCounterRequest{})
+
+	st := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+
+	var reason string
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			reason = detail.GetReason()
+		case *errdetails.BadRequest:
+			violations = detail.GetFieldViolations()
+		}
+	}
+	assert.Equal(t, service.CodeValidationFailed, reason)
+	if assert.Len(t, violations, 1) {
+		assert.Equal(t, "name", violations[0].GetField())
+	}
+}
+
+func TestServerUnauthenticated(t *testing.T) {
+	mockService := new(mocks.Service)
+
+	_, err := dial(t, mockService).GetCounter(context.Background(), &counterv1.GetCounterRequest{Id: uuid.NewString()})
+
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	mockService.AssertExpectations(t)
+}
@@ -2,7 +2,12 @@ package main
 
 import (
 	"fmt"
+	"gounter/internal/aggregator"
+	"gounter/internal/repository/embedded"
+	"gounter/internal/service"
 	"os"
+	"strconv"
+	"time"
 	// If you're using godotenv, uncomment the following line
 	// "github.com/joho/godotenv"
 )
@@ -40,3 +45,191 @@ func LoadConfig() (*DBConfig, error) {
 
 	return dbConfig, nil
 }
+
+// Storage backends selectable with STORAGE
+const (
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory"
+	StorageSQLite   = "sqlite"
+	StorageEmbedded = "embedded"
+	StorageRedis    = "redis"
+)
+
+// DefaultSQLitePath is the database file used by the SQLite storage unless SQLITE_PATH is set
+const DefaultSQLitePath = "gounter.db"
+
+// DefaultDataDir is the directory of the embedded storage unless DATA_DIR is set
+const DefaultDataDir = "data"
+
+// DefaultRedisURL is the server of the Redis storage unless REDIS_URL is set
+const DefaultRedisURL = "redis://localhost:6379/0"
+
+// StorageConfig holds the storage backend to use
+type StorageConfig struct {
+	Backend string
+	// SQLitePath is the database file of the SQLite storage
+	SQLitePath string
+	// DataDir holds the log and snapshots of the embedded storage
+	DataDir string
+	// SnapshotInterval is how often the embedded storage takes a snapshot
+	SnapshotInterval time.Duration
+	// RedisURL is the server of the Redis storage
+	RedisURL string
+}
+
+// LoadStorageConfig loads the storage backend from the STORAGE environment
+// variable, Postgres being the default
+func LoadStorageConfig() (*StorageConfig, error) {
+	storageConfig := &StorageConfig{
+		Backend:          StoragePostgres,
+		SQLitePath:       DefaultSQLitePath,
+		DataDir:          DefaultDataDir,
+		SnapshotInterval: embedded.DefaultSnapshotInterval,
+		RedisURL:         DefaultRedisURL,
+	}
+
+	if backend := os.Getenv("STORAGE"); backend != "" {
+		switch backend {
+		case StoragePostgres, StorageMemory, StorageSQLite, StorageEmbedded, StorageRedis:
+			storageConfig.Backend = backend
+		default:
+			return nil, fmt.Errorf("unsupported STORAGE %q", backend)
+		}
+	}
+
+	if path := os.Getenv("SQLITE_PATH"); path != "" {
+		storageConfig.SQLitePath = path
+	}
+
+	if dir := os.Getenv("DATA_DIR"); dir != "" {
+		storageConfig.DataDir = dir
+	}
+
+	if interval := os.Getenv("SNAPSHOT_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid SNAPSHOT_INTERVAL %q", interval)
+		}
+		storageConfig.SnapshotInterval = d
+	}
+
+	if url := os.Getenv("REDIS_URL"); url != "" {
+		storageConfig.RedisURL = url
+	}
+
+	return storageConfig, nil
+}
+
+// ServiceConfig holds the tunables of the counter service
+type ServiceConfig struct {
+	IdempotencyWindow time.Duration
+	// MinuteBucketRetention is how long minute buckets are kept, at least MaxRateWindow
+	MinuteBucketRetention time.Duration
+}
+
+// LoadServiceConfig loads the service configuration from environment variables,
+// falling back to the defaults for the ones that are not set
+func LoadServiceConfig() (*ServiceConfig, error) {
+	serviceConfig := &ServiceConfig{
+		IdempotencyWindow:     service.DefaultIdempotencyWindow,
+		MinuteBucketRetention: service.DefaultMinuteBucketRetention,
+	}
+
+	if window := os.Getenv("IDEMPOTENCY_WINDOW"); window != "" {
+		d, err := time.ParseDuration(window)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid IDEMPOTENCY_WINDOW %q", window)
+		}
+		serviceConfig.IdempotencyWindow = d
+	}
+
+	if retention := os.Getenv("MINUTE_BUCKET_RETENTION"); retention != "" {
+		d, err := time.ParseDuration(retention)
+		if err != nil || d < service.MaxRateWindow {
+			return nil, fmt.Errorf("invalid MINUTE_BUCKET_RETENTION %q, must be at least %s", retention, service.MaxRateWindow)
+		}
+		serviceConfig.MinuteBucketRetention = d
+	}
+
+	return serviceConfig, nil
+}
+
+// AggregatorConfig holds the settings of the optional increment aggregator
+type AggregatorConfig struct {
+	Enabled   bool
+	Interval  time.Duration
+	BatchSize int
+	// CloseTimeout bounds the flush of the last increments on shutdown
+	CloseTimeout time.Duration
+}
+
+// LoadAggregatorConfig loads the aggregator configuration from environment variables,
+// falling back to the defaults for the ones that are not set
+func LoadAggregatorConfig() (*AggregatorConfig, error) {
+	aggregatorConfig := &AggregatorConfig{
+		Interval:     aggregator.DefaultInterval,
+		BatchSize:    aggregator.DefaultBatchSize,
+		CloseTimeout: aggregator.DefaultCloseTimeout,
+	}
+
+	if enabled := os.Getenv("AGGREGATE_INCREMENTS"); enabled != "" {
+		b, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AGGREGATE_INCREMENTS %q", enabled)
+		}
+		aggregatorConfig.Enabled = b
+	}
+
+	if interval := os.Getenv("AGGREGATE_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid AGGREGATE_INTERVAL %q", interval)
+		}
+		aggregatorConfig.Interval = d
+	}
+
+	if size := os.Getenv("AGGREGATE_BATCH_SIZE"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid AGGREGATE_BATCH_SIZE %q", size)
+		}
+		aggregatorConfig.BatchSize = n
+	}
+
+	if timeout := os.Getenv("AGGREGATE_CLOSE_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid AGGREGATE_CLOSE_TIMEOUT %q", timeout)
+		}
+		aggregatorConfig.CloseTimeout = d
+	}
+
+	return aggregatorConfig, nil
+}
+
+// ServerConfig holds the optional features of the HTTP and gRPC servers
+type ServerConfig struct {
+	// DocsPage serves a page rendering the OpenAPI spec at /docs
+	DocsPage bool
+	// GRPCAddr is the address the gRPC API listens on
+	GRPCAddr string
+}
+
+// LoadServerConfig loads the server configuration from environment variables
+func LoadServerConfig() (*ServerConfig, error) {
+	serverConfig := &ServerConfig{GRPCAddr: ":9090"}
+
+	if addr := os.Getenv("GRPC_ADDR"); addr != "" {
+		serverConfig.GRPCAddr = addr
+	}
+
+	if enabled := os.Getenv("DOCS_PAGE"); enabled != "" {
+		b, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DOCS_PAGE %q", enabled)
+		}
+		serverConfig.DocsPage = b
+	}
+
+	return serverConfig, nil
+}
@@ -1,19 +1,32 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"gounter/api/auth"
 	"gounter/api/handler"
+	"gounter/api/idempotency"
+	counterv1 "gounter/api/proto/counter/v1"
 	"gounter/api/route"
-	"gounter/internal/repository"
+	"gounter/api/rpc"
+	"gounter/internal/aggregator"
 	"gounter/internal/service"
 	"gounter/util"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"google.golang.org/grpc"
 )
 
+// bucketPruneInterval is how often the minute buckets past their retention are removed
+const bucketPruneInterval = time.Hour
+
 func main() {
 	token, err := util.GenerateValidJWT()
 	if err != nil {
@@ -21,27 +34,144 @@ func main() {
 	}
 	fmt.Println("Generated JWT token (valid for 5 minutes): ", token)
 
-	config, err := LoadConfig()
+	adminToken, err := util.GenerateAdminJWT()
+	if err != nil {
+		log.Fatalf("Error generating admin JWT token: %v", err)
+	}
+	fmt.Println("Generated admin JWT token (valid for 5 minutes): ", adminToken)
+
+	storageConfig, err := LoadStorageConfig()
+	if err != nil {
+		log.Fatalf("Could not load storage config: %v", err)
+	}
+
+	serviceConfig, err := LoadServiceConfig()
+	if err != nil {
+		log.Fatalf("Could not load service config: %v", err)
+	}
+
+	aggregatorConfig, err := LoadAggregatorConfig()
 	if err != nil {
-		log.Fatalf("Could not load config: %v", err)
+		log.Fatalf("Could not load aggregator config: %v", err)
 	}
 
-	db, err := sqlx.Connect("postgres", fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=disable", config.User, config.Password, config.DBName, config.Host, config.Port))
+	serverConfig, err := LoadServerConfig()
 	if err != nil {
-		log.Fatalln("Failed to connect to database:", err)
+		log.Fatalf("Could not load server config: %v", err)
 	}
 
-	defer db.Close()
+	storage, closeStorage, err := openStorage(storageConfig)
+	if err != nil {
+		log.Fatalln("Failed to open storage:", err)
+	}
+
+	defer closeStorage()
+
+	var incrementAggregator *aggregator.Aggregator
+	if aggregatorConfig.Enabled {
+		flusher, ok := storage.(aggregator.Repository)
+		if !ok {
+			log.Fatalf("Increments cannot be aggregated with %s storage", storageConfig.Backend)
+		}
 
-	counterRepo := repository.New(db)
-	service := service.NewCounterService(counterRepo)
+		incrementAggregator = aggregator.New(flusher,
+			aggregator.WithInterval(aggregatorConfig.Interval),
+			aggregator.WithBatchSize(aggregatorConfig.BatchSize))
+		storage = incrementAggregator
+		log.Printf("Aggregating increments, flushing every %s or %d counters", aggregatorConfig.Interval, aggregatorConfig.BatchSize)
+	}
+
+	service := service.NewCounterService(storage,
+		service.WithIdempotencyWindow(serviceConfig.IdempotencyWindow),
+		service.WithMinuteBucketRetention(serviceConfig.MinuteBucketRetention))
 	counterHandler := handler.NewHandler(service)
 
-	routes := route.InitRoutes(counterHandler)
+	var routeOptions []route.Option
+	if serverConfig.DocsPage {
+		routeOptions = append(routeOptions, route.WithDocsPage())
+	}
+
+	routes := route.InitRoutes(counterHandler, routeOptions...)
+
+	// The requests are cancelled once the server shuts down, so the watch
+	// streams end instead of holding the shutdown until its timeout
+	requests, cancelRequests := context.WithCancel(context.Background())
+	server := &http.Server{
+		Addr:        ":8081",
+		Handler:     routes,
+		BaseContext: func(net.Listener) context.Context { return requests },
+	}
+	server.RegisterOnShutdown(cancelRequests)
 
 	// Start the HTTP server on port 8081
-	log.Println("Starting server on :8081...")
-	if err := http.ListenAndServe(":8081", routes); err != nil {
-		log.Fatal("Error starting server:", err)
+	go func() {
+		log.Println("Starting server on :8081...")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Error starting server:", err)
+		}
+	}()
+
+	// Serve the same counters over gRPC on a separate port
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(auth.UnaryServerInterceptor, idempotency.UnaryServerInterceptor),
+		grpc.StreamInterceptor(auth.StreamServerInterceptor))
+	counterv1.RegisterCounterServiceServer(grpcServer, rpc.NewServer(service))
+
+	listener, err := net.Listen("tcp", serverConfig.GRPCAddr)
+	if err != nil {
+		log.Fatalf("Could not listen on %s: %v", serverConfig.GRPCAddr, err)
+	}
+
+	go func() {
+		log.Printf("Starting gRPC server on %s...", serverConfig.GRPCAddr)
+		if err := grpcServer.Serve(listener); err != nil {
+			log.Fatal("Error starting gRPC server:", err)
+		}
+	}()
+
+	// Drop the minute buckets older than the retention, the hour and day buckets are kept
+	pruning, stopPruning := context.WithCancel(context.Background())
+	defer stopPruning()
+
+	go func() {
+		ticker := time.NewTicker(bucketPruneInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-pruning.Done():
+				return
+			case <-ticker.C:
+				if _, err := service.PruneMinuteBuckets(pruning); err != nil && !errors.Is(err, context.Canceled) {
+					log.Println("Failed to prune minute buckets:", err)
+				}
+			}
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	log.Println("Shutting down...")
+	stopPruning()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("Error shutting down server:", err)
+	}
+	grpcServer.GracefulStop()
+
+	// Write the increments still held in memory once no request can add more.
+	// The server shutdown may have used up its whole timeout, so the flush gets its own.
+	if incrementAggregator != nil {
+		flushCtx, cancelFlush := context.WithTimeout(context.Background(), aggregatorConfig.CloseTimeout)
+		defer cancelFlush()
+
+		if err := incrementAggregator.Close(flushCtx); err != nil {
+			log.Println("Failed to flush increments:", err)
+		}
 	}
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"gounter/internal/repository"
+	"gounter/internal/repository/embedded"
+	"gounter/internal/repository/memory"
+	"gounter/internal/repository/redis"
+	"gounter/internal/repository/sqlite"
+	"gounter/internal/service"
+	"log"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// openStorage opens the configured storage backend. The returned function
+// releases it once the server is done.
+func openStorage(storageConfig *StorageConfig) (service.Repository, func(), error) {
+	switch storageConfig.Backend {
+	case StorageMemory:
+		log.Println("Using in-memory storage, counters are lost when the server stops")
+		return memory.New(), func() {}, nil
+	case StorageSQLite:
+		db, err := sqlite.Open(storageConfig.SQLitePath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open %s: %v", storageConfig.SQLitePath, err)
+		}
+
+		log.Println("Using SQLite storage in", storageConfig.SQLitePath)
+		return sqlite.New(db), func() { db.Close() }, nil
+	case StorageEmbedded:
+		repo, err := embedded.Open(storageConfig.DataDir, embedded.WithSnapshotInterval(storageConfig.SnapshotInterval))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open %s: %v", storageConfig.DataDir, err)
+		}
+
+		log.Println("Using embedded storage in", storageConfig.DataDir)
+		return repo, func() {
+			if err := repo.Close(); err != nil {
+				log.Println("Failed to close storage:", err)
+			}
+		}, nil
+	case StorageRedis:
+		pool := redis.NewPool(storageConfig.RedisURL)
+
+		conn, err := pool.Dial()
+		if err != nil {
+			pool.Close()
+			return nil, nil, fmt.Errorf("failed to connect to redis: %v", err)
+		}
+		conn.Close()
+
+		log.Println("Using Redis storage at", storageConfig.RedisURL)
+		return redis.New(pool), func() { pool.Close() }, nil
+	default:
+		config, err := LoadConfig()
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not load config: %v", err)
+		}
+
+		db, err := sqlx.Connect("postgres", fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=disable", config.User, config.Password, config.DBName, config.Host, config.Port))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to database: %v", err)
+		}
+
+		return repository.New(db), func() { db.Close() }, nil
+	}
+}
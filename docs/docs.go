@@ -0,0 +1,16 @@
+// Package docs embeds the documentation of the HTTP API in the binary
+package docs
+
+import (
+	_ "embed"
+)
+
+// OpenAPI is the OpenAPI 3 description of the HTTP API
+//
+//go:embed swagger.json
+var OpenAPI []byte
+
+// Page renders OpenAPI with Swagger UI, loading the spec from /openapi.json
+//
+//go:embed index.html
+var Page []byte
@@ -0,0 +1,3 @@
+DROP INDEX counter_deleted_at_idx;
+
+ALTER TABLE counter DROP COLUMN deleted_at;
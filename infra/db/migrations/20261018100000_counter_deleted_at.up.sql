@@ -0,0 +1,3 @@
+ALTER TABLE counter ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX counter_deleted_at_idx ON counter (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE counter ALTER COLUMN value TYPE INTEGER;
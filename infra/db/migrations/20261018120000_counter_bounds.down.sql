@@ -0,0 +1,6 @@
+ALTER TABLE counter
+    DROP CONSTRAINT counter_bounds_check,
+    DROP CONSTRAINT counter_overflow_policy_check,
+    DROP COLUMN overflow_policy,
+    DROP COLUMN max_value,
+    DROP COLUMN min_value;
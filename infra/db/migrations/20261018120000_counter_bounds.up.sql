@@ -0,0 +1,6 @@
+ALTER TABLE counter
+    ADD COLUMN min_value BIGINT,
+    ADD COLUMN max_value BIGINT,
+    ADD COLUMN overflow_policy TEXT NOT NULL DEFAULT 'reject',
+    ADD CONSTRAINT counter_overflow_policy_check CHECK (overflow_policy IN ('reject', 'saturate')),
+    ADD CONSTRAINT counter_bounds_check CHECK (min_value IS NULL OR max_value IS NULL OR min_value <= max_value);
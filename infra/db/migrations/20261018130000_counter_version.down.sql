@@ -0,0 +1 @@
+ALTER TABLE counter DROP COLUMN version;
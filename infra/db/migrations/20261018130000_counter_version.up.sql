@@ -0,0 +1 @@
+ALTER TABLE counter ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,11 @@
+CREATE TABLE counter_events (
+    id BIGSERIAL PRIMARY KEY,
+    counter_id UUID NOT NULL REFERENCES counter (id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    delta BIGINT NOT NULL,
+    value BIGINT NOT NULL,
+    subject TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX counter_events_counter_id_id_idx ON counter_events (counter_id, id);
@@ -0,0 +1,8 @@
+CREATE TABLE counter_buckets (
+    counter_id UUID NOT NULL REFERENCES counter (id) ON DELETE CASCADE,
+    granularity TEXT NOT NULL,
+    bucket_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    delta BIGINT NOT NULL DEFAULT 0,
+    increments BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (counter_id, granularity, bucket_start)
+);
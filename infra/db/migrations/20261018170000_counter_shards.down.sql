@@ -0,0 +1,20 @@
+-- Fold the per shard buckets back into a single row per bucket
+ALTER TABLE counter_buckets DROP CONSTRAINT counter_buckets_pkey;
+WITH removed AS (
+    DELETE FROM counter_buckets RETURNING *
+)
+INSERT INTO counter_buckets (counter_id, granularity, bucket_start, delta, increments)
+SELECT counter_id, granularity, bucket_start, SUM(delta), SUM(increments)
+FROM removed
+GROUP BY counter_id, granularity, bucket_start;
+ALTER TABLE counter_buckets DROP COLUMN shard;
+ALTER TABLE counter_buckets ADD PRIMARY KEY (counter_id, granularity, bucket_start);
+
+-- Fold the shards back into the counter value
+UPDATE counter
+SET value = counter.value + totals.value
+FROM (SELECT counter_id, SUM(value) AS value FROM counter_shards GROUP BY counter_id) totals
+WHERE counter.id = totals.counter_id;
+
+DROP TABLE counter_shards;
+ALTER TABLE counter DROP COLUMN shards;
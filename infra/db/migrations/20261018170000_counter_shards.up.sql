@@ -0,0 +1,13 @@
+ALTER TABLE counter ADD COLUMN shards INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE counter_shards (
+    counter_id UUID NOT NULL REFERENCES counter (id) ON DELETE CASCADE,
+    shard INTEGER NOT NULL,
+    value BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (counter_id, shard)
+);
+
+-- Buckets of sharded counters are tallied per shard too, so they do not bring the contention back
+ALTER TABLE counter_buckets ADD COLUMN shard INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE counter_buckets DROP CONSTRAINT counter_buckets_pkey;
+ALTER TABLE counter_buckets ADD PRIMARY KEY (counter_id, granularity, bucket_start, shard);
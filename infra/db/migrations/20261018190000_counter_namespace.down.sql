@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS counter_namespace_name_key;
+
+ALTER TABLE counter DROP COLUMN IF EXISTS namespace;
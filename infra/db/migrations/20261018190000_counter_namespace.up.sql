@@ -0,0 +1,5 @@
+-- Names are only unique among the live counters of a namespace, counters
+-- without a namespace keep the names they had
+ALTER TABLE counter ADD COLUMN namespace TEXT;
+
+CREATE UNIQUE INDEX counter_namespace_name_key ON counter (namespace, name) WHERE namespace IS NOT NULL AND deleted_at IS NULL;
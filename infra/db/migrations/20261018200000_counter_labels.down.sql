@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS counter_labels_idx;
+
+ALTER TABLE counter
+    DROP COLUMN IF EXISTS unit,
+    DROP COLUMN IF EXISTS description,
+    DROP COLUMN IF EXISTS labels;
@@ -0,0 +1,6 @@
+ALTER TABLE counter
+    ADD COLUMN labels JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN description TEXT NOT NULL DEFAULT '',
+    ADD COLUMN unit TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX counter_labels_idx ON counter USING GIN (labels);
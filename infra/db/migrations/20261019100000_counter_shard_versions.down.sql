@@ -0,0 +1,8 @@
+-- Fold the writes counted by the shards back into the counter version
+UPDATE counter
+SET version = counter.version + totals.version
+FROM (SELECT counter_id, SUM(version) AS version FROM counter_shards GROUP BY counter_id) totals
+WHERE counter.id = totals.counter_id;
+
+ALTER TABLE counter_shards DROP COLUMN updated_at;
+ALTER TABLE counter_shards DROP COLUMN version;
@@ -0,0 +1,4 @@
+-- Shards count their own writes, so increments of sharded counters bump the
+-- version of the counter without locking its row
+ALTER TABLE counter_shards ADD COLUMN version BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE counter_shards ADD COLUMN updated_at TIMESTAMP WITH TIME ZONE;
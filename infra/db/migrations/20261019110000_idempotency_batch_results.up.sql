@@ -0,0 +1,2 @@
+-- Batches save the outcome of every operation under their idempotency key
+ALTER TABLE idempotency_keys ADD COLUMN results JSONB;
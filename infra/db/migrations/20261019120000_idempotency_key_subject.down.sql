@@ -0,0 +1,9 @@
+-- Keep the latest record of the keys used by several subjects
+DELETE FROM idempotency_keys older
+USING idempotency_keys newer
+WHERE older.key = newer.key
+    AND (older.created_at, older.subject) < (newer.created_at, newer.subject);
+
+ALTER TABLE idempotency_keys DROP CONSTRAINT idempotency_keys_pkey;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (key);
+ALTER TABLE idempotency_keys DROP COLUMN subject;
@@ -0,0 +1,4 @@
+-- Idempotency keys are chosen by the clients, so each subject gets its own
+ALTER TABLE idempotency_keys ADD COLUMN subject TEXT NOT NULL DEFAULT '';
+ALTER TABLE idempotency_keys DROP CONSTRAINT idempotency_keys_pkey;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (subject, key);
@@ -0,0 +1,2 @@
+-- Old minute buckets are pruned by start, across every counter
+CREATE INDEX counter_buckets_granularity_start_idx ON counter_buckets (granularity, bucket_start);
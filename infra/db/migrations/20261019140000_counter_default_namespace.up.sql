@@ -0,0 +1,12 @@
+-- Counters created without a namespace now go to the default one. The older
+-- ones join it unless another live counter already has their name there.
+UPDATE counter SET namespace = 'default'
+WHERE namespace IS NULL AND deleted_at IS NULL AND NOT EXISTS (
+    SELECT 1 FROM counter other
+    WHERE other.name = counter.name AND other.id <> counter.id AND other.deleted_at IS NULL
+        AND (other.namespace IS NULL OR other.namespace = 'default')
+);
+
+DROP INDEX IF EXISTS counter_namespace_name_key;
+
+CREATE UNIQUE INDEX counter_namespace_name_key ON counter (namespace, name) WHERE deleted_at IS NULL;
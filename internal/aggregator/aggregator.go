@@ -0,0 +1,538 @@
+// Package aggregator coalesces counter increments in memory and writes them to
+// the wrapped repository in batches, trading a little durability for far fewer
+// database round trips.
+package aggregator
+
+import (
+	"context"
+	"gounter/internal/model"
+	"gounter/internal/service"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultInterval is how often pending increments are flushed
+	DefaultInterval = time.Second
+	// DefaultBatchSize is the number of counters with pending increments that triggers
+	// a flush before the interval is up, and the most counters written by one transaction
+	DefaultBatchSize = 500
+	// DefaultCloseTimeout is how long writing the last increments may take on shutdown
+	DefaultCloseTimeout = 10 * time.Second
+)
+
+// Repository is the storage the aggregator writes through to
+type Repository interface {
+	service.Repository
+	FlushIncrements(ctx context.Context, increments []model.CoalescedIncrement) ([]*model.Counter, error)
+}
+
+// pendingIncrement is the sum of the increments of a counter not written yet
+type pendingIncrement struct {
+	delta int64
+	count int64
+	// bySubject holds the sums of each subject, in the order the subjects first
+	// incremented the counter, so the history keeps who made the increments
+	bySubject []model.CoalescedIncrement
+}
+
+// add adds increments of a subject to the pending ones
+func (p *pendingIncrement) add(increment model.CoalescedIncrement) {
+	p.delta += increment.Delta
+	p.count += increment.Count
+
+	for i := range p.bySubject {
+		if p.bySubject[i].Subject == increment.Subject {
+			p.bySubject[i].Delta += increment.Delta
+			p.bySubject[i].Count += increment.Count
+			return
+		}
+	}
+	p.bySubject = append(p.bySubject, increment)
+}
+
+// Aggregator implements service.Repository on top of another repository.
+// Increments of unbounded counters are summed per counter in memory and
+// flushed on an interval or when enough counters have pending increments.
+// Increments of bounded counters, and the ones carrying an idempotency record,
+// go straight to the repository since they need the stored value.
+// Reads add the pending increments to the stored values, and bump the version
+// once per pending increment, as the flush will.
+type Aggregator struct {
+	repo      Repository
+	interval  time.Duration
+	batchSize int
+
+	// flushing is held for writing while a batch is written, reads from the
+	// repository hold it for reading so they never count a batch twice
+	flushing sync.RWMutex
+
+	mu sync.Mutex
+	// counters holds the last known state of the counters with pending
+	// increments, used to answer increments without a read. A counter is
+	// evicted once its increments are flushed, so the map stays within the
+	// batch size.
+	counters map[uuid.UUID]*model.Counter
+	pending  map[uuid.UUID]*pendingIncrement
+	// inflight holds the batch being flushed
+	inflight map[uuid.UUID]*pendingIncrement
+	// dropped counts the increments flushed to counters that were gone
+	dropped int64
+	closed  bool
+
+	full chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+var _ service.Repository = (*Aggregator)(nil)
+
+// Option configures optional behaviour of the aggregator
+type Option func(*Aggregator)
+
+// WithInterval sets how often pending increments are flushed
+func WithInterval(interval time.Duration) Option {
+	return func(a *Aggregator) {
+		a.interval = interval
+	}
+}
+
+// WithBatchSize sets the number of counters with pending increments that triggers a flush
+func WithBatchSize(size int) Option {
+	return func(a *Aggregator) {
+		a.batchSize = size
+	}
+}
+
+// New creates an aggregator in front of repo and starts flushing in the background.
+// Close must be called to flush the last increments.
+func New(repo Repository, opts ...Option) *Aggregator {
+	a := &Aggregator{
+		repo:      repo,
+		interval:  DefaultInterval,
+		batchSize: DefaultBatchSize,
+		counters:  map[uuid.UUID]*model.Counter{},
+		pending:   map[uuid.UUID]*pendingIncrement{},
+		full:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	go a.run()
+
+	return a
+}
+
+// run flushes the pending increments until the aggregator is closed
+func (a *Aggregator) run() {
+	defer close(a.done)
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-a.full:
+		case <-a.stop:
+			return
+		}
+
+		if err := a.Flush(context.Background()); err != nil {
+			log.Println("Failed to flush increments:", err)
+		}
+	}
+}
+
+// Close stops the background flushing and flushes the pending increments.
+// Increments made after Close go straight to the repository.
+func (a *Aggregator) Close(ctx context.Context) error {
+	a.mu.Lock()
+	closed := a.closed
+	a.closed = true
+	a.mu.Unlock()
+
+	if !closed {
+		close(a.stop)
+		<-a.done
+	}
+
+	return a.Flush(ctx)
+}
+
+// Flush writes the pending increments to the repository, in batches of at most
+// the batch size counters. Increments that could not be written stay pending.
+// The increments of counters the repository no longer increments, because
+// they were deleted or bounded meanwhile, are dropped and logged.
+func (a *Aggregator) Flush(ctx context.Context) error {
+	a.flushing.Lock()
+	defer a.flushing.Unlock()
+
+	a.mu.Lock()
+	batch := a.pending
+	a.pending = map[uuid.UUID]*pendingIncrement{}
+	a.inflight = batch
+	a.mu.Unlock()
+
+	ids := make([]uuid.UUID, 0, len(batch))
+	for id := range batch {
+		ids = append(ids, id)
+	}
+
+	var (
+		flushed []*model.Counter
+		err     error
+	)
+	for len(ids) > 0 {
+		size := a.batchSize
+		if size <= 0 || size > len(ids) {
+			size = len(ids)
+		}
+
+		var increments []model.CoalescedIncrement
+		for _, id := range ids[:size] {
+			increments = append(increments, batch[id].bySubject...)
+		}
+
+		var counters []*model.Counter
+		if counters, err = a.repo.FlushIncrements(ctx, increments); err != nil {
+			break
+		}
+
+		flushed = append(flushed, counters...)
+		ids = ids[size:]
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.inflight = nil
+
+	// Keep what was not written for the next flush
+	for _, id := range ids {
+		for _, increment := range batch[id].bySubject {
+			pendingFor(a.pending, id).add(increment)
+		}
+		delete(batch, id)
+	}
+
+	// The counters written have nothing pending anymore, the increments of the
+	// others were acknowledged but cannot be written
+	for _, counter := range flushed {
+		delete(batch, counter.ID)
+		delete(a.counters, counter.ID)
+	}
+	for id, p := range batch {
+		log.Printf("Dropped %d increments of counter %s summing to %d: the counter was deleted or bounded before they were flushed", p.count, id, p.delta)
+		a.dropped += p.count
+		delete(a.counters, id)
+	}
+
+	return err
+}
+
+// pendingFor returns the pending increments of the counter in the batch, adding them when missing
+func pendingFor(batch map[uuid.UUID]*pendingIncrement, id uuid.UUID) *pendingIncrement {
+	p, ok := batch[id]
+	if !ok {
+		p = &pendingIncrement{}
+		batch[id] = p
+	}
+
+	return p
+}
+
+// Dropped returns the number of acknowledged increments that were dropped by
+// a flush because their counter could no longer be incremented
+func (a *Aggregator) Dropped() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.dropped
+}
+
+// withPending returns a copy of the stored counter with its pending increments
+// added, and its version bumped by the number of increments pending, so every
+// coalesced increment gets the version, and the ETag, the counter will have
+// once flushed. It must be called with mu held.
+func (a *Aggregator) withPending(counter *model.Counter) *model.Counter {
+	result := *counter
+
+	if p, ok := a.pending[counter.ID]; ok {
+		result.Value += p.delta
+		result.Version += p.count
+	}
+	if p, ok := a.inflight[counter.ID]; ok {
+		result.Value += p.delta
+		result.Version += p.count
+	}
+
+	return &result
+}
+
+// through runs a write or a read of a single counter on the repository,
+// remembers the stored counter and returns it with its pending increments added
+func (a *Aggregator) through(fn func() (*model.Counter, error)) (*model.Counter, error) {
+	a.flushing.RLock()
+	defer a.flushing.RUnlock()
+
+	return a.remember(fn())
+}
+
+// remember refreshes the stored counter when it has pending increments, and
+// returns it with its pending increments added. Counters with nothing pending
+// are not kept. It must be called with flushing held for reading.
+func (a *Aggregator) remember(counter *model.Counter, err error) (*model.Counter, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.pending[counter.ID]; ok {
+		a.counters[counter.ID] = counter
+	}
+
+	return a.withPending(counter), nil
+}
+
+// CreateCounter creates the counter in the repository
+func (a *Aggregator) CreateCounter(ctx context.Context, params model.CreateCounterParams) (*model.Counter, error) {
+	return a.through(func() (*model.Counter, error) {
+		return a.repo.CreateCounter(ctx, params)
+	})
+}
+
+// GetCounter reads the counter from the repository and adds its pending increments
+func (a *Aggregator) GetCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
+	return a.through(func() (*model.Counter, error) {
+		return a.repo.GetCounter(ctx, id)
+	})
+}
+
+// GetCounterByName reads the named counter from the repository and adds its pending increments
+func (a *Aggregator) GetCounterByName(ctx context.Context, namespace, name string) (*model.Counter, error) {
+	return a.through(func() (*model.Counter, error) {
+		return a.repo.GetCounterByName(ctx, namespace, name)
+	})
+}
+
+// ListCounters lists the counters from the repository and adds their pending increments
+func (a *Aggregator) ListCounters(ctx context.Context, filter model.CounterFilter) ([]*model.Counter, error) {
+	a.flushing.RLock()
+	defer a.flushing.RUnlock()
+
+	counters, err := a.repo.ListCounters(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i, counter := range counters {
+		counters[i] = a.withPending(counter)
+	}
+
+	return counters, nil
+}
+
+// IncrementCounter adds delta to the pending increments of an unbounded
+// counter and returns the counter as it will be once flushed. Other counters
+// are incremented in the repository right away.
+func (a *Aggregator) IncrementCounter(ctx context.Context, id uuid.UUID, delta int64) (*model.Counter, error) {
+	// The result has to be saved along with the change, which cannot wait for a flush
+	if _, ok := model.IdempotencyRecordFromContext(ctx); ok {
+		return a.incrementThrough(ctx, id, delta)
+	}
+
+	// No flush may run between reading the stored counter and adding to its
+	// pending increments, or the read would miss the increments flushed
+	a.flushing.RLock()
+	defer a.flushing.RUnlock()
+
+	a.mu.Lock()
+	counter, known := a.counters[id]
+	closed := a.closed
+	a.mu.Unlock()
+
+	if closed {
+		return a.remember(a.repo.IncrementCounter(ctx, id, delta))
+	}
+
+	if !known {
+		// Learn whether the counter exists and is bounded
+		var err error
+		if counter, err = a.repo.GetCounter(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	if counter.Min != nil || counter.Max != nil {
+		return a.remember(a.repo.IncrementCounter(ctx, id, delta))
+	}
+
+	subject, _ := model.SubjectFromContext(ctx)
+
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return a.remember(a.repo.IncrementCounter(ctx, id, delta))
+	}
+
+	pendingFor(a.pending, id).add(model.CoalescedIncrement{CounterID: id, Delta: delta, Count: 1, Subject: subject})
+
+	// Another increment may have read the counter meanwhile
+	if stored, ok := a.counters[id]; ok {
+		counter = stored
+	} else {
+		a.counters[id] = counter
+	}
+	result := a.withPending(counter)
+	full := len(a.pending) >= a.batchSize
+	a.mu.Unlock()
+
+	if full {
+		select {
+		case a.full <- struct{}{}:
+		default:
+		}
+	}
+
+	return result, nil
+}
+
+// incrementThrough increments the counter in the repository right away
+func (a *Aggregator) incrementThrough(ctx context.Context, id uuid.UUID, delta int64) (*model.Counter, error) {
+	return a.through(func() (*model.Counter, error) {
+		return a.repo.IncrementCounter(ctx, id, delta)
+	})
+}
+
+// SetCounter flushes the pending increments, which happened before the new
+// value was set, and sets the counter in the repository
+func (a *Aggregator) SetCounter(ctx context.Context, id uuid.UUID, value int64, expectedVersion int64) (*model.Counter, error) {
+	if err := a.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	return a.through(func() (*model.Counter, error) {
+		return a.repo.SetCounter(ctx, id, value, expectedVersion)
+	})
+}
+
+// UpdateCounter changes the metadata of the counter in the repository, which
+// leaves its pending increments alone
+func (a *Aggregator) UpdateCounter(ctx context.Context, id uuid.UUID, params model.UpdateCounterParams) (*model.Counter, error) {
+	return a.through(func() (*model.Counter, error) {
+		return a.repo.UpdateCounter(ctx, id, params)
+	})
+}
+
+// SoftDeleteCounter flushes the pending increments and deletes the counter in the repository
+func (a *Aggregator) SoftDeleteCounter(ctx context.Context, id uuid.UUID) (int64, error) {
+	if err := a.Flush(ctx); err != nil {
+		return 0, err
+	}
+
+	a.flushing.RLock()
+	defer a.flushing.RUnlock()
+
+	rowsAffected, err := a.repo.SoftDeleteCounter(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	a.mu.Lock()
+	delete(a.counters, id)
+	a.mu.Unlock()
+
+	return rowsAffected, nil
+}
+
+// ApplyBatch flushes the pending increments and applies the batch in the
+// repository, when it supports batches. The increments of the batch are not coalesced.
+func (a *Aggregator) ApplyBatch(ctx context.Context, ops []model.BatchOperation, atomic bool) ([]model.BatchResult, error) {
+	repo, ok := a.repo.(service.BatchRepository)
+	if !ok {
+		return nil, service.ErrBatchUnsupported
+	}
+
+	if err := a.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	a.flushing.RLock()
+	defer a.flushing.RUnlock()
+
+	results, err := repo.ApplyBatch(ctx, ops, atomic)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i, result := range results {
+		if result.Err != nil {
+			continue
+		}
+
+		if ops[i].Type == model.BatchDelete {
+			delete(a.counters, ops[i].CounterID)
+			continue
+		}
+
+		if _, ok := a.pending[result.Counter.ID]; ok {
+			a.counters[result.Counter.ID] = result.Counter
+		}
+		results[i].Counter = a.withPending(result.Counter)
+	}
+
+	return results, nil
+}
+
+// RestoreCounter restores the counter in the repository
+func (a *Aggregator) RestoreCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
+	return a.through(func() (*model.Counter, error) {
+		return a.repo.RestoreCounter(ctx, id)
+	})
+}
+
+// PurgeDeletedCounters purges the counters in the repository
+func (a *Aggregator) PurgeDeletedCounters(ctx context.Context, before time.Time) (int64, error) {
+	return a.repo.PurgeDeletedCounters(ctx, before)
+}
+
+// GetIdempotencyRecord reads the record from the repository
+func (a *Aggregator) GetIdempotencyRecord(ctx context.Context, subject, key string, since time.Time) (*model.IdempotencyRecord, error) {
+	return a.repo.GetIdempotencyRecord(ctx, subject, key, since)
+}
+
+// ListCounterEvents reads the history from the repository, which only holds flushed increments
+func (a *Aggregator) ListCounterEvents(ctx context.Context, filter model.CounterEventFilter) ([]*model.CounterEvent, error) {
+	return a.repo.ListCounterEvents(ctx, filter)
+}
+
+// ListCounterBuckets reads the buckets from the repository, which only hold flushed increments
+func (a *Aggregator) ListCounterBuckets(ctx context.Context, id uuid.UUID, granularity model.Granularity, from, to time.Time) ([]*model.CounterBucket, error) {
+	return a.repo.ListCounterBuckets(ctx, id, granularity, from, to)
+}
+
+// SumCounterBuckets reads the buckets from the repository, which only hold flushed increments
+func (a *Aggregator) SumCounterBuckets(ctx context.Context, ids []uuid.UUID, granularity model.Granularity, from, to time.Time) ([]*model.CounterBucket, error) {
+	return a.repo.SumCounterBuckets(ctx, ids, granularity, from, to)
+}
+
+// PruneCounterBuckets prunes the buckets in the repository
+func (a *Aggregator) PruneCounterBuckets(ctx context.Context, granularity model.Granularity, before time.Time) (int64, error) {
+	return a.repo.PruneCounterBuckets(ctx, granularity, before)
+}
@@ -0,0 +1,371 @@
+package aggregator_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"gounter/internal/aggregator"
+	"gounter/internal/model"
+	"gounter/test/mocks"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newAggregator returns an aggregator that only flushes when told to
+func newAggregator(t *testing.T, repo *mocks.Repository, opts ...aggregator.Option) *aggregator.Aggregator {
+	a := aggregator.New(repo, append([]aggregator.Option{aggregator.WithInterval(time.Hour)}, opts...)...)
+	t.Cleanup(func() {
+		_ = a.Close(context.TODO())
+	})
+
+	return a
+}
+
+func TestAggregatorCoalescesIncrements(t *testing.T) {
+	id := uuid.New()
+	repo := &mocks.Repository{}
+	repo.On("GetCounter", mock.Anything, id).
+		Return(&model.Counter{ID: id, Value: 10, Version: 4}, nil).Once()
+
+	a := newAggregator(t, repo)
+	ctx := model.WithSubject(context.TODO(), "producer")
+
+	// Every increment gets the version the counter will have once flushed
+	counter, err := a.IncrementCounter(ctx, id, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(11), counter.Value)
+	require.Equal(t, int64(5), counter.Version)
+
+	counter, err = a.IncrementCounter(ctx, id, 2)
+	require.NoError(t, err)
+	require.Equal(t, int64(13), counter.Value)
+	require.Equal(t, int64(6), counter.Version)
+
+	// Reads see the pending increments
+	repo.On("GetCounter", mock.Anything, id).
+		Return(&model.Counter{ID: id, Value: 10, Version: 4}, nil).Once()
+	counter, err = a.GetCounter(context.TODO(), id)
+	require.NoError(t, err)
+	require.Equal(t, int64(13), counter.Value)
+	require.Equal(t, int64(6), counter.Version)
+
+	repo.On("ListCounters", mock.Anything, model.CounterFilter{Limit: 10}).
+		Return([]*model.Counter{{ID: id, Value: 10}, {ID: uuid.New(), Value: 5}}, nil)
+	counters, err := a.ListCounters(context.TODO(), model.CounterFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, int64(13), counters[0].Value)
+	require.Equal(t, int64(5), counters[1].Value)
+
+	repo.On("FlushIncrements", mock.Anything, []model.CoalescedIncrement{{CounterID: id, Delta: 3, Count: 2, Subject: "producer"}}).
+		Return([]*model.Counter{{ID: id, Value: 13, Version: 6}}, nil).Once()
+	require.NoError(t, a.Flush(context.TODO()))
+
+	// Once flushed, the stored value already holds the increments
+	repo.On("GetCounter", mock.Anything, id).
+		Return(&model.Counter{ID: id, Value: 13, Version: 6}, nil).Once()
+	counter, err = a.GetCounter(context.TODO(), id)
+	require.NoError(t, err)
+	require.Equal(t, int64(13), counter.Value)
+	require.Equal(t, int64(6), counter.Version)
+
+	// Nothing left to flush
+	require.NoError(t, a.Flush(context.TODO()))
+
+	// The flushed counter was forgotten, so the next increment reads it again
+	repo.On("GetCounter", mock.Anything, id).
+		Return(&model.Counter{ID: id, Value: 13, Version: 6}, nil).Once()
+	counter, err = a.IncrementCounter(ctx, id, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(14), counter.Value)
+	require.Equal(t, int64(7), counter.Version)
+
+	repo.On("FlushIncrements", mock.Anything, []model.CoalescedIncrement{{CounterID: id, Delta: 1, Count: 1, Subject: "producer"}}).
+		Return([]*model.Counter{{ID: id, Value: 14, Version: 7}}, nil).Once()
+	require.NoError(t, a.Flush(context.TODO()))
+
+	repo.AssertExpectations(t)
+}
+
+func TestAggregatorIncrementCounter(t *testing.T) {
+	max := int64(100)
+
+	tests := []struct {
+		name          string
+		setupMock     func(repo *mocks.Repository, id uuid.UUID)
+		ctx           context.Context
+		expectedValue int64
+		expectedError error
+	}{
+		{
+			name: "bounded counters are incremented right away",
+			setupMock: func(repo *mocks.Repository, id uuid.UUID) {
+				repo.On("GetCounter", mock.Anything, id).
+					Return(&model.Counter{ID: id, Value: 10, Max: &max}, nil)
+				repo.On("IncrementCounter", mock.Anything, id, int64(5)).
+					Return(&model.Counter{ID: id, Value: 15, Max: &max}, nil)
+			},
+			ctx:           context.TODO(),
+			expectedValue: 15,
+		},
+		{
+			name: "idempotent increments are incremented right away",
+			setupMock: func(repo *mocks.Repository, id uuid.UUID) {
+				repo.On("IncrementCounter", mock.Anything, id, int64(5)).
+					Return(&model.Counter{ID: id, Value: 15}, nil)
+			},
+			ctx:           model.WithIdempotencyRecord(context.TODO(), &model.IdempotencyRecord{Key: "key-1"}),
+			expectedValue: 15,
+		},
+		{
+			name: "unknown counter",
+			setupMock: func(repo *mocks.Repository, id uuid.UUID) {
+				repo.On("GetCounter", mock.Anything, id).
+					Return(nil, sql.ErrNoRows)
+			},
+			ctx:           context.TODO(),
+			expectedError: sql.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := uuid.New()
+			repo := &mocks.Repository{}
+			tt.setupMock(repo, id)
+
+			a := newAggregator(t, repo)
+
+			counter, err := a.IncrementCounter(tt.ctx, id, 5)
+
+			// Validate the results
+			if tt.expectedError != nil {
+				require.Equal(t, tt.expectedError, err)
+				require.Nil(t, counter)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tt.expectedValue, counter.Value)
+			}
+
+			// Nothing was left pending
+			require.NoError(t, a.Flush(context.TODO()))
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAggregatorKeepsIncrementsWhenFlushFails(t *testing.T) {
+	id := uuid.New()
+	repo := &mocks.Repository{}
+	repo.On("GetCounter", mock.Anything, id).
+		Return(&model.Counter{ID: id, Value: 10}, nil)
+
+	a := newAggregator(t, repo)
+
+	_, err := a.IncrementCounter(context.TODO(), id, 2)
+	require.NoError(t, err)
+
+	repo.On("FlushIncrements", mock.Anything, []model.CoalescedIncrement{{CounterID: id, Delta: 2, Count: 1}}).
+		Return(nil, sql.ErrConnDone).Once()
+	require.Equal(t, sql.ErrConnDone, a.Flush(context.TODO()))
+
+	counter, err := a.GetCounter(context.TODO(), id)
+	require.NoError(t, err)
+	require.Equal(t, int64(12), counter.Value)
+
+	// Increments from another subject are kept apart, so each keeps its own history event
+	_, err = a.IncrementCounter(model.WithSubject(context.TODO(), "producer"), id, 3)
+	require.NoError(t, err)
+	_, err = a.IncrementCounter(context.TODO(), id, 1)
+	require.NoError(t, err)
+
+	repo.On("FlushIncrements", mock.Anything, []model.CoalescedIncrement{{CounterID: id, Delta: 3, Count: 2}, {CounterID: id, Delta: 3, Count: 1, Subject: "producer"}}).
+		Return([]*model.Counter{{ID: id, Value: 15}}, nil).Once()
+	require.NoError(t, a.Flush(context.TODO()))
+
+	repo.AssertExpectations(t)
+}
+
+func TestAggregatorReportsDroppedIncrements(t *testing.T) {
+	id := uuid.New()
+	repo := &mocks.Repository{}
+	repo.On("GetCounter", mock.Anything, id).
+		Return(&model.Counter{ID: id, Value: 10}, nil).Once()
+
+	a := newAggregator(t, repo)
+
+	_, err := a.IncrementCounter(context.TODO(), id, 2)
+	require.NoError(t, err)
+	_, err = a.IncrementCounter(context.TODO(), id, 3)
+	require.NoError(t, err)
+
+	// The counter was deleted before the flush, so the repository updates nothing
+	repo.On("FlushIncrements", mock.Anything, []model.CoalescedIncrement{{CounterID: id, Delta: 5, Count: 2}}).
+		Return([]*model.Counter{}, nil).Once()
+	require.NoError(t, a.Flush(context.TODO()))
+	require.Equal(t, int64(2), a.Dropped())
+
+	// Nothing is left pending
+	require.NoError(t, a.Flush(context.TODO()))
+
+	repo.AssertExpectations(t)
+}
+
+func TestAggregatorFlushesBeforeOverwrites(t *testing.T) {
+	id := uuid.New()
+	repo := &mocks.Repository{}
+	repo.On("GetCounter", mock.Anything, id).
+		Return(&model.Counter{ID: id, Value: 10}, nil).Once()
+
+	a := newAggregator(t, repo)
+
+	_, err := a.IncrementCounter(context.TODO(), id, 2)
+	require.NoError(t, err)
+
+	flush := repo.On("FlushIncrements", mock.Anything, []model.CoalescedIncrement{{CounterID: id, Delta: 2, Count: 1}}).
+		Return([]*model.Counter{{ID: id, Value: 12, Version: 2}}, nil).Once()
+	repo.On("SetCounter", mock.Anything, id, int64(0), int64(2)).
+		Return(&model.Counter{ID: id, Value: 0, Version: 3}, nil).Once().NotBefore(flush)
+
+	counter, err := a.SetCounter(context.TODO(), id, 0, 2)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), counter.Value)
+
+	// The counter set has nothing pending, it is read again before being incremented
+	repo.On("GetCounter", mock.Anything, id).
+		Return(&model.Counter{ID: id, Value: 0, Version: 3}, nil).Once()
+	counter, err = a.IncrementCounter(context.TODO(), id, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), counter.Value)
+
+	flush = repo.On("FlushIncrements", mock.Anything, []model.CoalescedIncrement{{CounterID: id, Delta: 1, Count: 1}}).
+		Return([]*model.Counter{{ID: id, Value: 1, Version: 4}}, nil).Once()
+	repo.On("SoftDeleteCounter", mock.Anything, id).
+		Return(int64(1), nil).Once().NotBefore(flush)
+
+	rowsAffected, err := a.SoftDeleteCounter(context.TODO(), id)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), rowsAffected)
+
+	// Deleted counters are read again before being incremented
+	repo.On("GetCounter", mock.Anything, id).
+		Return(nil, sql.ErrNoRows).Once()
+	_, err = a.IncrementCounter(context.TODO(), id, 1)
+	require.Equal(t, sql.ErrNoRows, err)
+
+	repo.AssertExpectations(t)
+}
+
+func TestAggregatorFlushesBeforeBatches(t *testing.T) {
+	id, deleted := uuid.New(), uuid.New()
+	repo := &mocks.Repository{}
+	repo.On("GetCounter", mock.Anything, id).
+		Return(&model.Counter{ID: id, Value: 10}, nil).Once()
+
+	a := newAggregator(t, repo)
+
+	_, err := a.IncrementCounter(context.TODO(), id, 2)
+	require.NoError(t, err)
+
+	ops := []model.BatchOperation{
+		{Type: model.BatchIncrement, CounterID: id, Delta: 5},
+		{Type: model.BatchDelete, CounterID: deleted},
+	}
+
+	flush := repo.On("FlushIncrements", mock.Anything, []model.CoalescedIncrement{{CounterID: id, Delta: 2, Count: 1}}).
+		Return([]*model.Counter{{ID: id, Value: 12, Version: 2}}, nil).Once()
+	repo.On("ApplyBatch", mock.Anything, ops, true).
+		Return([]model.BatchResult{{Counter: &model.Counter{ID: id, Value: 17, Version: 3}}, {}}, nil).Once().NotBefore(flush)
+
+	results, err := a.ApplyBatch(context.TODO(), ops, true)
+	require.NoError(t, err)
+	require.Equal(t, int64(17), results[0].Counter.Value)
+	require.Nil(t, results[1].Counter)
+
+	// The counter of the batch has nothing pending, it is read again before being incremented
+	repo.On("GetCounter", mock.Anything, id).
+		Return(&model.Counter{ID: id, Value: 17, Version: 3}, nil).Once()
+	counter, err := a.IncrementCounter(context.TODO(), id, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(18), counter.Value)
+
+	repo.On("FlushIncrements", mock.Anything, []model.CoalescedIncrement{{CounterID: id, Delta: 1, Count: 1}}).
+		Return([]*model.Counter{{ID: id, Value: 18, Version: 4}}, nil).Once()
+	require.NoError(t, a.Flush(context.TODO()))
+
+	repo.AssertExpectations(t)
+}
+
+func TestAggregatorFlushesFullBatches(t *testing.T) {
+	first, second := uuid.New(), uuid.New()
+	repo := &mocks.Repository{}
+	repo.On("GetCounter", mock.Anything, first).
+		Return(&model.Counter{ID: first}, nil)
+	repo.On("GetCounter", mock.Anything, second).
+		Return(&model.Counter{ID: second}, nil)
+
+	flushed := make(chan []model.CoalescedIncrement, 1)
+	repo.On("FlushIncrements", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			flushed <- args.Get(1).([]model.CoalescedIncrement)
+		}).
+		Return([]*model.Counter{}, nil)
+
+	a := newAggregator(t, repo, aggregator.WithBatchSize(2))
+
+	_, err := a.IncrementCounter(context.TODO(), first, 1)
+	require.NoError(t, err)
+	_, err = a.IncrementCounter(context.TODO(), second, 1)
+	require.NoError(t, err)
+
+	select {
+	case increments := <-flushed:
+		require.Len(t, increments, 2)
+	case <-time.After(time.Second):
+		t.Fatal("a full batch was not flushed")
+	}
+}
+
+func TestAggregatorClose(t *testing.T) {
+	id := uuid.New()
+	repo := &mocks.Repository{}
+	repo.On("GetCounter", mock.Anything, id).
+		Return(&model.Counter{ID: id, Value: 10}, nil).Once()
+	repo.On("FlushIncrements", mock.Anything, []model.CoalescedIncrement{{CounterID: id, Delta: 4, Count: 1}}).
+		Return([]*model.Counter{{ID: id, Value: 14}}, nil).Once()
+
+	a := aggregator.New(repo, aggregator.WithInterval(time.Hour))
+
+	_, err := a.IncrementCounter(context.TODO(), id, 4)
+	require.NoError(t, err)
+
+	require.NoError(t, a.Close(context.TODO()))
+
+	// Increments after Close are not held back
+	repo.On("IncrementCounter", mock.Anything, id, int64(1)).
+		Return(&model.Counter{ID: id, Value: 15}, nil).Once()
+	counter, err := a.IncrementCounter(context.TODO(), id, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(15), counter.Value)
+
+	require.NoError(t, a.Close(context.TODO()))
+
+	repo.AssertExpectations(t)
+}
+
+func TestAggregatorPassesThroughErrors(t *testing.T) {
+	id := uuid.New()
+	repo := &mocks.Repository{}
+	repo.On("SetCounter", mock.Anything, id, int64(1), int64(0)).
+		Return(nil, model.ErrVersionMismatch)
+
+	a := newAggregator(t, repo)
+
+	counter, err := a.SetCounter(context.TODO(), id, 1, 0)
+	require.True(t, errors.Is(err, model.ErrVersionMismatch))
+	require.Nil(t, counter)
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// BatchOperationType is the kind of change made by an operation of a batch
+type BatchOperationType string
+
+const (
+	BatchCreate    BatchOperationType = "create"
+	BatchIncrement BatchOperationType = "increment"
+	BatchSet       BatchOperationType = "set"
+	BatchDelete    BatchOperationType = "delete"
+)
+
+// BatchOperation is a single change of a batch. Create is only used by create,
+// which ignores CounterID, Delta by increment and Value and ExpectedVersion by set.
+type BatchOperation struct {
+	Type            BatchOperationType
+	CounterID       uuid.UUID
+	Create          CreateCounterParams
+	Delta           int64
+	Value           int64
+	ExpectedVersion int64
+}
+
+// BatchResult is the outcome of an operation of a batch. Counter is the counter
+// after the change, nil for deletes and failed operations.
+type BatchResult struct {
+	Counter *Counter
+	Err     error
+}
+
+// batchResultErrors name the storage errors a failed operation can have, so
+// the results of a batch can be saved with its idempotency record
+var batchResultErrors = map[string]error{
+	"not_found":        sql.ErrNoRows,
+	"out_of_bounds":    ErrOutOfBounds,
+	"version_mismatch": ErrVersionMismatch,
+	"name_taken":       ErrNameTaken,
+}
+
+// batchResultState is a BatchResult as it is saved with an idempotency record
+type batchResultState struct {
+	Counter *Counter `json:"counter,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// MarshalJSON encodes the result with the name of its error. It fails for the
+// errors storage does not report in the results of a batch.
+func (r BatchResult) MarshalJSON() ([]byte, error) {
+	state := batchResultState{Counter: r.Counter}
+	if r.Err != nil {
+		for name, err := range batchResultErrors {
+			if r.Err == err {
+				state.Error = name
+			}
+		}
+		if state.Error == "" {
+			return nil, fmt.Errorf("cannot save the batch result error %q", r.Err)
+		}
+	}
+
+	return json.Marshal(state)
+}
+
+// UnmarshalJSON decodes a result encoded by MarshalJSON
+func (r *BatchResult) UnmarshalJSON(data []byte) error {
+	var state batchResultState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	r.Counter, r.Err = state.Counter, nil
+	if state.Error != "" {
+		var ok bool
+		if r.Err, ok = batchResultErrors[state.Error]; !ok {
+			return fmt.Errorf("unknown batch result error %q", state.Error)
+		}
+	}
+
+	return nil
+}
+
+// BatchError is returned when an all-or-nothing batch is rolled back because
+// one of its operations failed
+type BatchError struct {
+	// Index is the position of the failed operation in the batch
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Index, e.Err)
+}
+
+// Unwrap lets errors.Is and errors.As match the error of the failed operation
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
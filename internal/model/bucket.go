@@ -0,0 +1,108 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Granularity is the width of the time buckets a counter is tallied in
+type Granularity string
+
+const (
+	GranularityMinute Granularity = "minute"
+	GranularityHour   Granularity = "hour"
+	GranularityDay    Granularity = "day"
+)
+
+// Duration returns the width of a bucket, or 0 for an unknown granularity
+func (g Granularity) Duration() time.Duration {
+	switch g {
+	case GranularityMinute:
+		return time.Minute
+	case GranularityHour:
+		return time.Hour
+	case GranularityDay:
+		return 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// BucketStart returns the start of the bucket holding t. Buckets are aligned in UTC.
+func (g Granularity) BucketStart(t time.Time) time.Time {
+	return t.UTC().Truncate(g.Duration())
+}
+
+// CounterBucket is the tally of the increments made to a counter during one time bucket
+type CounterBucket struct {
+	Start time.Time `json:"start"`
+	// Delta is the net change applied to the counter during the bucket
+	Delta int64 `json:"delta"`
+	// Increments is the number of increments and decrements made during the bucket
+	Increments int64 `json:"increments"`
+}
+
+// CounterSeriesQuery asks for the buckets of a counter between From, inclusive,
+// and To, exclusive. Both are optional.
+type CounterSeriesQuery struct {
+	CounterID   uuid.UUID
+	Granularity Granularity
+	From        *time.Time
+	To          *time.Time
+}
+
+// CounterSeries is the tally of a counter over consecutive buckets, empty ones included
+type CounterSeries struct {
+	CounterID   uuid.UUID        `json:"counter_id"`
+	Granularity Granularity      `json:"granularity"`
+	Buckets     []*CounterBucket `json:"buckets"`
+}
+
+// AggregateSeriesQuery asks for the buckets of the counters matching the
+// Labels selector, like team=payments,env=prod, summed per bucket
+type AggregateSeriesQuery struct {
+	Labels      string
+	Granularity Granularity
+	From        *time.Time
+	To          *time.Time
+}
+
+// AggregateSeries is the tally of the counters matching a selector, summed per bucket
+type AggregateSeries struct {
+	Labels Labels `json:"labels"`
+	// Counters is the number of counters summed up
+	Counters    int              `json:"counters"`
+	Granularity Granularity      `json:"granularity"`
+	Buckets     []*CounterBucket `json:"buckets"`
+}
+
+// CounterRate is the average number of increments per second of a counter over a sliding window
+type CounterRate struct {
+	CounterID uuid.UUID `json:"counter_id"`
+	// Window is the period the rate was measured over, as a Go duration
+	Window string    `json:"window"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	// Delta is the net change applied to the counter during the window
+	Delta int64 `json:"delta"`
+	// Increments is the number of increments and decrements made during the window
+	Increments int64 `json:"increments"`
+	// PerSecond is Increments divided by the length of the window in seconds,
+	// so decrements add to the rate rather than cancel increments out
+	PerSecond float64 `json:"per_second"`
+}
+
+// AggregateRate is the average number of increments per second of the
+// counters matching a selector, summed up, over a sliding window
+type AggregateRate struct {
+	Labels Labels `json:"labels"`
+	// Counters is the number of counters summed up
+	Counters   int       `json:"counters"`
+	Window     string    `json:"window"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Delta      int64     `json:"delta"`
+	Increments int64     `json:"increments"`
+	PerSecond  float64   `json:"per_second"`
+}
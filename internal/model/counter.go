@@ -1,16 +1,193 @@
 package model
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// ErrOutOfBounds is returned by storage when a change would move a counter past
+// one of its bounds and the counter uses the reject overflow policy
+var ErrOutOfBounds = errors.New("counter bounds exceeded")
+
+// ErrVersionMismatch is returned by storage when a conditional write expected
+// a different version than the stored one
+var ErrVersionMismatch = errors.New("counter version mismatch")
+
+// ErrNameTaken is returned by storage when a live counter of the namespace
+// already has the name
+var ErrNameTaken = errors.New("counter name taken")
+
+// DefaultNamespace holds the counters addressed by name without a namespace
+const DefaultNamespace = "default"
+
+// OverflowPolicy decides what happens when a change would move a bounded counter past its limits
+type OverflowPolicy string
+
+const (
+	// OverflowReject refuses the change and leaves the counter untouched
+	OverflowReject OverflowPolicy = "reject"
+	// OverflowSaturate applies the change but clamps the value to the bound
+	OverflowSaturate OverflowPolicy = "saturate"
+)
+
 // Counter represents the counter model
 type Counter struct {
-	ID        uuid.UUID `db:"id" json:"id"`
-	Name      string    `db:"name" json:"name"`
-	Value     int64     `db:"value" json:"value"`
-	CreatedAt time.Time `db:"created_at"`
-	UpdatedAt time.Time `db:"updated_at"`
+	ID             uuid.UUID      `db:"id" json:"id"`
+	Name           string         `db:"name" json:"name"`
+	Value          int64          `db:"value" json:"value"`
+	Min            *int64         `db:"min_value" json:"min,omitempty"`
+	Max            *int64         `db:"max_value" json:"max,omitempty"`
+	OverflowPolicy OverflowPolicy `db:"overflow_policy" json:"overflow_policy"`
+	// Namespace is DefaultNamespace unless set, the names of the live counters of
+	// a namespace are unique. Counters created before namespaces may have none.
+	Namespace string `db:"namespace" json:"namespace,omitempty"`
+	// Labels, Description and Unit describe the counter, they never affect its value
+	Labels      Labels `db:"labels" json:"labels,omitempty"`
+	Description string `db:"description" json:"description,omitempty"`
+	Unit        string `db:"unit" json:"unit,omitempty"`
+	// Shards is the number of rows increments are spread across, 1 for a plain counter
+	Shards int `db:"shards" json:"shards"`
+	// Version starts at 1 and is bumped on every write
+	Version   int64     `db:"version" json:"version"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+	// DeletedAt is set once the counter is soft deleted
+	DeletedAt *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
+}
+
+// CreateCounterParams holds everything needed to create a counter.
+// Min and Max are optional bounds enforced according to OverflowPolicy.
+// Shards spreads the increments of a busy counter across several rows.
+// The name has to be unique within Namespace, DefaultNamespace when empty.
+type CreateCounterParams struct {
+	Name           string         `json:"name"`
+	Namespace      string         `json:"namespace,omitempty"`
+	Labels         Labels         `json:"labels,omitempty"`
+	Description    string         `json:"description,omitempty"`
+	Unit           string         `json:"unit,omitempty"`
+	Min            *int64         `json:"min"`
+	Max            *int64         `json:"max"`
+	OverflowPolicy OverflowPolicy `json:"overflow_policy"`
+	Shards         int            `json:"shards,omitempty"`
+}
+
+// UpdateCounterParams holds the changes made to the metadata of a counter.
+// Fields left nil are not changed, Labels replaces all the labels when set.
+type UpdateCounterParams struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Unit        *string `json:"unit,omitempty"`
+	Labels      *Labels `json:"labels,omitempty"`
+}
+
+// Labels are the key value pairs counters are sliced by. They are stored as a
+// JSON object.
+type Labels map[string]string
+
+// Matches reports whether the labels include every label of the selector
+func (l Labels) Matches(selector Labels) bool {
+	for key, value := range selector {
+		if got, ok := l[key]; !ok || got != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Value encodes the labels as a JSON object, an empty one when there are none.
+// The object is a string since lib/pq would send bytes as bytea.
+func (l Labels) Value() (driver.Value, error) {
+	if l == nil {
+		return "{}", nil
+	}
+
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+// Scan decodes labels stored as a JSON object, no labels being an empty one
+func (l *Labels) Scan(src interface{}) error {
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		*l = Labels{}
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return fmt.Errorf("cannot scan %T into labels", src)
+	}
+
+	labels := Labels{}
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return err
+	}
+
+	*l = labels
+	return nil
+}
+
+// CoalescedIncrement is the sum of the increments a subject made to a counter,
+// applied to storage at once. The increments of several subjects to the same
+// counter are coalesced separately, so each keeps its own history event.
+type CoalescedIncrement struct {
+	CounterID uuid.UUID
+	Delta     int64
+	// Count is the number of increments that were coalesced
+	Count int64
+	// Subject made the coalesced increments, it is empty when unknown
+	Subject string
+}
+
+// CounterSort is the field counters are ordered by when listing them
+type CounterSort string
+
+const (
+	SortByName      CounterSort = "name"
+	SortByValue     CounterSort = "value"
+	SortByCreatedAt CounterSort = "created_at"
+)
+
+// ListCountersQuery describes a page of counters requested by a client.
+// Cursor is the opaque value returned as NextCursor by the previous page.
+type ListCountersQuery struct {
+	NamePrefix string
+	IDs        []uuid.UUID
+	// Labels is a selector like team=payments,env=prod
+	Labels     string
+	SortBy     CounterSort
+	Descending bool
+	Cursor     string
+	Limit      int
+}
+
+// CounterFilter is the storage level form of ListCountersQuery.
+// After holds the last counter of the previous page, if any.
+type CounterFilter struct {
+	NamePrefix string
+	IDs        []uuid.UUID
+	// Labels the counters must all have
+	Labels     Labels
+	SortBy     CounterSort
+	Descending bool
+	After      *Counter
+	Limit      int
+}
+
+// CounterPage is a single page of listed counters
+type CounterPage struct {
+	Counters   []*Counter `json:"counters"`
+	NextCursor string     `json:"next_cursor,omitempty"`
 }
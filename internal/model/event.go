@@ -0,0 +1,61 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CounterEventType is the kind of change recorded in the history of a counter
+type CounterEventType string
+
+const (
+	EventCreate    CounterEventType = "create"
+	EventIncrement CounterEventType = "increment"
+	EventDecrement CounterEventType = "decrement"
+	EventSet       CounterEventType = "set"
+	EventDelete    CounterEventType = "delete"
+	EventRestore   CounterEventType = "restore"
+	EventUpdate    CounterEventType = "update"
+)
+
+// CounterEvent is one change in the history of a counter
+type CounterEvent struct {
+	ID        int64            `json:"id"`
+	CounterID uuid.UUID        `json:"counter_id"`
+	Type      CounterEventType `json:"type"`
+	// Delta is the change actually applied, which can be smaller than the requested
+	// one when a saturating counter hits a bound
+	Delta int64 `json:"delta"`
+	// Value is the value of the counter after the change
+	Value int64 `json:"value"`
+	// Subject is the authenticated subject that made the change, if known
+	Subject   string    `json:"subject,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CounterHistoryQuery is what a client asks for when reading the history of a counter.
+// From is inclusive and To is exclusive, both are optional.
+type CounterHistoryQuery struct {
+	CounterID uuid.UUID
+	From      *time.Time
+	To        *time.Time
+	Cursor    string
+	Limit     int
+}
+
+// CounterEventFilter is the history query resolved for storage. Events are
+// returned oldest first, starting right after the event with id AfterID.
+type CounterEventFilter struct {
+	CounterID uuid.UUID
+	From      *time.Time
+	To        *time.Time
+	AfterID   int64
+	Limit     int
+}
+
+// CounterEventPage is one page of the history of a counter
+type CounterEventPage struct {
+	Events     []*CounterEvent `json:"events"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
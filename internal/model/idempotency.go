@@ -0,0 +1,45 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrDuplicateIdempotencyKey is returned by storage when another request of the
+// same subject already saved a result under the idempotency key within the window
+var ErrDuplicateIdempotencyKey = errors.New("duplicate idempotency key")
+
+// IdempotencyRecord is the result of a mutating request stored under the
+// idempotency key the client sent with it.
+type IdempotencyRecord struct {
+	// Subject is the authenticated subject that made the request, each subject
+	// has its own keys
+	Subject string
+	Key     string
+	// Request identifies the operation and its arguments, a key cannot be reused
+	// for a different request
+	Request string
+	// Counter is the counter state after the operation, nil for deletes
+	Counter *Counter
+	// Results are the outcomes of the operations of a batch, nil for the other requests
+	Results   []BatchResult
+	CreatedAt time.Time
+	// Since is the start of the window, records older than it can be replaced
+	Since time.Time
+}
+
+type idempotencyRecordKey struct{}
+
+// WithIdempotencyRecord returns a context asking storage to save the record in
+// the same transaction as the change it is handed to
+func WithIdempotencyRecord(ctx context.Context, record *IdempotencyRecord) context.Context {
+	return context.WithValue(ctx, idempotencyRecordKey{}, record)
+}
+
+// IdempotencyRecordFromContext returns the record to save along with a change, if any.
+// A nil record handed to WithIdempotencyRecord hides the one of the parent context.
+func IdempotencyRecordFromContext(ctx context.Context) (*IdempotencyRecord, bool) {
+	record, ok := ctx.Value(idempotencyRecordKey{}).(*IdempotencyRecord)
+	return record, ok && record != nil
+}
@@ -0,0 +1,16 @@
+package model
+
+import "context"
+
+type subjectKey struct{}
+
+// WithSubject returns a context carrying the authenticated subject making the request
+func WithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// SubjectFromContext returns the authenticated subject making the request, if any
+func SubjectFromContext(ctx context.Context) (string, bool) {
+	subject, ok := ctx.Value(subjectKey{}).(string)
+	return subject, ok
+}
@@ -0,0 +1,23 @@
+package model
+
+import "github.com/google/uuid"
+
+// CounterChange is a change of a counter sent to its watchers
+type CounterChange struct {
+	// ID orders the changes published by a server, clients resume after it
+	ID string
+	// Counter is the counter after the change. Only its ID is set when the
+	// counter was deleted.
+	Counter *Counter
+	Deleted bool
+}
+
+// WatchQuery describes the counters a client watches, either a single counter
+// or the counters matching a label selector
+type WatchQuery struct {
+	CounterID uuid.UUID
+	// Labels is a selector like team=payments,env=prod, used without CounterID
+	Labels string
+	// LastEventID is the ID of the last change the client received, if any
+	LastEventID string
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"gounter/internal/model"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// The operations of a best effort batch each run within a savepoint, so a
+	// failed one can be undone without losing the others
+	SavepointSQL           = `SAVEPOINT batch_operation;`
+	RollbackToSavepointSQL = `ROLLBACK TO SAVEPOINT batch_operation;`
+	ReleaseSavepointSQL    = `RELEASE SAVEPOINT batch_operation;`
+)
+
+// ApplyBatch applies the operations in a single transaction and returns their
+// results in the order of ops. The operations on existing counters run first,
+// sorted by counter id so concurrent batches lock the rows in the same order,
+// and the creates run last. When atomic is set an operation failing on a
+// missing counter, a taken name, its bounds or its version rolls back the
+// transaction, and the failed operation coming first in ops is returned as a
+// *model.BatchError. Otherwise such failures are reported in the results and
+// only undo their own operation. Any other error fails the batch.
+// The idempotency record carried by ctx, if any, is saved with the results.
+func (r *Counter) ApplyBatch(ctx context.Context, ops []model.BatchOperation, atomic bool) ([]model.BatchResult, error) {
+	now := time.Now().UTC()
+	results := make([]model.BatchResult, len(ops))
+
+	// The record holds the results of the whole batch, not of an operation
+	opCtx := model.WithIdempotencyRecord(ctx, nil)
+
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		var failed *model.BatchError
+		for _, i := range lockOrder(ops) {
+			// An atomic batch goes on after a failure, so the failed operation
+			// reported is the first of the request rather than of the lock order.
+			// A failed create aborts the transaction, so creates, and whatever
+			// runs after a failure, get a savepoint to go back to.
+			savepoint := !atomic || failed != nil || ops[i].Type == model.BatchCreate
+			if savepoint {
+				if _, err := tx.ExecContext(ctx, SavepointSQL); err != nil {
+					return err
+				}
+			}
+
+			counter, err := applyOperation(opCtx, tx, ops[i], now)
+			if err != nil && !isOperationError(err) {
+				return err
+			}
+
+			if err != nil {
+				if savepoint {
+					if _, err := tx.ExecContext(ctx, RollbackToSavepointSQL); err != nil {
+						return err
+					}
+				}
+
+				if atomic {
+					if failed == nil || i < failed.Index {
+						failed = &model.BatchError{Index: i, Err: err}
+					}
+					continue
+				}
+
+				results[i].Err = err
+				continue
+			}
+
+			if savepoint {
+				if _, err := tx.ExecContext(ctx, ReleaseSavepointSQL); err != nil {
+					return err
+				}
+			}
+			results[i].Counter = counter
+		}
+
+		if failed != nil {
+			return failed
+		}
+
+		return saveBatchIdempotencyRecord(ctx, tx, results)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// lockOrder returns the indexes of ops in the order they are applied: by
+// counter id, keeping the order of the operations on the same counter, then
+// the creates, which lock no existing row
+func lockOrder(ops []model.BatchOperation) []int {
+	order := make([]int, len(ops))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := ops[order[i]], ops[order[j]]
+		if a.Type == model.BatchCreate || b.Type == model.BatchCreate {
+			return b.Type == model.BatchCreate && a.Type != model.BatchCreate
+		}
+
+		return bytes.Compare(a.CounterID[:], b.CounterID[:]) < 0
+	})
+
+	return order
+}
+
+// applyOperation makes the change of a single operation in tx
+func applyOperation(ctx context.Context, tx *sqlx.Tx, op model.BatchOperation, now time.Time) (*model.Counter, error) {
+	switch op.Type {
+	case model.BatchCreate:
+		return createCounter(ctx, tx, op.Create, now)
+	case model.BatchIncrement:
+		return incrementCounter(ctx, tx, op.CounterID, op.Delta, now)
+	case model.BatchSet:
+		return setCounter(ctx, tx, op.CounterID, op.Value, op.ExpectedVersion, now)
+	case model.BatchDelete:
+		return nil, softDeleteCounter(ctx, tx, op.CounterID, now)
+	default:
+		return nil, fmt.Errorf("unsupported batch operation %q", op.Type)
+	}
+}
+
+// isOperationError reports whether err is the failure of a single operation,
+// as opposed to a failure of the database
+func isOperationError(err error) bool {
+	return err == sql.ErrNoRows || err == model.ErrOutOfBounds || err == model.ErrVersionMismatch || err == model.ErrNameTaken
+}
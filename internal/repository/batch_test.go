@@ -0,0 +1,202 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"gounter/internal/model"
+	counterRepository "gounter/internal/repository"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepositoryApplyBatch(t *testing.T) {
+	incremented := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	set := uuid.MustParse("00000000-0000-0000-0000-000000000002")
+	deleted := uuid.MustParse("00000000-0000-0000-0000-000000000003")
+
+	// The operations are applied by counter id, the results keep the request order
+	ops := []model.BatchOperation{
+		{Type: model.BatchDelete, CounterID: deleted},
+		{Type: model.BatchSet, CounterID: set, Value: 42, ExpectedVersion: 3},
+		{Type: model.BatchIncrement, CounterID: incremented, Delta: 5},
+	}
+
+	expectIncrement := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta(counterRepository.IncrementCounterSQL)).
+			WithArgs(incremented, int64(5), sqlmock.AnyArg()).
+			WillReturnRows(changedCounterRow(incremented, "Incremented", 15, 10))
+		expectEvent(mock, model.EventIncrement, 5, 15)
+		expectBuckets(mock, 5)
+	}
+
+	expectStaleSet := func(mock sqlmock.Sqlmock) {
+		expectLock(mock, set, 1)
+		mock.ExpectQuery(regexp.QuoteMeta(counterRepository.SetCounterSQL)).
+			WithArgs(set, int64(42), int64(3), sqlmock.AnyArg()).
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery(regexp.QuoteMeta(counterRepository.CounterVersionSQL)).
+			WithArgs(set).
+			WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(4))
+	}
+
+	expectDelete := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta(counterRepository.SoftDeleteCounter)).
+			WithArgs(deleted, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(7))
+		expectEvent(mock, model.EventDelete, 0, 7)
+	}
+
+	expectSavepoint := func(mock sqlmock.Sqlmock, release bool) {
+		statement := counterRepository.RollbackToSavepointSQL
+		if release {
+			statement = counterRepository.ReleaseSavepointSQL
+		}
+		mock.ExpectExec(regexp.QuoteMeta(statement)).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	tests := []struct {
+		name            string
+		atomic          bool
+		setupMock       func(mock sqlmock.Sqlmock)
+		expectedCounter []bool
+		expectedErrors  []error
+		expectedError   error
+	}{
+		{
+			name:   "rolls back an atomic batch on the first failed operation",
+			atomic: true,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectIncrement(mock)
+				expectStaleSet(mock)
+				mock.ExpectExec(regexp.QuoteMeta(counterRepository.SavepointSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectDelete(mock)
+				expectSavepoint(mock, true)
+				mock.ExpectRollback()
+			},
+			expectedError: &model.BatchError{Index: 1, Err: model.ErrVersionMismatch},
+		},
+		{
+			name:   "reports the failed operation coming first in the request",
+			atomic: true,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				expectIncrement(mock)
+				expectStaleSet(mock)
+				mock.ExpectExec(regexp.QuoteMeta(counterRepository.SavepointSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.SoftDeleteCounter)).
+					WithArgs(deleted, sqlmock.AnyArg()).
+					WillReturnError(sql.ErrNoRows)
+				expectSavepoint(mock, false)
+				mock.ExpectRollback()
+			},
+			expectedError: &model.BatchError{Index: 0, Err: sql.ErrNoRows},
+		},
+		{
+			name: "keeps the successful operations of a best effort batch",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(counterRepository.SavepointSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectIncrement(mock)
+				expectSavepoint(mock, true)
+				mock.ExpectExec(regexp.QuoteMeta(counterRepository.SavepointSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectStaleSet(mock)
+				expectSavepoint(mock, false)
+				mock.ExpectExec(regexp.QuoteMeta(counterRepository.SavepointSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+				expectDelete(mock)
+				expectSavepoint(mock, true)
+				mock.ExpectCommit()
+			},
+			expectedCounter: []bool{false, false, true},
+			expectedErrors:  []error{nil, model.ErrVersionMismatch, nil},
+		},
+		{
+			name: "fails a best effort batch when the database fails",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(counterRepository.SavepointSQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.IncrementCounterSQL)).
+					WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
+			},
+			expectedError: sql.ErrConnDone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			sqlxDB := sqlx.NewDb(db, "postgres")
+			repo := counterRepository.New(sqlxDB)
+
+			tt.setupMock(mock)
+
+			results, err := repo.ApplyBatch(context.TODO(), ops, tt.atomic)
+
+			// Validate the results
+			if tt.expectedError != nil {
+				require.Equal(t, tt.expectedError, err)
+				require.Nil(t, results)
+			} else {
+				require.NoError(t, err)
+				require.Len(t, results, len(ops))
+				for i, result := range results {
+					require.Equal(t, tt.expectedCounter[i], result.Counter != nil, "operation %d", i)
+					require.Equal(t, tt.expectedErrors[i], result.Err, "operation %d", i)
+				}
+			}
+
+			err = mock.ExpectationsWereMet()
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestRepositoryApplyBatchSavesIdempotencyRecord(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := counterRepository.New(sqlx.NewDb(db, "postgres"))
+
+	id := uuid.New()
+	since := time.Now().UTC().Add(-time.Hour)
+	ops := []model.BatchOperation{
+		{Type: model.BatchIncrement, CounterID: id, Delta: 1},
+		{Type: model.BatchIncrement, CounterID: id, Delta: 2},
+	}
+
+	// The operations save nothing, the record of the batch is saved once with every result
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(counterRepository.IncrementCounterSQL)).
+		WithArgs(id, int64(1), sqlmock.AnyArg()).
+		WillReturnRows(changedCounterRow(id, "Test Counter", 1, 0))
+	expectEvent(mock, model.EventIncrement, 1, 1)
+	expectBuckets(mock, 1)
+	mock.ExpectQuery(regexp.QuoteMeta(counterRepository.IncrementCounterSQL)).
+		WithArgs(id, int64(2), sqlmock.AnyArg()).
+		WillReturnRows(changedCounterRow(id, "Test Counter", 3, 1))
+	expectEvent(mock, model.EventIncrement, 2, 3)
+	expectBuckets(mock, 2)
+	mock.ExpectQuery(regexp.QuoteMeta(counterRepository.SaveIdempotencyRecordSQL)).
+		WithArgs("gounter", "key-1", "batch", []byte(nil), sqlmock.AnyArg(), sqlmock.AnyArg(), since).
+		WillReturnRows(sqlmock.NewRows([]string{"key"}).AddRow("key-1"))
+	mock.ExpectCommit()
+
+	ctx := model.WithIdempotencyRecord(context.TODO(), &model.IdempotencyRecord{Subject: "gounter", Key: "key-1", Request: "batch", Since: since})
+	applied, err := repo.ApplyBatch(ctx, ops, true)
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+	require.Equal(t, int64(3), applied[1].Counter.Value)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
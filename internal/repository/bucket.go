@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"gounter/internal/model"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	// AddToCounterBucketsSQL adds a change to the minute, hour and day buckets holding it.
+	// Sharded counters keep a row per shard so increments on different shards do not contend.
+	AddToCounterBucketsSQL = `
+		INSERT INTO counter_buckets (counter_id, shard, granularity, bucket_start, delta, increments)
+		VALUES ($1, $2, 'minute', $3, $6, 1), ($1, $2, 'hour', $4, $6, 1), ($1, $2, 'day', $5, $6, 1)
+		ON CONFLICT (counter_id, granularity, bucket_start, shard) DO UPDATE
+		SET delta = counter_buckets.delta + EXCLUDED.delta, increments = counter_buckets.increments + 1;`
+
+	ListCounterBucketsSQL = `
+		SELECT bucket_start, SUM(delta), SUM(increments)
+		FROM counter_buckets
+		WHERE counter_id = $1 AND granularity = $2 AND bucket_start >= $3 AND bucket_start < $4
+		GROUP BY bucket_start
+		ORDER BY bucket_start;`
+
+	// SumCounterBucketsSQL sums the buckets of several counters, given as an array
+	SumCounterBucketsSQL = `
+		SELECT bucket_start, SUM(delta), SUM(increments)
+		FROM counter_buckets
+		WHERE counter_id = ANY($1) AND granularity = $2 AND bucket_start >= $3 AND bucket_start < $4
+		GROUP BY bucket_start
+		ORDER BY bucket_start;`
+
+	PruneCounterBucketsSQL = `
+		DELETE FROM counter_buckets
+		WHERE granularity = $1 AND bucket_start < $2;`
+)
+
+// addToBuckets tallies a change of the counter made on shard at the given time
+// in the same transaction as the change. Plain counters use shard 0.
+func addToBuckets(ctx context.Context, tx *sqlx.Tx, counterID uuid.UUID, shard int, delta int64, at time.Time) error {
+	_, err := tx.ExecContext(ctx, AddToCounterBucketsSQL, counterID, shard,
+		model.GranularityMinute.BucketStart(at), model.GranularityHour.BucketStart(at), model.GranularityDay.BucketStart(at), delta)
+	return err
+}
+
+// ListCounterBuckets returns the non empty buckets of a counter starting between
+// from, inclusive, and to, exclusive, oldest first
+func (r *Counter) ListCounterBuckets(ctx context.Context, id uuid.UUID, granularity model.Granularity, from, to time.Time) ([]*model.CounterBucket, error) {
+	return r.queryBuckets(ctx, ListCounterBucketsSQL, id, granularity, from, to)
+}
+
+// SumCounterBuckets returns the non empty buckets of the counters starting
+// between from, inclusive, and to, exclusive, summed across the counters, oldest first
+func (r *Counter) SumCounterBuckets(ctx context.Context, ids []uuid.UUID, granularity model.Granularity, from, to time.Time) ([]*model.CounterBucket, error) {
+	return r.queryBuckets(ctx, SumCounterBucketsSQL, pq.Array(ids), granularity, from, to)
+}
+
+// PruneCounterBuckets removes the buckets of the granularity starting before
+// the given time, returning the number of rows removed
+func (r *Counter) PruneCounterBuckets(ctx context.Context, granularity model.Granularity, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, PruneCounterBucketsSQL, granularity, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// queryBuckets runs a query returning the start, delta and increments of buckets
+func (r *Counter) queryBuckets(ctx context.Context, query string, args ...interface{}) ([]*model.CounterBucket, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []*model.CounterBucket{}
+	for rows.Next() {
+		var bucket model.CounterBucket
+		if err := rows.Scan(&bucket.Start, &bucket.Delta, &bucket.Increments); err != nil {
+			return nil, err
+		}
+		bucket.Start = bucket.Start.UTC()
+
+		buckets = append(buckets, &bucket)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return buckets, nil
+}
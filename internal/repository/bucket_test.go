@@ -0,0 +1,198 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"gounter/internal/model"
+	counterRepository "gounter/internal/repository"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepositoryListCounterBuckets(t *testing.T) {
+	id := uuid.New()
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(3 * time.Hour)
+
+	tests := []struct {
+		name            string
+		setupMock       func(mock sqlmock.Sqlmock)
+		expectedBuckets []*model.CounterBucket
+		expectedError   error
+	}{
+		{
+			name: "lists the stored buckets",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT bucket_start, SUM\(delta\), SUM\(increments\) FROM counter_buckets WHERE counter_id = \$1 AND granularity = \$2 AND bucket_start >= \$3 AND bucket_start < \$4 GROUP BY bucket_start ORDER BY bucket_start;`).
+					WithArgs(id, model.GranularityHour, from, to).
+					WillReturnRows(sqlmock.NewRows([]string{"bucket_start", "delta", "increments"}).
+						AddRow(from, 12, 4).
+						AddRow(from.Add(2*time.Hour), -1, 1))
+			},
+			expectedBuckets: []*model.CounterBucket{
+				{Start: from, Delta: 12, Increments: 4},
+				{Start: from.Add(2 * time.Hour), Delta: -1, Increments: 1},
+			},
+		},
+		{
+			name: "database error",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.ListCounterBucketsSQL)).
+					WillReturnError(sql.ErrConnDone)
+			},
+			expectedError: sql.ErrConnDone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			sqlxDB := sqlx.NewDb(db, "postgres")
+			repo := counterRepository.New(sqlxDB)
+
+			tt.setupMock(mock)
+
+			buckets, err := repo.ListCounterBuckets(context.TODO(), id, model.GranularityHour, from, to)
+
+			// Validate the results
+			if tt.expectedError != nil {
+				require.Equal(t, tt.expectedError, err)
+				require.Nil(t, buckets)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tt.expectedBuckets, buckets)
+			}
+
+			err = mock.ExpectationsWereMet()
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestRepositorySumCounterBuckets(t *testing.T) {
+	ids := []uuid.UUID{uuid.New(), uuid.New()}
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(3 * time.Hour)
+
+	tests := []struct {
+		name            string
+		setupMock       func(mock sqlmock.Sqlmock)
+		expectedBuckets []*model.CounterBucket
+		expectedError   error
+	}{
+		{
+			name: "sums the buckets of the counters in one query",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT bucket_start, SUM\(delta\), SUM\(increments\) FROM counter_buckets WHERE counter_id = ANY\(\$1\) AND granularity = \$2 AND bucket_start >= \$3 AND bucket_start < \$4 GROUP BY bucket_start ORDER BY bucket_start;`).
+					WithArgs(pq.Array(ids), model.GranularityHour, from, to).
+					WillReturnRows(sqlmock.NewRows([]string{"bucket_start", "delta", "increments"}).
+						AddRow(from, 20, 6).
+						AddRow(from.Add(time.Hour), 3, 1))
+			},
+			expectedBuckets: []*model.CounterBucket{
+				{Start: from, Delta: 20, Increments: 6},
+				{Start: from.Add(time.Hour), Delta: 3, Increments: 1},
+			},
+		},
+		{
+			name: "database error",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.SumCounterBucketsSQL)).
+					WillReturnError(sql.ErrConnDone)
+			},
+			expectedError: sql.ErrConnDone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			sqlxDB := sqlx.NewDb(db, "postgres")
+			repo := counterRepository.New(sqlxDB)
+
+			tt.setupMock(mock)
+
+			buckets, err := repo.SumCounterBuckets(context.TODO(), ids, model.GranularityHour, from, to)
+
+			// Validate the results
+			if tt.expectedError != nil {
+				require.Equal(t, tt.expectedError, err)
+				require.Nil(t, buckets)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tt.expectedBuckets, buckets)
+			}
+
+			err = mock.ExpectationsWereMet()
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestRepositoryPruneCounterBuckets(t *testing.T) {
+	before := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		setupMock      func(mock sqlmock.Sqlmock)
+		expectedPruned int64
+		expectedError  error
+	}{
+		{
+			name: "removes the older buckets of the granularity",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`DELETE FROM counter_buckets WHERE granularity = \$1 AND bucket_start < \$2;`).
+					WithArgs(model.GranularityMinute, before).
+					WillReturnResult(sqlmock.NewResult(0, 42))
+			},
+			expectedPruned: 42,
+		},
+		{
+			name: "database error",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta(counterRepository.PruneCounterBucketsSQL)).
+					WillReturnError(sql.ErrConnDone)
+			},
+			expectedError: sql.ErrConnDone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			sqlxDB := sqlx.NewDb(db, "postgres")
+			repo := counterRepository.New(sqlxDB)
+
+			tt.setupMock(mock)
+
+			pruned, err := repo.PruneCounterBuckets(context.TODO(), model.GranularityMinute, before)
+
+			// Validate the results
+			if tt.expectedError != nil {
+				require.Equal(t, tt.expectedError, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.expectedPruned, pruned)
+
+			err = mock.ExpectationsWereMet()
+			require.NoError(t, err)
+		})
+	}
+}
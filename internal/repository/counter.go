@@ -2,33 +2,221 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"gounter/internal/model"
+	"math/rand"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
+// counterValue is the value of a counter, which is spread across its shards
+// when it has more than one. Plain counters never read counter_shards.
+const counterValue = `CASE WHEN counter.shards > 1
+			THEN counter.value + (SELECT COALESCE(SUM(value), 0) FROM counter_shards WHERE counter_id = counter.id)
+			ELSE counter.value END`
+
+// counterVersion is the version of a counter. The shards of a sharded counter
+// count the increments they took, which bump the version without locking the
+// counter row.
+const counterVersion = `CASE WHEN counter.shards > 1
+			THEN counter.version + (SELECT COALESCE(SUM(version), 0) FROM counter_shards WHERE counter_id = counter.id)
+			ELSE counter.version END`
+
+// counterUpdatedAt is the time of the last change of a counter, which may be
+// an increment on one of its shards
+const counterUpdatedAt = `CASE WHEN counter.shards > 1
+			THEN GREATEST(counter.updated_at, (SELECT MAX(updated_at) FROM counter_shards WHERE counter_id = counter.id))
+			ELSE counter.updated_at END`
+
+// counterColumns lists the columns read into a model.Counter, in scanCounter order
+const counterColumns = `id, name, COALESCE(namespace, '') AS namespace, labels, description, unit, ` + counterValue + ` AS value, min_value, max_value, overflow_policy, shards, ` + counterVersion + ` AS version, created_at, ` + counterUpdatedAt + ` AS updated_at`
+
 const (
 	CreateCounterSQL = `
-		INSERT INTO counter (id, name, value, created_at, updated_at) 
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, name, value;`
+		INSERT INTO counter (id, name, namespace, value, min_value, max_value, overflow_policy, shards, version, created_at, updated_at, labels, description, unit) 
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, 1, $9, $10, $11, $12, $13)
+		RETURNING ` + counterColumns + `;`
 
+	CreateCounterShardsSQL = `
+		INSERT INTO counter_shards (counter_id, shard)
+		SELECT $1, generate_series(0, $2 - 1);`
+
+	// IncrementCounterSQL only updates the row when the new value stays within the
+	// bounds, or clamps it to the bounds when the counter saturates. LEAST and
+	// GREATEST ignore the bounds that are not set. It also returns the value
+	// before the change so the applied delta can be recorded.
+	// Sharded counters are left alone, and unlocked, for IncrementCounterShardSQL.
 	IncrementCounterSQL = `
+		WITH previous AS (
+			SELECT id AS previous_id, value AS previous_value
+			FROM counter
+			WHERE id = $1 AND deleted_at IS NULL AND shards = 1
+			FOR UPDATE
+		)
+		UPDATE counter
+		SET value = LEAST(GREATEST(value + $2, min_value), max_value),
+			version = version + 1,
+			updated_at = $3
+		FROM previous
+		WHERE id = previous_id
+			AND (overflow_policy = 'saturate'
+				OR value + $2 BETWEEN COALESCE(min_value, value + $2) AND COALESCE(max_value, value + $2))
+		RETURNING ` + counterColumns + `, previous_value;`
+
+	// SetCounterSQL sets the value only when the stored version matches, and
+	// applies the bounds the same way IncrementCounterSQL does.
+	SetCounterSQL = `
+		WITH previous AS (
+			SELECT id AS previous_id, value AS previous_value
+			FROM counter
+			WHERE id = $1 AND deleted_at IS NULL
+			FOR UPDATE
+		)
 		UPDATE counter
-		SET value = value + 1
-		WHERE id = $1
-		RETURNING id, name, value;`
+		SET value = LEAST(GREATEST($2, min_value), max_value),
+			version = version + 1,
+			updated_at = $4
+		FROM previous
+		WHERE id = previous_id AND ` + counterVersion + ` = $3
+			AND (overflow_policy = 'saturate'
+				OR $2 BETWEEN COALESCE(min_value, $2) AND COALESCE(max_value, $2))
+		RETURNING ` + counterColumns + `, previous_value;`
+
+	CounterVersionSQL = `
+		SELECT ` + counterVersion + ` FROM counter WHERE id = $1 AND deleted_at IS NULL;`
+
+	// LockCounterSQL locks a live counter before its version is checked
+	LockCounterSQL = `
+		SELECT shards FROM counter WHERE id = $1 AND deleted_at IS NULL FOR UPDATE;`
+
+	// LockCounterShardsSQL locks the shards of a counter, so no increment
+	// changes its version or value between the check and the write
+	LockCounterShardsSQL = `
+		SELECT shard FROM counter_shards WHERE counter_id = $1 ORDER BY shard FOR UPDATE;`
+
+	CounterShardsSQL = `
+		SELECT shards FROM counter WHERE id = $1 AND deleted_at IS NULL;`
+
+	// IncrementCounterShardSQL only locks one shard of a sharded counter, which
+	// has no bounds to check. The shard counts the write towards the version.
+	IncrementCounterShardSQL = `
+		UPDATE counter_shards
+		SET value = value + $3, version = version + 1, updated_at = $4
+		WHERE counter_id = $1 AND shard = $2;`
+
+	// ResetCounterShardsSQL zeroes the shards of a counter and returns what they held
+	ResetCounterShardsSQL = `
+		WITH previous AS (
+			SELECT shard AS previous_shard, value AS previous_value
+			FROM counter_shards
+			WHERE counter_id = $1
+			FOR UPDATE
+		), reset AS (
+			UPDATE counter_shards
+			SET value = 0
+			FROM previous
+			WHERE counter_id = $1 AND shard = previous_shard
+			RETURNING previous_value
+		)
+		SELECT COALESCE(SUM(previous_value), 0) FROM reset;`
+
+	GetCounterSQL = `
+		SELECT ` + counterColumns + `
+		FROM counter
+		WHERE id = $1 AND deleted_at IS NULL;`
+
+	GetCounterByNameSQL = `
+		SELECT ` + counterColumns + `
+		FROM counter
+		WHERE namespace = $1 AND name = $2 AND deleted_at IS NULL;`
+
+	ListCountersSQL = `
+		SELECT ` + counterColumns + `
+		FROM counter
+		WHERE deleted_at IS NULL`
 
 	SoftDeleteCounter = `
-		DELETE FROM counter 
-		WHERE id = $1;`
+		UPDATE counter
+		SET deleted_at = $2, updated_at = $2, version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING ` + counterValue + `;`
+
+	// UpdateCounterSQL changes the metadata given as not null parameters
+	UpdateCounterSQL = `
+		UPDATE counter
+		SET name = COALESCE($2, name),
+			description = COALESCE($3, description),
+			unit = COALESCE($4, unit),
+			labels = COALESCE($5::jsonb, labels),
+			version = version + 1,
+			updated_at = $6
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING ` + counterColumns + `;`
+
+	RestoreCounterSQL = `
+		UPDATE counter
+		SET deleted_at = NULL, updated_at = $2, version = version + 1
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING ` + counterColumns + `;`
+
+	PurgeDeletedCountersSQL = `
+		DELETE FROM counter
+		WHERE deleted_at IS NOT NULL AND deleted_at < $1;`
+)
+
+const (
+	// uniqueViolation is the code of the error raised when a unique constraint is violated
+	uniqueViolation = "23505"
+	// namespaceNameKey keeps the names of the live counters of a namespace unique
+	namespaceNameKey = "counter_namespace_name_key"
 )
 
+// sortColumns maps the supported sort fields to their column names
+var sortColumns = map[model.CounterSort]string{
+	model.SortByName:      "name",
+	model.SortByValue:     counterValue,
+	model.SortByCreatedAt: "created_at",
+}
+
+// likeEscaper escapes the LIKE wildcards in a user supplied prefix
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 // CounterRepository defines the interface for counter operations
 type CounterRepository interface {
-	CreateCounter(ctx context.Context, name string) (*model.Counter, error)
+	CreateCounter(ctx context.Context, params model.CreateCounterParams) (*model.Counter, error)
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanCounter reads a row selected with counterColumns into a counter.
+// Columns selected after counterColumns are read into extra.
+func scanCounter(row rowScanner, extra ...interface{}) (*model.Counter, error) {
+	var counter model.Counter
+
+	dest := []interface{}{&counter.ID, &counter.Name, &counter.Namespace, &counter.Labels, &counter.Description, &counter.Unit, &counter.Value, &counter.Min, &counter.Max,
+		&counter.OverflowPolicy, &counter.Shards, &counter.Version, &counter.CreatedAt, &counter.UpdatedAt}
+
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &counter, nil
+}
+
+// isNameTaken reports whether err is a violation of the unique name of the counters of a namespace
+func isNameTaken(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation && pqErr.Constraint == namespaceNameKey
 }
 
 // Counter struct do operation counter table in db.
@@ -41,46 +229,335 @@ func New(db *sqlx.DB) *Counter {
 	return &Counter{db: db}
 }
 
+// inTx runs fn in a transaction, which is rolled back when fn fails
+func (r *Counter) inTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // CreateCounter inserts a new counter into the database and returns the created counter
-func (r *Counter) CreateCounter(ctx context.Context, name string) (*model.Counter, error) {
+func (r *Counter) CreateCounter(ctx context.Context, params model.CreateCounterParams) (*model.Counter, error) {
 	now := time.Now().UTC()
-	id := uuid.New()
 
-	var counter model.Counter
+	var counter *model.Counter
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		counter, err = createCounter(ctx, tx, params, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return counter, nil
+}
+
+// createCounter inserts a new counter in tx, along with its shards and history
+func createCounter(ctx context.Context, tx *sqlx.Tx, params model.CreateCounterParams, now time.Time) (*model.Counter, error) {
+	id := uuid.New()
 
 	// Perform the insert and return the created counter
-	err := r.db.QueryRowContext(ctx, CreateCounterSQL, id, name, 0, now, now).
-		Scan(&counter.ID, &counter.Name, &counter.Value)
+	row := tx.QueryRowContext(ctx, CreateCounterSQL, id, params.Name, params.Namespace, 0,
+		params.Min, params.Max, params.OverflowPolicy, params.Shards, now, now,
+		params.Labels, params.Description, params.Unit)
+
+	counter, err := scanCounter(row)
+	if isNameTaken(err) {
+		return nil, model.ErrNameTaken
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return &counter, nil
+	if counter.Shards > 1 {
+		if _, err := tx.ExecContext(ctx, CreateCounterShardsSQL, id, counter.Shards); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := recordEvent(ctx, tx, counter.ID, model.EventCreate, 0, counter.Value, now); err != nil {
+		return nil, err
+	}
+
+	if err := saveIdempotencyRecord(ctx, tx, counter); err != nil {
+		return nil, err
+	}
+
+	return counter, nil
 }
 
-// IncrementCounter increments the counter by 1 and returns the new value
-func (r *Counter) IncrementCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
-	var counter model.Counter
+// GetCounter fetches a single counter by its id
+func (r *Counter) GetCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
+	return scanCounter(r.db.QueryRowContext(ctx, GetCounterSQL, id))
+}
 
-	err := r.db.QueryRowContext(ctx, IncrementCounterSQL, id).
-		Scan(&counter.ID, &counter.Name, &counter.Value)
+// GetCounterByName fetches the live counter of the namespace with the given name
+func (r *Counter) GetCounterByName(ctx context.Context, namespace, name string) (*model.Counter, error) {
+	return scanCounter(r.db.QueryRowContext(ctx, GetCounterByNameSQL, namespace, name))
+}
+
+// ListCounters returns the counters matching the filter, ordered by the sort field
+// and then by id so the order is stable across pages.
+func (r *Counter) ListCounters(ctx context.Context, filter model.CounterFilter) ([]*model.Counter, error) {
+	column, ok := sortColumns[filter.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sort field %q", filter.SortBy)
+	}
+
+	var (
+		conditions []string
+		args       []interface{}
+	)
+
+	if filter.NamePrefix != "" {
+		args = append(args, likeEscaper.Replace(filter.NamePrefix)+"%")
+		conditions = append(conditions, fmt.Sprintf("name LIKE $%d", len(args)))
+	}
+
+	if len(filter.IDs) > 0 {
+		args = append(args, pq.Array(filter.IDs))
+		conditions = append(conditions, fmt.Sprintf("id = ANY($%d)", len(args)))
+	}
+
+	if len(filter.Labels) > 0 {
+		args = append(args, filter.Labels)
+		conditions = append(conditions, fmt.Sprintf("labels @> $%d::jsonb", len(args)))
+	}
+
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if filter.After != nil {
+		args = append(args, sortValue(filter.After, filter.SortBy), filter.After.ID)
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s ($%d, $%d)", column, comparison, len(args)-1, len(args)))
+	}
+
+	query := ListCountersSQL
+	for _, condition := range conditions {
+		query += " AND " + condition
+	}
+
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf("\n\t\tORDER BY %s %s, id %s\n\t\tLIMIT $%d;", column, direction, direction, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return &counter, nil
+	counters := []*model.Counter{}
+	for rows.Next() {
+		counter, err := scanCounter(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		counters = append(counters, counter)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counters, nil
 }
 
-// SoftDeleteCounter will hard delete the counter.
-// It returns the number of rows affected.
-func (r *Counter) SoftDeleteCounter(ctx context.Context, id uuid.UUID) (int64, error) {
-	result, err := r.db.ExecContext(ctx, SoftDeleteCounter, id)
+// sortValue returns the value of the counter field used as the sort key
+func sortValue(counter *model.Counter, sortBy model.CounterSort) interface{} {
+	switch sortBy {
+	case model.SortByValue:
+		return counter.Value
+	case model.SortByCreatedAt:
+		return counter.CreatedAt
+	default:
+		return counter.Name
+	}
+}
+
+// IncrementCounter adds delta to the counter and returns the new value.
+// A negative delta decrements the counter. Bounds are enforced by the update
+// itself, it returns model.ErrOutOfBounds when the counter rejects the change
+// and sql.ErrNoRows when the counter does not exist. Sharded counters are
+// incremented on one of their shards picked at random.
+func (r *Counter) IncrementCounter(ctx context.Context, id uuid.UUID, delta int64) (*model.Counter, error) {
+	now := time.Now().UTC()
+
+	var counter *model.Counter
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		counter, err = incrementCounter(ctx, tx, id, delta, now)
+		return err
+	})
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+
+	return counter, nil
+}
+
+// incrementCounter adds delta to the counter in tx and records the change
+func incrementCounter(ctx context.Context, tx *sqlx.Tx, id uuid.UUID, delta int64, now time.Time) (*model.Counter, error) {
+	var previous int64
+	var shard int
+
+	counter, err := scanCounter(tx.QueryRowContext(ctx, IncrementCounterSQL, id, delta, now), &previous)
+	if err == sql.ErrNoRows {
+		// Nothing was updated, find out whether the counter is missing, out of bounds or sharded
+		var shards int
+		if err := tx.QueryRowContext(ctx, CounterShardsSQL, id).Scan(&shards); err != nil {
+			return nil, err
+		}
+
+		if shards <= 1 {
+			return nil, model.ErrOutOfBounds
+		}
+
+		shard = rand.Intn(shards)
+		if counter, err = incrementShard(ctx, tx, id, shard, delta, now); err != nil {
+			return nil, err
+		}
+		previous = counter.Value - delta
+	} else if err != nil {
+		return nil, err
+	}
+
+	eventType := model.EventIncrement
+	if delta < 0 {
+		eventType = model.EventDecrement
+	}
+
+	if err := recordEvent(ctx, tx, id, eventType, counter.Value-previous, counter.Value, now); err != nil {
+		return nil, err
+	}
+
+	if err := addToBuckets(ctx, tx, id, shard, counter.Value-previous, now); err != nil {
+		return nil, err
+	}
+
+	if err := saveIdempotencyRecord(ctx, tx, counter); err != nil {
+		return nil, err
+	}
+
+	return counter, nil
+}
+
+// incrementShard adds delta to one shard of a sharded counter and returns the counter
+func incrementShard(ctx context.Context, tx *sqlx.Tx, id uuid.UUID, shard int, delta int64, now time.Time) (*model.Counter, error) {
+	if _, err := tx.ExecContext(ctx, IncrementCounterShardSQL, id, shard, delta, now); err != nil {
+		return nil, err
+	}
+
+	return scanCounter(tx.QueryRowContext(ctx, GetCounterSQL, id))
+}
+
+// SetCounter sets the counter to value when its version is still expectedVersion.
+// It returns model.ErrVersionMismatch when the counter was changed in between,
+// model.ErrOutOfBounds when the counter rejects the value and sql.ErrNoRows when
+// the counter does not exist.
+func (r *Counter) SetCounter(ctx context.Context, id uuid.UUID, value int64, expectedVersion int64) (*model.Counter, error) {
+	now := time.Now().UTC()
+
+	var counter *model.Counter
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		counter, err = setCounter(ctx, tx, id, value, expectedVersion, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return counter, nil
+}
+
+// setCounter sets the counter to value in tx and records the change
+func setCounter(ctx context.Context, tx *sqlx.Tx, id uuid.UUID, value int64, expectedVersion int64, now time.Time) (*model.Counter, error) {
+	// The version of a sharded counter is summed over its shards, which are
+	// locked after the counter like everywhere else
+	var shards int
+	if err := tx.QueryRowContext(ctx, LockCounterSQL, id).Scan(&shards); err != nil {
+		return nil, err
+	}
+	if shards > 1 {
+		if _, err := tx.ExecContext(ctx, LockCounterShardsSQL, id); err != nil {
+			return nil, err
+		}
+	}
+
+	row := tx.QueryRowContext(ctx, SetCounterSQL, id, value, expectedVersion, now)
+
+	var previous int64
+	counter, err := scanCounter(row, &previous)
+	if err == sql.ErrNoRows {
+		// Nothing was updated, find out which condition did not hold
+		var version int64
+		if err := tx.QueryRowContext(ctx, CounterVersionSQL, id).Scan(&version); err != nil {
+			return nil, err
+		}
+
+		if version != expectedVersion {
+			return nil, model.ErrVersionMismatch
+		}
+
+		return nil, model.ErrOutOfBounds
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	if counter.Shards > 1 {
+		// The value was set on the counter row, so the shards have to start over.
+		// The returned value and the previous one still include what they held.
+		var held int64
+		if err := tx.QueryRowContext(ctx, ResetCounterShardsSQL, id).Scan(&held); err != nil {
+			return nil, err
+		}
+		counter.Value -= held
+		previous += held
+	}
+
+	if err := recordEvent(ctx, tx, id, model.EventSet, counter.Value-previous, counter.Value, now); err != nil {
+		return nil, err
+	}
+
+	if err := saveIdempotencyRecord(ctx, tx, counter); err != nil {
+		return nil, err
+	}
+
+	return counter, nil
+}
 
-	// Check how many rows were affected by the update
-	rowsAffected, err := result.RowsAffected()
+// SoftDeleteCounter marks the counter as deleted without removing the row.
+// It returns the number of rows affected, which is 0 when the counter does not
+// exist or is already deleted.
+func (r *Counter) SoftDeleteCounter(ctx context.Context, id uuid.UUID) (int64, error) {
+	now := time.Now().UTC()
+
+	var rowsAffected int64
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		err := softDeleteCounter(ctx, tx, id, now)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rowsAffected = 1
+
+		return nil
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -88,3 +565,90 @@ func (r *Counter) SoftDeleteCounter(ctx context.Context, id uuid.UUID) (int64, e
 	// Return the number of affected rows
 	return rowsAffected, nil
 }
+
+// softDeleteCounter marks the counter as deleted in tx and records the change.
+// It returns sql.ErrNoRows when the counter does not exist or is already deleted.
+func softDeleteCounter(ctx context.Context, tx *sqlx.Tx, id uuid.UUID, now time.Time) error {
+	var value int64
+	if err := tx.QueryRowContext(ctx, SoftDeleteCounter, id, now).Scan(&value); err != nil {
+		return err
+	}
+
+	if err := recordEvent(ctx, tx, id, model.EventDelete, 0, value, now); err != nil {
+		return err
+	}
+
+	return saveIdempotencyRecord(ctx, tx, nil)
+}
+
+// UpdateCounter changes the metadata of a live counter and returns it.
+// It returns sql.ErrNoRows when the counter does not exist and
+// model.ErrNameTaken when it is renamed to a name taken in its namespace.
+func (r *Counter) UpdateCounter(ctx context.Context, id uuid.UUID, params model.UpdateCounterParams) (*model.Counter, error) {
+	now := time.Now().UTC()
+
+	var counter *model.Counter
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		counter, err = scanCounter(tx.QueryRowContext(ctx, UpdateCounterSQL, id,
+			params.Name, params.Description, params.Unit, params.Labels, now))
+		if isNameTaken(err) {
+			return model.ErrNameTaken
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := recordEvent(ctx, tx, id, model.EventUpdate, 0, counter.Value, now); err != nil {
+			return err
+		}
+
+		return saveIdempotencyRecord(ctx, tx, counter)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return counter, nil
+}
+
+// RestoreCounter clears the deleted mark of a soft deleted counter and returns it.
+// It returns sql.ErrNoRows when there is no deleted counter with the given id and
+// model.ErrNameTaken when another counter took its name in the meantime.
+func (r *Counter) RestoreCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
+	now := time.Now().UTC()
+
+	var counter *model.Counter
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		counter, err = scanCounter(tx.QueryRowContext(ctx, RestoreCounterSQL, id, now))
+		if isNameTaken(err) {
+			return model.ErrNameTaken
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := recordEvent(ctx, tx, id, model.EventRestore, 0, counter.Value, now); err != nil {
+			return err
+		}
+
+		return saveIdempotencyRecord(ctx, tx, counter)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return counter, nil
+}
+
+// PurgeDeletedCounters hard deletes the counters soft deleted before the given time.
+// It returns the number of counters removed.
+func (r *Counter) PurgeDeletedCounters(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, PurgeDeletedCountersSQL, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -5,33 +5,118 @@ import (
 	"database/sql"
 	"gounter/internal/model"
 	counterRepository "gounter/internal/repository"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/brianvoe/gofakeit"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/require"
 )
 
+// counterColumns are the columns returned by every query reading a counter
+var counterColumns = []string{"id", "name", "namespace", "labels", "description", "unit", "value", "min_value", "max_value", "overflow_policy", "shards", "version", "created_at", "updated_at"}
+
+// counterValuePattern matches the value of a counter summed over its shards
+const counterValuePattern = `CASE WHEN counter\.shards > 1 THEN counter\.value \+ \(SELECT COALESCE\(SUM\(value\), 0\) FROM counter_shards WHERE counter_id = counter\.id\) ELSE counter\.value END`
+
+// counterVersionPattern matches the version of a counter summed over its shards
+const counterVersionPattern = `CASE WHEN counter\.shards > 1 THEN counter\.version \+ \(SELECT COALESCE\(SUM\(version\), 0\) FROM counter_shards WHERE counter_id = counter\.id\) ELSE counter\.version END`
+
+// counterUpdatedAtPattern matches the last change of a counter, which may be on a shard
+const counterUpdatedAtPattern = `CASE WHEN counter\.shards > 1 THEN GREATEST\(counter\.updated_at, \(SELECT MAX\(updated_at\) FROM counter_shards WHERE counter_id = counter\.id\)\) ELSE counter\.updated_at END`
+
+// counterColumnsPattern matches the columns selected by every query reading a counter
+const counterColumnsPattern = `id, name, COALESCE\(namespace, ''\) AS namespace, labels, description, unit, ` + counterValuePattern + ` AS value, min_value, max_value, overflow_policy, shards, ` + counterVersionPattern + ` AS version, created_at, ` + counterUpdatedAtPattern + ` AS updated_at`
+
+// counterRow returns the result of a query reading a single unbounded counter
+func counterRow(id interface{}, name string, value int64) *sqlmock.Rows {
+	now := time.Now().UTC()
+
+	return sqlmock.NewRows(counterColumns).
+		AddRow(id, name, "", "{}", "", "", value, nil, nil, "reject", 1, 1, now, now)
+}
+
+// changedCounterRow returns the result of an update that also reads the previous value
+func changedCounterRow(id interface{}, name string, value, previous int64) *sqlmock.Rows {
+	now := time.Now().UTC()
+
+	return sqlmock.NewRows(append(counterColumns, "previous_value")).
+		AddRow(id, name, "", "{}", "", "", value, nil, nil, "reject", 1, 1, now, now, previous)
+}
+
+// expectEvent expects the change to be recorded in the history of the counter
+func expectEvent(mock sqlmock.Sqlmock, eventType model.CounterEventType, delta, value int64) {
+	mock.ExpectExec(regexp.QuoteMeta(counterRepository.InsertCounterEventSQL)).
+		WithArgs(sqlmock.AnyArg(), eventType, delta, value, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+// expectLock expects a counter with the given number of shards to be locked
+// before its version is checked
+func expectLock(mock sqlmock.Sqlmock, id uuid.UUID, shards int) {
+	mock.ExpectQuery(regexp.QuoteMeta(counterRepository.LockCounterSQL)).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"shards"}).AddRow(shards))
+	if shards > 1 {
+		mock.ExpectExec(regexp.QuoteMeta(counterRepository.LockCounterShardsSQL)).
+			WithArgs(id).
+			WillReturnResult(sqlmock.NewResult(0, int64(shards)))
+	}
+}
+
+// expectBuckets expects the change to be added to the time buckets of the counter
+func expectBuckets(mock sqlmock.Sqlmock, delta int64) {
+	mock.ExpectExec(regexp.QuoteMeta(counterRepository.AddToCounterBucketsSQL)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), delta).
+		WillReturnResult(sqlmock.NewResult(1, 3))
+}
+
 func TestRepositoryCreateCounter(t *testing.T) {
 	tests := []struct {
 		name            string
 		setupMock       func(mock sqlmock.Sqlmock)
-		inputName       string
+		input           model.CreateCounterParams
 		expectedCounter *model.Counter
 		expectedError   error
 	}{
 		{
 			name: "successfully creates counter",
 			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
 				// Mock the insertion and return the created counter
-				mock.ExpectQuery(`INSERT INTO counter \(id, name, value, created_at, updated_at\) VALUES \(\$1, \$2, \$3, \$4, \$5\) RETURNING id, name, value;`).
-					WithArgs(sqlmock.AnyArg(), "Test Counter", 0, sqlmock.AnyArg(), sqlmock.AnyArg()).
-					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "value"}).
-						AddRow(gofakeit.UUID(), "Test Counter", 0))
+				mock.ExpectQuery(`INSERT INTO counter \(id, name, namespace, value, min_value, max_value, overflow_policy, shards, version, created_at, updated_at, labels, description, unit\) VALUES \(\$1, \$2, NULLIF\(\$3, ''\), \$4, \$5, \$6, \$7, \$8, 1, \$9, \$10, \$11, \$12, \$13\) RETURNING `+counterColumnsPattern+`;`).
+					WithArgs(sqlmock.AnyArg(), "Test Counter", "", 0, nil, nil, model.OverflowReject, 1, sqlmock.AnyArg(), sqlmock.AnyArg(), "{}", "", "").
+					WillReturnRows(counterRow(gofakeit.UUID(), "Test Counter", 0))
+				expectEvent(mock, model.EventCreate, 0, 0)
+				mock.ExpectCommit()
+			},
+			input: model.CreateCounterParams{Name: "Test Counter", OverflowPolicy: model.OverflowReject, Shards: 1},
+			expectedCounter: &model.Counter{
+				Name:  "Test Counter",
+				Value: 0,
 			},
-			inputName: "Test Counter",
+			expectedError: nil,
+		},
+		{
+			name: "successfully creates sharded counter",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.CreateCounterSQL)).
+					WithArgs(sqlmock.AnyArg(), "Test Counter", "", 0, nil, nil, model.OverflowReject, 4, sqlmock.AnyArg(), sqlmock.AnyArg(), "{}", "", "").
+					WillReturnRows(sqlmock.NewRows(counterColumns).
+						AddRow(gofakeit.UUID(), "Test Counter", "", "{}", "", "", 0, nil, nil, "reject", 4, 1, time.Now(), time.Now()))
+				// One row is created per shard
+				mock.ExpectExec(regexp.QuoteMeta(counterRepository.CreateCounterShardsSQL)).
+					WithArgs(sqlmock.AnyArg(), 4).
+					WillReturnResult(sqlmock.NewResult(0, 4))
+				expectEvent(mock, model.EventCreate, 0, 0)
+				mock.ExpectCommit()
+			},
+			input: model.CreateCounterParams{Name: "Test Counter", OverflowPolicy: model.OverflowReject, Shards: 4},
 			expectedCounter: &model.Counter{
 				Name:  "Test Counter",
 				Value: 0,
@@ -41,14 +126,29 @@ func TestRepositoryCreateCounter(t *testing.T) {
 		{
 			name: "database error during insertion",
 			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
 				// Mock a database error
-				mock.ExpectQuery(`INSERT INTO counter \(id, name, value, created_at, updated_at\) VALUES \(\$1, \$2, \$3, \$4, \$5\) RETURNING id, name, value;`).
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.CreateCounterSQL)).
 					WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
 			},
-			inputName:       "Test Counter",
+			input:           model.CreateCounterParams{Name: "Test Counter", OverflowPolicy: model.OverflowReject, Shards: 1},
 			expectedCounter: nil,
 			expectedError:   sql.ErrConnDone,
 		},
+		{
+			name: "name taken in the namespace",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.CreateCounterSQL)).
+					WithArgs(sqlmock.AnyArg(), "Test Counter", "payments", 0, nil, nil, model.OverflowReject, 1, sqlmock.AnyArg(), sqlmock.AnyArg(), "{}", "", "").
+					WillReturnError(&pq.Error{Code: "23505", Constraint: "counter_namespace_name_key"})
+				mock.ExpectRollback()
+			},
+			input:           model.CreateCounterParams{Name: "Test Counter", Namespace: "payments", OverflowPolicy: model.OverflowReject, Shards: 1},
+			expectedCounter: nil,
+			expectedError:   model.ErrNameTaken,
+		},
 	}
 
 	for _, tt := range tests {
@@ -63,7 +163,7 @@ func TestRepositoryCreateCounter(t *testing.T) {
 			tt.setupMock(mock)
 
 			ctx := context.TODO()
-			counter, err := repo.CreateCounter(ctx, tt.inputName)
+			counter, err := repo.CreateCounter(ctx, tt.input)
 
 			// Validate the results
 			if tt.expectedError != nil {
@@ -86,41 +186,129 @@ func TestRepositoryCreateCounter(t *testing.T) {
 func TestRepositoryIncrementCounter(t *testing.T) {
 	tests := []struct {
 		name          string
-		setupMock     func(mock sqlmock.Sqlmock, id uuid.UUID)
+		setupMock     func(mock sqlmock.Sqlmock, id uuid.UUID, delta int64)
+		delta         int64
 		id            uuid.UUID
 		expectedValue *model.Counter
 		expectedError error
 	}{
 		{
 			name: "successfully increments counter",
-			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
-				mock.ExpectQuery(`UPDATE counter SET value = value \+ 1 WHERE id = \$1 RETURNING id, name, value;`).
-					WithArgs(id).
-					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "value"}).
-						AddRow(gofakeit.UUID(), "Test Counter", 11))
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID, delta int64) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.IncrementCounterSQL)).
+					WithArgs(id, delta, sqlmock.AnyArg()).
+					WillReturnRows(changedCounterRow(gofakeit.UUID(), "Test Counter", 11, 10))
+				expectEvent(mock, model.EventIncrement, 1, 11)
+				expectBuckets(mock, 1)
+				mock.ExpectCommit()
 			},
 			id:            uuid.New(),
+			delta:         1,
 			expectedValue: &model.Counter{Name: "Test Counter", Value: 11},
 			expectedError: nil,
 		},
+		{
+			name: "successfully decrements counter by delta",
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID, delta int64) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.IncrementCounterSQL)).
+					WithArgs(id, delta, sqlmock.AnyArg()).
+					WillReturnRows(changedCounterRow(gofakeit.UUID(), "Test Counter", -490, 10))
+				expectEvent(mock, model.EventDecrement, -500, -490)
+				expectBuckets(mock, -500)
+				mock.ExpectCommit()
+			},
+			id:            uuid.New(),
+			delta:         -500,
+			expectedValue: &model.Counter{Name: "Test Counter", Value: -490},
+			expectedError: nil,
+		},
+		{
+			name: "records the clamped delta of a saturating counter",
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID, delta int64) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.IncrementCounterSQL)).
+					WithArgs(id, delta, sqlmock.AnyArg()).
+					WillReturnRows(changedCounterRow(gofakeit.UUID(), "Test Counter", 100, 98))
+				expectEvent(mock, model.EventIncrement, 2, 100)
+				expectBuckets(mock, 2)
+				mock.ExpectCommit()
+			},
+			id:            uuid.New(),
+			delta:         5,
+			expectedValue: &model.Counter{Name: "Test Counter", Value: 100},
+			expectedError: nil,
+		},
+		{
+			name: "increments one shard of a sharded counter",
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID, delta int64) {
+				mock.ExpectBegin()
+				// The single row update skips sharded counters
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.IncrementCounterSQL)).
+					WithArgs(id, delta, sqlmock.AnyArg()).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.CounterShardsSQL)).
+					WithArgs(id).
+					WillReturnRows(sqlmock.NewRows([]string{"shards"}).AddRow(4))
+				mock.ExpectExec(regexp.QuoteMeta(counterRepository.IncrementCounterShardSQL)).
+					WithArgs(id, sqlmock.AnyArg(), delta, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.GetCounterSQL)).
+					WithArgs(id).
+					WillReturnRows(counterRow(id, "Test Counter", 1003))
+				expectEvent(mock, model.EventIncrement, 3, 1003)
+				expectBuckets(mock, 3)
+				mock.ExpectCommit()
+			},
+			id:            uuid.New(),
+			delta:         3,
+			expectedValue: &model.Counter{Name: "Test Counter", Value: 1003},
+			expectedError: nil,
+		},
 		{
 			name: "counter not found",
-			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
-				mock.ExpectQuery(`UPDATE counter SET value = value \+ 1 WHERE id = \$1 RETURNING id, name, value;`).
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID, delta int64) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.IncrementCounterSQL)).
+					WithArgs(id, delta, sqlmock.AnyArg()).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.CounterShardsSQL)).
 					WithArgs(id).
 					WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
 			},
 			id:            uuid.New(),
+			delta:         1,
 			expectedError: sql.ErrNoRows,
 		},
 		{
-			name: "database error",
-			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
-				mock.ExpectQuery(`UPDATE counter SET value = value \+ 1 WHERE id = \$1 RETURNING id, name, value;`).
+			name: "change rejected by the bounds",
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID, delta int64) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.IncrementCounterSQL)).
+					WithArgs(id, delta, sqlmock.AnyArg()).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.CounterShardsSQL)).
 					WithArgs(id).
+					WillReturnRows(sqlmock.NewRows([]string{"shards"}).AddRow(1))
+				mock.ExpectRollback()
+			},
+			id:            uuid.New(),
+			delta:         100,
+			expectedError: model.ErrOutOfBounds,
+		},
+		{
+			name: "database error",
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID, delta int64) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.IncrementCounterSQL)).
+					WithArgs(id, delta, sqlmock.AnyArg()).
 					WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
 			},
 			id:            uuid.New(),
+			delta:         1,
 			expectedError: sql.ErrConnDone,
 		},
 	}
@@ -134,11 +322,11 @@ func TestRepositoryIncrementCounter(t *testing.T) {
 			sqlxDB := sqlx.NewDb(db, "postgres")
 			repo := counterRepository.New(sqlxDB)
 
-			tt.setupMock(mock, tt.id)
+			tt.setupMock(mock, tt.id, tt.delta)
 
 			// Call the IncrementCounter function
 			ctx := context.TODO()
-			updatedCounter, err := repo.IncrementCounter(ctx, tt.id)
+			updatedCounter, err := repo.IncrementCounter(ctx, tt.id, tt.delta)
 
 			// Validate the results
 			if tt.expectedError != nil {
@@ -156,6 +344,125 @@ func TestRepositoryIncrementCounter(t *testing.T) {
 	}
 }
 
+func TestRepositorySetCounter(t *testing.T) {
+	tests := []struct {
+		name          string
+		setupMock     func(mock sqlmock.Sqlmock, id uuid.UUID)
+		id            uuid.UUID
+		expectedValue int64
+		expectedError error
+	}{
+		{
+			name: "successfully sets counter",
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectBegin()
+				expectLock(mock, id, 1)
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.SetCounterSQL)).
+					WithArgs(id, int64(42), int64(3), sqlmock.AnyArg()).
+					WillReturnRows(changedCounterRow(id, "Test Counter", 42, 40))
+				expectEvent(mock, model.EventSet, 2, 42)
+				mock.ExpectCommit()
+			},
+			id:            uuid.New(),
+			expectedValue: 42,
+		},
+		{
+			name: "successfully sets sharded counter",
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				now := time.Now().UTC()
+
+				mock.ExpectBegin()
+				expectLock(mock, id, 4)
+				// The returned value still includes the 30 held by the shards
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.SetCounterSQL)).
+					WithArgs(id, int64(42), int64(3), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(append(counterColumns, "previous_value")).
+						AddRow(id, "Test Counter", "", "{}", "", "", 72, nil, nil, "reject", 4, 4, now, now, 10))
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.ResetCounterShardsSQL)).
+					WithArgs(id).
+					WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(30))
+				expectEvent(mock, model.EventSet, 2, 42)
+				mock.ExpectCommit()
+			},
+			id:            uuid.New(),
+			expectedValue: 42,
+		},
+		{
+			name: "version mismatch",
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectBegin()
+				expectLock(mock, id, 1)
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.SetCounterSQL)).
+					WithArgs(id, int64(42), int64(3), sqlmock.AnyArg()).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.CounterVersionSQL)).
+					WithArgs(id).
+					WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(4))
+				mock.ExpectRollback()
+			},
+			id:            uuid.New(),
+			expectedError: model.ErrVersionMismatch,
+		},
+		{
+			name: "value rejected by the bounds",
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectBegin()
+				expectLock(mock, id, 1)
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.SetCounterSQL)).
+					WithArgs(id, int64(42), int64(3), sqlmock.AnyArg()).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.CounterVersionSQL)).
+					WithArgs(id).
+					WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+				mock.ExpectRollback()
+			},
+			id:            uuid.New(),
+			expectedError: model.ErrOutOfBounds,
+		},
+		{
+			name: "counter not found",
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.LockCounterSQL)).
+					WithArgs(id).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			id:            uuid.New(),
+			expectedError: sql.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			sqlxDB := sqlx.NewDb(db, "postgres")
+			repo := counterRepository.New(sqlxDB)
+
+			tt.setupMock(mock, tt.id)
+
+			ctx := context.TODO()
+			counter, err := repo.SetCounter(ctx, tt.id, 42, 3)
+
+			// Validate the results
+			if tt.expectedError != nil {
+				require.Error(t, err)
+				require.Equal(t, tt.expectedError, err)
+				require.Nil(t, counter)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tt.expectedValue, counter.Value)
+			}
+
+			err = mock.ExpectationsWereMet()
+			require.NoError(t, err)
+		})
+	}
+}
+
 func TestRepositorySoftDeleteCounter(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -167,10 +474,13 @@ func TestRepositorySoftDeleteCounter(t *testing.T) {
 		{
 			name: "successfully soft deletes counter",
 			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
-				// Mock the update and return 1 row affected
-				mock.ExpectExec(`DELETE FROM counter WHERE id = \$1;`).
-					WithArgs(id).
-					WillReturnResult(sqlmock.NewResult(1, 1)) // 1 row affected
+				mock.ExpectBegin()
+				// Mock the update and return the value of the deleted counter
+				mock.ExpectQuery(`UPDATE counter SET deleted_at = \$2, updated_at = \$2, version = version \+ 1 WHERE id = \$1 AND deleted_at IS NULL RETURNING `+counterValuePattern+`;`).
+					WithArgs(id, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(7))
+				expectEvent(mock, model.EventDelete, 0, 7)
+				mock.ExpectCommit()
 			},
 			id:               uuid.New(),
 			expectedAffected: 1,
@@ -179,10 +489,12 @@ func TestRepositorySoftDeleteCounter(t *testing.T) {
 		{
 			name: "counter not found",
 			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectBegin()
 				// Mock the update but return 0 rows affected (no such counter)
-				mock.ExpectExec(`DELETE FROM counter WHERE id = \$1;`).
-					WithArgs(id).
-					WillReturnResult(sqlmock.NewResult(1, 0)) // 0 rows affected
+				mock.ExpectQuery(`UPDATE counter SET deleted_at = \$2, updated_at = \$2, version = version \+ 1 WHERE id = \$1 AND deleted_at IS NULL RETURNING `+counterValuePattern+`;`).
+					WithArgs(id, sqlmock.AnyArg()).
+					WillReturnError(sql.ErrNoRows) // 0 rows affected
+				mock.ExpectCommit()
 			},
 			id:               uuid.New(),
 			expectedAffected: 0,
@@ -191,10 +503,12 @@ func TestRepositorySoftDeleteCounter(t *testing.T) {
 		{
 			name: "counter already deleted",
 			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectBegin()
 				// Mock the update but return 0 rows affected (already deleted)
-				mock.ExpectExec(`DELETE FROM counter WHERE id = \$1;`).
-					WithArgs(id).
-					WillReturnResult(sqlmock.NewResult(1, 0)) // 0 rows affected
+				mock.ExpectQuery(`UPDATE counter SET deleted_at = \$2, updated_at = \$2, version = version \+ 1 WHERE id = \$1 AND deleted_at IS NULL RETURNING `+counterValuePattern+`;`).
+					WithArgs(id, sqlmock.AnyArg()).
+					WillReturnError(sql.ErrNoRows) // 0 rows affected
+				mock.ExpectCommit()
 			},
 			id:               uuid.New(),
 			expectedAffected: 0,
@@ -203,10 +517,12 @@ func TestRepositorySoftDeleteCounter(t *testing.T) {
 		{
 			name: "database error during update",
 			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectBegin()
 				// Mock a database error
-				mock.ExpectExec(`DELETE FROM counter WHERE id = \$1;`).
-					WithArgs(id).
+				mock.ExpectQuery(`UPDATE counter SET deleted_at = \$2, updated_at = \$2, version = version \+ 1 WHERE id = \$1 AND deleted_at IS NULL RETURNING `+counterValuePattern+`;`).
+					WithArgs(id, sqlmock.AnyArg()).
 					WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
 			},
 			id:               uuid.New(),
 			expectedAffected: 0,
@@ -243,3 +559,343 @@ func TestRepositorySoftDeleteCounter(t *testing.T) {
 		})
 	}
 }
+
+func TestRepositoryGetCounter(t *testing.T) {
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name            string
+		setupMock       func(mock sqlmock.Sqlmock, id uuid.UUID)
+		id              uuid.UUID
+		expectedCounter *model.Counter
+		expectedError   error
+	}{
+		{
+			name: "successfully fetches counter",
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectQuery(`SELECT ` + counterColumnsPattern + ` FROM counter WHERE id = \$1 AND deleted_at IS NULL;`).
+					WithArgs(id).
+					WillReturnRows(sqlmock.NewRows(counterColumns).
+						AddRow(id, "Test Counter", "", "{}", "", "", 7, nil, nil, "reject", 1, 1, now, now))
+			},
+			id:              uuid.New(),
+			expectedCounter: &model.Counter{Name: "Test Counter", Value: 7, CreatedAt: now, UpdatedAt: now},
+			expectedError:   nil,
+		},
+		{
+			name: "counter not found",
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectQuery(`SELECT ` + counterColumnsPattern + ` FROM counter WHERE id = \$1 AND deleted_at IS NULL;`).
+					WithArgs(id).
+					WillReturnError(sql.ErrNoRows)
+			},
+			id:            uuid.New(),
+			expectedError: sql.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			sqlxDB := sqlx.NewDb(db, "postgres")
+			repo := counterRepository.New(sqlxDB)
+
+			tt.setupMock(mock, tt.id)
+
+			ctx := context.TODO()
+			counter, err := repo.GetCounter(ctx, tt.id)
+
+			// Validate the results
+			if tt.expectedError != nil {
+				require.Error(t, err)
+				require.Equal(t, tt.expectedError, err)
+				require.Nil(t, counter)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tt.id, counter.ID)
+				require.Equal(t, tt.expectedCounter.Name, counter.Name)
+				require.Equal(t, tt.expectedCounter.Value, counter.Value)
+				require.Equal(t, tt.expectedCounter.CreatedAt, counter.CreatedAt)
+				require.Equal(t, tt.expectedCounter.UpdatedAt, counter.UpdatedAt)
+			}
+
+			err = mock.ExpectationsWereMet()
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestRepositoryListCounters(t *testing.T) {
+	now := time.Now().UTC()
+	after := &model.Counter{ID: uuid.New(), Name: "page_b", Value: 4}
+	ids := []uuid.UUID{uuid.New(), uuid.New()}
+
+	tests := []struct {
+		name          string
+		filter        model.CounterFilter
+		setupMock     func(mock sqlmock.Sqlmock)
+		expectedCount int
+		expectedError bool
+	}{
+		{
+			name:   "lists counters without filters",
+			filter: model.CounterFilter{SortBy: model.SortByCreatedAt, Limit: 3},
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT ` + counterColumnsPattern + ` FROM counter WHERE deleted_at IS NULL ORDER BY created_at ASC, id ASC LIMIT \$1;`).
+					WithArgs(3).
+					WillReturnRows(sqlmock.NewRows(counterColumns).
+						AddRow(uuid.New(), "a", "", "{}", "", "", 1, nil, nil, "reject", 1, 1, now, now).
+						AddRow(uuid.New(), "b", "", "{}", "", "", 2, int64(0), int64(10), "saturate", 1, 1, now, now))
+			},
+			expectedCount: 2,
+		},
+		{
+			name: "filters by prefix and ids after a cursor",
+			filter: model.CounterFilter{
+				NamePrefix: "page_%",
+				IDs:        ids,
+				SortBy:     model.SortByName,
+				Descending: true,
+				After:      after,
+				Limit:      2,
+			},
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT `+counterColumnsPattern+` FROM counter WHERE deleted_at IS NULL AND name LIKE \$1 AND id = ANY\(\$2\) AND \(name, id\) < \(\$3, \$4\) ORDER BY name DESC, id DESC LIMIT \$5;`).
+					WithArgs(`page\_\%%`, sqlmock.AnyArg(), "page_b", after.ID, 2).
+					WillReturnRows(sqlmock.NewRows(counterColumns).
+						AddRow(ids[0], "page_a", "", "{}", "", "", 1, nil, nil, "reject", 1, 1, now, now))
+			},
+			expectedCount: 1,
+		},
+		{
+			name:   "filters by labels",
+			filter: model.CounterFilter{Labels: model.Labels{"team": "payments"}, SortBy: model.SortByCreatedAt, Limit: 2},
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT `+counterColumnsPattern+` FROM counter WHERE deleted_at IS NULL AND labels @> \$1::jsonb ORDER BY created_at ASC, id ASC LIMIT \$2;`).
+					WithArgs(`{"team":"payments"}`, 2).
+					WillReturnRows(sqlmock.NewRows(counterColumns).
+						AddRow(uuid.New(), "a", "", `{"team":"payments","env":"prod"}`, "", "", 1, nil, nil, "reject", 1, 1, now, now))
+			},
+			expectedCount: 1,
+		},
+		{
+			name:          "unsupported sort field",
+			filter:        model.CounterFilter{SortBy: "id", Limit: 1},
+			setupMock:     func(mock sqlmock.Sqlmock) {},
+			expectedError: true,
+		},
+		{
+			name:   "database error",
+			filter: model.CounterFilter{SortBy: model.SortByValue, Limit: 1},
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT ` + counterColumnsPattern + ` FROM counter WHERE deleted_at IS NULL ORDER BY ` + counterValuePattern + ` ASC, id ASC LIMIT \$1;`).
+					WillReturnError(sql.ErrConnDone)
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			sqlxDB := sqlx.NewDb(db, "postgres")
+			repo := counterRepository.New(sqlxDB)
+
+			tt.setupMock(mock)
+
+			ctx := context.TODO()
+			counters, err := repo.ListCounters(ctx, tt.filter)
+
+			// Validate the results
+			if tt.expectedError {
+				require.Error(t, err)
+				require.Nil(t, counters)
+			} else {
+				require.NoError(t, err)
+				require.Len(t, counters, tt.expectedCount)
+			}
+
+			err = mock.ExpectationsWereMet()
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestRepositoryUpdateCounter(t *testing.T) {
+	now := time.Now().UTC()
+	name, unit := "Renamed", "requests"
+	labels := model.Labels{"team": "payments"}
+
+	tests := []struct {
+		name          string
+		setupMock     func(mock sqlmock.Sqlmock, id uuid.UUID)
+		id            uuid.UUID
+		params        model.UpdateCounterParams
+		expectedError error
+	}{
+		{
+			name: "successfully updates counter",
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.UpdateCounterSQL)).
+					WithArgs(id, name, nil, unit, `{"team":"payments"}`, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(counterColumns).
+						AddRow(id, name, "", `{"team":"payments"}`, "", unit, 5, nil, nil, "reject", 1, 2, now, now))
+				expectEvent(mock, model.EventUpdate, 0, 5)
+				mock.ExpectCommit()
+			},
+			id:     uuid.New(),
+			params: model.UpdateCounterParams{Name: &name, Unit: &unit, Labels: &labels},
+		},
+		{
+			name: "counter not found",
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.UpdateCounterSQL)).
+					WithArgs(id, nil, nil, unit, nil, sqlmock.AnyArg()).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			id:            uuid.New(),
+			params:        model.UpdateCounterParams{Unit: &unit},
+			expectedError: sql.ErrNoRows,
+		},
+		{
+			name: "renamed to a name taken in the namespace",
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.UpdateCounterSQL)).
+					WithArgs(id, name, nil, nil, nil, sqlmock.AnyArg()).
+					WillReturnError(&pq.Error{Code: "23505", Constraint: "counter_namespace_name_key"})
+				mock.ExpectRollback()
+			},
+			id:            uuid.New(),
+			params:        model.UpdateCounterParams{Name: &name},
+			expectedError: model.ErrNameTaken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			sqlxDB := sqlx.NewDb(db, "postgres")
+			repo := counterRepository.New(sqlxDB)
+
+			tt.setupMock(mock, tt.id)
+
+			counter, err := repo.UpdateCounter(context.TODO(), tt.id, tt.params)
+
+			if tt.expectedError != nil {
+				require.Error(t, err)
+				require.Equal(t, tt.expectedError, err)
+				require.Nil(t, counter)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, name, counter.Name)
+				require.Equal(t, unit, counter.Unit)
+				require.Equal(t, labels, counter.Labels)
+			}
+
+			err = mock.ExpectationsWereMet()
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestRepositoryRestoreCounter(t *testing.T) {
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name          string
+		setupMock     func(mock sqlmock.Sqlmock, id uuid.UUID)
+		id            uuid.UUID
+		expectedError error
+	}{
+		{
+			name: "successfully restores counter",
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`UPDATE counter SET deleted_at = NULL, updated_at = \$2, version = version \+ 1 WHERE id = \$1 AND deleted_at IS NOT NULL RETURNING `+counterColumnsPattern+`;`).
+					WithArgs(id, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows(counterColumns).
+						AddRow(id, "Test Counter", "", "{}", "", "", 5, nil, nil, "reject", 1, 1, now, now))
+				expectEvent(mock, model.EventRestore, 0, 5)
+				mock.ExpectCommit()
+			},
+			id:            uuid.New(),
+			expectedError: nil,
+		},
+		{
+			name: "counter not deleted or not found",
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`UPDATE counter SET deleted_at = NULL, updated_at = \$2, version = version \+ 1 WHERE id = \$1 AND deleted_at IS NOT NULL RETURNING `+counterColumnsPattern+`;`).
+					WithArgs(id, sqlmock.AnyArg()).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			id:            uuid.New(),
+			expectedError: sql.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			sqlxDB := sqlx.NewDb(db, "postgres")
+			repo := counterRepository.New(sqlxDB)
+
+			tt.setupMock(mock, tt.id)
+
+			ctx := context.TODO()
+			counter, err := repo.RestoreCounter(ctx, tt.id)
+
+			// Validate the results
+			if tt.expectedError != nil {
+				require.Error(t, err)
+				require.Equal(t, tt.expectedError, err)
+				require.Nil(t, counter)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tt.id, counter.ID)
+				require.Equal(t, int64(5), counter.Value)
+			}
+
+			err = mock.ExpectationsWereMet()
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestRepositoryPurgeDeletedCounters(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	repo := counterRepository.New(sqlxDB)
+
+	before := time.Now().UTC()
+	mock.ExpectExec(`DELETE FROM counter WHERE deleted_at IS NOT NULL AND deleted_at < \$1;`).
+		WithArgs(before).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	purged, err := repo.PurgeDeletedCounters(context.TODO(), before)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), purged)
+
+	err = mock.ExpectationsWereMet()
+	require.NoError(t, err)
+}
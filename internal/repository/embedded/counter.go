@@ -0,0 +1,433 @@
+// Package embedded is a storage engine that needs no database server. Counters
+// are kept in memory, every change is checked against them, then appended to a
+// write-ahead log and synced to disk before it is applied, so only the changes
+// that apply are logged. Snapshots of the counters periodically
+// replace the log written before them. On startup the latest snapshot is
+// loaded and the rest of the log replayed. Batches and aggregated increments
+// are not supported.
+package embedded
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gounter/internal/model"
+	"gounter/internal/repository/memory"
+	"gounter/internal/service"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultSnapshotInterval is how often a snapshot is taken
+const DefaultSnapshotInterval = 5 * time.Minute
+
+// ErrClosed is returned for changes made after the storage was closed
+var ErrClosed = errors.New("storage is closed")
+
+// Counter implements service.Repository on top of the in-memory repository,
+// which the log records are applied to
+type Counter struct {
+	dir              string
+	snapshotInterval time.Duration
+	state            *memory.Counter
+
+	// mu serializes the changes, so they are applied in the order they are logged
+	mu  sync.Mutex
+	log *segment
+	// seq is the sequence number of the last logged change
+	seq uint64
+	// applying is the change being applied, it gives the state its clock and ids
+	applying *record
+	// unlogged is set while applying a change that is not in the log yet
+	unlogged bool
+	closed   bool
+
+	// snapshotting allows a single snapshot at a time
+	snapshotting sync.Mutex
+	// snapshotSeq is the sequence number the latest snapshot covers
+	snapshotSeq uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+var _ service.Repository = (*Counter)(nil)
+
+// Option configures optional behaviour of the storage
+type Option func(*Counter)
+
+// WithSnapshotInterval sets how often a snapshot is taken, 0 disables the periodic snapshots
+func WithSnapshotInterval(interval time.Duration) Option {
+	return func(r *Counter) {
+		r.snapshotInterval = interval
+	}
+}
+
+// Open recovers the counters stored in dir, creating it when missing, and
+// starts taking periodic snapshots. Close must be called to release the files.
+func Open(dir string, opts ...Option) (*Counter, error) {
+	r := &Counter{
+		dir:              dir,
+		snapshotInterval: DefaultSnapshotInterval,
+		stop:             make(chan struct{}),
+		done:             make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	r.state = memory.New(
+		memory.WithClock(func() time.Time {
+			return r.applying.At
+		}),
+		memory.WithIDs(func() uuid.UUID {
+			return r.applying.CounterID
+		}),
+		memory.WithBeforeChange(r.logChange))
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	if err := r.recover(); err != nil {
+		return nil, err
+	}
+
+	go r.run()
+
+	return r, nil
+}
+
+// recover loads the latest snapshot, replays the log written after it and
+// opens the last segment for appending
+func (r *Counter) recover() error {
+	snap, err := readSnapshot(r.dir)
+	if err != nil {
+		return fmt.Errorf("reading snapshot: %v", err)
+	}
+
+	if snap != nil {
+		r.state.Restore(snap.State)
+		r.seq, r.snapshotSeq = snap.Seq, snap.Seq
+	}
+
+	segments, err := listSegments(r.dir)
+	if err != nil {
+		return err
+	}
+
+	for i, info := range segments {
+		records, size, err := readSegment(info.path)
+		last := i == len(segments)-1
+		// Only the last record of the log can be torn by a crash
+		if err != nil && (err != errCorruptRecord || !last) {
+			return fmt.Errorf("reading %s: %v", info.path, err)
+		}
+
+		for _, rec := range records {
+			if rec.Seq <= r.seq {
+				continue
+			}
+			if rec.Seq != r.seq+1 {
+				return fmt.Errorf("reading %s: missing changes %d to %d", info.path, r.seq+1, rec.Seq-1)
+			}
+
+			r.seq = rec.Seq
+			// Older logs may hold changes that failed when they were made,
+			// they fail the same way again
+			r.apply(rec)
+		}
+
+		if last {
+			if r.log, err = openSegment(info, size); err != nil {
+				return err
+			}
+		}
+	}
+
+	if r.log == nil {
+		if r.log, err = createSegment(r.dir, r.seq+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// run takes the periodic snapshots until the storage is closed
+func (r *Counter) run() {
+	defer close(r.done)
+
+	if r.snapshotInterval <= 0 {
+		<-r.stop
+		return
+	}
+
+	ticker := time.NewTicker(r.snapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.Snapshot(); err != nil {
+				log.Println("Failed to take snapshot:", err)
+			}
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// Snapshot writes the current state of the counters and removes the log
+// segments it covers. Changes go on while the snapshot is written.
+func (r *Counter) Snapshot() error {
+	r.snapshotting.Lock()
+	defer r.snapshotting.Unlock()
+
+	r.mu.Lock()
+	if r.closed || r.seq == r.snapshotSeq {
+		r.mu.Unlock()
+		return nil
+	}
+
+	state := r.state.Snapshot()
+	seq := r.seq
+
+	// Later changes go to a new segment, so the ones before can be removed
+	next, err := createSegment(r.dir, seq+1)
+	if err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	previous := r.log
+	r.log = next
+	r.mu.Unlock()
+
+	if err := previous.close(); err != nil {
+		return err
+	}
+
+	if err := writeSnapshot(r.dir, &snapshot{Seq: seq, State: state}); err != nil {
+		return err
+	}
+	r.snapshotSeq = seq
+
+	segments, err := listSegments(r.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range segments {
+		if info.first <= seq {
+			if err := os.Remove(info.path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return syncDir(r.dir)
+}
+
+// Close takes a last snapshot and closes the log
+func (r *Counter) Close() error {
+	r.mu.Lock()
+	closed := r.closed
+	r.mu.Unlock()
+
+	if closed {
+		return nil
+	}
+
+	close(r.stop)
+	<-r.done
+
+	err := r.Snapshot()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	if closeErr := r.log.close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// change applies a change made with ctx, the state logs it through logChange
+// once it is known to apply
+func (r *Counter) change(ctx context.Context, rec *record) (*model.Counter, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil, 0, ErrClosed
+	}
+
+	rec.Seq = r.seq + 1
+	rec.At = time.Now().UTC()
+	rec.Subject, _ = model.SubjectFromContext(ctx)
+	if idempotency, ok := model.IdempotencyRecordFromContext(ctx); ok {
+		rec.Idempotency = &idempotencyKey{Subject: idempotency.Subject, Key: idempotency.Key, Request: idempotency.Request, Since: idempotency.Since}
+	}
+
+	r.unlogged = true
+	defer func() {
+		r.unlogged = false
+	}()
+
+	return r.apply(rec)
+}
+
+// logChange appends the change being applied to the log, after the state
+// validated it and before the state changes. It is called by the state with
+// mu held, and does nothing for the changes replayed from the log.
+func (r *Counter) logChange() error {
+	if !r.unlogged {
+		return nil
+	}
+
+	if err := r.log.append(r.applying); err != nil {
+		return err
+	}
+	r.seq = r.applying.Seq
+
+	return nil
+}
+
+// apply applies a logged change to the state, it must be called with mu held
+func (r *Counter) apply(rec *record) (*model.Counter, int64, error) {
+	r.applying = rec
+	defer func() {
+		r.applying = nil
+	}()
+
+	ctx := context.Background()
+	if rec.Subject != "" {
+		ctx = model.WithSubject(ctx, rec.Subject)
+	}
+	if rec.Idempotency != nil {
+		ctx = model.WithIdempotencyRecord(ctx, &model.IdempotencyRecord{
+			Subject: rec.Idempotency.Subject,
+			Key:     rec.Idempotency.Key,
+			Request: rec.Idempotency.Request,
+			Since:   rec.Idempotency.Since,
+		})
+	}
+
+	var (
+		counter      *model.Counter
+		rowsAffected int64
+		err          error
+	)
+	switch rec.Op {
+	case opCreate:
+		counter, err = r.state.CreateCounter(ctx, *rec.Create)
+	case opIncrement:
+		counter, err = r.state.IncrementCounter(ctx, rec.CounterID, rec.Delta)
+	case opSet:
+		counter, err = r.state.SetCounter(ctx, rec.CounterID, rec.Value, rec.ExpectedVersion)
+	case opDelete:
+		rowsAffected, err = r.state.SoftDeleteCounter(ctx, rec.CounterID)
+	case opRestore:
+		counter, err = r.state.RestoreCounter(ctx, rec.CounterID)
+	case opUpdate:
+		counter, err = r.state.UpdateCounter(ctx, rec.CounterID, *rec.Update)
+	case opPurge:
+		rowsAffected, err = r.state.PurgeDeletedCounters(ctx, *rec.Before)
+	case opPrune:
+		rowsAffected, err = r.state.PruneCounterBuckets(ctx, rec.Granularity, *rec.Before)
+	default:
+		err = fmt.Errorf("unknown operation %q", rec.Op)
+	}
+
+	return counter, rowsAffected, err
+}
+
+// CreateCounter creates a counter
+func (r *Counter) CreateCounter(ctx context.Context, params model.CreateCounterParams) (*model.Counter, error) {
+	counter, _, err := r.change(ctx, &record{Op: opCreate, CounterID: uuid.New(), Create: &params})
+	return counter, err
+}
+
+// GetCounter fetches a single counter by its id
+func (r *Counter) GetCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
+	return r.state.GetCounter(ctx, id)
+}
+
+// GetCounterByName fetches the live counter with the name in the namespace
+func (r *Counter) GetCounterByName(ctx context.Context, namespace, name string) (*model.Counter, error) {
+	return r.state.GetCounterByName(ctx, namespace, name)
+}
+
+// ListCounters returns the counters matching the filter
+func (r *Counter) ListCounters(ctx context.Context, filter model.CounterFilter) ([]*model.Counter, error) {
+	return r.state.ListCounters(ctx, filter)
+}
+
+// IncrementCounter adds delta to the counter and returns the new value
+func (r *Counter) IncrementCounter(ctx context.Context, id uuid.UUID, delta int64) (*model.Counter, error) {
+	counter, _, err := r.change(ctx, &record{Op: opIncrement, CounterID: id, Delta: delta})
+	return counter, err
+}
+
+// SetCounter sets the counter to value when its version is still expectedVersion
+func (r *Counter) SetCounter(ctx context.Context, id uuid.UUID, value int64, expectedVersion int64) (*model.Counter, error) {
+	counter, _, err := r.change(ctx, &record{Op: opSet, CounterID: id, Value: value, ExpectedVersion: expectedVersion})
+	return counter, err
+}
+
+// UpdateCounter changes the metadata of the counter
+func (r *Counter) UpdateCounter(ctx context.Context, id uuid.UUID, params model.UpdateCounterParams) (*model.Counter, error) {
+	counter, _, err := r.change(ctx, &record{Op: opUpdate, CounterID: id, Update: &params})
+	return counter, err
+}
+
+// SoftDeleteCounter marks the counter as deleted
+func (r *Counter) SoftDeleteCounter(ctx context.Context, id uuid.UUID) (int64, error) {
+	_, rowsAffected, err := r.change(ctx, &record{Op: opDelete, CounterID: id})
+	return rowsAffected, err
+}
+
+// RestoreCounter clears the deleted mark of a soft deleted counter
+func (r *Counter) RestoreCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
+	counter, _, err := r.change(ctx, &record{Op: opRestore, CounterID: id})
+	return counter, err
+}
+
+// PurgeDeletedCounters removes the counters soft deleted before the given time
+func (r *Counter) PurgeDeletedCounters(ctx context.Context, before time.Time) (int64, error) {
+	_, purged, err := r.change(ctx, &record{Op: opPurge, Before: &before})
+	return purged, err
+}
+
+// GetIdempotencyRecord returns the record saved by subject under key since the given time
+func (r *Counter) GetIdempotencyRecord(ctx context.Context, subject, key string, since time.Time) (*model.IdempotencyRecord, error) {
+	return r.state.GetIdempotencyRecord(ctx, subject, key, since)
+}
+
+// ListCounterEvents returns the history of a counter matching the filter
+func (r *Counter) ListCounterEvents(ctx context.Context, filter model.CounterEventFilter) ([]*model.CounterEvent, error) {
+	return r.state.ListCounterEvents(ctx, filter)
+}
+
+// ListCounterBuckets returns the buckets of a counter starting within [from, to)
+func (r *Counter) ListCounterBuckets(ctx context.Context, id uuid.UUID, granularity model.Granularity, from, to time.Time) ([]*model.CounterBucket, error) {
+	return r.state.ListCounterBuckets(ctx, id, granularity, from, to)
+}
+
+// SumCounterBuckets returns the buckets of the counters starting within [from, to), summed across the counters
+func (r *Counter) SumCounterBuckets(ctx context.Context, ids []uuid.UUID, granularity model.Granularity, from, to time.Time) ([]*model.CounterBucket, error) {
+	return r.state.SumCounterBuckets(ctx, ids, granularity, from, to)
+}
+
+// PruneCounterBuckets removes the buckets of the granularity starting before the given time
+func (r *Counter) PruneCounterBuckets(ctx context.Context, granularity model.Granularity, before time.Time) (int64, error) {
+	_, pruned, err := r.change(ctx, &record{Op: opPrune, Granularity: granularity, Before: &before})
+	return pruned, err
+}
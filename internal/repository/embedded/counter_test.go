@@ -0,0 +1,210 @@
+package embedded_test
+
+import (
+	"context"
+	"gounter/internal/model"
+	"gounter/internal/repository/embedded"
+	"gounter/internal/service"
+	"gounter/test/storagetest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedRepository(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) service.Repository {
+		repo, err := embedded.Open(t.TempDir(), embedded.WithSnapshotInterval(0))
+		require.NoError(t, err)
+		t.Cleanup(func() { repo.Close() })
+
+		return repo
+	})
+}
+
+// open opens the storage in dir without periodic snapshots
+func open(t *testing.T, dir string) *embedded.Counter {
+	repo, err := embedded.Open(dir, embedded.WithSnapshotInterval(0))
+	require.NoError(t, err)
+
+	return repo
+}
+
+// requireSameState checks that both repositories hold the same counters and history
+func requireSameState(t *testing.T, expected, actual *embedded.Counter) {
+	filter := model.CounterFilter{SortBy: model.SortByCreatedAt, Limit: 100}
+
+	expectedCounters, err := expected.ListCounters(context.TODO(), filter)
+	require.NoError(t, err)
+	actualCounters, err := actual.ListCounters(context.TODO(), filter)
+	require.NoError(t, err)
+	require.Equal(t, expectedCounters, actualCounters)
+
+	for _, counter := range expectedCounters {
+		eventFilter := model.CounterEventFilter{CounterID: counter.ID, Limit: 100}
+
+		expectedEvents, err := expected.ListCounterEvents(context.TODO(), eventFilter)
+		require.NoError(t, err)
+		actualEvents, err := actual.ListCounterEvents(context.TODO(), eventFilter)
+		require.NoError(t, err)
+		require.Equal(t, expectedEvents, actualEvents)
+
+		from := model.GranularityDay.BucketStart(counter.CreatedAt)
+		to := from.Add(48 * time.Hour)
+		expectedBuckets, err := expected.ListCounterBuckets(context.TODO(), counter.ID, model.GranularityMinute, from, to)
+		require.NoError(t, err)
+		actualBuckets, err := actual.ListCounterBuckets(context.TODO(), counter.ID, model.GranularityMinute, from, to)
+		require.NoError(t, err)
+		require.Equal(t, expectedBuckets, actualBuckets)
+	}
+}
+
+// makeChanges creates a few counters and changes them
+func makeChanges(t *testing.T, repo *embedded.Counter) {
+	ctx := model.WithSubject(context.TODO(), "edge")
+	max := int64(10)
+
+	for _, params := range []model.CreateCounterParams{
+		storagetest.CounterParams("requests"),
+		{Name: "seats", Max: &max, OverflowPolicy: model.OverflowReject, Shards: 1},
+		storagetest.CounterParams("temporary"),
+	} {
+		counter, err := repo.CreateCounter(ctx, params)
+		require.NoError(t, err)
+
+		_, err = repo.IncrementCounter(ctx, counter.ID, 4)
+		require.NoError(t, err)
+
+		// Failed changes are not logged, so they are not replayed either
+		_, err = repo.IncrementCounter(ctx, counter.ID, 20)
+		if counter.Max != nil {
+			require.Equal(t, model.ErrOutOfBounds, err)
+		} else {
+			require.NoError(t, err)
+		}
+
+		if counter.Name == "temporary" {
+			_, err = repo.SoftDeleteCounter(ctx, counter.ID)
+			require.NoError(t, err)
+		}
+	}
+}
+
+func TestEmbeddedRecoversFromLog(t *testing.T) {
+	dir := t.TempDir()
+
+	repo := open(t, dir)
+	makeChanges(t, repo)
+
+	// Opening the directory again, as after a crash, replays the whole log
+	recovered := open(t, dir)
+	defer recovered.Close()
+
+	requireSameState(t, repo, recovered)
+}
+
+func TestEmbeddedRecoversFromSnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	repo := open(t, dir)
+	makeChanges(t, repo)
+	require.NoError(t, repo.Snapshot())
+
+	// The snapshot replaces the log written before it
+	segments, err := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+	_, err = os.Stat(filepath.Join(dir, "snapshot.json"))
+	require.NoError(t, err)
+
+	// Changes after the snapshot are replayed on top of it
+	makeChanges(t, repo)
+
+	recovered := open(t, dir)
+	requireSameState(t, repo, recovered)
+	require.NoError(t, recovered.Close())
+
+	// Close takes a last snapshot, leaving nothing to replay
+	recovered = open(t, dir)
+	defer recovered.Close()
+	requireSameState(t, repo, recovered)
+}
+
+func TestEmbeddedIgnoresTornRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	repo := open(t, dir)
+	makeChanges(t, repo)
+
+	segments, err := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+
+	// A crash in the middle of a write leaves part of a record behind
+	file, err := os.OpenFile(segments[0], os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = file.Write([]byte{42, 0, 0, 0, 1, 2, 3})
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	recovered := open(t, dir)
+	requireSameState(t, repo, recovered)
+
+	// The torn record is cut off, so later changes are recovered too
+	makeChanges(t, recovered)
+
+	again := open(t, dir)
+	defer again.Close()
+	requireSameState(t, recovered, again)
+}
+
+func TestEmbeddedLogsOnlyChangesThatApply(t *testing.T) {
+	dir := t.TempDir()
+
+	repo := open(t, dir)
+	defer repo.Close()
+
+	max := int64(10)
+	counter, err := repo.CreateCounter(context.TODO(), model.CreateCounterParams{Name: "seats", Namespace: "venue", Max: &max, OverflowPolicy: model.OverflowReject, Shards: 1})
+	require.NoError(t, err)
+
+	segments, err := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+
+	before, err := os.Stat(segments[0])
+	require.NoError(t, err)
+
+	_, err = repo.IncrementCounter(context.TODO(), counter.ID, 20)
+	require.Equal(t, model.ErrOutOfBounds, err)
+	_, err = repo.SetCounter(context.TODO(), counter.ID, 1, counter.Version+1)
+	require.Equal(t, model.ErrVersionMismatch, err)
+	_, err = repo.CreateCounter(context.TODO(), model.CreateCounterParams{Name: "seats", Namespace: "venue", Shards: 1})
+	require.Equal(t, model.ErrNameTaken, err)
+	purged, err := repo.PurgeDeletedCounters(context.TODO(), time.Now().UTC())
+	require.NoError(t, err)
+	require.Equal(t, int64(0), purged)
+
+	// Nothing was appended for the changes that did not apply
+	after, err := os.Stat(segments[0])
+	require.NoError(t, err)
+	require.Equal(t, before.Size(), after.Size())
+
+	_, err = repo.IncrementCounter(context.TODO(), counter.ID, 2)
+	require.NoError(t, err)
+
+	recovered := open(t, dir)
+	defer recovered.Close()
+	requireSameState(t, repo, recovered)
+}
+
+func TestEmbeddedRejectsChangesAfterClose(t *testing.T) {
+	repo := open(t, t.TempDir())
+	require.NoError(t, repo.Close())
+	require.NoError(t, repo.Close())
+
+	_, err := repo.CreateCounter(context.TODO(), storagetest.CounterParams("late"))
+	require.Equal(t, embedded.ErrClosed, err)
+}
@@ -0,0 +1,226 @@
+package embedded
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gounter/internal/model"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Operations recorded in the log
+const (
+	opCreate    = "create"
+	opIncrement = "increment"
+	opSet       = "set"
+	opDelete    = "delete"
+	opRestore   = "restore"
+	opUpdate    = "update"
+	opPurge     = "purge"
+	opPrune     = "prune_buckets"
+)
+
+// recordHeaderSize is the size of the length and checksum written before each record
+const recordHeaderSize = 8
+
+// segmentPattern names the log segments after the sequence number of their first record
+const segmentPattern = "wal-%020d.log"
+
+// errCorruptRecord is returned for a record that was not fully written or got damaged
+var errCorruptRecord = errors.New("corrupt log record")
+
+// record is a change as written to the log. It holds every input of the
+// change, including the time and the id of created counters, so replaying it
+// on the same state gives the same result.
+type record struct {
+	Seq             uint64                     `json:"seq"`
+	Op              string                     `json:"op"`
+	At              time.Time                  `json:"at"`
+	CounterID       uuid.UUID                  `json:"counter_id"`
+	Create          *model.CreateCounterParams `json:"create,omitempty"`
+	Update          *model.UpdateCounterParams `json:"update,omitempty"`
+	Delta           int64                      `json:"delta,omitempty"`
+	Value           int64                      `json:"value,omitempty"`
+	ExpectedVersion int64                      `json:"expected_version,omitempty"`
+	Before          *time.Time                 `json:"before,omitempty"`
+	Granularity     model.Granularity          `json:"granularity,omitempty"`
+	Subject         string                     `json:"subject,omitempty"`
+	Idempotency     *idempotencyKey            `json:"idempotency,omitempty"`
+}
+
+// idempotencyKey is the idempotency record a change was made with
+type idempotencyKey struct {
+	Subject string    `json:"subject,omitempty"`
+	Key     string    `json:"key"`
+	Request string    `json:"request"`
+	Since   time.Time `json:"since"`
+}
+
+// segment is the log file records are appended to
+type segment struct {
+	file  *os.File
+	first uint64
+	size  int64
+}
+
+// segmentInfo is a log file found in the data directory
+type segmentInfo struct {
+	path  string
+	first uint64
+}
+
+// listSegments returns the log segments in dir, oldest first
+func listSegments(dir string) ([]segmentInfo, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]segmentInfo, 0, len(paths))
+	for _, path := range paths {
+		var first uint64
+		if _, err := fmt.Sscanf(filepath.Base(path), segmentPattern, &first); err != nil {
+			return nil, fmt.Errorf("unexpected log file %s", path)
+		}
+		segments = append(segments, segmentInfo{path: path, first: first})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].first < segments[j].first
+	})
+
+	return segments, nil
+}
+
+// createSegment creates an empty segment starting at the given sequence number
+func createSegment(dir string, first uint64) (*segment, error) {
+	file, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf(segmentPattern, first)), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syncDir(dir); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &segment{file: file, first: first}, nil
+}
+
+// openSegment opens an existing segment for appending after its first size bytes,
+// dropping whatever follows them
+func openSegment(info segmentInfo, size int64) (*segment, error) {
+	file, err := os.OpenFile(info.path, os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &segment{file: file, first: info.first, size: size}, nil
+}
+
+// append writes the record and waits for it to reach the disk. A record that
+// could not be written completely is cut off again.
+func (s *segment) append(rec *record) error {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[recordHeaderSize:], payload)
+
+	if _, err := s.file.Write(buf); err != nil {
+		s.file.Truncate(s.size)
+		s.file.Seek(s.size, io.SeekStart)
+		return err
+	}
+
+	if err := s.file.Sync(); err != nil {
+		s.file.Truncate(s.size)
+		s.file.Seek(s.size, io.SeekStart)
+		return err
+	}
+
+	s.size += int64(len(buf))
+
+	return nil
+}
+
+// close closes the segment file
+func (s *segment) close() error {
+	return s.file.Close()
+}
+
+// readSegment reads the records of a segment. It returns the records up to
+// the first one that is incomplete or damaged, the size they take and
+// errCorruptRecord if there was such a record.
+func readSegment(path string) ([]*record, int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		records []*record
+		offset  int64
+	)
+	for offset < int64(len(data)) {
+		rest := data[offset:]
+		if len(rest) < recordHeaderSize {
+			return records, offset, errCorruptRecord
+		}
+
+		length := int64(binary.LittleEndian.Uint32(rest[0:4]))
+		if int64(len(rest)) < recordHeaderSize+length {
+			return records, offset, errCorruptRecord
+		}
+
+		payload := rest[recordHeaderSize : recordHeaderSize+length]
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(rest[4:8]) {
+			return records, offset, errCorruptRecord
+		}
+
+		var rec record
+		decoder := json.NewDecoder(bytes.NewReader(payload))
+		if err := decoder.Decode(&rec); err != nil {
+			return records, offset, errCorruptRecord
+		}
+
+		records = append(records, &rec)
+		offset += recordHeaderSize + length
+	}
+
+	return records, offset, nil
+}
+
+// syncDir makes the creation, removal and renaming of files in dir durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
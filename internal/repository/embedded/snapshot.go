@@ -0,0 +1,72 @@
+package embedded
+
+import (
+	"encoding/json"
+	"gounter/internal/repository/memory"
+	"os"
+	"path/filepath"
+)
+
+// snapshotFile holds the latest snapshot in the data directory
+const snapshotFile = "snapshot.json"
+
+// snapshot is the state of the counters once every record up to Seq was applied
+type snapshot struct {
+	Seq   uint64           `json:"seq"`
+	State *memory.Snapshot `json:"state"`
+}
+
+// readSnapshot reads the latest snapshot, it returns nil when there is none yet
+func readSnapshot(dir string) (*snapshot, error) {
+	data, err := os.ReadFile(filepath.Join(dir, snapshotFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+
+	return &snap, nil
+}
+
+// writeSnapshot replaces the latest snapshot. The snapshot is written to a
+// temporary file first, so a crash leaves either the old or the new one.
+func writeSnapshot(dir string, snap *snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, snapshotFile)
+	tmp := path + ".tmp"
+
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
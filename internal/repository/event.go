@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"gounter/internal/model"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	InsertCounterEventSQL = `
+		INSERT INTO counter_events (counter_id, type, delta, value, subject, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6);`
+
+	ListCounterEventsSQL = `
+		SELECT id, counter_id, type, delta, value, subject, created_at
+		FROM counter_events
+		WHERE counter_id = $1 AND id > $2`
+)
+
+// recordEvent adds a change of the counter to its history in the same
+// transaction as the change. The subject is taken from ctx.
+func recordEvent(ctx context.Context, tx *sqlx.Tx, counterID uuid.UUID, eventType model.CounterEventType, delta, value int64, at time.Time) error {
+	var subject sql.NullString
+	subject.String, subject.Valid = model.SubjectFromContext(ctx)
+
+	_, err := tx.ExecContext(ctx, InsertCounterEventSQL, counterID, eventType, delta, value, subject, at)
+	return err
+}
+
+// ListCounterEvents returns the history of a counter matching the filter, oldest first
+func (r *Counter) ListCounterEvents(ctx context.Context, filter model.CounterEventFilter) ([]*model.CounterEvent, error) {
+	query := ListCounterEventsSQL
+	args := []interface{}{filter.CounterID, filter.AfterID}
+
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		query += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		query += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf("\n\t\tORDER BY id\n\t\tLIMIT $%d;", len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*model.CounterEvent{}
+	for rows.Next() {
+		var (
+			event   model.CounterEvent
+			subject sql.NullString
+		)
+
+		err := rows.Scan(&event.ID, &event.CounterID, &event.Type, &event.Delta, &event.Value, &subject, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		event.Subject = subject.String
+
+		events = append(events, &event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -0,0 +1,120 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"gounter/internal/model"
+	counterRepository "gounter/internal/repository"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+// eventColumns are the columns returned by the history query
+var eventColumns = []string{"id", "counter_id", "type", "delta", "value", "subject", "created_at"}
+
+func TestRepositoryListCounterEvents(t *testing.T) {
+	id := uuid.New()
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	tests := []struct {
+		name           string
+		setupMock      func(mock sqlmock.Sqlmock)
+		filter         model.CounterEventFilter
+		expectedEvents []*model.CounterEvent
+		expectedError  error
+	}{
+		{
+			name: "lists the whole history",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT id, counter_id, type, delta, value, subject, created_at FROM counter_events WHERE counter_id = \$1 AND id > \$2 ORDER BY id LIMIT \$3;`).
+					WithArgs(id, int64(0), 10).
+					WillReturnRows(sqlmock.NewRows(eventColumns).
+						AddRow(1, id, "create", 0, 0, "alice", from).
+						AddRow(2, id, "increment", 5, 5, nil, from))
+			},
+			filter: model.CounterEventFilter{CounterID: id, Limit: 10},
+			expectedEvents: []*model.CounterEvent{
+				{ID: 1, CounterID: id, Type: model.EventCreate, Delta: 0, Value: 0, Subject: "alice", CreatedAt: from},
+				{ID: 2, CounterID: id, Type: model.EventIncrement, Delta: 5, Value: 5, CreatedAt: from},
+			},
+		},
+		{
+			name: "filters by time range after the cursor",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT id, counter_id, type, delta, value, subject, created_at FROM counter_events WHERE counter_id = \$1 AND id > \$2 AND created_at >= \$3 AND created_at < \$4 ORDER BY id LIMIT \$5;`).
+					WithArgs(id, int64(7), from, to, 3).
+					WillReturnRows(sqlmock.NewRows(eventColumns))
+			},
+			filter:         model.CounterEventFilter{CounterID: id, From: &from, To: &to, AfterID: 7, Limit: 3},
+			expectedEvents: []*model.CounterEvent{},
+		},
+		{
+			name: "database error",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.ListCounterEventsSQL)).
+					WillReturnError(sql.ErrConnDone)
+			},
+			filter:        model.CounterEventFilter{CounterID: id, Limit: 10},
+			expectedError: sql.ErrConnDone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			sqlxDB := sqlx.NewDb(db, "postgres")
+			repo := counterRepository.New(sqlxDB)
+
+			tt.setupMock(mock)
+
+			events, err := repo.ListCounterEvents(context.TODO(), tt.filter)
+
+			// Validate the results
+			if tt.expectedError != nil {
+				require.Equal(t, tt.expectedError, err)
+				require.Nil(t, events)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tt.expectedEvents, events)
+			}
+
+			err = mock.ExpectationsWereMet()
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestRepositoryRecordsEventSubject(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	repo := counterRepository.New(sqlxDB)
+
+	id := uuid.New()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(counterRepository.RestoreCounterSQL)).
+		WithArgs(id, sqlmock.AnyArg()).
+		WillReturnRows(counterRow(id, "Test Counter", 5))
+	mock.ExpectExec(regexp.QuoteMeta(counterRepository.InsertCounterEventSQL)).
+		WithArgs(id, model.EventRestore, int64(0), int64(5), sql.NullString{String: "alice", Valid: true}, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	_, err = repo.RestoreCounter(model.WithSubject(context.TODO(), "alice"), id)
+	require.NoError(t, err)
+
+	err = mock.ExpectationsWereMet()
+	require.NoError(t, err)
+}
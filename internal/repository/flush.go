@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"gounter/internal/model"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// FlushIncrementsSQL applies a batch of coalesced increments, given as
+	// (counter id, delta, count) rows in place of %s. The version is bumped once
+	// per coalesced increment, as if they had been written one by one. Bounded
+	// counters are never coalesced, the bounds check only guards against a stale caller.
+	FlushIncrementsSQL = `
+		UPDATE counter
+		SET value = counter.value + batch_delta, version = version + batch_count, updated_at = $1
+		FROM (VALUES %s) AS batch (batch_id, batch_delta, batch_count)
+		WHERE id = batch_id AND deleted_at IS NULL AND min_value IS NULL AND max_value IS NULL
+		RETURNING ` + counterColumns + `;`
+
+	// InsertCounterEventsSQL records one event per row given in place of %s
+	InsertCounterEventsSQL = `
+		INSERT INTO counter_events (counter_id, type, delta, value, subject, created_at)
+		VALUES %s;`
+
+	// AddToCounterBucketsBatchSQL adds several changes, given in place of %s, to their buckets
+	AddToCounterBucketsBatchSQL = `
+		INSERT INTO counter_buckets (counter_id, shard, granularity, bucket_start, delta, increments)
+		VALUES %s
+		ON CONFLICT (counter_id, granularity, bucket_start, shard) DO UPDATE
+		SET delta = counter_buckets.delta + EXCLUDED.delta, increments = counter_buckets.increments + EXCLUDED.increments;`
+)
+
+// maxParameters is the most bind parameters Postgres takes in one statement
+const maxParameters = 65535
+
+// FlushIncrements applies coalesced increments with a single update per counter
+// batch, along with one history event per counter and subject and their time
+// buckets, in one transaction. Statements that would bind more parameters than
+// Postgres takes are split. It returns the updated counters, increments of
+// missing, deleted or bounded counters are dropped.
+func (r *Counter) FlushIncrements(ctx context.Context, increments []model.CoalescedIncrement) ([]*model.Counter, error) {
+	if len(increments) == 0 {
+		return []*model.Counter{}, nil
+	}
+
+	// Sum the increments of every counter, keeping those of each subject for its history
+	var totals []model.CoalescedIncrement
+	bySubject := map[uuid.UUID][]model.CoalescedIncrement{}
+	for _, increment := range increments {
+		if _, ok := bySubject[increment.CounterID]; !ok {
+			totals = append(totals, model.CoalescedIncrement{CounterID: increment.CounterID})
+		}
+		bySubject[increment.CounterID] = append(bySubject[increment.CounterID], increment)
+	}
+	for i := range totals {
+		for _, increment := range bySubject[totals[i].CounterID] {
+			totals[i].Delta += increment.Delta
+			totals[i].Count += increment.Count
+		}
+	}
+
+	// Lock the rows in the same order in every batch so concurrent flushes cannot deadlock
+	sort.Slice(totals, func(i, j int) bool {
+		return bytes.Compare(totals[i].CounterID[:], totals[j].CounterID[:]) < 0
+	})
+
+	now := time.Now().UTC()
+
+	var counters []*model.Counter
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		if counters, err = flushIncrements(ctx, tx, totals, now); err != nil || len(counters) == 0 {
+			return err
+		}
+
+		updated := make(map[uuid.UUID]*model.Counter, len(counters))
+		for _, counter := range counters {
+			updated[counter.ID] = counter
+		}
+
+		var events, buckets []interface{}
+		for _, total := range totals {
+			counter, ok := updated[total.CounterID]
+			if !ok {
+				continue
+			}
+
+			// Each event carries the value the counter had after the increments it records
+			value := counter.Value - total.Delta
+			for _, increment := range bySubject[total.CounterID] {
+				value += increment.Delta
+
+				eventType := model.EventIncrement
+				if increment.Delta < 0 {
+					eventType = model.EventDecrement
+				}
+
+				subject := sql.NullString{String: increment.Subject, Valid: increment.Subject != ""}
+				events = append(events, counter.ID, eventType, increment.Delta, value, subject, now)
+			}
+
+			for _, granularity := range []model.Granularity{model.GranularityMinute, model.GranularityHour, model.GranularityDay} {
+				buckets = append(buckets, counter.ID, 0, granularity, granularity.BucketStart(now), total.Delta, total.Count)
+			}
+		}
+
+		if err := execRows(ctx, tx, InsertCounterEventsSQL, 6, events); err != nil {
+			return err
+		}
+
+		return execRows(ctx, tx, AddToCounterBucketsBatchSQL, 6, buckets)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return counters, nil
+}
+
+// flushIncrements runs the batched update, split to fit the parameters of a
+// statement, and returns the updated counters
+func flushIncrements(ctx context.Context, tx *sqlx.Tx, increments []model.CoalescedIncrement, now time.Time) ([]*model.Counter, error) {
+	counters := []*model.Counter{}
+
+	// Every row binds 3 parameters after the time of the update
+	size := (maxParameters - 1) / 3
+	for len(increments) > 0 {
+		if size > len(increments) {
+			size = len(increments)
+		}
+
+		args := []interface{}{now}
+		for _, increment := range increments[:size] {
+			args = append(args, increment.CounterID, increment.Delta, increment.Count)
+		}
+
+		query := fmt.Sprintf(FlushIncrementsSQL, placeholders(size, 3, 2, "uuid", "bigint", "bigint"))
+		updated, err := queryCounters(ctx, tx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		counters = append(counters, updated...)
+		increments = increments[size:]
+	}
+
+	return counters, nil
+}
+
+// queryCounters runs a query returning counters
+func queryCounters(ctx context.Context, tx *sqlx.Tx, query string, args ...interface{}) ([]*model.Counter, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counters := []*model.Counter{}
+	for rows.Next() {
+		counter, err := scanCounter(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		counters = append(counters, counter)
+	}
+
+	return counters, rows.Err()
+}
+
+// execRows runs a statement inserting the rows of columns values given in
+// args in place of %s, in as many statements as the parameters require
+func execRows(ctx context.Context, tx *sqlx.Tx, query string, columns int, args []interface{}) error {
+	size := maxParameters / columns * columns
+	for len(args) > 0 {
+		if size > len(args) {
+			size = len(args)
+		}
+
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(query, placeholders(size/columns, columns, 1)), args[:size]...); err != nil {
+			return err
+		}
+		args = args[size:]
+	}
+
+	return nil
+}
+
+// placeholders returns rows groups of columns numbered placeholders starting at
+// start, like ($2, $3), ($4, $5). The optional types are cast to column by column.
+func placeholders(rows, columns, start int, types ...string) string {
+	groups := make([]string, rows)
+	for i := range groups {
+		values := make([]string, columns)
+		for j := range values {
+			values[j] = fmt.Sprintf("$%d", start+i*columns+j)
+			if j < len(types) {
+				values[j] += "::" + types[j]
+			}
+		}
+		groups[i] = "(" + strings.Join(values, ", ") + ")"
+	}
+
+	return strings.Join(groups, ", ")
+}
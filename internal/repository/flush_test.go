@@ -0,0 +1,229 @@
+package repository_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"gounter/internal/model"
+	counterRepository "gounter/internal/repository"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepositoryFlushIncrements(t *testing.T) {
+	first, second := uuid.New(), uuid.New()
+	if bytes.Compare(first[:], second[:]) > 0 {
+		first, second = second, first
+	}
+
+	flushSQL := regexp.QuoteMeta(fmt.Sprintf(counterRepository.FlushIncrementsSQL, "($2::uuid, $3::bigint, $4::bigint), ($5::uuid, $6::bigint, $7::bigint)"))
+	eventsSQL := regexp.QuoteMeta(fmt.Sprintf(counterRepository.InsertCounterEventsSQL, "($1, $2, $3, $4, $5, $6)"))
+	bucketsSQL := regexp.QuoteMeta(fmt.Sprintf(counterRepository.AddToCounterBucketsBatchSQL, "($1, $2, $3, $4, $5, $6), ($7, $8, $9, $10, $11, $12), ($13, $14, $15, $16, $17, $18)"))
+
+	// The increments are given out of order, they are written sorted by counter ID
+	increments := []model.CoalescedIncrement{
+		{CounterID: second, Delta: -2, Count: 2},
+		{CounterID: first, Delta: 7, Count: 3, Subject: "producer"},
+	}
+
+	tests := []struct {
+		name          string
+		setupMock     func(mock sqlmock.Sqlmock)
+		expectedIDs   []uuid.UUID
+		expectedError error
+	}{
+		{
+			name: "applies the increments with one update",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				now := time.Now().UTC()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(`UPDATE counter SET value = counter\.value \+ batch_delta, version = version \+ batch_count, updated_at = \$1 FROM \(VALUES \(\$2::uuid, \$3::bigint, \$4::bigint\), \(\$5::uuid, \$6::bigint, \$7::bigint\)\) AS batch \(batch_id, batch_delta, batch_count\) WHERE id = batch_id AND deleted_at IS NULL AND min_value IS NULL AND max_value IS NULL RETURNING `+counterColumnsPattern+`;`).
+					WithArgs(sqlmock.AnyArg(), first, int64(7), int64(3), second, int64(-2), int64(2)).
+					WillReturnRows(sqlmock.NewRows(counterColumns).
+						AddRow(first, "First", "", "{}", "", "", 17, nil, nil, "reject", 1, 2, now, now).
+						AddRow(second, "Second", "", "{}", "", "", 3, nil, nil, "reject", 1, 5, now, now))
+				mock.ExpectExec(`INSERT INTO counter_events \(counter_id, type, delta, value, subject, created_at\) VALUES \(\$1, \$2, \$3, \$4, \$5, \$6\), \(\$7, \$8, \$9, \$10, \$11, \$12\);`).
+					WithArgs(first, model.EventIncrement, int64(7), int64(17), sql.NullString{String: "producer", Valid: true}, sqlmock.AnyArg(),
+						second, model.EventDecrement, int64(-2), int64(3), sql.NullString{}, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(2, 2))
+				mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf(counterRepository.AddToCounterBucketsBatchSQL, "($1, $2, $3, $4, $5, $6), ($7, $8, $9, $10, $11, $12), ($13, $14, $15, $16, $17, $18), ($19, $20, $21, $22, $23, $24), ($25, $26, $27, $28, $29, $30), ($31, $32, $33, $34, $35, $36)"))).
+					WillReturnResult(sqlmock.NewResult(6, 6))
+				mock.ExpectCommit()
+			},
+			expectedIDs: []uuid.UUID{first, second},
+		},
+		{
+			name: "drops the increments of missing counters",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				now := time.Now().UTC()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(flushSQL).
+					WithArgs(sqlmock.AnyArg(), first, int64(7), int64(3), second, int64(-2), int64(2)).
+					WillReturnRows(sqlmock.NewRows(counterColumns).
+						AddRow(first, "First", "", "{}", "", "", 17, nil, nil, "reject", 1, 2, now, now))
+				mock.ExpectExec(eventsSQL).
+					WithArgs(first, model.EventIncrement, int64(7), int64(17), sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(bucketsSQL).
+					WithArgs(first, 0, model.GranularityMinute, sqlmock.AnyArg(), int64(7), int64(3),
+						first, 0, model.GranularityHour, sqlmock.AnyArg(), int64(7), int64(3),
+						first, 0, model.GranularityDay, sqlmock.AnyArg(), int64(7), int64(3)).
+					WillReturnResult(sqlmock.NewResult(3, 3))
+				mock.ExpectCommit()
+			},
+			expectedIDs: []uuid.UUID{first},
+		},
+		{
+			name: "rolls back when the history cannot be written",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(flushSQL).
+					WillReturnRows(counterRow(first, "First", 17))
+				mock.ExpectExec(eventsSQL).
+					WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
+			},
+			expectedError: sql.ErrConnDone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			sqlxDB := sqlx.NewDb(db, "postgres")
+			repo := counterRepository.New(sqlxDB)
+
+			tt.setupMock(mock)
+
+			counters, err := repo.FlushIncrements(context.TODO(), increments)
+
+			// Validate the results
+			if tt.expectedError != nil {
+				require.Equal(t, tt.expectedError, err)
+				require.Nil(t, counters)
+			} else {
+				require.NoError(t, err)
+				ids := []uuid.UUID{}
+				for _, counter := range counters {
+					ids = append(ids, counter.ID)
+				}
+				require.Equal(t, tt.expectedIDs, ids)
+			}
+
+			err = mock.ExpectationsWereMet()
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestRepositoryFlushNoIncrements(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := counterRepository.New(sqlx.NewDb(db, "postgres"))
+
+	counters, err := repo.FlushIncrements(context.TODO(), nil)
+	require.NoError(t, err)
+	require.Empty(t, counters)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepositoryFlushIncrementsBySubject(t *testing.T) {
+	id := uuid.New()
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := counterRepository.New(sqlx.NewDb(db, "postgres"))
+
+	// The increments of both subjects are applied with one row, each gets its own event
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf(counterRepository.FlushIncrementsSQL, "($2::uuid, $3::bigint, $4::bigint)"))).
+		WithArgs(sqlmock.AnyArg(), id, int64(7), int64(3)).
+		WillReturnRows(counterRow(id, "First", 17))
+	mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf(counterRepository.InsertCounterEventsSQL, "($1, $2, $3, $4, $5, $6), ($7, $8, $9, $10, $11, $12)"))).
+		WithArgs(id, model.EventIncrement, int64(3), int64(13), sql.NullString{String: "producer", Valid: true}, sqlmock.AnyArg(),
+			id, model.EventIncrement, int64(4), int64(17), sql.NullString{String: "importer", Valid: true}, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	mock.ExpectExec(regexp.QuoteMeta(fmt.Sprintf(counterRepository.AddToCounterBucketsBatchSQL, "($1, $2, $3, $4, $5, $6), ($7, $8, $9, $10, $11, $12), ($13, $14, $15, $16, $17, $18)"))).
+		WithArgs(id, 0, model.GranularityMinute, sqlmock.AnyArg(), int64(7), int64(3),
+			id, 0, model.GranularityHour, sqlmock.AnyArg(), int64(7), int64(3),
+			id, 0, model.GranularityDay, sqlmock.AnyArg(), int64(7), int64(3)).
+		WillReturnResult(sqlmock.NewResult(3, 3))
+	mock.ExpectCommit()
+
+	counters, err := repo.FlushIncrements(context.TODO(), []model.CoalescedIncrement{
+		{CounterID: id, Delta: 3, Count: 1, Subject: "producer"},
+		{CounterID: id, Delta: 4, Count: 2, Subject: "importer"},
+	})
+	require.NoError(t, err)
+	require.Len(t, counters, 1)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepositoryFlushIncrementsSplitsStatements(t *testing.T) {
+	// Every counter adds 3 bucket rows of 6 parameters, Postgres takes at most
+	// 65535 parameters in a statement, 3640 counters fit in one
+	tests := []struct {
+		name               string
+		counters           int
+		expectedStatements int
+	}{
+		{name: "buckets fitting one statement", counters: 3640, expectedStatements: 1},
+		{name: "buckets split past the parameters limit", counters: 3641, expectedStatements: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			repo := counterRepository.New(sqlx.NewDb(db, "postgres"))
+
+			now := time.Now().UTC()
+			increments := make([]model.CoalescedIncrement, tt.counters)
+			rows := sqlmock.NewRows(counterColumns)
+			for i := range increments {
+				increments[i] = model.CoalescedIncrement{CounterID: uuid.New(), Delta: 1, Count: 1}
+				rows.AddRow(increments[i].CounterID, "Counter", "", "{}", "", "", 1, nil, nil, "reject", 1, 1, now, now)
+			}
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`UPDATE counter`).
+				WillReturnRows(rows)
+			mock.ExpectExec(`INSERT INTO counter_events`).
+				WillReturnResult(sqlmock.NewResult(0, int64(tt.counters)))
+			mock.ExpectExec(`INSERT INTO counter_buckets`).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			if tt.expectedStatements > 1 {
+				// The last statement only holds the bucket row left over
+				mock.ExpectExec(`INSERT INTO counter_buckets \(counter_id, shard, granularity, bucket_start, delta, increments\) VALUES \(\$1, \$2, \$3, \$4, \$5, \$6\) ON CONFLICT`).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+			mock.ExpectCommit()
+
+			counters, err := repo.FlushIncrements(context.TODO(), increments)
+			require.NoError(t, err)
+			require.Len(t, counters, tt.counters)
+
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"gounter/internal/model"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	GetIdempotencyRecordSQL = `
+		SELECT subject, key, request, counter, results, created_at
+		FROM idempotency_keys
+		WHERE subject = $1 AND key = $2 AND created_at >= $3;`
+
+	// SaveIdempotencyRecordSQL only replaces an existing key of the subject once
+	// it fell out of the window, otherwise it returns no row.
+	SaveIdempotencyRecordSQL = `
+		INSERT INTO idempotency_keys (subject, key, request, counter, results, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (subject, key) DO UPDATE
+		SET request = EXCLUDED.request, counter = EXCLUDED.counter, results = EXCLUDED.results, created_at = EXCLUDED.created_at
+		WHERE idempotency_keys.created_at < $7
+		RETURNING key;`
+)
+
+// GetIdempotencyRecord returns the record saved by subject under key since the
+// given time. It returns sql.ErrNoRows when there is none.
+func (r *Counter) GetIdempotencyRecord(ctx context.Context, subject, key string, since time.Time) (*model.IdempotencyRecord, error) {
+	var (
+		record           model.IdempotencyRecord
+		counter, results []byte
+	)
+
+	err := r.db.QueryRowContext(ctx, GetIdempotencyRecordSQL, subject, key, since).
+		Scan(&record.Subject, &record.Key, &record.Request, &counter, &results, &record.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if counter != nil {
+		if err := json.Unmarshal(counter, &record.Counter); err != nil {
+			return nil, err
+		}
+	}
+
+	if results != nil {
+		if err := json.Unmarshal(results, &record.Results); err != nil {
+			return nil, err
+		}
+	}
+
+	return &record, nil
+}
+
+// saveIdempotencyRecord saves the record carried by ctx, if any, with the
+// counter state resulting from the change made in tx.
+// It returns model.ErrDuplicateIdempotencyKey when the key is already taken.
+func saveIdempotencyRecord(ctx context.Context, tx *sqlx.Tx, counter *model.Counter) error {
+	record, ok := model.IdempotencyRecordFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	var state []byte
+	if counter != nil {
+		var err error
+		if state, err = json.Marshal(counter); err != nil {
+			return err
+		}
+	}
+
+	return insertIdempotencyRecord(ctx, tx, record, state, nil)
+}
+
+// saveBatchIdempotencyRecord saves the record carried by ctx, if any, with the
+// results of the batch applied in tx
+func saveBatchIdempotencyRecord(ctx context.Context, tx *sqlx.Tx, results []model.BatchResult) error {
+	record, ok := model.IdempotencyRecordFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	state, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+
+	return insertIdempotencyRecord(ctx, tx, record, nil, state)
+}
+
+// insertIdempotencyRecord saves the record with the encoded counter state or batch results
+func insertIdempotencyRecord(ctx context.Context, tx *sqlx.Tx, record *model.IdempotencyRecord, counter, results []byte) error {
+	var key string
+	err := tx.QueryRowContext(ctx, SaveIdempotencyRecordSQL, record.Subject, record.Key, record.Request, counter, results, time.Now().UTC(), record.Since).
+		Scan(&key)
+	if err == sql.ErrNoRows {
+		return model.ErrDuplicateIdempotencyKey
+	}
+
+	return err
+}
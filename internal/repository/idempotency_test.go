@@ -0,0 +1,177 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"gounter/internal/model"
+	counterRepository "gounter/internal/repository"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepositoryGetIdempotencyRecord(t *testing.T) {
+	since := time.Now().UTC().Add(-time.Hour)
+	counter := &model.Counter{ID: uuid.New(), Name: "Test Counter", Value: 3, Version: 2}
+	state, err := json.Marshal(counter)
+	require.NoError(t, err)
+
+	results := []model.BatchResult{{Counter: counter}, {Err: model.ErrVersionMismatch}, {}}
+	batchState, err := json.Marshal(results)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		setupMock       func(mock sqlmock.Sqlmock)
+		expectedCounter *model.Counter
+		expectedResults []model.BatchResult
+		expectedError   error
+	}{
+		{
+			name: "returns the stored counter state",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.GetIdempotencyRecordSQL)).
+					WithArgs("gounter", "key-1", since).
+					WillReturnRows(sqlmock.NewRows([]string{"subject", "key", "request", "counter", "results", "created_at"}).
+						AddRow("gounter", "key-1", "increment", state, nil, time.Now().UTC()))
+			},
+			expectedCounter: counter,
+		},
+		{
+			name: "returns no state for deletes",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.GetIdempotencyRecordSQL)).
+					WithArgs("gounter", "key-1", since).
+					WillReturnRows(sqlmock.NewRows([]string{"subject", "key", "request", "counter", "results", "created_at"}).
+						AddRow("gounter", "key-1", "delete", nil, nil, time.Now().UTC()))
+			},
+			expectedCounter: nil,
+		},
+		{
+			name: "returns the results of a batch",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.GetIdempotencyRecordSQL)).
+					WithArgs("gounter", "key-1", since).
+					WillReturnRows(sqlmock.NewRows([]string{"subject", "key", "request", "counter", "results", "created_at"}).
+						AddRow("gounter", "key-1", "batch", nil, batchState, time.Now().UTC()))
+			},
+			expectedResults: results,
+		},
+		{
+			name: "unknown or expired key",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.GetIdempotencyRecordSQL)).
+					WithArgs("gounter", "key-1", since).
+					WillReturnError(sql.ErrNoRows)
+			},
+			expectedError: sql.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			sqlxDB := sqlx.NewDb(db, "postgres")
+			repo := counterRepository.New(sqlxDB)
+
+			tt.setupMock(mock)
+
+			record, err := repo.GetIdempotencyRecord(context.TODO(), "gounter", "key-1", since)
+
+			// Validate the results
+			if tt.expectedError != nil {
+				require.Equal(t, tt.expectedError, err)
+				require.Nil(t, record)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, "gounter", record.Subject)
+				require.Equal(t, "key-1", record.Key)
+				require.Equal(t, tt.expectedCounter, record.Counter)
+				require.Equal(t, tt.expectedResults, record.Results)
+			}
+
+			err = mock.ExpectationsWereMet()
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestRepositorySavesIdempotencyRecordWithChange(t *testing.T) {
+	since := time.Now().UTC().Add(-time.Hour)
+
+	tests := []struct {
+		name          string
+		setupMock     func(mock sqlmock.Sqlmock, id uuid.UUID)
+		expectedError error
+	}{
+		{
+			name: "saves the record in the increment transaction",
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.IncrementCounterSQL)).
+					WithArgs(id, int64(1), sqlmock.AnyArg()).
+					WillReturnRows(changedCounterRow(id, "Test Counter", 1, 0))
+				expectEvent(mock, model.EventIncrement, 1, 1)
+				expectBuckets(mock, 1)
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.SaveIdempotencyRecordSQL)).
+					WithArgs("gounter", "key-1", "increment", sqlmock.AnyArg(), []byte(nil), sqlmock.AnyArg(), since).
+					WillReturnRows(sqlmock.NewRows([]string{"key"}).AddRow("key-1"))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "rolls the increment back when the key is taken",
+			setupMock: func(mock sqlmock.Sqlmock, id uuid.UUID) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.IncrementCounterSQL)).
+					WithArgs(id, int64(1), sqlmock.AnyArg()).
+					WillReturnRows(changedCounterRow(id, "Test Counter", 1, 0))
+				expectEvent(mock, model.EventIncrement, 1, 1)
+				expectBuckets(mock, 1)
+				mock.ExpectQuery(regexp.QuoteMeta(counterRepository.SaveIdempotencyRecordSQL)).
+					WithArgs("gounter", "key-1", "increment", sqlmock.AnyArg(), []byte(nil), sqlmock.AnyArg(), since).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			expectedError: model.ErrDuplicateIdempotencyKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			sqlxDB := sqlx.NewDb(db, "postgres")
+			repo := counterRepository.New(sqlxDB)
+
+			id := uuid.New()
+			tt.setupMock(mock, id)
+
+			ctx := model.WithIdempotencyRecord(context.TODO(), &model.IdempotencyRecord{Subject: "gounter", Key: "key-1", Request: "increment", Since: since})
+			counter, err := repo.IncrementCounter(ctx, id, 1)
+
+			// Validate the results
+			if tt.expectedError != nil {
+				require.Equal(t, tt.expectedError, err)
+				require.Nil(t, counter)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, int64(1), counter.Value)
+			}
+
+			err = mock.ExpectationsWereMet()
+			require.NoError(t, err)
+		})
+	}
+}
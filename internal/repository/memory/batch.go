@@ -0,0 +1,65 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"gounter/internal/model"
+)
+
+// ApplyBatch applies the operations in order while holding the lock, so no
+// other change is interleaved. When atomic is set the first failed operation
+// restores the state from before the batch and is returned as a
+// *model.BatchError. Otherwise the failures are reported in the results.
+// The idempotency record carried by ctx, if any, is saved with the results.
+func (r *Counter) ApplyBatch(ctx context.Context, ops []model.BatchOperation, atomic bool) ([]model.BatchResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkIdempotencyKey(ctx); err != nil {
+		return nil, err
+	}
+
+	var before *Snapshot
+	if atomic {
+		before = r.snapshot()
+	}
+
+	// The record holds the results of the whole batch, not of an operation
+	opCtx := model.WithIdempotencyRecord(ctx, nil)
+
+	results := make([]model.BatchResult, len(ops))
+	for i, op := range ops {
+		counter, err := r.applyOperation(opCtx, op)
+		if err != nil {
+			if atomic {
+				r.restore(before)
+				return nil, &model.BatchError{Index: i, Err: err}
+			}
+
+			results[i].Err = err
+			continue
+		}
+
+		results[i].Counter = counter
+	}
+
+	r.saveBatchIdempotencyRecord(ctx, results, r.now())
+
+	return results, nil
+}
+
+// applyOperation makes the change of a single operation. It must be called with mu held.
+func (r *Counter) applyOperation(ctx context.Context, op model.BatchOperation) (*model.Counter, error) {
+	switch op.Type {
+	case model.BatchCreate:
+		return r.createCounter(ctx, op.Create)
+	case model.BatchIncrement:
+		return r.incrementCounter(ctx, op.CounterID, op.Delta)
+	case model.BatchSet:
+		return r.setCounter(ctx, op.CounterID, op.Value, op.ExpectedVersion)
+	case model.BatchDelete:
+		return nil, r.softDeleteCounter(ctx, op.CounterID)
+	default:
+		return nil, fmt.Errorf("unsupported batch operation %q", op.Type)
+	}
+}
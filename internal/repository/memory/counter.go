@@ -0,0 +1,581 @@
+// Package memory keeps counters in process memory and is meant for local
+// development and tests: everything is lost when the process exits.
+//
+// Idempotency records are only dropped once they are older than the window,
+// checked at most once a minute as new records are saved, so the memory they
+// hold grows with the keys used within a window. Sharded counters keep their
+// shard count and behave as in the other storages, but hold a single value
+// since every change takes the same lock anyway. Aggregated increments are not
+// supported.
+package memory
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"gounter/internal/model"
+	"gounter/internal/service"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Counter stores counters, their history and the idempotency records in maps
+// guarded by a single lock, so every operation is atomic.
+type Counter struct {
+	mu sync.RWMutex
+
+	// counters holds soft deleted counters too, until they are purged
+	counters    map[uuid.UUID]*model.Counter
+	events      map[uuid.UUID][]*model.CounterEvent
+	lastEventID int64
+	buckets     map[bucketKey]*model.CounterBucket
+	idempotency map[idempotencyKey]*model.IdempotencyRecord
+	// idempotencyPrunedAt is when the expired idempotency records were last dropped
+	idempotencyPrunedAt time.Time
+
+	now   func() time.Time
+	newID func() uuid.UUID
+	// beforeChange is called once a change is known to apply, before it is made
+	beforeChange func() error
+}
+
+var _ service.BatchRepository = (*Counter)(nil)
+
+// Option configures optional behaviour of the repository
+type Option func(*Counter)
+
+// WithClock sets the clock giving the time of the changes
+func WithClock(now func() time.Time) Option {
+	return func(r *Counter) {
+		r.now = now
+	}
+}
+
+// WithIDs sets the generator of the ids of created counters
+func WithIDs(newID func() uuid.UUID) Option {
+	return func(r *Counter) {
+		r.newID = newID
+	}
+}
+
+// WithBeforeChange sets a hook called with the lock held once a change was
+// validated, right before it is made. The change is abandoned when the hook
+// fails, and its error returned.
+func WithBeforeChange(hook func() error) Option {
+	return func(r *Counter) {
+		r.beforeChange = hook
+	}
+}
+
+// New creates an empty in-memory repository
+func New(opts ...Option) *Counter {
+	r := &Counter{
+		counters:    map[uuid.UUID]*model.Counter{},
+		events:      map[uuid.UUID][]*model.CounterEvent{},
+		buckets:     map[bucketKey]*model.CounterBucket{},
+		idempotency: map[idempotencyKey]*model.IdempotencyRecord{},
+		now: func() time.Time {
+			return time.Now().UTC()
+		},
+		newID: uuid.New,
+		beforeChange: func() error {
+			return nil
+		},
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// copyCounter returns a copy of the stored counter, callers never share it
+func copyCounter(counter *model.Counter) *model.Counter {
+	copied := *counter
+	copied.DeletedAt = nil
+	copied.Labels = copyLabels(counter.Labels)
+
+	return &copied
+}
+
+// copyLabels returns a copy of labels, an empty one when there are none
+func copyLabels(labels model.Labels) model.Labels {
+	copied := make(model.Labels, len(labels))
+	for key, value := range labels {
+		copied[key] = value
+	}
+
+	return copied
+}
+
+// liveCounter returns the stored counter unless it is missing or soft deleted.
+// It must be called with mu held.
+func (r *Counter) liveCounter(id uuid.UUID) (*model.Counter, error) {
+	counter, ok := r.counters[id]
+	if !ok || counter.DeletedAt != nil {
+		return nil, sql.ErrNoRows
+	}
+
+	return counter, nil
+}
+
+// namedCounter returns the live counter with the name in the namespace, or
+// sql.ErrNoRows. Counters outside of any namespace are never found by name.
+// It must be called with mu held.
+func (r *Counter) namedCounter(namespace, name string) (*model.Counter, error) {
+	if namespace == "" {
+		return nil, sql.ErrNoRows
+	}
+
+	for _, counter := range r.counters {
+		if counter.DeletedAt == nil && counter.Namespace == namespace && counter.Name == name {
+			return counter, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+// CreateCounter stores a new counter and returns it
+func (r *Counter) CreateCounter(ctx context.Context, params model.CreateCounterParams) (*model.Counter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.createCounter(ctx, params)
+}
+
+// createCounter stores a new counter. It must be called with mu held.
+func (r *Counter) createCounter(ctx context.Context, params model.CreateCounterParams) (*model.Counter, error) {
+	if _, err := r.namedCounter(params.Namespace, params.Name); err == nil {
+		return nil, model.ErrNameTaken
+	}
+
+	if err := r.checkIdempotencyKey(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := r.beforeChange(); err != nil {
+		return nil, err
+	}
+
+	now := r.now()
+	counter := &model.Counter{
+		ID:             r.newID(),
+		Name:           params.Name,
+		Namespace:      params.Namespace,
+		Labels:         copyLabels(params.Labels),
+		Description:    params.Description,
+		Unit:           params.Unit,
+		Min:            params.Min,
+		Max:            params.Max,
+		OverflowPolicy: params.OverflowPolicy,
+		Shards:         params.Shards,
+		Version:        1,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	r.counters[counter.ID] = counter
+
+	r.recordEvent(ctx, counter.ID, model.EventCreate, 0, counter.Value, now)
+	r.saveIdempotencyRecord(ctx, counter, now)
+
+	return copyCounter(counter), nil
+}
+
+// GetCounter returns a single counter by its id, or sql.ErrNoRows
+func (r *Counter) GetCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counter, err := r.liveCounter(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return copyCounter(counter), nil
+}
+
+// GetCounterByName returns the live counter with the name in the namespace, or sql.ErrNoRows
+func (r *Counter) GetCounterByName(ctx context.Context, namespace, name string) (*model.Counter, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counter, err := r.namedCounter(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return copyCounter(counter), nil
+}
+
+// ListCounters returns the counters matching the filter, ordered by the sort field
+// and then by id so the order is stable across pages.
+func (r *Counter) ListCounters(ctx context.Context, filter model.CounterFilter) ([]*model.Counter, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counters := make([]*model.Counter, 0, len(r.counters))
+	for _, counter := range r.counters {
+		counters = append(counters, counter)
+	}
+
+	counters, err := FilterCounters(counters, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, counter := range counters {
+		counters[i] = copyCounter(counter)
+	}
+
+	return counters, nil
+}
+
+// FilterCounters returns the page of counters matching the filter, ordered the
+// way ListCounters orders them. It is shared with the storages that cannot
+// filter counters themselves. Soft deleted counters are left out.
+func FilterCounters(counters []*model.Counter, filter model.CounterFilter) ([]*model.Counter, error) {
+	less, ok := counterOrders[filter.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sort field %q", filter.SortBy)
+	}
+
+	// before reports whether a comes before b in the requested direction
+	before := func(a, b *model.Counter) bool {
+		if filter.Descending {
+			a, b = b, a
+		}
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		return bytes.Compare(a.ID[:], b.ID[:]) < 0
+	}
+
+	ids := make(map[uuid.UUID]bool, len(filter.IDs))
+	for _, id := range filter.IDs {
+		ids[id] = true
+	}
+
+	matching := []*model.Counter{}
+	for _, counter := range counters {
+		if counter.DeletedAt != nil ||
+			!strings.HasPrefix(counter.Name, filter.NamePrefix) ||
+			!counter.Labels.Matches(filter.Labels) ||
+			(len(ids) > 0 && !ids[counter.ID]) ||
+			(filter.After != nil && !before(filter.After, counter)) {
+			continue
+		}
+
+		matching = append(matching, counter)
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		return before(matching[i], matching[j])
+	})
+
+	if len(matching) > filter.Limit {
+		matching = matching[:filter.Limit]
+	}
+
+	return matching, nil
+}
+
+// counterOrders compares counters on the supported sort fields
+var counterOrders = map[model.CounterSort]func(a, b *model.Counter) bool{
+	model.SortByName: func(a, b *model.Counter) bool {
+		return a.Name < b.Name
+	},
+	model.SortByValue: func(a, b *model.Counter) bool {
+		return a.Value < b.Value
+	},
+	model.SortByCreatedAt: func(a, b *model.Counter) bool {
+		return a.CreatedAt.Before(b.CreatedAt)
+	},
+}
+
+// applyBounds returns value once the bounds of the counter are applied, and
+// false when the counter rejects it
+func applyBounds(counter *model.Counter, value int64) (int64, bool) {
+	if counter.Min != nil && value < *counter.Min {
+		if counter.OverflowPolicy != model.OverflowSaturate {
+			return 0, false
+		}
+		value = *counter.Min
+	}
+
+	if counter.Max != nil && value > *counter.Max {
+		if counter.OverflowPolicy != model.OverflowSaturate {
+			return 0, false
+		}
+		value = *counter.Max
+	}
+
+	return value, true
+}
+
+// IncrementCounter adds delta to the counter and returns the new value.
+// A negative delta decrements the counter. It returns model.ErrOutOfBounds when
+// the counter rejects the change and sql.ErrNoRows when the counter does not exist.
+func (r *Counter) IncrementCounter(ctx context.Context, id uuid.UUID, delta int64) (*model.Counter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.incrementCounter(ctx, id, delta)
+}
+
+// incrementCounter adds delta to the counter. It must be called with mu held.
+func (r *Counter) incrementCounter(ctx context.Context, id uuid.UUID, delta int64) (*model.Counter, error) {
+	counter, err := r.liveCounter(id)
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := applyBounds(counter, counter.Value+delta)
+	if !ok {
+		return nil, model.ErrOutOfBounds
+	}
+
+	if err := r.checkIdempotencyKey(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := r.beforeChange(); err != nil {
+		return nil, err
+	}
+
+	now := r.now()
+	applied := value - counter.Value
+	counter.Value = value
+	counter.Version++
+	counter.UpdatedAt = now
+
+	eventType := model.EventIncrement
+	if delta < 0 {
+		eventType = model.EventDecrement
+	}
+
+	r.recordEvent(ctx, id, eventType, applied, counter.Value, now)
+	r.addToBuckets(id, applied, now)
+	r.saveIdempotencyRecord(ctx, counter, now)
+
+	return copyCounter(counter), nil
+}
+
+// SetCounter sets the counter to value when its version is still expectedVersion.
+// It returns model.ErrVersionMismatch when the counter was changed in between,
+// model.ErrOutOfBounds when the counter rejects the value and sql.ErrNoRows when
+// the counter does not exist.
+func (r *Counter) SetCounter(ctx context.Context, id uuid.UUID, value int64, expectedVersion int64) (*model.Counter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.setCounter(ctx, id, value, expectedVersion)
+}
+
+// setCounter sets the counter to value. It must be called with mu held.
+func (r *Counter) setCounter(ctx context.Context, id uuid.UUID, value int64, expectedVersion int64) (*model.Counter, error) {
+	counter, err := r.liveCounter(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if counter.Version != expectedVersion {
+		return nil, model.ErrVersionMismatch
+	}
+
+	value, ok := applyBounds(counter, value)
+	if !ok {
+		return nil, model.ErrOutOfBounds
+	}
+
+	if err := r.checkIdempotencyKey(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := r.beforeChange(); err != nil {
+		return nil, err
+	}
+
+	now := r.now()
+	applied := value - counter.Value
+	counter.Value = value
+	counter.Version++
+	counter.UpdatedAt = now
+
+	r.recordEvent(ctx, id, model.EventSet, applied, counter.Value, now)
+	r.saveIdempotencyRecord(ctx, counter, now)
+
+	return copyCounter(counter), nil
+}
+
+// UpdateCounter changes the metadata of a live counter and returns it.
+// It returns sql.ErrNoRows when the counter does not exist and
+// model.ErrNameTaken when it is renamed to a name taken in its namespace.
+func (r *Counter) UpdateCounter(ctx context.Context, id uuid.UUID, params model.UpdateCounterParams) (*model.Counter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counter, err := r.liveCounter(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Name != nil {
+		if named, err := r.namedCounter(counter.Namespace, *params.Name); err == nil && named.ID != id {
+			return nil, model.ErrNameTaken
+		}
+	}
+
+	if err := r.checkIdempotencyKey(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := r.beforeChange(); err != nil {
+		return nil, err
+	}
+
+	if params.Name != nil {
+		counter.Name = *params.Name
+	}
+	if params.Description != nil {
+		counter.Description = *params.Description
+	}
+	if params.Unit != nil {
+		counter.Unit = *params.Unit
+	}
+	if params.Labels != nil {
+		counter.Labels = copyLabels(*params.Labels)
+	}
+
+	now := r.now()
+	counter.Version++
+	counter.UpdatedAt = now
+
+	r.recordEvent(ctx, id, model.EventUpdate, 0, counter.Value, now)
+	r.saveIdempotencyRecord(ctx, counter, now)
+
+	return copyCounter(counter), nil
+}
+
+// SoftDeleteCounter marks the counter as deleted without removing it.
+// It returns the number of counters affected, which is 0 when the counter does
+// not exist or is already deleted.
+func (r *Counter) SoftDeleteCounter(ctx context.Context, id uuid.UUID) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.softDeleteCounter(ctx, id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return 1, nil
+}
+
+// softDeleteCounter marks the counter as deleted. It returns sql.ErrNoRows when
+// the counter does not exist or is already deleted. It must be called with mu held.
+func (r *Counter) softDeleteCounter(ctx context.Context, id uuid.UUID) error {
+	counter, err := r.liveCounter(id)
+	if err != nil {
+		return err
+	}
+
+	if err := r.checkIdempotencyKey(ctx); err != nil {
+		return err
+	}
+
+	if err := r.beforeChange(); err != nil {
+		return err
+	}
+
+	now := r.now()
+	counter.DeletedAt = &now
+	counter.UpdatedAt = now
+	counter.Version++
+
+	r.recordEvent(ctx, id, model.EventDelete, 0, counter.Value, now)
+	r.saveIdempotencyRecord(ctx, nil, now)
+
+	return nil
+}
+
+// RestoreCounter clears the deleted mark of a soft deleted counter and returns it.
+// It returns sql.ErrNoRows when there is no deleted counter with the given id and
+// model.ErrNameTaken when another counter took its name in the meantime.
+func (r *Counter) RestoreCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counter, ok := r.counters[id]
+	if !ok || counter.DeletedAt == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	if _, err := r.namedCounter(counter.Namespace, counter.Name); err == nil {
+		return nil, model.ErrNameTaken
+	}
+
+	if err := r.checkIdempotencyKey(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := r.beforeChange(); err != nil {
+		return nil, err
+	}
+
+	now := r.now()
+	counter.DeletedAt = nil
+	counter.UpdatedAt = now
+	counter.Version++
+
+	r.recordEvent(ctx, id, model.EventRestore, 0, counter.Value, now)
+	r.saveIdempotencyRecord(ctx, counter, now)
+
+	return copyCounter(counter), nil
+}
+
+// PurgeDeletedCounters removes the counters soft deleted before the given time,
+// along with their history. It returns the number of counters removed.
+func (r *Counter) PurgeDeletedCounters(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged []uuid.UUID
+	for id, counter := range r.counters {
+		if counter.DeletedAt != nil && counter.DeletedAt.Before(before) {
+			purged = append(purged, id)
+		}
+	}
+
+	if len(purged) == 0 {
+		return 0, nil
+	}
+
+	if err := r.beforeChange(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range purged {
+		delete(r.counters, id)
+		delete(r.events, id)
+		for key := range r.buckets {
+			if key.counterID == id {
+				delete(r.buckets, key)
+			}
+		}
+	}
+
+	return int64(len(purged)), nil
+}
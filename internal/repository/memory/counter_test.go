@@ -0,0 +1,46 @@
+package memory_test
+
+import (
+	"context"
+	"gounter/internal/model"
+	"gounter/internal/repository/memory"
+	"gounter/internal/service"
+	"gounter/test/storagetest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) service.Repository {
+		return memory.New()
+	})
+}
+
+func TestMemoryRepositoryPrunesIdempotencyRecords(t *testing.T) {
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	repo := memory.New(memory.WithClock(func() time.Time {
+		return now
+	}))
+
+	counter, err := repo.CreateCounter(context.TODO(), model.CreateCounterParams{Name: "orders", OverflowPolicy: model.OverflowReject, Shards: 1})
+	require.NoError(t, err)
+
+	increment := func(key string) {
+		record := &model.IdempotencyRecord{Subject: "alice", Key: key, Request: "increment", Since: now.Add(-time.Hour)}
+		_, err := repo.IncrementCounter(model.WithIdempotencyRecord(context.TODO(), record), counter.ID, 1)
+		require.NoError(t, err)
+	}
+
+	increment("key-1")
+	require.Len(t, repo.Snapshot().Idempotency, 1)
+
+	// Once the first record fell out of the window, the next save drops it
+	now = now.Add(2 * time.Hour)
+	increment("key-2")
+
+	records := repo.Snapshot().Idempotency
+	require.Len(t, records, 1)
+	require.Equal(t, "key-2", records[0].Key)
+}
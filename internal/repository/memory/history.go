@@ -0,0 +1,147 @@
+package memory
+
+import (
+	"context"
+	"gounter/internal/model"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// bucketKey identifies the bucket of a counter at a granularity
+type bucketKey struct {
+	counterID   uuid.UUID
+	granularity model.Granularity
+	start       time.Time
+}
+
+// recordEvent appends a change to the history of the counter.
+// It must be called with mu held.
+func (r *Counter) recordEvent(ctx context.Context, counterID uuid.UUID, eventType model.CounterEventType, delta, value int64, at time.Time) {
+	subject, _ := model.SubjectFromContext(ctx)
+
+	r.lastEventID++
+	r.events[counterID] = append(r.events[counterID], &model.CounterEvent{
+		ID:        r.lastEventID,
+		CounterID: counterID,
+		Type:      eventType,
+		Delta:     delta,
+		Value:     value,
+		Subject:   subject,
+		CreatedAt: at,
+	})
+}
+
+// addToBuckets adds an applied change to the minute, hour and day buckets of the counter.
+// It must be called with mu held.
+func (r *Counter) addToBuckets(counterID uuid.UUID, delta int64, at time.Time) {
+	for _, granularity := range []model.Granularity{model.GranularityMinute, model.GranularityHour, model.GranularityDay} {
+		key := bucketKey{counterID: counterID, granularity: granularity, start: granularity.BucketStart(at)}
+
+		bucket, ok := r.buckets[key]
+		if !ok {
+			bucket = &model.CounterBucket{Start: key.start}
+			r.buckets[key] = bucket
+		}
+
+		bucket.Delta += delta
+		bucket.Increments++
+	}
+}
+
+// ListCounterEvents returns the history of a counter matching the filter, oldest first
+func (r *Counter) ListCounterEvents(ctx context.Context, filter model.CounterEventFilter) ([]*model.CounterEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events := []*model.CounterEvent{}
+	for _, event := range r.events[filter.CounterID] {
+		if len(events) == filter.Limit {
+			break
+		}
+
+		if event.ID <= filter.AfterID ||
+			(filter.From != nil && event.CreatedAt.Before(*filter.From)) ||
+			(filter.To != nil && !event.CreatedAt.Before(*filter.To)) {
+			continue
+		}
+
+		copied := *event
+		events = append(events, &copied)
+	}
+
+	return events, nil
+}
+
+// ListCounterBuckets returns the buckets of a counter starting within [from, to), oldest first
+func (r *Counter) ListCounterBuckets(ctx context.Context, id uuid.UUID, granularity model.Granularity, from, to time.Time) ([]*model.CounterBucket, error) {
+	return r.SumCounterBuckets(ctx, []uuid.UUID{id}, granularity, from, to)
+}
+
+// SumCounterBuckets returns the buckets of the counters starting within [from, to),
+// summed across the counters, oldest first
+func (r *Counter) SumCounterBuckets(ctx context.Context, ids []uuid.UUID, granularity model.Granularity, from, to time.Time) ([]*model.CounterBucket, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	wanted := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	sums := map[time.Time]*model.CounterBucket{}
+	for key, bucket := range r.buckets {
+		if !wanted[key.counterID] || key.granularity != granularity ||
+			key.start.Before(from) || !key.start.Before(to) {
+			continue
+		}
+
+		sum, ok := sums[key.start]
+		if !ok {
+			sum = &model.CounterBucket{Start: key.start}
+			sums[key.start] = sum
+		}
+		sum.Delta += bucket.Delta
+		sum.Increments += bucket.Increments
+	}
+
+	buckets := make([]*model.CounterBucket, 0, len(sums))
+	for _, sum := range sums {
+		buckets = append(buckets, sum)
+	}
+
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Start.Before(buckets[j].Start)
+	})
+
+	return buckets, nil
+}
+
+// PruneCounterBuckets removes the buckets of the granularity starting before
+// the given time, returning the number of buckets removed
+func (r *Counter) PruneCounterBuckets(ctx context.Context, granularity model.Granularity, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var pruned []bucketKey
+	for key := range r.buckets {
+		if key.granularity == granularity && key.start.Before(before) {
+			pruned = append(pruned, key)
+		}
+	}
+
+	if len(pruned) == 0 {
+		return 0, nil
+	}
+
+	if err := r.beforeChange(); err != nil {
+		return 0, err
+	}
+
+	for _, key := range pruned {
+		delete(r.buckets, key)
+	}
+
+	return int64(len(pruned)), nil
+}
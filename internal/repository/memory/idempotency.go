@@ -0,0 +1,110 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"gounter/internal/model"
+	"time"
+)
+
+// idempotencyPruneInterval is how often the records that fell out of the window are dropped
+const idempotencyPruneInterval = time.Minute
+
+// idempotencyKey identifies a record, each subject has its own keys
+type idempotencyKey struct {
+	subject string
+	key     string
+}
+
+// GetIdempotencyRecord returns the record saved by subject under key since the
+// given time. It returns sql.ErrNoRows when there is none.
+func (r *Counter) GetIdempotencyRecord(ctx context.Context, subject, key string, since time.Time) (*model.IdempotencyRecord, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	record, ok := r.idempotency[idempotencyKey{subject: subject, key: key}]
+	if !ok || record.CreatedAt.Before(since) {
+		return nil, sql.ErrNoRows
+	}
+
+	return copyIdempotencyRecord(record), nil
+}
+
+// checkIdempotencyKey returns model.ErrDuplicateIdempotencyKey when the record
+// carried by ctx cannot be saved, before any change is made.
+// It must be called with mu held.
+func (r *Counter) checkIdempotencyKey(ctx context.Context) error {
+	record, ok := model.IdempotencyRecordFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	saved, ok := r.idempotency[idempotencyKey{subject: record.Subject, key: record.Key}]
+	if ok && !saved.CreatedAt.Before(record.Since) {
+		return model.ErrDuplicateIdempotencyKey
+	}
+
+	return nil
+}
+
+// saveIdempotencyRecord saves the record carried by ctx, if any, with the
+// counter state resulting from the change. It must be called with mu held,
+// after checkIdempotencyKey.
+func (r *Counter) saveIdempotencyRecord(ctx context.Context, counter *model.Counter, at time.Time) {
+	record, ok := model.IdempotencyRecordFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	r.storeIdempotencyRecord(&model.IdempotencyRecord{Subject: record.Subject, Key: record.Key, Request: record.Request, Counter: counter, CreatedAt: at}, record.Since)
+}
+
+// saveBatchIdempotencyRecord saves the record carried by ctx, if any, with the
+// results of the batch. It must be called with mu held, after checkIdempotencyKey.
+func (r *Counter) saveBatchIdempotencyRecord(ctx context.Context, results []model.BatchResult, at time.Time) {
+	record, ok := model.IdempotencyRecordFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	r.storeIdempotencyRecord(&model.IdempotencyRecord{Subject: record.Subject, Key: record.Key, Request: record.Request, Results: results, CreatedAt: at}, record.Since)
+}
+
+// storeIdempotencyRecord keeps a copy of the record. Every prune interval, the
+// records created before since, the start of the window, are dropped so the map
+// does not grow forever. It must be called with mu held.
+func (r *Counter) storeIdempotencyRecord(record *model.IdempotencyRecord, since time.Time) {
+	r.idempotency[idempotencyKey{subject: record.Subject, key: record.Key}] = copyIdempotencyRecord(record)
+
+	if record.CreatedAt.Sub(r.idempotencyPrunedAt) < idempotencyPruneInterval {
+		return
+	}
+
+	for key, saved := range r.idempotency {
+		if saved.CreatedAt.Before(since) {
+			delete(r.idempotency, key)
+		}
+	}
+	r.idempotencyPrunedAt = record.CreatedAt
+}
+
+// copyIdempotencyRecord returns a deep copy of the record, so callers cannot
+// change the saved counter states
+func copyIdempotencyRecord(record *model.IdempotencyRecord) *model.IdempotencyRecord {
+	copied := *record
+	if record.Counter != nil {
+		copied.Counter = copyCounter(record.Counter)
+	}
+
+	if record.Results != nil {
+		copied.Results = make([]model.BatchResult, len(record.Results))
+		for i, result := range record.Results {
+			copied.Results[i] = result
+			if result.Counter != nil {
+				copied.Results[i].Counter = copyCounter(result.Counter)
+			}
+		}
+	}
+
+	return &copied
+}
@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"gounter/internal/model"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Snapshot is a point in time copy of everything the repository holds, which
+// can be encoded as JSON and restored later
+type Snapshot struct {
+	// Counters includes the soft deleted counters
+	Counters    []*model.Counter           `json:"counters"`
+	Events      []*model.CounterEvent      `json:"events"`
+	LastEventID int64                      `json:"last_event_id"`
+	Buckets     []*SnapshotBucket          `json:"buckets"`
+	Idempotency []*model.IdempotencyRecord `json:"idempotency"`
+}
+
+// SnapshotBucket is a time bucket of a counter in a snapshot
+type SnapshotBucket struct {
+	CounterID   uuid.UUID         `json:"counter_id"`
+	Granularity model.Granularity `json:"granularity"`
+	Start       time.Time         `json:"start"`
+	Delta       int64             `json:"delta"`
+	Increments  int64             `json:"increments"`
+}
+
+// Snapshot copies the current state of the repository
+func (r *Counter) Snapshot() *Snapshot {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.snapshot()
+}
+
+// snapshot copies the current state. It must be called with mu held.
+func (r *Counter) snapshot() *Snapshot {
+	snapshot := &Snapshot{
+		Counters:    make([]*model.Counter, 0, len(r.counters)),
+		Events:      []*model.CounterEvent{},
+		LastEventID: r.lastEventID,
+		Buckets:     make([]*SnapshotBucket, 0, len(r.buckets)),
+		Idempotency: make([]*model.IdempotencyRecord, 0, len(r.idempotency)),
+	}
+
+	for _, counter := range r.counters {
+		copied := *counter
+		snapshot.Counters = append(snapshot.Counters, &copied)
+	}
+
+	for _, events := range r.events {
+		for _, event := range events {
+			copied := *event
+			snapshot.Events = append(snapshot.Events, &copied)
+		}
+	}
+
+	for key, bucket := range r.buckets {
+		snapshot.Buckets = append(snapshot.Buckets, &SnapshotBucket{
+			CounterID:   key.counterID,
+			Granularity: key.granularity,
+			Start:       key.start,
+			Delta:       bucket.Delta,
+			Increments:  bucket.Increments,
+		})
+	}
+
+	for _, record := range r.idempotency {
+		snapshot.Idempotency = append(snapshot.Idempotency, copyIdempotencyRecord(record))
+	}
+
+	return snapshot
+}
+
+// Restore replaces the state of the repository with the snapshot
+func (r *Counter) Restore(snapshot *Snapshot) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.restore(snapshot)
+}
+
+// restore replaces the state with the snapshot. It must be called with mu held.
+func (r *Counter) restore(snapshot *Snapshot) {
+	r.counters = make(map[uuid.UUID]*model.Counter, len(snapshot.Counters))
+	for _, counter := range snapshot.Counters {
+		copied := *counter
+		r.counters[counter.ID] = &copied
+	}
+
+	// Events are appended in id order, which is the order of each counter history
+	r.events = map[uuid.UUID][]*model.CounterEvent{}
+	events := append([]*model.CounterEvent(nil), snapshot.Events...)
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+	for _, event := range events {
+		copied := *event
+		r.events[event.CounterID] = append(r.events[event.CounterID], &copied)
+	}
+	r.lastEventID = snapshot.LastEventID
+
+	r.buckets = make(map[bucketKey]*model.CounterBucket, len(snapshot.Buckets))
+	for _, bucket := range snapshot.Buckets {
+		key := bucketKey{counterID: bucket.CounterID, granularity: bucket.Granularity, start: bucket.Start}
+		r.buckets[key] = &model.CounterBucket{Start: bucket.Start, Delta: bucket.Delta, Increments: bucket.Increments}
+	}
+
+	r.idempotency = make(map[idempotencyKey]*model.IdempotencyRecord, len(snapshot.Idempotency))
+	for _, record := range snapshot.Idempotency {
+		r.idempotency[idempotencyKey{subject: record.Subject, key: record.Key}] = copyIdempotencyRecord(record)
+	}
+}
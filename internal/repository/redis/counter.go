@@ -0,0 +1,567 @@
+// Package redis stores counters in a Redis server. The value of a counter is
+// a string key changed with INCRBY, its other fields a hash. Every change is
+// a Lua script so it is applied atomically along with its history and
+// idempotency record.
+//
+// Listing counters is O(N) in the counters stored, deleted ones included: every
+// counter is read and filtered in the application, so this storage suits
+// thousands of counters, not millions. Batches and aggregated increments are
+// not supported.
+package redis
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"gounter/internal/model"
+	"gounter/internal/repository/memory"
+	"gounter/internal/service"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/google/uuid"
+)
+
+// DefaultPrefix is put in front of every key
+const DefaultPrefix = "gounter:"
+
+// Counter does the counter operations on a Redis server
+type Counter struct {
+	pool   *redis.Pool
+	prefix string
+}
+
+var _ service.Repository = (*Counter)(nil)
+
+// Option configures optional behaviour of the repository
+type Option func(*Counter)
+
+// WithPrefix sets the prefix of the keys, so several instances can share a server
+func WithPrefix(prefix string) Option {
+	return func(r *Counter) {
+		r.prefix = prefix
+	}
+}
+
+// New creates a repository using the connections of pool
+func New(pool *redis.Pool, opts ...Option) *Counter {
+	r := &Counter{pool: pool, prefix: DefaultPrefix}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// NewPool returns a pool of connections to the server at url, like redis://localhost:6379/0
+func NewPool(url string) *redis.Pool {
+	return &redis.Pool{
+		MaxIdle:     16,
+		IdleTimeout: 5 * time.Minute,
+		DialContext: func(ctx context.Context) (redis.Conn, error) {
+			return redis.DialURLContext(ctx, url)
+		},
+		TestOnBorrow: func(conn redis.Conn, lastUsed time.Time) error {
+			if time.Since(lastUsed) < time.Minute {
+				return nil
+			}
+			_, err := conn.Do("PING")
+			return err
+		},
+	}
+}
+
+func (r *Counter) countersKey() string {
+	return r.prefix + "counters"
+}
+
+func (r *Counter) counterKey(id uuid.UUID) string {
+	return r.prefix + "counter:" + id.String()
+}
+
+func (r *Counter) valueKey(id uuid.UUID) string {
+	return r.counterKey(id) + ":value"
+}
+
+// namesKey is the hash from the namespace and name of the live counters that
+// have a namespace to their ids
+func (r *Counter) namesKey() string {
+	return r.prefix + "names"
+}
+
+func (r *Counter) eventsKey(id uuid.UUID) string {
+	return r.counterKey(id) + ":events"
+}
+
+func (r *Counter) eventSeqKey() string {
+	return r.prefix + "events:seq"
+}
+
+func (r *Counter) bucketsKey(id uuid.UUID, granularity model.Granularity) string {
+	return r.counterKey(id) + ":buckets:" + string(granularity)
+}
+
+// idempotencyKey is the hash of the record saved by subject under key. The
+// subject is escaped so it cannot run into the key.
+func (r *Counter) idempotencyKey(subject, key string) string {
+	return r.prefix + "idempotency:" + url.QueryEscape(subject) + ":" + key
+}
+
+// toMicros and fromMicros convert the stored timestamps, which have the
+// microsecond precision of Postgres
+func toMicros(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Microsecond), 10)
+}
+
+func fromMicros(s string) (time.Time, error) {
+	micros, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(0, micros*int64(time.Microsecond)).UTC(), nil
+}
+
+// now returns the current time at the stored precision
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// idempotencyArgs returns the script arguments for the record carried by ctx, if any
+func (r *Counter) idempotencyArgs(ctx context.Context) (key string, args []interface{}) {
+	record, ok := model.IdempotencyRecordFromContext(ctx)
+	if !ok {
+		return r.idempotencyKey("", ""), []interface{}{"0", "", "0"}
+	}
+
+	return r.idempotencyKey(record.Subject, record.Key), []interface{}{"1", record.Request, toMicros(record.Since)}
+}
+
+// run runs a script and turns its status into the errors of the Postgres
+// repository. It returns the fields following the status.
+func (r *Counter) run(ctx context.Context, script *redis.Script, keysAndArgs ...interface{}) ([]string, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	reply, err := redis.Strings(script.DoContext(ctx, conn, keysAndArgs...))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reply) == 0 {
+		return nil, errors.New("empty script reply")
+	}
+
+	switch reply[0] {
+	case statusOK:
+		return reply[1:], nil
+	case statusNotFound:
+		return nil, sql.ErrNoRows
+	case statusOutOfBounds:
+		return nil, model.ErrOutOfBounds
+	case statusVersionMismatch:
+		return nil, model.ErrVersionMismatch
+	case statusDuplicate:
+		return nil, model.ErrDuplicateIdempotencyKey
+	case statusNameTaken:
+		return nil, model.ErrNameTaken
+	default:
+		return nil, fmt.Errorf("unexpected script status %q", reply[0])
+	}
+}
+
+// parseCounter reads a counter from its hash fields, given as name and value pairs.
+// Only the fields starting with prefix are read, without it.
+func parseCounter(fields []string, prefix string) (*model.Counter, error) {
+	values := map[string]string{}
+	for i := 0; i+1 < len(fields); i += 2 {
+		if len(fields[i]) > len(prefix) && fields[i][:len(prefix)] == prefix {
+			values[fields[i][len(prefix):]] = fields[i+1]
+		}
+	}
+
+	var (
+		counter model.Counter
+		err     error
+	)
+
+	if counter.ID, err = uuid.Parse(values["id"]); err != nil {
+		return nil, fmt.Errorf("invalid counter id %q", values["id"])
+	}
+	counter.Name = values["name"]
+	counter.Namespace = values["namespace"]
+	counter.Description = values["description"]
+	counter.Unit = values["unit"]
+	counter.Labels = model.Labels{}
+	if s, ok := values["labels"]; ok {
+		if err := counter.Labels.Scan(s); err != nil {
+			return nil, fmt.Errorf("invalid counter labels %q", s)
+		}
+	}
+	counter.OverflowPolicy = model.OverflowPolicy(values["overflow_policy"])
+
+	integers := []struct {
+		field string
+		dest  *int64
+	}{
+		{"value", &counter.Value},
+		{"version", &counter.Version},
+	}
+	for _, integer := range integers {
+		if *integer.dest, err = strconv.ParseInt(values[integer.field], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid counter %s %q", integer.field, values[integer.field])
+		}
+	}
+
+	if counter.Shards, err = strconv.Atoi(values["shards"]); err != nil {
+		return nil, fmt.Errorf("invalid counter shards %q", values["shards"])
+	}
+
+	bounds := []struct {
+		field string
+		dest  **int64
+	}{
+		{"min", &counter.Min},
+		{"max", &counter.Max},
+	}
+	for _, bound := range bounds {
+		s, ok := values[bound.field]
+		if !ok {
+			continue
+		}
+
+		b, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid counter %s %q", bound.field, s)
+		}
+		*bound.dest = &b
+	}
+
+	if counter.CreatedAt, err = fromMicros(values["created_at"]); err != nil {
+		return nil, fmt.Errorf("invalid counter created_at %q", values["created_at"])
+	}
+	if counter.UpdatedAt, err = fromMicros(values["updated_at"]); err != nil {
+		return nil, fmt.Errorf("invalid counter updated_at %q", values["updated_at"])
+	}
+
+	if s, ok := values["deleted_at"]; ok {
+		deletedAt, err := fromMicros(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid counter deleted_at %q", s)
+		}
+		counter.DeletedAt = &deletedAt
+	}
+
+	return &counter, nil
+}
+
+// optionalInt returns the script argument of an optional bound
+func optionalInt(i *int64) string {
+	if i == nil {
+		return ""
+	}
+
+	return strconv.FormatInt(*i, 10)
+}
+
+// CreateCounter stores a new counter and returns it
+func (r *Counter) CreateCounter(ctx context.Context, params model.CreateCounterParams) (*model.Counter, error) {
+	id := uuid.New()
+	subject, _ := model.SubjectFromContext(ctx)
+	idempotencyKey, idempotencyArgs := r.idempotencyArgs(ctx)
+
+	labels, err := params.Labels.Value()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{
+		r.counterKey(id), r.valueKey(id), r.eventsKey(id), r.eventSeqKey(), r.countersKey(), idempotencyKey, r.namesKey(),
+		id.String(), params.Name, optionalInt(params.Min), optionalInt(params.Max), string(params.OverflowPolicy), params.Shards,
+		toMicros(now()), subject, params.Namespace, labels, params.Description, params.Unit,
+	}
+
+	fields, err := r.run(ctx, createScript, append(args, idempotencyArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseCounter(fields, "")
+}
+
+// GetCounter fetches a single counter by its id
+func (r *Counter) GetCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
+	fields, err := r.run(ctx, getScript, r.counterKey(id), r.valueKey(id))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseCounter(fields, "")
+}
+
+// GetCounterByName fetches the live counter with the name in the namespace
+func (r *Counter) GetCounterByName(ctx context.Context, namespace, name string) (*model.Counter, error) {
+	if namespace == "" {
+		return nil, sql.ErrNoRows
+	}
+
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	member, err := redis.String(redis.DoContext(conn, ctx, "HGET", r.namesKey(), namespace+"/"+name))
+	if err == redis.ErrNil {
+		return nil, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.Parse(member)
+	if err != nil {
+		return nil, fmt.Errorf("invalid counter id %q", member)
+	}
+
+	return r.GetCounter(ctx, id)
+}
+
+// ListCounters returns the counters matching the filter, ordered by the sort field
+// and then by id so the order is stable across pages. There is no index to
+// filter, sort or page with: unless the ids are given, every counter ever
+// created and not purged is read in a single transaction and filtered here,
+// so a page costs O(N) in the number of counters.
+func (r *Counter) ListCounters(ctx context.Context, filter model.CounterFilter) ([]*model.Counter, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	ids := filter.IDs
+	if len(ids) == 0 {
+		members, err := redis.Strings(redis.DoContext(conn, ctx, "SMEMBERS", r.countersKey()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, member := range members {
+			id, err := uuid.Parse(member)
+			if err != nil {
+				return nil, fmt.Errorf("invalid counter id %q", member)
+			}
+			ids = append(ids, id)
+		}
+	}
+
+	if err := conn.Send("MULTI"); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if err := conn.Send("HGETALL", r.counterKey(id)); err != nil {
+			return nil, err
+		}
+		if err := conn.Send("GET", r.valueKey(id)); err != nil {
+			return nil, err
+		}
+	}
+
+	replies, err := redis.Values(redis.DoContext(conn, ctx, "EXEC"))
+	if err != nil {
+		return nil, err
+	}
+
+	counters := make([]*model.Counter, 0, len(ids))
+	for i := 0; i+1 < len(replies); i += 2 {
+		fields, err := redis.Strings(replies[i], nil)
+		if err != nil {
+			return nil, err
+		}
+
+		// Unknown ids asked for have no hash
+		if len(fields) == 0 {
+			continue
+		}
+
+		value, err := redis.String(replies[i+1], nil)
+		if err != nil {
+			return nil, err
+		}
+
+		counter, err := parseCounter(append(fields, "value", value), "")
+		if err != nil {
+			return nil, err
+		}
+
+		counters = append(counters, counter)
+	}
+
+	return memory.FilterCounters(counters, filter)
+}
+
+// IncrementCounter adds delta to the counter and returns the new value.
+// A negative delta decrements the counter. It returns model.ErrOutOfBounds when
+// the counter rejects the change and sql.ErrNoRows when the counter does not exist.
+func (r *Counter) IncrementCounter(ctx context.Context, id uuid.UUID, delta int64) (*model.Counter, error) {
+	at := now()
+	subject, _ := model.SubjectFromContext(ctx)
+	idempotencyKey, idempotencyArgs := r.idempotencyArgs(ctx)
+
+	args := []interface{}{
+		r.counterKey(id), r.valueKey(id), r.eventsKey(id), r.eventSeqKey(),
+		r.bucketsKey(id, model.GranularityMinute), r.bucketsKey(id, model.GranularityHour), r.bucketsKey(id, model.GranularityDay),
+		idempotencyKey,
+		delta, toMicros(at), subject,
+		toMicros(model.GranularityMinute.BucketStart(at)), toMicros(model.GranularityHour.BucketStart(at)), toMicros(model.GranularityDay.BucketStart(at)),
+	}
+
+	fields, err := r.run(ctx, incrementScript, append(args, idempotencyArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseCounter(fields, "")
+}
+
+// SetCounter sets the counter to value when its version is still expectedVersion.
+// It returns model.ErrVersionMismatch when the counter was changed in between,
+// model.ErrOutOfBounds when the counter rejects the value and sql.ErrNoRows when
+// the counter does not exist.
+func (r *Counter) SetCounter(ctx context.Context, id uuid.UUID, value int64, expectedVersion int64) (*model.Counter, error) {
+	subject, _ := model.SubjectFromContext(ctx)
+	idempotencyKey, idempotencyArgs := r.idempotencyArgs(ctx)
+
+	args := []interface{}{
+		r.counterKey(id), r.valueKey(id), r.eventsKey(id), r.eventSeqKey(), idempotencyKey,
+		value, expectedVersion, toMicros(now()), subject,
+	}
+
+	fields, err := r.run(ctx, setScript, append(args, idempotencyArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseCounter(fields, "")
+}
+
+// UpdateCounter changes the metadata of a live counter and returns it.
+// It returns sql.ErrNoRows when the counter does not exist and
+// model.ErrNameTaken when it is renamed to a name taken in its namespace.
+func (r *Counter) UpdateCounter(ctx context.Context, id uuid.UUID, params model.UpdateCounterParams) (*model.Counter, error) {
+	var changes []interface{}
+	if params.Name != nil {
+		changes = append(changes, "name", *params.Name)
+	}
+	if params.Description != nil {
+		changes = append(changes, "description", *params.Description)
+	}
+	if params.Unit != nil {
+		changes = append(changes, "unit", *params.Unit)
+	}
+	if params.Labels != nil {
+		labels, err := params.Labels.Value()
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, "labels", labels)
+	}
+
+	subject, _ := model.SubjectFromContext(ctx)
+	idempotencyKey, idempotencyArgs := r.idempotencyArgs(ctx)
+
+	args := []interface{}{
+		r.counterKey(id), r.valueKey(id), r.eventsKey(id), r.eventSeqKey(), idempotencyKey, r.namesKey(),
+		toMicros(now()), subject, len(changes) / 2,
+	}
+	args = append(args, changes...)
+
+	fields, err := r.run(ctx, updateScript, append(args, idempotencyArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseCounter(fields, "")
+}
+
+// SoftDeleteCounter marks the counter as deleted without removing it.
+// It returns the number of counters affected, which is 0 when the counter does
+// not exist or is already deleted.
+func (r *Counter) SoftDeleteCounter(ctx context.Context, id uuid.UUID) (int64, error) {
+	subject, _ := model.SubjectFromContext(ctx)
+	idempotencyKey, idempotencyArgs := r.idempotencyArgs(ctx)
+
+	args := []interface{}{
+		r.counterKey(id), r.valueKey(id), r.eventsKey(id), r.eventSeqKey(), idempotencyKey, r.namesKey(),
+		toMicros(now()), subject,
+	}
+
+	fields, err := r.run(ctx, deleteScript, append(args, idempotencyArgs...)...)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(fields[0], 10, 64)
+}
+
+// RestoreCounter clears the deleted mark of a soft deleted counter and returns it.
+// It returns sql.ErrNoRows when there is no deleted counter with the given id and
+// model.ErrNameTaken when another counter took its name in the meantime.
+func (r *Counter) RestoreCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
+	subject, _ := model.SubjectFromContext(ctx)
+	idempotencyKey, idempotencyArgs := r.idempotencyArgs(ctx)
+
+	args := []interface{}{
+		r.counterKey(id), r.valueKey(id), r.eventsKey(id), r.eventSeqKey(), idempotencyKey, r.namesKey(),
+		toMicros(now()), subject,
+	}
+
+	fields, err := r.run(ctx, restoreScript, append(args, idempotencyArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseCounter(fields, "")
+}
+
+// PurgeDeletedCounters removes the counters soft deleted before the given time,
+// along with their history. It returns the number of counters removed.
+func (r *Counter) PurgeDeletedCounters(ctx context.Context, before time.Time) (int64, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	members, err := redis.Strings(redis.DoContext(conn, ctx, "SMEMBERS", r.countersKey()))
+	if err != nil {
+		return 0, err
+	}
+
+	var purged int64
+	for _, member := range members {
+		id, err := uuid.Parse(member)
+		if err != nil {
+			return purged, fmt.Errorf("invalid counter id %q", member)
+		}
+
+		removed, err := redis.Int64(purgeScript.DoContext(ctx, conn,
+			r.counterKey(id), r.valueKey(id), r.eventsKey(id),
+			r.bucketsKey(id, model.GranularityMinute), r.bucketsKey(id, model.GranularityHour), r.bucketsKey(id, model.GranularityDay),
+			r.countersKey(), member, toMicros(before)))
+		if err != nil {
+			return purged, err
+		}
+
+		purged += removed
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,78 @@
+package redis_test
+
+import (
+	"context"
+	"gounter/internal/model"
+	"gounter/internal/repository/redis"
+	"gounter/internal/service"
+	"gounter/test/storagetest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// newRepository returns a repository on a server that lives as long as the test
+func newRepository(t *testing.T) *redis.Counter {
+	server := miniredis.RunT(t)
+
+	pool := redis.NewPool("redis://" + server.Addr())
+	t.Cleanup(func() { pool.Close() })
+
+	return redis.New(pool)
+}
+
+func TestRedisRepository(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) service.Repository {
+		return newRepository(t)
+	})
+}
+
+func TestRedisRepositoryKeepsLargeValuesExact(t *testing.T) {
+	repo := newRepository(t)
+
+	// Doubles cannot tell 2^53 and 2^53 + 1 apart
+	max := int64(1<<53 + 1)
+	params := storagetest.CounterParams("large")
+	params.Max = &max
+	counter, err := repo.CreateCounter(context.TODO(), params)
+	require.NoError(t, err)
+
+	counter, err = repo.SetCounter(context.TODO(), counter.ID, 1<<53, counter.Version)
+	require.NoError(t, err)
+
+	counter, err = repo.IncrementCounter(context.TODO(), counter.ID, 1)
+	require.NoError(t, err)
+	require.Equal(t, max, counter.Value)
+
+	_, err = repo.IncrementCounter(context.TODO(), counter.ID, 1)
+	require.Equal(t, model.ErrOutOfBounds, err)
+
+	counter, err = repo.GetCounter(context.TODO(), counter.ID)
+	require.NoError(t, err)
+	require.Equal(t, max, counter.Value)
+
+	// A saturated increment records the exact delta applied
+	params = storagetest.CounterParams("saturated")
+	params.Max = &max
+	params.OverflowPolicy = model.OverflowSaturate
+	saturated, err := repo.CreateCounter(context.TODO(), params)
+	require.NoError(t, err)
+
+	saturated, err = repo.SetCounter(context.TODO(), saturated.ID, 1<<53-1, saturated.Version)
+	require.NoError(t, err)
+
+	saturated, err = repo.IncrementCounter(context.TODO(), saturated.ID, 5)
+	require.NoError(t, err)
+	require.Equal(t, max, saturated.Value)
+
+	events, err := repo.ListCounterEvents(context.TODO(), model.CounterEventFilter{CounterID: saturated.ID, Limit: 10})
+	require.NoError(t, err)
+
+	var deltas []int64
+	for _, event := range events {
+		deltas = append(deltas, event.Delta)
+	}
+	require.Contains(t, deltas, int64(1<<53-1))
+	require.Contains(t, deltas, int64(2))
+}
@@ -0,0 +1,271 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"gounter/internal/model"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/google/uuid"
+)
+
+// parseEvent reads an event stored by record_event as "id|type|delta|value|created_at|subject"
+func parseEvent(counterID uuid.UUID, member string) (*model.CounterEvent, error) {
+	parts := strings.SplitN(member, "|", 6)
+	if len(parts) != 6 {
+		return nil, fmt.Errorf("invalid counter event %q", member)
+	}
+
+	event := model.CounterEvent{CounterID: counterID, Type: model.CounterEventType(parts[1]), Subject: parts[5]}
+
+	var err error
+	if event.ID, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid counter event %q", member)
+	}
+	if event.Delta, err = strconv.ParseInt(parts[2], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid counter event %q", member)
+	}
+	if event.Value, err = strconv.ParseInt(parts[3], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid counter event %q", member)
+	}
+	if event.CreatedAt, err = fromMicros(parts[4]); err != nil {
+		return nil, fmt.Errorf("invalid counter event %q", member)
+	}
+
+	return &event, nil
+}
+
+// ListCounterEvents returns the history of a counter matching the filter, oldest first
+func (r *Counter) ListCounterEvents(ctx context.Context, filter model.CounterEventFilter) ([]*model.CounterEvent, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	members, err := redis.Strings(redis.DoContext(conn, ctx, "ZRANGEBYSCORE",
+		r.eventsKey(filter.CounterID), "("+strconv.FormatInt(filter.AfterID, 10), "+inf"))
+	if err != nil {
+		return nil, err
+	}
+
+	events := []*model.CounterEvent{}
+	for _, member := range members {
+		if len(events) == filter.Limit {
+			break
+		}
+
+		event, err := parseEvent(filter.CounterID, member)
+		if err != nil {
+			return nil, err
+		}
+
+		if (filter.From != nil && event.CreatedAt.Before(*filter.From)) ||
+			(filter.To != nil && !event.CreatedAt.Before(*filter.To)) {
+			continue
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// ListCounterBuckets returns the buckets of a counter starting within [from, to), oldest first.
+// Each bucket is stored as two hash fields, its start holding the delta and
+// its start followed by ":n" holding the number of increments.
+func (r *Counter) ListCounterBuckets(ctx context.Context, id uuid.UUID, granularity model.Granularity, from, to time.Time) ([]*model.CounterBucket, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	fields, err := redis.StringMap(redis.DoContext(conn, ctx, "HGETALL", r.bucketsKey(id, granularity)))
+	if err != nil {
+		return nil, err
+	}
+
+	sums := map[time.Time]*model.CounterBucket{}
+	if err := addBuckets(sums, fields, from, to); err != nil {
+		return nil, err
+	}
+
+	return sortBuckets(sums), nil
+}
+
+// SumCounterBuckets returns the buckets of the counters starting within [from, to),
+// summed across the counters, oldest first. The buckets of every counter are
+// read in a single transaction.
+func (r *Counter) SumCounterBuckets(ctx context.Context, ids []uuid.UUID, granularity model.Granularity, from, to time.Time) ([]*model.CounterBucket, error) {
+	if len(ids) == 0 {
+		return []*model.CounterBucket{}, nil
+	}
+
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.Send("MULTI"); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if err := conn.Send("HGETALL", r.bucketsKey(id, granularity)); err != nil {
+			return nil, err
+		}
+	}
+
+	replies, err := redis.Values(redis.DoContext(conn, ctx, "EXEC"))
+	if err != nil {
+		return nil, err
+	}
+
+	sums := map[time.Time]*model.CounterBucket{}
+	for _, reply := range replies {
+		fields, err := redis.StringMap(reply, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := addBuckets(sums, fields, from, to); err != nil {
+			return nil, err
+		}
+	}
+
+	return sortBuckets(sums), nil
+}
+
+// PruneCounterBuckets removes the buckets of the granularity starting before
+// the given time, returning the number of buckets removed. Like listing, it
+// goes through every counter stored.
+func (r *Counter) PruneCounterBuckets(ctx context.Context, granularity model.Granularity, before time.Time) (int64, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	members, err := redis.Strings(redis.DoContext(conn, ctx, "SMEMBERS", r.countersKey()))
+	if err != nil || len(members) == 0 {
+		return 0, err
+	}
+
+	keys := make([]string, len(members))
+	if err := conn.Send("MULTI"); err != nil {
+		return 0, err
+	}
+	for i, member := range members {
+		id, err := uuid.Parse(member)
+		if err != nil {
+			return 0, fmt.Errorf("invalid counter id %q", member)
+		}
+
+		keys[i] = r.bucketsKey(id, granularity)
+		if err := conn.Send("HKEYS", keys[i]); err != nil {
+			return 0, err
+		}
+	}
+
+	replies, err := redis.Values(redis.DoContext(conn, ctx, "EXEC"))
+	if err != nil {
+		return 0, err
+	}
+
+	// Buckets only ever get increments in their own time, so the old ones
+	// cannot change between the read and the removal
+	var pruned int64
+	if err := conn.Send("MULTI"); err != nil {
+		return 0, err
+	}
+	for i, reply := range replies {
+		fields, err := redis.Strings(reply, nil)
+		if err != nil {
+			return 0, err
+		}
+
+		args := redis.Args{keys[i]}
+		for _, field := range fields {
+			start, err := fromMicros(strings.TrimSuffix(field, ":n"))
+			if err != nil {
+				return 0, fmt.Errorf("invalid counter bucket %q", field)
+			}
+
+			if start.Before(before) {
+				args = append(args, field)
+				if !strings.HasSuffix(field, ":n") {
+					pruned++
+				}
+			}
+		}
+
+		if len(args) > 1 {
+			if err := conn.Send("HDEL", args...); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if _, err := redis.DoContext(conn, ctx, "EXEC"); err != nil {
+		return 0, err
+	}
+
+	return pruned, nil
+}
+
+// addBuckets adds the buckets held by the fields of a bucket hash starting
+// within [from, to) to the sums
+func addBuckets(sums map[time.Time]*model.CounterBucket, fields map[string]string, from, to time.Time) error {
+	for field, value := range fields {
+		if strings.HasSuffix(field, ":n") {
+			continue
+		}
+
+		start, err := fromMicros(field)
+		if err != nil {
+			return fmt.Errorf("invalid counter bucket %q", field)
+		}
+
+		if start.Before(from) || !start.Before(to) {
+			continue
+		}
+
+		delta, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid counter bucket %q", field)
+		}
+		increments, err := strconv.ParseInt(fields[field+":n"], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid counter bucket %q", field)
+		}
+
+		sum, ok := sums[start]
+		if !ok {
+			sum = &model.CounterBucket{Start: start}
+			sums[start] = sum
+		}
+		sum.Delta += delta
+		sum.Increments += increments
+	}
+
+	return nil
+}
+
+// sortBuckets returns the summed buckets, oldest first
+func sortBuckets(sums map[time.Time]*model.CounterBucket) []*model.CounterBucket {
+	buckets := make([]*model.CounterBucket, 0, len(sums))
+	for _, sum := range sums {
+		buckets = append(buckets, sum)
+	}
+
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Start.Before(buckets[j].Start)
+	})
+
+	return buckets
+}
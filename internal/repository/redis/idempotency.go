@@ -0,0 +1,52 @@
+package redis
+
+import (
+	"context"
+	"database/sql"
+	"gounter/internal/model"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// GetIdempotencyRecord returns the record saved by subject under key since the
+// given time. It returns sql.ErrNoRows when there is none.
+func (r *Counter) GetIdempotencyRecord(ctx context.Context, subject, key string, since time.Time) (*model.IdempotencyRecord, error) {
+	conn, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	fields, err := redis.Strings(redis.DoContext(conn, ctx, "HGETALL", r.idempotencyKey(subject, key)))
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	for i := 0; i+1 < len(fields); i += 2 {
+		values[fields[i]] = fields[i+1]
+	}
+
+	createdAt, ok := values["created_at"]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	record := model.IdempotencyRecord{Subject: subject, Key: key, Request: values["request"]}
+	if record.CreatedAt, err = fromMicros(createdAt); err != nil {
+		return nil, err
+	}
+
+	if record.CreatedAt.Before(since) {
+		return nil, sql.ErrNoRows
+	}
+
+	if _, ok := values["counter.id"]; ok {
+		if record.Counter, err = parseCounter(fields, "counter."); err != nil {
+			return nil, err
+		}
+	}
+
+	return &record, nil
+}
@@ -0,0 +1,359 @@
+package redis
+
+import "github.com/gomodule/redigo/redis"
+
+// Every change runs as a single script, which Redis executes atomically.
+// Scripts reply with a status first, followed by the fields of the counter
+// when there is one. Integers are handed around as strings since Lua numbers
+// are doubles, which cannot hold every int64: values are compared as strings
+// and added up by Redis itself, with INCRBY and DECRBY.
+const (
+	statusOK              = "ok"
+	statusNotFound        = "not_found"
+	statusOutOfBounds     = "out_of_bounds"
+	statusVersionMismatch = "version_mismatch"
+	statusDuplicate       = "duplicate"
+	statusNameTaken       = "name_taken"
+)
+
+// scriptHelpers are the functions shared by the scripts. compare orders two
+// integers given as decimal strings. difference leaves a in key and returns
+// a - b, as computed by Redis. clamp returns the value once the bounds of the
+// counter are applied, and whether the counter accepts it.
+const scriptHelpers = `
+local function is_live(key)
+	return redis.call('EXISTS', key) == 1 and redis.call('HEXISTS', key, 'deleted_at') == 0
+end
+
+local function counter_fields(key, value_key)
+	local fields = redis.call('HGETALL', key)
+	table.insert(fields, 'value')
+	table.insert(fields, redis.call('GET', value_key) or '0')
+	return fields
+end
+
+local function compare(a, b)
+	local a_negative, b_negative = a:sub(1, 1) == '-', b:sub(1, 1) == '-'
+	if a_negative ~= b_negative then
+		return a_negative and -1 or 1
+	end
+	local sign = 1
+	if a_negative then
+		a, b, sign = a:sub(2), b:sub(2), -1
+	end
+	if a == b then
+		return 0
+	end
+	if #a ~= #b then
+		return #a < #b and -sign or sign
+	end
+	return a < b and -sign or sign
+end
+
+local function difference(key, a, b)
+	redis.call('SET', key, a)
+	redis.call('DECRBY', key, b)
+	local d = redis.call('GET', key)
+	redis.call('SET', key, a)
+	return d
+end
+
+local function clamp(counter_key, value)
+	local bounds = redis.call('HMGET', counter_key, 'min', 'max', 'overflow_policy')
+	local clamped = value
+	if bounds[1] and compare(value, bounds[1]) < 0 then
+		clamped = bounds[1]
+	elseif bounds[2] and compare(value, bounds[2]) > 0 then
+		clamped = bounds[2]
+	end
+	return clamped, clamped == value or bounds[3] == 'saturate'
+end
+
+local function idempotency_taken(key, use, since)
+	if use ~= '1' then
+		return false
+	end
+	local created_at = redis.call('HGET', key, 'created_at')
+	return created_at and tonumber(created_at) >= tonumber(since)
+end
+
+local function save_idempotency(key, use, request, now, fields)
+	if use ~= '1' then
+		return
+	end
+	redis.call('DEL', key)
+	redis.call('HSET', key, 'request', request, 'created_at', now)
+	if fields then
+		for i = 1, #fields, 2 do
+			redis.call('HSET', key, 'counter.' .. fields[i], fields[i + 1])
+		end
+	end
+end
+
+local function record_event(events_key, seq_key, event_type, delta, value, subject, now)
+	local id = redis.call('INCR', seq_key)
+	redis.call('ZADD', events_key, id, table.concat({id, event_type, delta, value, now, subject}, '|'))
+end
+
+local function name_field(key)
+	local namespace = redis.call('HGET', key, 'namespace')
+	if not namespace then
+		return nil
+	end
+	return namespace .. '/' .. redis.call('HGET', key, 'name')
+end
+
+local function reply(fields)
+	table.insert(fields, 1, 'ok')
+	return fields
+end
+`
+
+// createScript stores a new counter.
+// KEYS: counter, value, events, event sequence, counter set, idempotency record, names.
+// ARGV: id, name, min, max, overflow policy, shards, now, subject, namespace, labels, description, unit,
+// use idempotency, request, since.
+var createScript = redis.NewScript(7, scriptHelpers+`
+local name = ARGV[9] .. '/' .. ARGV[2]
+if ARGV[9] ~= '' and redis.call('HEXISTS', KEYS[7], name) == 1 then
+	return {'name_taken'}
+end
+
+if idempotency_taken(KEYS[6], ARGV[13], ARGV[15]) then
+	return {'duplicate'}
+end
+
+redis.call('HSET', KEYS[1], 'id', ARGV[1], 'name', ARGV[2], 'overflow_policy', ARGV[5], 'shards', ARGV[6],
+	'version', 1, 'created_at', ARGV[7], 'updated_at', ARGV[7],
+	'labels', ARGV[10], 'description', ARGV[11], 'unit', ARGV[12])
+if ARGV[9] ~= '' then
+	redis.call('HSET', KEYS[1], 'namespace', ARGV[9])
+	redis.call('HSET', KEYS[7], name, ARGV[1])
+end
+if ARGV[3] ~= '' then
+	redis.call('HSET', KEYS[1], 'min', ARGV[3])
+end
+if ARGV[4] ~= '' then
+	redis.call('HSET', KEYS[1], 'max', ARGV[4])
+end
+redis.call('SET', KEYS[2], 0)
+redis.call('SADD', KEYS[5], ARGV[1])
+
+record_event(KEYS[3], KEYS[4], 'create', '0', '0', ARGV[8], ARGV[7])
+
+local fields = counter_fields(KEYS[1], KEYS[2])
+save_idempotency(KEYS[6], ARGV[13], ARGV[14], ARGV[7], fields)
+return reply(fields)
+`)
+
+// getScript reads a live counter.
+// KEYS: counter, value.
+var getScript = redis.NewScript(2, scriptHelpers+`
+if not is_live(KEYS[1]) then
+	return {'not_found'}
+end
+
+return reply(counter_fields(KEYS[1], KEYS[2]))
+`)
+
+// incrementScript adds a delta to the value with INCRBY, and puts the value
+// back when it is out of bounds and the counter rejects it, or clamps it.
+// KEYS: counter, value, events, event sequence, minute, hour and day buckets, idempotency record.
+// ARGV: delta, now, subject, minute, hour and day bucket starts, use idempotency, request, since.
+var incrementScript = redis.NewScript(8, scriptHelpers+`
+if not is_live(KEYS[1]) then
+	return {'not_found'}
+end
+
+local current = redis.call('GET', KEYS[2]) or '0'
+redis.call('INCRBY', KEYS[2], ARGV[1])
+local value = redis.call('GET', KEYS[2])
+local target, allowed = clamp(KEYS[1], value)
+if not allowed then
+	redis.call('SET', KEYS[2], current)
+	return {'out_of_bounds'}
+end
+
+if idempotency_taken(KEYS[8], ARGV[7], ARGV[9]) then
+	redis.call('SET', KEYS[2], current)
+	return {'duplicate'}
+end
+
+local applied = ARGV[1]
+if target ~= value then
+	applied = difference(KEYS[2], target, current)
+	value = target
+end
+
+redis.call('HINCRBY', KEYS[1], 'version', 1)
+redis.call('HSET', KEYS[1], 'updated_at', ARGV[2])
+
+local event_type = 'increment'
+if ARGV[1]:sub(1, 1) == '-' then
+	event_type = 'decrement'
+end
+record_event(KEYS[3], KEYS[4], event_type, applied, value, ARGV[3], ARGV[2])
+
+for i = 5, 7 do
+	redis.call('HINCRBY', KEYS[i], ARGV[i - 1], applied)
+	redis.call('HINCRBY', KEYS[i], ARGV[i - 1] .. ':n', 1)
+end
+
+local fields = counter_fields(KEYS[1], KEYS[2])
+save_idempotency(KEYS[8], ARGV[7], ARGV[8], ARGV[2], fields)
+return reply(fields)
+`)
+
+// setScript sets the value when the version still matches.
+// KEYS: counter, value, events, event sequence, idempotency record.
+// ARGV: value, expected version, now, subject, use idempotency, request, since.
+var setScript = redis.NewScript(5, scriptHelpers+`
+if not is_live(KEYS[1]) then
+	return {'not_found'}
+end
+
+if redis.call('HGET', KEYS[1], 'version') ~= ARGV[2] then
+	return {'version_mismatch'}
+end
+
+local current = redis.call('GET', KEYS[2]) or '0'
+local value, allowed = clamp(KEYS[1], ARGV[1])
+if not allowed then
+	return {'out_of_bounds'}
+end
+
+if idempotency_taken(KEYS[5], ARGV[5], ARGV[7]) then
+	return {'duplicate'}
+end
+
+local applied = difference(KEYS[2], value, current)
+redis.call('HINCRBY', KEYS[1], 'version', 1)
+redis.call('HSET', KEYS[1], 'updated_at', ARGV[3])
+
+record_event(KEYS[3], KEYS[4], 'set', applied, value, ARGV[4], ARGV[3])
+
+local fields = counter_fields(KEYS[1], KEYS[2])
+save_idempotency(KEYS[5], ARGV[5], ARGV[6], ARGV[3], fields)
+return reply(fields)
+`)
+
+// updateScript changes the metadata of a live counter. The changed fields
+// are given as a count followed by field and value pairs. A renamed counter
+// moves to its new name in its namespace, unless another counter has it.
+// KEYS: counter, value, events, event sequence, idempotency record, names.
+// ARGV: now, subject, number of changed fields, field and value pairs, use idempotency, request, since.
+var updateScript = redis.NewScript(6, scriptHelpers+`
+if not is_live(KEYS[1]) then
+	return {'not_found'}
+end
+
+local n = tonumber(ARGV[3])
+local changes = {}
+for i = 4, 3 + 2 * n, 2 do
+	changes[ARGV[i]] = ARGV[i + 1]
+end
+local use, request, since = ARGV[4 + 2 * n], ARGV[5 + 2 * n], ARGV[6 + 2 * n]
+
+local id = redis.call('HGET', KEYS[1], 'id')
+local old_name = name_field(KEYS[1])
+local new_name
+if old_name and changes['name'] then
+	new_name = redis.call('HGET', KEYS[1], 'namespace') .. '/' .. changes['name']
+	local owner = redis.call('HGET', KEYS[6], new_name)
+	if owner and owner ~= id then
+		return {'name_taken'}
+	end
+end
+
+if idempotency_taken(KEYS[5], use, since) then
+	return {'duplicate'}
+end
+
+for field, value in pairs(changes) do
+	redis.call('HSET', KEYS[1], field, value)
+end
+if new_name then
+	redis.call('HDEL', KEYS[6], old_name)
+	redis.call('HSET', KEYS[6], new_name, id)
+end
+redis.call('HINCRBY', KEYS[1], 'version', 1)
+redis.call('HSET', KEYS[1], 'updated_at', ARGV[1])
+
+record_event(KEYS[3], KEYS[4], 'update', '0', redis.call('GET', KEYS[2]) or '0', ARGV[2], ARGV[1])
+
+local fields = counter_fields(KEYS[1], KEYS[2])
+save_idempotency(KEYS[5], use, request, ARGV[1], fields)
+return reply(fields)
+`)
+
+// deleteScript marks a live counter as deleted, replying with the number of
+// counters deleted. Its name is freed for other counters of its namespace.
+// KEYS: counter, value, events, event sequence, idempotency record, names.
+// ARGV: now, subject, use idempotency, request, since.
+var deleteScript = redis.NewScript(6, scriptHelpers+`
+if not is_live(KEYS[1]) then
+	return {'ok', '0'}
+end
+
+if idempotency_taken(KEYS[5], ARGV[3], ARGV[5]) then
+	return {'duplicate'}
+end
+
+redis.call('HSET', KEYS[1], 'deleted_at', ARGV[1], 'updated_at', ARGV[1])
+redis.call('HINCRBY', KEYS[1], 'version', 1)
+local name = name_field(KEYS[1])
+if name then
+	redis.call('HDEL', KEYS[6], name)
+end
+
+record_event(KEYS[3], KEYS[4], 'delete', '0', redis.call('GET', KEYS[2]) or '0', ARGV[2], ARGV[1])
+
+save_idempotency(KEYS[5], ARGV[3], ARGV[4], ARGV[1], nil)
+return {'ok', '1'}
+`)
+
+// restoreScript clears the deleted mark of a counter, unless another counter
+// of its namespace took its name in the meantime.
+// KEYS: counter, value, events, event sequence, idempotency record, names.
+// ARGV: now, subject, use idempotency, request, since.
+var restoreScript = redis.NewScript(6, scriptHelpers+`
+if redis.call('HEXISTS', KEYS[1], 'deleted_at') == 0 then
+	return {'not_found'}
+end
+
+local name = name_field(KEYS[1])
+if name and redis.call('HEXISTS', KEYS[6], name) == 1 then
+	return {'name_taken'}
+end
+
+if idempotency_taken(KEYS[5], ARGV[3], ARGV[5]) then
+	return {'duplicate'}
+end
+
+redis.call('HDEL', KEYS[1], 'deleted_at')
+redis.call('HSET', KEYS[1], 'updated_at', ARGV[1])
+redis.call('HINCRBY', KEYS[1], 'version', 1)
+if name then
+	redis.call('HSET', KEYS[6], name, redis.call('HGET', KEYS[1], 'id'))
+end
+
+record_event(KEYS[3], KEYS[4], 'restore', '0', redis.call('GET', KEYS[2]) or '0', ARGV[2], ARGV[1])
+
+local fields = counter_fields(KEYS[1], KEYS[2])
+save_idempotency(KEYS[5], ARGV[3], ARGV[4], ARGV[1], fields)
+return reply(fields)
+`)
+
+// purgeScript removes a counter deleted before the given time, along with its history.
+// KEYS: counter, value, events, minute, hour and day buckets, counter set.
+// ARGV: id, before.
+var purgeScript = redis.NewScript(7, `
+local deleted_at = redis.call('HGET', KEYS[1], 'deleted_at')
+if not deleted_at or tonumber(deleted_at) >= tonumber(ARGV[2]) then
+	return 0
+end
+
+redis.call('DEL', KEYS[1], KEYS[2], KEYS[3], KEYS[4], KEYS[5], KEYS[6])
+redis.call('SREM', KEYS[7], ARGV[1])
+return 1
+`)
@@ -0,0 +1,471 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"gounter/internal/model"
+	"gounter/internal/service"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// counterColumns lists the columns read into a model.Counter, in scanCounter order
+const counterColumns = `id, name, COALESCE(namespace, '') AS namespace, labels, description, unit, value, min_value, max_value, overflow_policy, shards, version, created_at, updated_at`
+
+// SQLite has a single writer, so sharded counters keep their value in the
+// counter row.
+const (
+	CreateCounterSQL = `
+		INSERT INTO counter (id, name, namespace, value, min_value, max_value, overflow_policy, shards, version, created_at, updated_at, labels, description, unit)
+		VALUES (?1, ?2, NULLIF(?3, ''), ?4, ?5, ?6, ?7, ?8, 1, ?9, ?10, ?11, ?12, ?13)
+		RETURNING ` + counterColumns + `;`
+
+	CounterValueSQL = `
+		SELECT value FROM counter WHERE id = ?1 AND deleted_at IS NULL;`
+
+	// IncrementCounterSQL only updates the row when the new value stays within the
+	// bounds, or clamps it to the bounds when the counter saturates. Comparisons
+	// with a bound that is not set are never true.
+	IncrementCounterSQL = `
+		UPDATE counter
+		SET value = CASE WHEN value + ?2 < min_value THEN min_value WHEN value + ?2 > max_value THEN max_value ELSE value + ?2 END,
+			version = version + 1,
+			updated_at = ?3
+		WHERE id = ?1 AND deleted_at IS NULL
+			AND (overflow_policy = 'saturate'
+				OR value + ?2 BETWEEN COALESCE(min_value, value + ?2) AND COALESCE(max_value, value + ?2))
+		RETURNING ` + counterColumns + `;`
+
+	// SetCounterSQL sets the value only when the stored version matches, and
+	// applies the bounds the same way IncrementCounterSQL does
+	SetCounterSQL = `
+		UPDATE counter
+		SET value = CASE WHEN ?2 < min_value THEN min_value WHEN ?2 > max_value THEN max_value ELSE ?2 END,
+			version = version + 1,
+			updated_at = ?4
+		WHERE id = ?1 AND deleted_at IS NULL AND version = ?3
+			AND (overflow_policy = 'saturate'
+				OR ?2 BETWEEN COALESCE(min_value, ?2) AND COALESCE(max_value, ?2))
+		RETURNING ` + counterColumns + `;`
+
+	CounterVersionSQL = `
+		SELECT version FROM counter WHERE id = ?1 AND deleted_at IS NULL;`
+
+	GetCounterSQL = `
+		SELECT ` + counterColumns + `
+		FROM counter
+		WHERE id = ?1 AND deleted_at IS NULL;`
+
+	GetCounterByNameSQL = `
+		SELECT ` + counterColumns + `
+		FROM counter
+		WHERE namespace = ?1 AND name = ?2 AND deleted_at IS NULL;`
+
+	ListCountersSQL = `
+		SELECT ` + counterColumns + `
+		FROM counter
+		WHERE deleted_at IS NULL`
+
+	SoftDeleteCounterSQL = `
+		UPDATE counter
+		SET deleted_at = ?2, updated_at = ?2, version = version + 1
+		WHERE id = ?1 AND deleted_at IS NULL
+		RETURNING value;`
+
+	// UpdateCounterSQL changes the metadata given as not null parameters
+	UpdateCounterSQL = `
+		UPDATE counter
+		SET name = COALESCE(?2, name),
+			description = COALESCE(?3, description),
+			unit = COALESCE(?4, unit),
+			labels = COALESCE(?5, labels),
+			version = version + 1,
+			updated_at = ?6
+		WHERE id = ?1 AND deleted_at IS NULL
+		RETURNING ` + counterColumns + `;`
+
+	RestoreCounterSQL = `
+		UPDATE counter
+		SET deleted_at = NULL, updated_at = ?2, version = version + 1
+		WHERE id = ?1 AND deleted_at IS NOT NULL
+		RETURNING ` + counterColumns + `;`
+
+	PurgeDeletedCountersSQL = `
+		DELETE FROM counter
+		WHERE deleted_at IS NOT NULL AND deleted_at < ?1;`
+)
+
+// sortColumns maps the supported sort fields to their column names
+var sortColumns = map[model.CounterSort]string{
+	model.SortByName:      "name",
+	model.SortByValue:     "value",
+	model.SortByCreatedAt: "created_at",
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanCounter reads a row selected with counterColumns into a counter
+func scanCounter(row rowScanner) (*model.Counter, error) {
+	var counter model.Counter
+
+	err := row.Scan(&counter.ID, &counter.Name, &counter.Namespace, &counter.Labels, &counter.Description, &counter.Unit, &counter.Value, &counter.Min, &counter.Max,
+		&counter.OverflowPolicy, &counter.Shards, &counter.Version, &counter.CreatedAt, &counter.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	counter.CreatedAt = counter.CreatedAt.UTC()
+	counter.UpdatedAt = counter.UpdatedAt.UTC()
+
+	return &counter, nil
+}
+
+// Counter does the counter operations on a SQLite database
+type Counter struct {
+	db *sqlx.DB
+}
+
+var _ service.Repository = (*Counter)(nil)
+
+// New creates a repository on a database opened with Open
+func New(db *sqlx.DB) *Counter {
+	return &Counter{db: db}
+}
+
+// inTx runs fn in a write transaction, which is rolled back when fn fails
+func (r *Counter) inTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	return inTx(ctx, r.db, fn)
+}
+
+// CreateCounter inserts a new counter and returns it
+func (r *Counter) CreateCounter(ctx context.Context, params model.CreateCounterParams) (*model.Counter, error) {
+	now := time.Now().UTC()
+
+	var counter *model.Counter
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		row := tx.QueryRowContext(ctx, CreateCounterSQL, uuid.New(), params.Name, params.Namespace, 0,
+			params.Min, params.Max, params.OverflowPolicy, params.Shards, now, now,
+			params.Labels, params.Description, params.Unit)
+
+		var err error
+		if counter, err = scanCounter(row); isNameTaken(err) {
+			return model.ErrNameTaken
+		} else if err != nil {
+			return err
+		}
+
+		if err := recordEvent(ctx, tx, counter.ID, model.EventCreate, 0, counter.Value, now); err != nil {
+			return err
+		}
+
+		return saveIdempotencyRecord(ctx, tx, counter)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return counter, nil
+}
+
+// GetCounter fetches a single counter by its id
+func (r *Counter) GetCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
+	return scanCounter(r.db.QueryRowContext(ctx, GetCounterSQL, id))
+}
+
+// GetCounterByName fetches the live counter with the name in the namespace
+func (r *Counter) GetCounterByName(ctx context.Context, namespace, name string) (*model.Counter, error) {
+	return scanCounter(r.db.QueryRowContext(ctx, GetCounterByNameSQL, namespace, name))
+}
+
+// ListCounters returns the counters matching the filter, ordered by the sort field
+// and then by id so the order is stable across pages.
+func (r *Counter) ListCounters(ctx context.Context, filter model.CounterFilter) ([]*model.Counter, error) {
+	column, ok := sortColumns[filter.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sort field %q", filter.SortBy)
+	}
+
+	var (
+		conditions []string
+		args       []interface{}
+	)
+
+	if filter.NamePrefix != "" {
+		// LIKE ignores the case of ASCII letters in SQLite, instr does not
+		args = append(args, filter.NamePrefix)
+		conditions = append(conditions, fmt.Sprintf("instr(name, ?%d) = 1", len(args)))
+	}
+
+	if len(filter.IDs) > 0 {
+		placeholders := make([]string, len(filter.IDs))
+		for i, id := range filter.IDs {
+			args = append(args, id)
+			placeholders[i] = fmt.Sprintf("?%d", len(args))
+		}
+		conditions = append(conditions, fmt.Sprintf("id IN (%s)", strings.Join(placeholders, ", ")))
+	}
+
+	// The service only accepts label keys that need no escaping in a JSON path
+	for key, value := range filter.Labels {
+		args = append(args, `$."`+key+`"`, value)
+		conditions = append(conditions, fmt.Sprintf("json_extract(labels, ?%d) = ?%d", len(args)-1, len(args)))
+	}
+
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if filter.After != nil {
+		args = append(args, sortValue(filter.After, filter.SortBy), filter.After.ID)
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (?%d, ?%d)", column, comparison, len(args)-1, len(args)))
+	}
+
+	query := ListCountersSQL
+	for _, condition := range conditions {
+		query += " AND " + condition
+	}
+
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf("\n\t\tORDER BY %s %s, id %s\n\t\tLIMIT ?%d;", column, direction, direction, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counters := []*model.Counter{}
+	for rows.Next() {
+		counter, err := scanCounter(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		counters = append(counters, counter)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counters, nil
+}
+
+// sortValue returns the value of the counter field used as the sort key
+func sortValue(counter *model.Counter, sortBy model.CounterSort) interface{} {
+	switch sortBy {
+	case model.SortByValue:
+		return counter.Value
+	case model.SortByCreatedAt:
+		return counter.CreatedAt
+	default:
+		return counter.Name
+	}
+}
+
+// IncrementCounter adds delta to the counter and returns the new value.
+// A negative delta decrements the counter. Bounds are enforced by the update
+// itself, it returns model.ErrOutOfBounds when the counter rejects the change
+// and sql.ErrNoRows when the counter does not exist.
+func (r *Counter) IncrementCounter(ctx context.Context, id uuid.UUID, delta int64) (*model.Counter, error) {
+	now := time.Now().UTC()
+
+	var counter *model.Counter
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		// The transaction holds the write lock, nothing changes the value in between
+		var previous int64
+		if err := tx.QueryRowContext(ctx, CounterValueSQL, id).Scan(&previous); err != nil {
+			return err
+		}
+
+		var err error
+		counter, err = scanCounter(tx.QueryRowContext(ctx, IncrementCounterSQL, id, delta, now))
+		if err == sql.ErrNoRows {
+			return model.ErrOutOfBounds
+		}
+		if err != nil {
+			return err
+		}
+
+		eventType := model.EventIncrement
+		if delta < 0 {
+			eventType = model.EventDecrement
+		}
+
+		if err := recordEvent(ctx, tx, id, eventType, counter.Value-previous, counter.Value, now); err != nil {
+			return err
+		}
+
+		if err := addToBuckets(ctx, tx, id, counter.Value-previous, now); err != nil {
+			return err
+		}
+
+		return saveIdempotencyRecord(ctx, tx, counter)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return counter, nil
+}
+
+// SetCounter sets the counter to value when its version is still expectedVersion.
+// It returns model.ErrVersionMismatch when the counter was changed in between,
+// model.ErrOutOfBounds when the counter rejects the value and sql.ErrNoRows when
+// the counter does not exist.
+func (r *Counter) SetCounter(ctx context.Context, id uuid.UUID, value int64, expectedVersion int64) (*model.Counter, error) {
+	now := time.Now().UTC()
+
+	var counter *model.Counter
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		var previous int64
+		if err := tx.QueryRowContext(ctx, CounterValueSQL, id).Scan(&previous); err != nil {
+			return err
+		}
+
+		var err error
+		counter, err = scanCounter(tx.QueryRowContext(ctx, SetCounterSQL, id, value, expectedVersion, now))
+		if err == sql.ErrNoRows {
+			// Nothing was updated, find out which condition did not hold
+			var version int64
+			if err := tx.QueryRowContext(ctx, CounterVersionSQL, id).Scan(&version); err != nil {
+				return err
+			}
+
+			if version != expectedVersion {
+				return model.ErrVersionMismatch
+			}
+
+			return model.ErrOutOfBounds
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := recordEvent(ctx, tx, id, model.EventSet, counter.Value-previous, counter.Value, now); err != nil {
+			return err
+		}
+
+		return saveIdempotencyRecord(ctx, tx, counter)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return counter, nil
+}
+
+// SoftDeleteCounter marks the counter as deleted without removing the row.
+// It returns the number of rows affected, which is 0 when the counter does not
+// exist or is already deleted.
+func (r *Counter) SoftDeleteCounter(ctx context.Context, id uuid.UUID) (int64, error) {
+	now := time.Now().UTC()
+
+	var rowsAffected int64
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		var value int64
+		err := tx.QueryRowContext(ctx, SoftDeleteCounterSQL, id, now).Scan(&value)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rowsAffected = 1
+
+		if err := recordEvent(ctx, tx, id, model.EventDelete, 0, value, now); err != nil {
+			return err
+		}
+
+		return saveIdempotencyRecord(ctx, tx, nil)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return rowsAffected, nil
+}
+
+// UpdateCounter changes the metadata of a live counter and returns it.
+// It returns sql.ErrNoRows when the counter does not exist and
+// model.ErrNameTaken when it is renamed to a name taken in its namespace.
+func (r *Counter) UpdateCounter(ctx context.Context, id uuid.UUID, params model.UpdateCounterParams) (*model.Counter, error) {
+	now := time.Now().UTC()
+
+	var counter *model.Counter
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		row := tx.QueryRowContext(ctx, UpdateCounterSQL, id, params.Name, params.Description, params.Unit, params.Labels, now)
+
+		var err error
+		if counter, err = scanCounter(row); isNameTaken(err) {
+			return model.ErrNameTaken
+		} else if err != nil {
+			return err
+		}
+
+		if err := recordEvent(ctx, tx, id, model.EventUpdate, 0, counter.Value, now); err != nil {
+			return err
+		}
+
+		return saveIdempotencyRecord(ctx, tx, counter)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return counter, nil
+}
+
+// RestoreCounter clears the deleted mark of a soft deleted counter and returns it.
+// It returns sql.ErrNoRows when there is no deleted counter with the given id and
+// model.ErrNameTaken when another counter took its name in the meantime.
+func (r *Counter) RestoreCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
+	now := time.Now().UTC()
+
+	var counter *model.Counter
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		var err error
+		if counter, err = scanCounter(tx.QueryRowContext(ctx, RestoreCounterSQL, id, now)); isNameTaken(err) {
+			return model.ErrNameTaken
+		} else if err != nil {
+			return err
+		}
+
+		if err := recordEvent(ctx, tx, id, model.EventRestore, 0, counter.Value, now); err != nil {
+			return err
+		}
+
+		return saveIdempotencyRecord(ctx, tx, counter)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return counter, nil
+}
+
+// PurgeDeletedCounters hard deletes the counters soft deleted before the given time,
+// their history goes with them. It returns the number of counters removed.
+func (r *Counter) PurgeDeletedCounters(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, PurgeDeletedCountersSQL, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// isNameTaken reports whether err violates the unique index on the names of
+// the live counters of a namespace. The message is matched rather than the
+// sqlite3.Error type, which only exists in the cgo builds of the driver.
+func isNameTaken(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed: counter.namespace")
+}
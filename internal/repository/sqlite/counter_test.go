@@ -0,0 +1,44 @@
+package sqlite_test
+
+import (
+	"context"
+	"gounter/internal/repository/sqlite"
+	"gounter/internal/service"
+	"gounter/test/storagetest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteRepository(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) service.Repository {
+		db, err := sqlite.Open(filepath.Join(t.TempDir(), "gounter.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+
+		return sqlite.New(db)
+	})
+}
+
+func TestSQLiteMigrationsAreAppliedOnce(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "gounter.db")
+
+	db, err := sqlite.Open(filename)
+	require.NoError(t, err)
+
+	counter, err := sqlite.New(db).CreateCounter(context.TODO(), storagetest.CounterParams("kept"))
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	// Reopening the file keeps the schema and the data
+	db, err = sqlite.Open(filename)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, sqlite.Migrate(context.TODO(), db))
+
+	stored, err := sqlite.New(db).GetCounter(context.TODO(), counter.ID)
+	require.NoError(t, err)
+	require.Equal(t, "kept", stored.Name)
+}
@@ -0,0 +1,172 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"gounter/internal/model"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	InsertCounterEventSQL = `
+		INSERT INTO counter_events (counter_id, type, delta, value, subject, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6);`
+
+	ListCounterEventsSQL = `
+		SELECT id, counter_id, type, delta, value, subject, created_at
+		FROM counter_events
+		WHERE counter_id = ?1 AND id > ?2`
+
+	AddToCounterBucketsSQL = `
+		INSERT INTO counter_buckets (counter_id, granularity, bucket_start, delta, increments)
+		VALUES (?1, 'minute', ?2, ?5, 1), (?1, 'hour', ?3, ?5, 1), (?1, 'day', ?4, ?5, 1)
+		ON CONFLICT (counter_id, granularity, bucket_start) DO UPDATE
+		SET delta = delta + excluded.delta, increments = increments + 1;`
+
+	ListCounterBucketsSQL = `
+		SELECT bucket_start, delta, increments
+		FROM counter_buckets
+		WHERE counter_id = ?1 AND granularity = ?2 AND bucket_start >= ?3 AND bucket_start < ?4
+		ORDER BY bucket_start;`
+
+	// SumCounterBucketsSQL sums the buckets of the counters whose ids are given in place of %s
+	SumCounterBucketsSQL = `
+		SELECT bucket_start, SUM(delta), SUM(increments)
+		FROM counter_buckets
+		WHERE granularity = ?1 AND bucket_start >= ?2 AND bucket_start < ?3 AND counter_id IN (%s)
+		GROUP BY bucket_start
+		ORDER BY bucket_start;`
+
+	PruneCounterBucketsSQL = `
+		DELETE FROM counter_buckets
+		WHERE granularity = ?1 AND bucket_start < ?2;`
+)
+
+// recordEvent adds a change to the history of the counter, in the same
+// transaction as the change
+func recordEvent(ctx context.Context, tx *sqlx.Tx, counterID uuid.UUID, eventType model.CounterEventType, delta, value int64, at time.Time) error {
+	var subject sql.NullString
+	subject.String, subject.Valid = model.SubjectFromContext(ctx)
+
+	_, err := tx.ExecContext(ctx, InsertCounterEventSQL, counterID, eventType, delta, value, subject, at)
+	return err
+}
+
+// addToBuckets adds an applied change to the minute, hour and day buckets of the counter
+func addToBuckets(ctx context.Context, tx *sqlx.Tx, counterID uuid.UUID, delta int64, at time.Time) error {
+	_, err := tx.ExecContext(ctx, AddToCounterBucketsSQL, counterID,
+		model.GranularityMinute.BucketStart(at), model.GranularityHour.BucketStart(at), model.GranularityDay.BucketStart(at), delta)
+	return err
+}
+
+// ListCounterEvents returns the history of a counter matching the filter, oldest first
+func (r *Counter) ListCounterEvents(ctx context.Context, filter model.CounterEventFilter) ([]*model.CounterEvent, error) {
+	query := ListCounterEventsSQL
+	args := []interface{}{filter.CounterID, filter.AfterID}
+
+	if filter.From != nil {
+		args = append(args, filter.From.UTC())
+		query += fmt.Sprintf(" AND created_at >= ?%d", len(args))
+	}
+
+	if filter.To != nil {
+		args = append(args, filter.To.UTC())
+		query += fmt.Sprintf(" AND created_at < ?%d", len(args))
+	}
+
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf("\n\t\tORDER BY id\n\t\tLIMIT ?%d;", len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*model.CounterEvent{}
+	for rows.Next() {
+		var (
+			event   model.CounterEvent
+			subject sql.NullString
+		)
+
+		err := rows.Scan(&event.ID, &event.CounterID, &event.Type, &event.Delta, &event.Value, &subject, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		event.Subject = subject.String
+		event.CreatedAt = event.CreatedAt.UTC()
+
+		events = append(events, &event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// ListCounterBuckets returns the buckets of a counter starting within [from, to), oldest first
+func (r *Counter) ListCounterBuckets(ctx context.Context, id uuid.UUID, granularity model.Granularity, from, to time.Time) ([]*model.CounterBucket, error) {
+	return r.queryBuckets(ctx, ListCounterBucketsSQL, id, granularity, from.UTC(), to.UTC())
+}
+
+// SumCounterBuckets returns the buckets of the counters starting within [from, to),
+// summed across the counters, oldest first
+func (r *Counter) SumCounterBuckets(ctx context.Context, ids []uuid.UUID, granularity model.Granularity, from, to time.Time) ([]*model.CounterBucket, error) {
+	if len(ids) == 0 {
+		return []*model.CounterBucket{}, nil
+	}
+
+	args := []interface{}{granularity, from.UTC(), to.UTC()}
+	placeholders := make([]string, len(ids))
+	for i, id := range ids {
+		args = append(args, id)
+		placeholders[i] = fmt.Sprintf("?%d", len(args))
+	}
+
+	return r.queryBuckets(ctx, fmt.Sprintf(SumCounterBucketsSQL, strings.Join(placeholders, ", ")), args...)
+}
+
+// PruneCounterBuckets removes the buckets of the granularity starting before
+// the given time, returning the number of buckets removed
+func (r *Counter) PruneCounterBuckets(ctx context.Context, granularity model.Granularity, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, PruneCounterBucketsSQL, granularity, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// queryBuckets runs a query returning the start, delta and increments of buckets
+func (r *Counter) queryBuckets(ctx context.Context, query string, args ...interface{}) ([]*model.CounterBucket, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []*model.CounterBucket{}
+	for rows.Next() {
+		var bucket model.CounterBucket
+		if err := rows.Scan(&bucket.Start, &bucket.Delta, &bucket.Increments); err != nil {
+			return nil, err
+		}
+		bucket.Start = bucket.Start.UTC()
+
+		buckets = append(buckets, &bucket)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return buckets, nil
+}
@@ -0,0 +1,78 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"gounter/internal/model"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	GetIdempotencyRecordSQL = `
+		SELECT subject, key, request, counter, created_at
+		FROM idempotency_keys
+		WHERE subject = ?1 AND key = ?2 AND created_at >= ?3;`
+
+	// SaveIdempotencyRecordSQL only replaces an existing key of the subject once
+	// it fell out of the window, otherwise it returns no row.
+	SaveIdempotencyRecordSQL = `
+		INSERT INTO idempotency_keys (subject, key, request, counter, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?5)
+		ON CONFLICT (subject, key) DO UPDATE
+		SET request = EXCLUDED.request, counter = EXCLUDED.counter, created_at = EXCLUDED.created_at
+		WHERE idempotency_keys.created_at < ?6
+		RETURNING key;`
+)
+
+// GetIdempotencyRecord returns the record saved by subject under key since the
+// given time. It returns sql.ErrNoRows when there is none.
+func (r *Counter) GetIdempotencyRecord(ctx context.Context, subject, key string, since time.Time) (*model.IdempotencyRecord, error) {
+	var (
+		record  model.IdempotencyRecord
+		counter []byte
+	)
+
+	err := r.db.QueryRowContext(ctx, GetIdempotencyRecordSQL, subject, key, since.UTC()).
+		Scan(&record.Subject, &record.Key, &record.Request, &counter, &record.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if counter != nil {
+		if err := json.Unmarshal(counter, &record.Counter); err != nil {
+			return nil, err
+		}
+	}
+
+	return &record, nil
+}
+
+// saveIdempotencyRecord saves the record carried by ctx, if any, with the
+// counter state resulting from the change made in tx.
+// It returns model.ErrDuplicateIdempotencyKey when the key is already taken.
+func saveIdempotencyRecord(ctx context.Context, tx *sqlx.Tx, counter *model.Counter) error {
+	record, ok := model.IdempotencyRecordFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	var state []byte
+	if counter != nil {
+		var err error
+		if state, err = json.Marshal(counter); err != nil {
+			return err
+		}
+	}
+
+	var key string
+	err := tx.QueryRowContext(ctx, SaveIdempotencyRecordSQL, record.Subject, record.Key, record.Request, state, time.Now().UTC(), record.Since.UTC()).
+		Scan(&key)
+	if err == sql.ErrNoRows {
+		return model.ErrDuplicateIdempotencyKey
+	}
+
+	return err
+}
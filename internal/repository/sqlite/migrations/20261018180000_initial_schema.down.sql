@@ -0,0 +1,4 @@
+DROP TABLE counter_buckets;
+DROP TABLE counter_events;
+DROP TABLE idempotency_keys;
+DROP TABLE counter;
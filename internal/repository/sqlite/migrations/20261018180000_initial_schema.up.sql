@@ -0,0 +1,46 @@
+CREATE TABLE counter (
+    id TEXT PRIMARY KEY NOT NULL,
+    name TEXT NOT NULL,
+    value INTEGER NOT NULL DEFAULT 0,
+    min_value INTEGER,
+    max_value INTEGER,
+    overflow_policy TEXT NOT NULL DEFAULT 'reject' CHECK (overflow_policy IN ('reject', 'saturate')),
+    shards INTEGER NOT NULL DEFAULT 1 CHECK (shards >= 1),
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP,
+    CHECK (min_value IS NULL OR max_value IS NULL OR min_value <= max_value)
+);
+
+CREATE INDEX counter_deleted_at_idx ON counter (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE idempotency_keys (
+    key TEXT PRIMARY KEY NOT NULL,
+    request TEXT NOT NULL,
+    counter BLOB,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys (created_at);
+
+CREATE TABLE counter_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    counter_id TEXT NOT NULL REFERENCES counter (id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    delta INTEGER NOT NULL,
+    value INTEGER NOT NULL,
+    subject TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX counter_events_counter_id_id_idx ON counter_events (counter_id, id);
+
+CREATE TABLE counter_buckets (
+    counter_id TEXT NOT NULL REFERENCES counter (id) ON DELETE CASCADE,
+    granularity TEXT NOT NULL,
+    bucket_start TIMESTAMP NOT NULL,
+    delta INTEGER NOT NULL DEFAULT 0,
+    increments INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (counter_id, granularity, bucket_start)
+);
@@ -0,0 +1,3 @@
+ALTER TABLE counter ADD COLUMN namespace TEXT;
+
+CREATE UNIQUE INDEX counter_namespace_name_key ON counter (namespace, name) WHERE namespace IS NOT NULL AND deleted_at IS NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE counter DROP COLUMN unit;
+ALTER TABLE counter DROP COLUMN description;
+ALTER TABLE counter DROP COLUMN labels;
@@ -0,0 +1,3 @@
+ALTER TABLE counter ADD COLUMN labels TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE counter ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE counter ADD COLUMN unit TEXT NOT NULL DEFAULT '';
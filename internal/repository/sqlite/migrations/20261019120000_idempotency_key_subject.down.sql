@@ -0,0 +1,15 @@
+CREATE TABLE idempotency_keys_by_key (
+    key TEXT PRIMARY KEY NOT NULL,
+    request TEXT NOT NULL,
+    counter BLOB,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Keep the latest record of the keys used by several subjects
+INSERT OR REPLACE INTO idempotency_keys_by_key (key, request, counter, created_at)
+SELECT key, request, counter, created_at FROM idempotency_keys ORDER BY created_at;
+
+DROP TABLE idempotency_keys;
+ALTER TABLE idempotency_keys_by_key RENAME TO idempotency_keys;
+
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys (created_at);
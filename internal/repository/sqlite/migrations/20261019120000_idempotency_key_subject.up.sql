@@ -0,0 +1,17 @@
+-- SQLite cannot change a primary key, the table is copied into one keyed by subject
+CREATE TABLE idempotency_keys_by_subject (
+    subject TEXT NOT NULL DEFAULT '',
+    key TEXT NOT NULL,
+    request TEXT NOT NULL,
+    counter BLOB,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (subject, key)
+);
+
+INSERT INTO idempotency_keys_by_subject (key, request, counter, created_at)
+SELECT key, request, counter, created_at FROM idempotency_keys;
+
+DROP TABLE idempotency_keys;
+ALTER TABLE idempotency_keys_by_subject RENAME TO idempotency_keys;
+
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys (created_at);
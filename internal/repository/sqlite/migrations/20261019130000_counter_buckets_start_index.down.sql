@@ -0,0 +1 @@
+DROP INDEX counter_buckets_granularity_start_idx;
@@ -0,0 +1,132 @@
+// Package sqlite stores counters in a SQLite database file, for running gounter
+// as a single binary without a database server.
+//
+// The go-sqlite3 driver needs cgo: a binary built with CGO_ENABLED=0 compiles
+// but fails to open the database. Transactions take the write lock when they
+// begin, so changes are applied one at a time, each waiting up to 5s for the
+// lock. Batches and aggregated increments are not supported.
+package sqlite
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+const (
+	CreateMigrationsTableSQL = `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY NOT NULL
+		);`
+
+	AppliedMigrationsSQL = `
+		SELECT version FROM schema_migrations;`
+
+	RecordMigrationSQL = `
+		INSERT INTO schema_migrations (version) VALUES (?1);`
+)
+
+// Open opens the database file at filename, creating it when missing, and
+// brings its schema up to date. Write transactions take the database lock
+// when they begin, so concurrent increments wait for each other instead of
+// failing to upgrade a read lock.
+func Open(filename string) (*sqlx.DB, error) {
+	dsn := fmt.Sprintf("file:%s?_txlock=immediate&_busy_timeout=5000&_journal_mode=WAL&_foreign_keys=on", filename)
+
+	db, err := sqlx.Connect("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Migrate(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Migrate applies the embedded up migrations that were not applied yet, in version order
+func Migrate(ctx context.Context, db *sqlx.DB) error {
+	if _, err := db.ExecContext(ctx, CreateMigrationsTableSQL); err != nil {
+		return err
+	}
+
+	var applied []int64
+	if err := db.SelectContext(ctx, &applied, AppliedMigrationsSQL); err != nil {
+		return err
+	}
+
+	done := make(map[int64]bool, len(applied))
+	for _, version := range applied {
+		done[version] = true
+	}
+
+	files, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".up.sql") {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version, err := strconv.ParseInt(strings.SplitN(name, "_", 2)[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid migration name %q", name)
+		}
+
+		if done[version] {
+			continue
+		}
+
+		script, err := migrations.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return err
+		}
+
+		err = inTx(ctx, db, func(tx *sqlx.Tx) error {
+			if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+				return err
+			}
+
+			_, err := tx.ExecContext(ctx, RecordMigrationSQL, version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// inTx runs fn in a transaction, which is rolled back when fn fails
+func inTx(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gounter/internal/model"
+	"gounter/internal/validation"
+
+	"github.com/google/uuid"
+)
+
+// MaxBatchSize is the largest number of operations a batch can hold
+const MaxBatchSize = 1000
+
+// BatchRepository is implemented by the storages able to apply a batch of
+// operations in a single transaction
+type BatchRepository interface {
+	Repository
+	// ApplyBatch applies the operations in order. When atomic is set the first
+	// failed operation rolls back the whole batch and is returned as a
+	// *model.BatchError, otherwise the failed operations are reported in their
+	// results and the others are kept.
+	ApplyBatch(ctx context.Context, ops []model.BatchOperation, atomic bool) ([]model.BatchResult, error)
+}
+
+var (
+	// ErrBatchUnsupported is returned when the storage cannot apply batches
+	ErrBatchUnsupported = newError(KindUnsupported, "batch_unsupported", "batches are not supported by this storage")
+	// ErrEmptyBatch is returned when a batch has no operations
+	ErrEmptyBatch = newError(KindValidation, "empty_batch", "batch must have at least one operation")
+	// ErrBatchTooLarge is returned when a batch has more than MaxBatchSize operations
+	ErrBatchTooLarge = newError(KindValidation, "batch_too_large", fmt.Sprintf("batch must have at most %d operations", MaxBatchSize))
+	// ErrInvalidBatchOperation is returned for an operation of an unknown type
+	ErrInvalidBatchOperation = newError(KindValidation, "invalid_batch_operation", "operation must be create, increment, set or delete")
+)
+
+// ApplyBatch applies many counter operations in a single transaction and
+// returns the result of each one. In atomic mode an invalid or failed
+// operation fails the whole batch with a *model.BatchError and nothing is
+// applied. Otherwise each operation succeeds or fails on its own. With an
+// idempotency key the results of a retried batch are replayed.
+func (s *CounterService) ApplyBatch(ctx context.Context, ops []model.BatchOperation, atomic bool) ([]model.BatchResult, error) {
+	repo, ok := s.repo.(BatchRepository)
+	if !ok {
+		return nil, ErrBatchUnsupported
+	}
+
+	if len(ops) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	if len(ops) > MaxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	results := make([]model.BatchResult, len(ops))
+
+	// The valid operations go to storage, indexes maps them back to their position
+	valid := make([]model.BatchOperation, 0, len(ops))
+	indexes := make([]int, 0, len(ops))
+	for i, op := range ops {
+		if err := validateBatchOperation(&op); err != nil {
+			if atomic {
+				return nil, &model.BatchError{Index: i, Err: err}
+			}
+
+			results[i].Err = err
+			continue
+		}
+
+		valid = append(valid, op)
+		indexes = append(indexes, i)
+	}
+
+	if len(valid) == 0 {
+		return results, nil
+	}
+
+	request, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := "best_effort"
+	if atomic {
+		mode = "atomic"
+	}
+
+	applied, err := s.idempotentBatch(ctx, fmt.Sprintf("batch %s %s", mode, request), func(ctx context.Context) ([]model.BatchResult, error) {
+		applied, err := repo.ApplyBatch(ctx, valid, atomic)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, result := range applied {
+			if result.Err != nil {
+				continue
+			}
+
+			if valid[i].Type == model.BatchDelete {
+				s.changes.publish(&model.Counter{ID: valid[i].CounterID}, true)
+			} else {
+				s.changes.publish(result.Counter, false)
+			}
+		}
+
+		return applied, nil
+	})
+	if err != nil {
+		var batchErr *model.BatchError
+		if errors.As(err, &batchErr) {
+			return nil, &model.BatchError{Index: indexes[batchErr.Index], Err: operationError(valid[batchErr.Index], batchErr.Err)}
+		}
+
+		return nil, err
+	}
+
+	for i, result := range applied {
+		if result.Err != nil {
+			result.Err = operationError(valid[i], result.Err)
+		}
+		results[indexes[i]] = result
+	}
+
+	return results, nil
+}
+
+// validateBatchOperation checks an operation the way the single counter
+// methods check their arguments, and fills in the defaults
+func validateBatchOperation(op *model.BatchOperation) error {
+	var v validation.Validator
+
+	switch op.Type {
+	case model.BatchCreate:
+		return validateCreateParams(&op.Create)
+	case model.BatchIncrement:
+		v.Field("delta", validateDelta(op.Delta))
+	case model.BatchSet, model.BatchDelete:
+	default:
+		v.Field("op", ErrInvalidBatchOperation)
+	}
+	v.Check(op.CounterID != uuid.Nil, "id", validation.ErrRequired)
+
+	return v.Err()
+}
+
+// operationError turns the storage error of a failed operation into the error
+// the single counter methods return
+func operationError(op model.BatchOperation, err error) error {
+	switch err {
+	case sql.ErrNoRows:
+		return ErrCounterNotFound
+	case model.ErrVersionMismatch:
+		return ErrVersionMismatch
+	case model.ErrNameTaken:
+		return ErrNameTaken
+	case model.ErrOutOfBounds:
+		if op.Type == model.BatchSet {
+			return &OutOfBoundsError{ID: op.CounterID, Value: &op.Value}
+		}
+
+		return &OutOfBoundsError{ID: op.CounterID, Delta: op.Delta}
+	}
+
+	return err
+}
@@ -0,0 +1,125 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"gounter/internal/model"
+	"gounter/internal/service"
+	"gounter/internal/validation"
+	"gounter/test/mocks"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounterServiceApplyBatch(t *testing.T) {
+	id := uuid.New()
+
+	create := model.BatchOperation{Type: model.BatchCreate, Create: model.CreateCounterParams{Name: "created"}}
+	// The service fills in the defaults of the created counter
+	created := model.BatchOperation{Type: model.BatchCreate, Create: model.CreateCounterParams{Name: "created", Namespace: model.DefaultNamespace, OverflowPolicy: model.OverflowReject, Shards: 1}}
+	increment := model.BatchOperation{Type: model.BatchIncrement, CounterID: id, Delta: 5}
+	zero := model.BatchOperation{Type: model.BatchIncrement, CounterID: id}
+	set := model.BatchOperation{Type: model.BatchSet, CounterID: id, Value: 3, ExpectedVersion: 2}
+
+	tests := []struct {
+		name            string
+		setupMock       func(repo *mocks.Repository)
+		ops             []model.BatchOperation
+		atomic          bool
+		expectedResults []model.BatchResult
+		expectedError   error
+	}{
+		{
+			name: "applies a batch",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("ApplyBatch", mock.Anything, []model.BatchOperation{created, increment}, true).
+					Return([]model.BatchResult{{Counter: &model.Counter{Name: "created"}}, {Counter: &model.Counter{ID: id, Value: 5}}}, nil)
+			},
+			ops:             []model.BatchOperation{create, increment},
+			atomic:          true,
+			expectedResults: []model.BatchResult{{Counter: &model.Counter{Name: "created"}}, {Counter: &model.Counter{ID: id, Value: 5}}},
+		},
+		{
+			name:          "fails an atomic batch with an invalid operation",
+			setupMock:     func(repo *mocks.Repository) {},
+			ops:           []model.BatchOperation{create, zero},
+			atomic:        true,
+			expectedError: &model.BatchError{Index: 1, Err: validation.Errors{{Field: "delta", Err: service.ErrInvalidDelta}}},
+		},
+		{
+			name: "maps the failed operation of an atomic batch",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("ApplyBatch", mock.Anything, []model.BatchOperation{increment, set}, true).
+					Return(nil, &model.BatchError{Index: 1, Err: model.ErrVersionMismatch})
+			},
+			ops:           []model.BatchOperation{increment, set},
+			atomic:        true,
+			expectedError: &model.BatchError{Index: 1, Err: service.ErrVersionMismatch},
+		},
+		{
+			name: "applies the valid operations of a best effort batch",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("ApplyBatch", mock.Anything, []model.BatchOperation{increment, set}, false).
+					Return([]model.BatchResult{{Err: model.ErrOutOfBounds}, {Err: sql.ErrNoRows}}, nil)
+			},
+			ops:    []model.BatchOperation{zero, increment, {Type: "reset"}, set},
+			atomic: false,
+			expectedResults: []model.BatchResult{
+				{Err: validation.Errors{{Field: "delta", Err: service.ErrInvalidDelta}}},
+				{Err: &service.OutOfBoundsError{ID: id, Delta: 5}},
+				{Err: validation.Errors{{Field: "op", Err: service.ErrInvalidBatchOperation}, {Field: "id", Err: validation.ErrRequired}}},
+				{Err: service.ErrCounterNotFound},
+			},
+		},
+		{
+			name:          "empty batch",
+			setupMock:     func(repo *mocks.Repository) {},
+			ops:           []model.BatchOperation{},
+			expectedError: service.ErrEmptyBatch,
+		},
+		{
+			name:          "too many operations",
+			setupMock:     func(repo *mocks.Repository) {},
+			ops:           make([]model.BatchOperation, service.MaxBatchSize+1),
+			expectedError: service.ErrBatchTooLarge,
+		},
+		{
+			name: "database error",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("ApplyBatch", mock.Anything, mock.Anything, false).Return(nil, errors.New("db error"))
+			},
+			ops:           []model.BatchOperation{increment},
+			expectedError: errors.New("db error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(mocks.Repository)
+			tt.setupMock(mockRepo)
+
+			counterService := service.NewCounterService(mockRepo)
+
+			results, err := counterService.ApplyBatch(context.TODO(), tt.ops, tt.atomic)
+
+			require.Equal(t, tt.expectedError, err)
+			require.Equal(t, tt.expectedResults, results)
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCounterServiceApplyBatchUnsupported(t *testing.T) {
+	// Hide ApplyBatch from the service
+	repo := struct{ service.Repository }{new(mocks.Repository)}
+
+	counterService := service.NewCounterService(repo)
+
+	_, err := counterService.ApplyBatch(context.TODO(), []model.BatchOperation{{Type: model.BatchDelete}}, true)
+	require.Equal(t, service.ErrBatchUnsupported, err)
+}
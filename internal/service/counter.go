@@ -3,8 +3,13 @@ package service
 import (
 	"context"
 	"database/sql"
-	"errors"
+	"encoding/json"
+	"fmt"
 	"gounter/internal/model"
+	"gounter/internal/validation"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -12,56 +17,592 @@ import (
 // Repository defines the interface for the counter repository
 type Repository interface {
 	SoftDeleteCounter(ctx context.Context, id uuid.UUID) (int64, error)
-	IncrementCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error)
-	CreateCounter(ctx context.Context, name string) (*model.Counter, error)
+	IncrementCounter(ctx context.Context, id uuid.UUID, delta int64) (*model.Counter, error)
+	SetCounter(ctx context.Context, id uuid.UUID, value int64, expectedVersion int64) (*model.Counter, error)
+	UpdateCounter(ctx context.Context, id uuid.UUID, params model.UpdateCounterParams) (*model.Counter, error)
+	CreateCounter(ctx context.Context, params model.CreateCounterParams) (*model.Counter, error)
+	GetCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error)
+	GetCounterByName(ctx context.Context, namespace, name string) (*model.Counter, error)
+	ListCounters(ctx context.Context, filter model.CounterFilter) ([]*model.Counter, error)
+	RestoreCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error)
+	PurgeDeletedCounters(ctx context.Context, before time.Time) (int64, error)
+	GetIdempotencyRecord(ctx context.Context, subject, key string, since time.Time) (*model.IdempotencyRecord, error)
+	ListCounterEvents(ctx context.Context, filter model.CounterEventFilter) ([]*model.CounterEvent, error)
+	ListCounterBuckets(ctx context.Context, id uuid.UUID, granularity model.Granularity, from, to time.Time) ([]*model.CounterBucket, error)
+	SumCounterBuckets(ctx context.Context, ids []uuid.UUID, granularity model.Granularity, from, to time.Time) ([]*model.CounterBucket, error)
+	PruneCounterBuckets(ctx context.Context, granularity model.Granularity, before time.Time) (int64, error)
 }
 
-// ErrCounterNotFound is returned when a counter is not found
-var ErrCounterNotFound = errors.New("counter not found")
+const (
+	// DefaultListLimit is the page size used when the client does not ask for one
+	DefaultListLimit = 20
+	// MaxListLimit is the largest page size a client can ask for
+	MaxListLimit = 100
+	// MaxShards is the largest number of shards a counter can be spread across
+	MaxShards = 64
+	// DefaultPurgeRetention is how long soft deleted counters are kept before a purge removes them
+	DefaultPurgeRetention = 30 * 24 * time.Hour
+	// MaxLabels is the largest number of labels a counter can have
+	MaxLabels = 32
+)
+
+var (
+	// ErrCounterNotFound is returned when a counter is not found
+	ErrCounterNotFound = newError(KindNotFound, "counter_not_found", "counter not found")
+	// ErrInvalidSort is returned when counters are listed by an unsupported field
+	ErrInvalidSort = newError(KindValidation, "invalid_sort", "invalid sort field")
+	// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+	ErrInvalidCursor = newError(KindValidation, "invalid_cursor", "invalid cursor")
+	// ErrInvalidDelta is returned when a counter is changed by zero
+	ErrInvalidDelta = newError(KindValidation, "invalid_delta", "delta must not be zero")
+	// ErrInvalidRetention is returned when purging with a non positive retention period
+	ErrInvalidRetention = newError(KindValidation, "invalid_retention", "retention must be positive")
+	// ErrInvalidBounds is returned when a counter is created with bounds that exclude its initial value of 0
+	ErrInvalidBounds = newError(KindValidation, "invalid_bounds", "bounds must satisfy min <= 0 <= max")
+	// ErrInvalidOverflowPolicy is returned when a counter is created with an unknown overflow policy
+	ErrInvalidOverflowPolicy = newError(KindValidation, "invalid_overflow_policy", "overflow policy must be reject or saturate")
+	// ErrInvalidShards is returned when a counter is created with less than 1 or more than MaxShards shards
+	ErrInvalidShards = newError(KindValidation, "invalid_shards", fmt.Sprintf("shards must be between 1 and %d", MaxShards))
+	// ErrShardedBounds is returned when a sharded counter is created with bounds, which would need every shard locked
+	ErrShardedBounds = newError(KindValidation, "sharded_bounds", "sharded counters cannot have bounds")
+	// ErrVersionMismatch is returned when a conditional write expected another version of the counter
+	ErrVersionMismatch = newError(KindPreconditionFailed, "version_mismatch", "counter version does not match")
+	// ErrInvalidTimeRange is returned when the history is read with a range ending before it starts
+	ErrInvalidTimeRange = newError(KindValidation, "invalid_time_range", "from must be before to")
+	// ErrInvalidNamespace is returned when a counter is created in a namespace with an unsupported name
+	ErrInvalidNamespace = newError(KindValidation, "invalid_namespace", "namespace must be 1 to 64 letters, digits, '.', '_' or '-'")
+	// ErrNameTaken is returned when another live counter of the namespace has the same name
+	ErrNameTaken = newError(KindConflict, "name_taken", "counter name is already taken in the namespace")
+	// ErrInvalidLabels is returned when a counter is given too many labels or labels with unsupported characters
+	ErrInvalidLabels = newError(KindValidation, "invalid_labels", fmt.Sprintf("labels must be at most %d keys and values of up to 63 letters, digits, '.', '_', '/' or '-'", MaxLabels))
+	// ErrInvalidLabelSelector is returned when counters are filtered with a selector other than key=value pairs separated by commas
+	ErrInvalidLabelSelector = newError(KindValidation, "invalid_label_selector", "label selector must be key=value pairs separated by commas")
+	// ErrEmptyUpdate is returned when a counter is updated without any field to change
+	ErrEmptyUpdate = newError(KindValidation, "empty_update", "update must change at least one field")
+)
+
+var (
+	// namespacePattern matches the supported namespaces
+	namespacePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+	// labelKeyPattern and labelValuePattern match the supported labels, which
+	// need no escaping in a label selector or a JSON path
+	labelKeyPattern   = regexp.MustCompile(`^[A-Za-z0-9._/-]{1,63}$`)
+	labelValuePattern = regexp.MustCompile(`^[A-Za-z0-9._/-]{0,63}$`)
+)
+
+// OutOfBoundsError is returned when a change would move a counter past one of
+// its bounds and the counter uses the reject overflow policy
+type OutOfBoundsError struct {
+	ID uuid.UUID
+	// Delta is the rejected change of an increment
+	Delta int64
+	// Value is the rejected value of a set
+	Value *int64
+}
+
+func (e *OutOfBoundsError) Error() string {
+	if e.Value != nil {
+		return fmt.Sprintf("setting counter %s to %d would exceed its bounds", e.ID, *e.Value)
+	}
+
+	return fmt.Sprintf("changing counter %s by %d would exceed its bounds", e.ID, e.Delta)
+}
+
+// Unwrap lets errors.Is match the error against model.ErrOutOfBounds
+func (e *OutOfBoundsError) Unwrap() error {
+	return model.ErrOutOfBounds
+}
+
+// Kind returns KindConflict, the change conflicts with the value of the counter
+func (e *OutOfBoundsError) Kind() ErrorKind {
+	return KindConflict
+}
+
+// Code returns the stable identifier of the error
+func (e *OutOfBoundsError) Code() string {
+	return "out_of_bounds"
+}
 
 // CounterService is an implementation of the Service interface
 type CounterService struct {
-	repo Repository
+	repo              Repository
+	idempotencyWindow time.Duration
+	// minuteBucketRetention is how long minute buckets are kept
+	minuteBucketRetention time.Duration
+	// changes publishes the successful writes to the watchers of the counters
+	changes *changeFeed
+}
+
+// Option configures optional behaviour of the counter service
+type Option func(*CounterService)
+
+// WithIdempotencyWindow sets how long the result of a request is replayed for its idempotency key
+func WithIdempotencyWindow(window time.Duration) Option {
+	return func(s *CounterService) {
+		s.idempotencyWindow = window
+	}
+}
+
+// WithMinuteBucketRetention sets how long minute buckets are kept before PruneMinuteBuckets removes them
+func WithMinuteBucketRetention(retention time.Duration) Option {
+	return func(s *CounterService) {
+		s.minuteBucketRetention = retention
+	}
 }
 
 // NewCounterService creates a new instance of the counter service
-func NewCounterService(repo Repository) *CounterService {
-	return &CounterService{repo: repo}
+func NewCounterService(repo Repository, opts ...Option) *CounterService {
+	s := &CounterService{
+		repo:                  repo,
+		idempotencyWindow:     DefaultIdempotencyWindow,
+		minuteBucketRetention: DefaultMinuteBucketRetention,
+		changes:               newChangeFeed(),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 // CreateCounter calls the repository to create a counter and returns the created counter
-func (s *CounterService) CreateCounter(ctx context.Context, name string) (*model.Counter, error) {
-	counter, err := s.repo.CreateCounter(ctx, name)
+func (s *CounterService) CreateCounter(ctx context.Context, params model.CreateCounterParams) (*model.Counter, error) {
+	if err := validateCreateParams(&params); err != nil {
+		return nil, err
+	}
+
+	request, err := json.Marshal(params)
 	if err != nil {
 		return nil, err
 	}
 
+	return s.idempotent(ctx, "create "+string(request), func(ctx context.Context) (*model.Counter, error) {
+		counter, err := s.repo.CreateCounter(ctx, params)
+		if err != nil {
+			if err == model.ErrNameTaken {
+				return nil, ErrNameTaken
+			}
+
+			return nil, err
+		}
+
+		s.changes.publish(counter, false)
+		return counter, nil
+	})
+}
+
+// validateCreateParams checks the parameters of a new counter and fills in
+// the defaults. Every invalid field is reported in validation.Errors.
+func validateCreateParams(params *model.CreateCounterParams) error {
+	var v validation.Validator
+
+	// Counters created without a namespace go to the default one, so their
+	// names are unique and they can be incremented by name
+	if params.Namespace == "" {
+		params.Namespace = model.DefaultNamespace
+	}
+
+	v.Field("name", validation.Name(params.Name))
+	v.Check(namespacePattern.MatchString(params.Namespace), "namespace", ErrInvalidNamespace)
+	v.Field("labels", validateLabels(params.Labels))
+
+	switch params.OverflowPolicy {
+	case "":
+		params.OverflowPolicy = model.OverflowReject
+	case model.OverflowReject, model.OverflowSaturate:
+	default:
+		v.Field("overflow_policy", ErrInvalidOverflowPolicy)
+	}
+
+	// Counters start at 0, so the bounds have to allow it
+	v.Check(params.Min == nil || *params.Min <= 0, "min", ErrInvalidBounds)
+	v.Check(params.Max == nil || *params.Max >= 0, "max", ErrInvalidBounds)
+
+	if params.Shards == 0 {
+		params.Shards = 1
+	}
+	if params.Shards < 1 || params.Shards > MaxShards {
+		v.Field("shards", ErrInvalidShards)
+	} else if params.Shards > 1 && (params.Min != nil || params.Max != nil) {
+		v.Field("shards", ErrShardedBounds)
+	}
+
+	return v.Err()
+}
+
+// validateDelta checks the change made by an increment or a decrement
+func validateDelta(delta int64) error {
+	if delta == 0 {
+		return ErrInvalidDelta
+	}
+
+	return validation.Delta(delta)
+}
+
+// validateLabels checks the number of labels and their characters
+func validateLabels(labels model.Labels) error {
+	if len(labels) > MaxLabels {
+		return ErrInvalidLabels
+	}
+
+	for key, value := range labels {
+		if !labelKeyPattern.MatchString(key) || !labelValuePattern.MatchString(value) {
+			return ErrInvalidLabels
+		}
+	}
+
+	return nil
+}
+
+// parseLabelSelector reads a selector like team=payments,env=prod into the
+// labels the counters must have. An empty selector matches every counter.
+func parseLabelSelector(selector string) (model.Labels, error) {
+	if strings.TrimSpace(selector) == "" {
+		return nil, nil
+	}
+
+	labels := model.Labels{}
+	for _, requirement := range strings.Split(selector, ",") {
+		parts := strings.SplitN(requirement, "=", 2)
+		if len(parts) != 2 {
+			return nil, ErrInvalidLabelSelector
+		}
+
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if !labelKeyPattern.MatchString(key) || !labelValuePattern.MatchString(value) {
+			return nil, ErrInvalidLabelSelector
+		}
+		if got, ok := labels[key]; ok && got != value {
+			return nil, ErrInvalidLabelSelector
+		}
+		labels[key] = value
+	}
+
+	return labels, nil
+}
+
+// GetCounter returns the counter with the given id
+func (s *CounterService) GetCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
+	counter, err := s.repo.GetCounter(ctx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrCounterNotFound
+		}
+
+		return nil, err
+	}
+
 	return counter, nil
 }
 
-// IncrementCounter increments the counter value and returns the updated counter
-func (s *CounterService) IncrementCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
-	newCounterValue, err := s.repo.IncrementCounter(ctx, id)
+// ListCounters returns a page of counters matching the query along with the
+// cursor for the next page, which is empty on the last page.
+func (s *CounterService) ListCounters(ctx context.Context, query model.ListCountersQuery) (*model.CounterPage, error) {
+	if query.SortBy == "" {
+		query.SortBy = model.SortByCreatedAt
+	}
+
+	switch query.SortBy {
+	case model.SortByName, model.SortByValue, model.SortByCreatedAt:
+	default:
+		return nil, ErrInvalidSort
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+
+	labels, err := parseLabelSelector(query.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := model.CounterFilter{
+		NamePrefix: query.NamePrefix,
+		IDs:        query.IDs,
+		Labels:     labels,
+		SortBy:     query.SortBy,
+		Descending: query.Descending,
+		// Fetch one extra counter to learn whether there is a next page
+		Limit: limit + 1,
+	}
+
+	if query.Cursor != "" {
+		after, err := decodeCursor(query.Cursor, query.SortBy, query.Descending)
+		if err != nil {
+			return nil, err
+		}
+		filter.After = after
+	}
+
+	counters, err := s.repo.ListCounters(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &model.CounterPage{Counters: counters}
+	if len(counters) > limit {
+		page.Counters = counters[:limit]
+		page.NextCursor = encodeCursor(page.Counters[limit-1], query.SortBy, query.Descending)
+	}
+
+	return page, nil
+}
+
+// CounterHistory returns a page of the changes made to a counter, oldest first,
+// along with the cursor for the next page, which is empty on the last page.
+func (s *CounterService) CounterHistory(ctx context.Context, query model.CounterHistoryQuery) (*model.CounterEventPage, error) {
+	if query.From != nil && query.To != nil && !query.From.Before(*query.To) {
+		return nil, ErrInvalidTimeRange
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+
+	filter := model.CounterEventFilter{
+		CounterID: query.CounterID,
+		From:      query.From,
+		To:        query.To,
+		// Fetch one extra event to learn whether there is a next page
+		Limit: limit + 1,
+	}
+
+	if query.Cursor != "" {
+		after, err := decodeEventCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.AfterID = after
+	}
+
+	// The history of a missing or deleted counter is not available
+	if _, err := s.GetCounter(ctx, query.CounterID); err != nil {
+		return nil, err
+	}
+
+	events, err := s.repo.ListCounterEvents(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &model.CounterEventPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		page.NextCursor = encodeEventCursor(page.Events[limit-1])
+	}
+
+	return page, nil
+}
+
+// IncrementCounter adds delta to the counter value and returns the updated counter.
+// A negative delta decrements the counter.
+func (s *CounterService) IncrementCounter(ctx context.Context, id uuid.UUID, delta int64) (*model.Counter, error) {
+	var v validation.Validator
+	v.Check(id != uuid.Nil, "id", validation.ErrRequired)
+	v.Field("delta", validateDelta(delta))
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.idempotent(ctx, fmt.Sprintf("increment %s %d", id, delta), func(ctx context.Context) (*model.Counter, error) {
+		return s.incrementCounter(ctx, id, delta)
+	})
+}
+
+// IncrementCounterByName adds delta to the counter with the name in the
+// namespace, creating the counter with the default settings on first use.
+// The default namespace is used when namespace is empty.
+func (s *CounterService) IncrementCounterByName(ctx context.Context, namespace, name string, delta int64) (*model.Counter, error) {
+	if namespace == "" {
+		namespace = model.DefaultNamespace
+	}
+
+	var v validation.Validator
+	v.Check(namespacePattern.MatchString(namespace), "namespace", ErrInvalidNamespace)
+	v.Field("name", validation.Name(name))
+	v.Field("delta", validateDelta(delta))
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	request := fmt.Sprintf("increment %s/%s %d", namespace, name, delta)
+	return s.idempotent(ctx, request, func(recordCtx context.Context) (*model.Counter, error) {
+		// Only the increment saves the idempotency record, so the counter is
+		// looked up and created without it
+		counter, err := s.namedCounter(ctx, namespace, name)
+		if err != nil {
+			return nil, err
+		}
+
+		return s.incrementCounter(recordCtx, counter.ID, delta)
+	})
+}
+
+// namedCounter returns the live counter with the name in the namespace,
+// creating it when there is none
+func (s *CounterService) namedCounter(ctx context.Context, namespace, name string) (*model.Counter, error) {
+	counter, err := s.repo.GetCounterByName(ctx, namespace, name)
+	if err != sql.ErrNoRows {
+		return counter, err
+	}
+
+	params := model.CreateCounterParams{Name: name, Namespace: namespace}
+	if err := validateCreateParams(&params); err != nil {
+		return nil, err
+	}
+
+	counter, err = s.repo.CreateCounter(ctx, params)
+	if err == model.ErrNameTaken {
+		// A concurrent request created the counter first
+		return s.repo.GetCounterByName(ctx, namespace, name)
+	}
+
+	return counter, err
+}
+
+// incrementCounter adds delta to the counter in the repository and maps its errors
+func (s *CounterService) incrementCounter(ctx context.Context, id uuid.UUID, delta int64) (*model.Counter, error) {
+	counter, err := s.repo.IncrementCounter(ctx, id, delta)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrCounterNotFound
 		}
 
+		if err == model.ErrOutOfBounds {
+			return nil, &OutOfBoundsError{ID: id, Delta: delta}
+		}
+
+		return nil, err
+	}
+
+	s.changes.publish(counter, false)
+	return counter, nil
+}
+
+// SetCounter sets the counter to an absolute value, provided nobody changed it
+// since the client read expectedVersion
+func (s *CounterService) SetCounter(ctx context.Context, id uuid.UUID, value int64, expectedVersion int64) (*model.Counter, error) {
+	return s.idempotent(ctx, fmt.Sprintf("set %s %d %d", id, value, expectedVersion), func(ctx context.Context) (*model.Counter, error) {
+		counter, err := s.repo.SetCounter(ctx, id, value, expectedVersion)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return nil, ErrCounterNotFound
+			case model.ErrVersionMismatch:
+				return nil, ErrVersionMismatch
+			case model.ErrOutOfBounds:
+				return nil, &OutOfBoundsError{ID: id, Value: &value}
+			}
+
+			return nil, err
+		}
+
+		s.changes.publish(counter, false)
+		return counter, nil
+	})
+}
+
+// UpdateCounter changes the name, description, unit or labels of a counter and returns it
+func (s *CounterService) UpdateCounter(ctx context.Context, id uuid.UUID, params model.UpdateCounterParams) (*model.Counter, error) {
+	if params.Name == nil && params.Description == nil && params.Unit == nil && params.Labels == nil {
+		return nil, ErrEmptyUpdate
+	}
+
+	var v validation.Validator
+	if params.Name != nil {
+		v.Field("name", validation.Name(*params.Name))
+	}
+	if params.Labels != nil {
+		v.Field("labels", validateLabels(*params.Labels))
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	request, err := json.Marshal(params)
+	if err != nil {
 		return nil, err
 	}
 
-	return newCounterValue, nil
+	return s.idempotent(ctx, fmt.Sprintf("update %s %s", id, request), func(ctx context.Context) (*model.Counter, error) {
+		counter, err := s.repo.UpdateCounter(ctx, id, params)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return nil, ErrCounterNotFound
+			case model.ErrNameTaken:
+				return nil, ErrNameTaken
+			}
+
+			return nil, err
+		}
+
+		s.changes.publish(counter, false)
+		return counter, nil
+	})
 }
 
 // SoftDeleteCounter soft deletes a counter and returns meaningful error if the counter is already deleted or not found
 func (s *CounterService) SoftDeleteCounter(ctx context.Context, id uuid.UUID) (int64, error) {
-	rowsAffected, err := s.repo.SoftDeleteCounter(ctx, id)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return 0, ErrCounterNotFound
+	_, err := s.idempotent(ctx, fmt.Sprintf("delete %s", id), func(ctx context.Context) (*model.Counter, error) {
+		rowsAffected, err := s.repo.SoftDeleteCounter(ctx, id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, ErrCounterNotFound
+			}
+			return nil, err
+		}
+
+		if rowsAffected == 0 {
+			return nil, ErrCounterNotFound
 		}
+
+		s.changes.publish(&model.Counter{ID: id}, true)
+		return nil, nil
+	})
+	if err != nil {
 		return 0, err
 	}
 
-	return rowsAffected, nil
+	return 1, nil
+}
+
+// RestoreCounter brings back a soft deleted counter and returns it
+func (s *CounterService) RestoreCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
+	return s.idempotent(ctx, fmt.Sprintf("restore %s", id), func(ctx context.Context) (*model.Counter, error) {
+		counter, err := s.repo.RestoreCounter(ctx, id)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return nil, ErrCounterNotFound
+			case model.ErrNameTaken:
+				return nil, ErrNameTaken
+			}
+
+			return nil, err
+		}
+
+		s.changes.publish(counter, false)
+		return counter, nil
+	})
+}
+
+// PurgeDeletedCounters permanently removes the counters that were soft deleted
+// more than retention ago and returns how many were removed
+func (s *CounterService) PurgeDeletedCounters(ctx context.Context, retention time.Duration) (int64, error) {
+	if retention <= 0 {
+		return 0, ErrInvalidRetention
+	}
+
+	return s.repo.PurgeDeletedCounters(ctx, time.Now().UTC().Add(-retention))
 }
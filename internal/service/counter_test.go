@@ -6,8 +6,11 @@ import (
 	"errors"
 	"gounter/internal/model"
 	"gounter/internal/service"
+	"gounter/internal/validation"
 	"gounter/test/mocks"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -16,26 +19,118 @@ import (
 )
 
 func TestCounterServiceCreateCounter(t *testing.T) {
+	min, max, positive, negative := int64(0), int64(10), int64(5), int64(-5)
+
 	tests := []struct {
 		name          string
 		setupMock     func(repo *mocks.Repository)
-		inputName     string
+		input         model.CreateCounterParams
 		expectedError error
 	}{
 		{
 			name: "successfully creates a counter",
 			setupMock: func(repo *mocks.Repository) {
-				repo.On("CreateCounter", mock.Anything, "test_counter").Return(&model.Counter{}, nil)
+				repo.On("CreateCounter", mock.Anything, model.CreateCounterParams{Name: "test_counter", Namespace: model.DefaultNamespace, OverflowPolicy: model.OverflowReject, Shards: 1}).
+					Return(&model.Counter{}, nil)
+			},
+			input:         model.CreateCounterParams{Name: "test_counter"},
+			expectedError: nil,
+		},
+		{
+			name: "successfully creates a bounded counter",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("CreateCounter", mock.Anything, model.CreateCounterParams{Name: "seats", Namespace: model.DefaultNamespace, Min: &min, Max: &max, OverflowPolicy: model.OverflowSaturate, Shards: 1}).
+					Return(&model.Counter{}, nil)
+			},
+			input:         model.CreateCounterParams{Name: "seats", Min: &min, Max: &max, OverflowPolicy: model.OverflowSaturate},
+			expectedError: nil,
+		},
+		{
+			name:          "bounds excluding the initial value",
+			setupMock:     func(repo *mocks.Repository) {},
+			input:         model.CreateCounterParams{Name: "seats", Min: &positive, Max: &max},
+			expectedError: validation.Errors{{Field: "min", Err: service.ErrInvalidBounds}},
+		},
+		{
+			name: "successfully creates a sharded counter",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("CreateCounter", mock.Anything, model.CreateCounterParams{Name: "page_views", Namespace: model.DefaultNamespace, OverflowPolicy: model.OverflowReject, Shards: 16}).
+					Return(&model.Counter{}, nil)
 			},
-			inputName:     "test_counter",
+			input:         model.CreateCounterParams{Name: "page_views", Shards: 16},
 			expectedError: nil,
 		},
+		{
+			name:          "too many shards",
+			setupMock:     func(repo *mocks.Repository) {},
+			input:         model.CreateCounterParams{Name: "page_views", Shards: service.MaxShards + 1},
+			expectedError: validation.Errors{{Field: "shards", Err: service.ErrInvalidShards}},
+		},
+		{
+			name:          "sharded counter with bounds",
+			setupMock:     func(repo *mocks.Repository) {},
+			input:         model.CreateCounterParams{Name: "page_views", Max: &max, Shards: 4},
+			expectedError: validation.Errors{{Field: "shards", Err: service.ErrShardedBounds}},
+		},
+		{
+			name:          "invalid namespace",
+			setupMock:     func(repo *mocks.Repository) {},
+			input:         model.CreateCounterParams{Name: "signups", Namespace: "growth/eu"},
+			expectedError: validation.Errors{{Field: "namespace", Err: service.ErrInvalidNamespace}},
+		},
+		{
+			name:          "invalid labels",
+			setupMock:     func(repo *mocks.Repository) {},
+			input:         model.CreateCounterParams{Name: "signups", Labels: model.Labels{"team": "pay ments"}},
+			expectedError: validation.Errors{{Field: "labels", Err: service.ErrInvalidLabels}},
+		},
+		{
+			name:          "name too long",
+			setupMock:     func(repo *mocks.Repository) {},
+			input:         model.CreateCounterParams{Name: strings.Repeat("n", validation.MaxNameLength+1)},
+			expectedError: validation.Errors{{Field: "name", Err: validation.ErrNameTooLong}},
+		},
+		{
+			name:      "reports every invalid field",
+			setupMock: func(repo *mocks.Repository) {},
+			input:     model.CreateCounterParams{Name: "  ", Namespace: "growth/eu", Max: &negative, Shards: -1},
+			expectedError: validation.Errors{
+				{Field: "name", Err: validation.ErrNameCharacters},
+				{Field: "namespace", Err: service.ErrInvalidNamespace},
+				{Field: "max", Err: service.ErrInvalidBounds},
+				{Field: "shards", Err: service.ErrInvalidShards},
+			},
+		},
+		{
+			name: "name taken in the default namespace",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("CreateCounter", mock.Anything, model.CreateCounterParams{Name: "signups", Namespace: model.DefaultNamespace, OverflowPolicy: model.OverflowReject, Shards: 1}).
+					Return(nil, model.ErrNameTaken)
+			},
+			input:         model.CreateCounterParams{Name: "signups"},
+			expectedError: service.ErrNameTaken,
+		},
+		{
+			name: "name taken in the namespace",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("CreateCounter", mock.Anything, model.CreateCounterParams{Name: "signups", Namespace: "growth", OverflowPolicy: model.OverflowReject, Shards: 1}).
+					Return(nil, model.ErrNameTaken)
+			},
+			input:         model.CreateCounterParams{Name: "signups", Namespace: "growth"},
+			expectedError: service.ErrNameTaken,
+		},
+		{
+			name:          "unknown overflow policy",
+			setupMock:     func(repo *mocks.Repository) {},
+			input:         model.CreateCounterParams{Name: "seats", OverflowPolicy: "wrap"},
+			expectedError: validation.Errors{{Field: "overflow_policy", Err: service.ErrInvalidOverflowPolicy}},
+		},
 		{
 			name: "failed to create counter due to database error",
 			setupMock: func(repo *mocks.Repository) {
-				repo.On("CreateCounter", mock.Anything, "test_counter").Return(nil, errors.New("db error"))
+				repo.On("CreateCounter", mock.Anything, mock.Anything).Return(nil, errors.New("db error"))
 			},
-			inputName:     "test_counter",
+			input:         model.CreateCounterParams{Name: "test_counter"},
 			expectedError: errors.New("db error"),
 		},
 	}
@@ -48,7 +143,7 @@ func TestCounterServiceCreateCounter(t *testing.T) {
 			svc := service.NewCounterService(repo)
 
 			ctx := context.TODO()
-			_, err := svc.CreateCounter(ctx, tt.inputName)
+			_, err := svc.CreateCounter(ctx, tt.input)
 
 			if tt.expectedError != nil {
 				require.Error(t, err)
@@ -68,25 +163,60 @@ func TestCounterServiceIncrementCounter(t *testing.T) {
 		expectedValue *model.Counter
 		setupMock     func(repo *mocks.Repository, id uuid.UUID)
 		inputID       uuid.UUID
+		inputDelta    int64
 		expectedError error
 	}{
 		{
 			name: "successfully increments counter",
 			setupMock: func(repo *mocks.Repository, id uuid.UUID) {
-				repo.On("IncrementCounter", mock.Anything, id).Return(&model.Counter{Name: "Test Counter", Value: 1}, nil)
+				repo.On("IncrementCounter", mock.Anything, id, int64(1)).Return(&model.Counter{Name: "Test Counter", Value: 1}, nil)
 			},
 			inputID:       uuid.New(),
+			inputDelta:    1,
 			expectedError: nil,
 			expectedValue: &model.Counter{Name: "Test Counter", Value: 1},
 		},
+		{
+			name: "successfully decrements counter",
+			setupMock: func(repo *mocks.Repository, id uuid.UUID) {
+				repo.On("IncrementCounter", mock.Anything, id, int64(-5)).Return(&model.Counter{Name: "Test Counter", Value: -5}, nil)
+			},
+			inputID:       uuid.New(),
+			inputDelta:    -5,
+			expectedError: nil,
+			expectedValue: &model.Counter{Name: "Test Counter", Value: -5},
+		},
+		{
+			name:          "zero delta",
+			setupMock:     func(repo *mocks.Repository, id uuid.UUID) {},
+			inputID:       uuid.New(),
+			inputDelta:    0,
+			expectedError: validation.Errors{{Field: "delta", Err: service.ErrInvalidDelta}},
+		},
+		{
+			name:          "missing id and delta out of range",
+			setupMock:     func(repo *mocks.Repository, id uuid.UUID) {},
+			inputDelta:    validation.MaxDelta + 1,
+			expectedError: validation.Errors{{Field: "id", Err: validation.ErrRequired}, {Field: "delta", Err: validation.ErrDeltaRange}},
+		},
 		{
 			name: "counter not found",
 			setupMock: func(repo *mocks.Repository, id uuid.UUID) {
-				repo.On("IncrementCounter", mock.Anything, id).Return(nil, sql.ErrNoRows)
+				repo.On("IncrementCounter", mock.Anything, id, int64(1)).Return(nil, sql.ErrNoRows)
 			},
 			inputID:       uuid.New(),
+			inputDelta:    1,
 			expectedError: service.ErrCounterNotFound,
 		},
+		{
+			name: "change rejected by the bounds",
+			setupMock: func(repo *mocks.Repository, id uuid.UUID) {
+				repo.On("IncrementCounter", mock.Anything, id, int64(1)).Return(nil, model.ErrOutOfBounds)
+			},
+			inputID:       uuid.MustParse("8f1c7f55-54b4-4c5e-9d3c-0c6f0d6e9a10"),
+			inputDelta:    1,
+			expectedError: &service.OutOfBoundsError{ID: uuid.MustParse("8f1c7f55-54b4-4c5e-9d3c-0c6f0d6e9a10"), Delta: 1},
+		},
 	}
 
 	for _, tt := range tests {
@@ -97,7 +227,7 @@ func TestCounterServiceIncrementCounter(t *testing.T) {
 			svc := service.NewCounterService(repo)
 
 			ctx := context.TODO()
-			newValue, err := svc.IncrementCounter(ctx, tt.inputID)
+			newValue, err := svc.IncrementCounter(ctx, tt.inputID, tt.inputDelta)
 
 			if tt.expectedError != nil {
 				require.Error(t, err)
@@ -112,6 +242,170 @@ func TestCounterServiceIncrementCounter(t *testing.T) {
 	}
 }
 
+func TestCounterServiceIncrementCounterByName(t *testing.T) {
+	id := uuid.New()
+	params := model.CreateCounterParams{Name: "signups", Namespace: "growth", OverflowPolicy: model.OverflowReject, Shards: 1}
+
+	tests := []struct {
+		name          string
+		setupMock     func(repo *mocks.Repository)
+		namespace     string
+		delta         int64
+		expectedValue *model.Counter
+		expectedError error
+	}{
+		{
+			name: "increments the existing counter",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("GetCounterByName", mock.Anything, "growth", "signups").Return(&model.Counter{ID: id}, nil)
+				repo.On("IncrementCounter", mock.Anything, id, int64(2)).Return(&model.Counter{ID: id, Value: 2}, nil)
+			},
+			namespace:     "growth",
+			delta:         2,
+			expectedValue: &model.Counter{ID: id, Value: 2},
+		},
+		{
+			name: "creates the counter on first use",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("GetCounterByName", mock.Anything, "growth", "signups").Return(nil, sql.ErrNoRows)
+				repo.On("CreateCounter", mock.Anything, params).Return(&model.Counter{ID: id}, nil)
+				repo.On("IncrementCounter", mock.Anything, id, int64(1)).Return(&model.Counter{ID: id, Value: 1}, nil)
+			},
+			namespace:     "growth",
+			delta:         1,
+			expectedValue: &model.Counter{ID: id, Value: 1},
+		},
+		{
+			name: "increments the counter a concurrent request created",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("GetCounterByName", mock.Anything, "growth", "signups").Return(nil, sql.ErrNoRows).Once()
+				repo.On("CreateCounter", mock.Anything, params).Return(nil, model.ErrNameTaken)
+				repo.On("GetCounterByName", mock.Anything, "growth", "signups").Return(&model.Counter{ID: id}, nil).Once()
+				repo.On("IncrementCounter", mock.Anything, id, int64(1)).Return(&model.Counter{ID: id, Value: 1}, nil)
+			},
+			namespace:     "growth",
+			delta:         1,
+			expectedValue: &model.Counter{ID: id, Value: 1},
+		},
+		{
+			name: "uses the default namespace",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("GetCounterByName", mock.Anything, model.DefaultNamespace, "signups").Return(&model.Counter{ID: id}, nil)
+				repo.On("IncrementCounter", mock.Anything, id, int64(1)).Return(&model.Counter{ID: id, Value: 1}, nil)
+			},
+			delta:         1,
+			expectedValue: &model.Counter{ID: id, Value: 1},
+		},
+		{
+			name:          "zero delta",
+			setupMock:     func(repo *mocks.Repository) {},
+			namespace:     "growth",
+			expectedError: validation.Errors{{Field: "delta", Err: service.ErrInvalidDelta}},
+		},
+		{
+			name:          "invalid namespace",
+			setupMock:     func(repo *mocks.Repository) {},
+			namespace:     "growth eu",
+			delta:         1,
+			expectedError: validation.Errors{{Field: "namespace", Err: service.ErrInvalidNamespace}},
+		},
+		{
+			name: "change rejected by the bounds",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("GetCounterByName", mock.Anything, "growth", "signups").Return(&model.Counter{ID: id}, nil)
+				repo.On("IncrementCounter", mock.Anything, id, int64(-1)).Return(nil, model.ErrOutOfBounds)
+			},
+			namespace:     "growth",
+			delta:         -1,
+			expectedError: &service.OutOfBoundsError{ID: id, Delta: -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(mocks.Repository)
+			tt.setupMock(repo)
+
+			svc := service.NewCounterService(repo)
+
+			counter, err := svc.IncrementCounterByName(context.TODO(), tt.namespace, "signups", tt.delta)
+
+			if tt.expectedError != nil {
+				require.Error(t, err)
+				require.Equal(t, tt.expectedError, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedValue, counter)
+			}
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCounterServiceSetCounter(t *testing.T) {
+	id := uuid.New()
+	value := int64(42)
+
+	tests := []struct {
+		name          string
+		setupMock     func(repo *mocks.Repository)
+		expectedValue *model.Counter
+		expectedError error
+	}{
+		{
+			name: "successfully sets counter",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("SetCounter", mock.Anything, id, value, int64(3)).Return(&model.Counter{ID: id, Value: value, Version: 4}, nil)
+			},
+			expectedValue: &model.Counter{ID: id, Value: value, Version: 4},
+		},
+		{
+			name: "counter not found",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("SetCounter", mock.Anything, id, value, int64(3)).Return(nil, sql.ErrNoRows)
+			},
+			expectedError: service.ErrCounterNotFound,
+		},
+		{
+			name: "version mismatch",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("SetCounter", mock.Anything, id, value, int64(3)).Return(nil, model.ErrVersionMismatch)
+			},
+			expectedError: service.ErrVersionMismatch,
+		},
+		{
+			name: "value rejected by the bounds",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("SetCounter", mock.Anything, id, value, int64(3)).Return(nil, model.ErrOutOfBounds)
+			},
+			expectedError: &service.OutOfBoundsError{ID: id, Value: &value},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(mocks.Repository)
+			tt.setupMock(repo)
+
+			svc := service.NewCounterService(repo)
+
+			ctx := context.TODO()
+			counter, err := svc.SetCounter(ctx, id, value, 3)
+
+			if tt.expectedError != nil {
+				require.Error(t, err)
+				require.Equal(t, tt.expectedError, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedValue, counter)
+			}
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
 func TestCounterServiceSoftDeleteCounter(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -138,6 +432,15 @@ func TestCounterServiceSoftDeleteCounter(t *testing.T) {
 			expectedAffected: 0,
 			expectedError:    service.ErrCounterNotFound,
 		},
+		{
+			name: "already deleted",
+			setupMock: func(repo *mocks.Repository, id uuid.UUID) {
+				repo.On("SoftDeleteCounter", mock.Anything, id).Return(int64(0), nil)
+			},
+			inputID:          uuid.New(),
+			expectedAffected: 0,
+			expectedError:    service.ErrCounterNotFound,
+		},
 	}
 
 	for _, tt := range tests {
@@ -162,3 +465,383 @@ func TestCounterServiceSoftDeleteCounter(t *testing.T) {
 		})
 	}
 }
+
+func TestCounterServiceGetCounter(t *testing.T) {
+	tests := []struct {
+		name          string
+		expectedValue *model.Counter
+		setupMock     func(repo *mocks.Repository, id uuid.UUID)
+		inputID       uuid.UUID
+		expectedError error
+	}{
+		{
+			name: "successfully fetches counter",
+			setupMock: func(repo *mocks.Repository, id uuid.UUID) {
+				repo.On("GetCounter", mock.Anything, id).Return(&model.Counter{Name: "Test Counter", Value: 3}, nil)
+			},
+			inputID:       uuid.New(),
+			expectedError: nil,
+			expectedValue: &model.Counter{Name: "Test Counter", Value: 3},
+		},
+		{
+			name: "counter not found",
+			setupMock: func(repo *mocks.Repository, id uuid.UUID) {
+				repo.On("GetCounter", mock.Anything, id).Return(nil, sql.ErrNoRows)
+			},
+			inputID:       uuid.New(),
+			expectedError: service.ErrCounterNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(mocks.Repository)
+			tt.setupMock(repo, tt.inputID)
+
+			svc := service.NewCounterService(repo)
+
+			ctx := context.TODO()
+			counter, err := svc.GetCounter(ctx, tt.inputID)
+
+			if tt.expectedError != nil {
+				require.Error(t, err)
+				require.Equal(t, tt.expectedError, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedValue, counter)
+			}
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCounterServiceListCounters(t *testing.T) {
+	counters := []*model.Counter{
+		{ID: uuid.New(), Name: "a", Value: 1},
+		{ID: uuid.New(), Name: "b", Value: 2},
+		{ID: uuid.New(), Name: "c", Value: 3},
+	}
+
+	t.Run("returns a cursor when there are more counters", func(t *testing.T) {
+		repo := new(mocks.Repository)
+		repo.On("ListCounters", mock.Anything, model.CounterFilter{SortBy: model.SortByName, Limit: 3}).
+			Return(counters, nil)
+
+		svc := service.NewCounterService(repo)
+
+		page, err := svc.ListCounters(context.TODO(), model.ListCountersQuery{SortBy: model.SortByName, Limit: 2})
+		require.NoError(t, err)
+		assert.Equal(t, counters[:2], page.Counters)
+		require.NotEmpty(t, page.NextCursor)
+
+		// The cursor must resume right after the last counter of the page
+		repo.On("ListCounters", mock.Anything, mock.MatchedBy(func(filter model.CounterFilter) bool {
+			return filter.After != nil && filter.After.ID == counters[1].ID && filter.After.Name == "b"
+		})).Return(counters[2:], nil)
+
+		page, err = svc.ListCounters(context.TODO(), model.ListCountersQuery{SortBy: model.SortByName, Limit: 2, Cursor: page.NextCursor})
+		require.NoError(t, err)
+		assert.Equal(t, counters[2:], page.Counters)
+		assert.Empty(t, page.NextCursor)
+
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("filters by label selector", func(t *testing.T) {
+		repo := new(mocks.Repository)
+		repo.On("ListCounters", mock.Anything, model.CounterFilter{
+			Labels: model.Labels{"team": "payments", "env": "prod"},
+			SortBy: model.SortByCreatedAt,
+			Limit:  service.DefaultListLimit + 1,
+		}).Return(counters[:1], nil)
+
+		svc := service.NewCounterService(repo)
+
+		page, err := svc.ListCounters(context.TODO(), model.ListCountersQuery{Labels: "team=payments, env=prod"})
+		require.NoError(t, err)
+		assert.Equal(t, counters[:1], page.Counters)
+
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("applies default and maximum limits", func(t *testing.T) {
+		repo := new(mocks.Repository)
+		repo.On("ListCounters", mock.Anything, model.CounterFilter{SortBy: model.SortByCreatedAt, Limit: service.DefaultListLimit + 1}).
+			Return([]*model.Counter{}, nil)
+		repo.On("ListCounters", mock.Anything, model.CounterFilter{SortBy: model.SortByCreatedAt, Limit: service.MaxListLimit + 1}).
+			Return([]*model.Counter{}, nil)
+
+		svc := service.NewCounterService(repo)
+
+		_, err := svc.ListCounters(context.TODO(), model.ListCountersQuery{})
+		require.NoError(t, err)
+		_, err = svc.ListCounters(context.TODO(), model.ListCountersQuery{Limit: 10 * service.MaxListLimit})
+		require.NoError(t, err)
+
+		repo.AssertExpectations(t)
+	})
+
+	tests := []struct {
+		name          string
+		query         model.ListCountersQuery
+		expectedError error
+	}{
+		{
+			name:          "invalid sort field",
+			query:         model.ListCountersQuery{SortBy: "id"},
+			expectedError: service.ErrInvalidSort,
+		},
+		{
+			name:          "malformed cursor",
+			query:         model.ListCountersQuery{Cursor: "not a cursor"},
+			expectedError: service.ErrInvalidCursor,
+		},
+		{
+			name:          "malformed label selector",
+			query:         model.ListCountersQuery{Labels: "team"},
+			expectedError: service.ErrInvalidLabelSelector,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(mocks.Repository)
+			svc := service.NewCounterService(repo)
+
+			_, err := svc.ListCounters(context.TODO(), tt.query)
+			require.Equal(t, tt.expectedError, err)
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCounterServiceCounterHistory(t *testing.T) {
+	id := uuid.New()
+	events := []*model.CounterEvent{
+		{ID: 4, CounterID: id, Type: model.EventCreate},
+		{ID: 9, CounterID: id, Type: model.EventIncrement, Delta: 1, Value: 1},
+		{ID: 12, CounterID: id, Type: model.EventDecrement, Delta: -1, Value: 0},
+	}
+
+	t.Run("returns a cursor when there are more events", func(t *testing.T) {
+		repo := new(mocks.Repository)
+		repo.On("GetCounter", mock.Anything, id).Return(&model.Counter{ID: id}, nil)
+		repo.On("ListCounterEvents", mock.Anything, model.CounterEventFilter{CounterID: id, Limit: 3}).
+			Return(events, nil)
+		repo.On("ListCounterEvents", mock.Anything, model.CounterEventFilter{CounterID: id, AfterID: 9, Limit: 3}).
+			Return(events[2:], nil)
+
+		svc := service.NewCounterService(repo)
+
+		page, err := svc.CounterHistory(context.TODO(), model.CounterHistoryQuery{CounterID: id, Limit: 2})
+		require.NoError(t, err)
+		assert.Equal(t, events[:2], page.Events)
+		require.NotEmpty(t, page.NextCursor)
+
+		// The cursor must resume right after the last event of the page
+		page, err = svc.CounterHistory(context.TODO(), model.CounterHistoryQuery{CounterID: id, Limit: 2, Cursor: page.NextCursor})
+		require.NoError(t, err)
+		assert.Equal(t, events[2:], page.Events)
+		assert.Empty(t, page.NextCursor)
+
+		repo.AssertExpectations(t)
+	})
+
+	from := time.Now().UTC()
+	to := from.Add(-time.Hour)
+
+	tests := []struct {
+		name          string
+		setupMock     func(repo *mocks.Repository)
+		query         model.CounterHistoryQuery
+		expectedError error
+	}{
+		{
+			name: "counter not found",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("GetCounter", mock.Anything, id).Return(nil, sql.ErrNoRows)
+			},
+			query:         model.CounterHistoryQuery{CounterID: id},
+			expectedError: service.ErrCounterNotFound,
+		},
+		{
+			name:          "range ending before it starts",
+			setupMock:     func(*mocks.Repository) {},
+			query:         model.CounterHistoryQuery{CounterID: id, From: &from, To: &to},
+			expectedError: service.ErrInvalidTimeRange,
+		},
+		{
+			name:          "malformed cursor",
+			setupMock:     func(*mocks.Repository) {},
+			query:         model.CounterHistoryQuery{CounterID: id, Cursor: "not a cursor"},
+			expectedError: service.ErrInvalidCursor,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(mocks.Repository)
+			tt.setupMock(repo)
+			svc := service.NewCounterService(repo)
+
+			_, err := svc.CounterHistory(context.TODO(), tt.query)
+			require.Equal(t, tt.expectedError, err)
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCounterServiceRestoreCounter(t *testing.T) {
+	tests := []struct {
+		name          string
+		expectedValue *model.Counter
+		setupMock     func(repo *mocks.Repository, id uuid.UUID)
+		inputID       uuid.UUID
+		expectedError error
+	}{
+		{
+			name: "successfully restores counter",
+			setupMock: func(repo *mocks.Repository, id uuid.UUID) {
+				repo.On("RestoreCounter", mock.Anything, id).Return(&model.Counter{Name: "Test Counter", Value: 4}, nil)
+			},
+			inputID:       uuid.New(),
+			expectedError: nil,
+			expectedValue: &model.Counter{Name: "Test Counter", Value: 4},
+		},
+		{
+			name: "counter not found",
+			setupMock: func(repo *mocks.Repository, id uuid.UUID) {
+				repo.On("RestoreCounter", mock.Anything, id).Return(nil, sql.ErrNoRows)
+			},
+			inputID:       uuid.New(),
+			expectedError: service.ErrCounterNotFound,
+		},
+		{
+			name: "name taken in the meantime",
+			setupMock: func(repo *mocks.Repository, id uuid.UUID) {
+				repo.On("RestoreCounter", mock.Anything, id).Return(nil, model.ErrNameTaken)
+			},
+			inputID:       uuid.New(),
+			expectedError: service.ErrNameTaken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(mocks.Repository)
+			tt.setupMock(repo, tt.inputID)
+
+			svc := service.NewCounterService(repo)
+
+			ctx := context.TODO()
+			counter, err := svc.RestoreCounter(ctx, tt.inputID)
+
+			if tt.expectedError != nil {
+				require.Error(t, err)
+				require.Equal(t, tt.expectedError, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedValue, counter)
+			}
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCounterServiceUpdateCounter(t *testing.T) {
+	id := uuid.New()
+	name := "renamed"
+	labels := model.Labels{"team": "payments"}
+	badLabels := model.Labels{"team name": "payments"}
+
+	tests := []struct {
+		name          string
+		setupMock     func(repo *mocks.Repository)
+		params        model.UpdateCounterParams
+		expectedValue *model.Counter
+		expectedError error
+	}{
+		{
+			name: "successfully updates counter",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("UpdateCounter", mock.Anything, id, model.UpdateCounterParams{Name: &name, Labels: &labels}).
+					Return(&model.Counter{ID: id, Name: name, Labels: labels, Version: 2}, nil)
+			},
+			params:        model.UpdateCounterParams{Name: &name, Labels: &labels},
+			expectedValue: &model.Counter{ID: id, Name: name, Labels: labels, Version: 2},
+		},
+		{
+			name:          "nothing to update",
+			setupMock:     func(*mocks.Repository) {},
+			expectedError: service.ErrEmptyUpdate,
+		},
+		{
+			name:          "invalid labels",
+			setupMock:     func(*mocks.Repository) {},
+			params:        model.UpdateCounterParams{Labels: &badLabels},
+			expectedError: validation.Errors{{Field: "labels", Err: service.ErrInvalidLabels}},
+		},
+		{
+			name: "counter not found",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("UpdateCounter", mock.Anything, id, mock.Anything).Return(nil, sql.ErrNoRows)
+			},
+			params:        model.UpdateCounterParams{Name: &name},
+			expectedError: service.ErrCounterNotFound,
+		},
+		{
+			name: "name taken in the namespace",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("UpdateCounter", mock.Anything, id, mock.Anything).Return(nil, model.ErrNameTaken)
+			},
+			params:        model.UpdateCounterParams{Name: &name},
+			expectedError: service.ErrNameTaken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(mocks.Repository)
+			tt.setupMock(repo)
+			svc := service.NewCounterService(repo)
+
+			counter, err := svc.UpdateCounter(context.TODO(), id, tt.params)
+			require.Equal(t, tt.expectedError, err)
+			assert.Equal(t, tt.expectedValue, counter)
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCounterServicePurgeDeletedCounters(t *testing.T) {
+	t.Run("purges counters deleted before the retention period", func(t *testing.T) {
+		repo := new(mocks.Repository)
+		repo.On("PurgeDeletedCounters", mock.Anything, mock.MatchedBy(func(before time.Time) bool {
+			cutoff := time.Now().Add(-time.Hour)
+			return before.Before(cutoff.Add(time.Second)) && before.After(cutoff.Add(-time.Minute))
+		})).Return(int64(2), nil)
+
+		svc := service.NewCounterService(repo)
+
+		purged, err := svc.PurgeDeletedCounters(context.TODO(), time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), purged)
+
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("rejects a non positive retention", func(t *testing.T) {
+		repo := new(mocks.Repository)
+		svc := service.NewCounterService(repo)
+
+		_, err := svc.PurgeDeletedCounters(context.TODO(), 0)
+		require.Equal(t, service.ErrInvalidRetention, err)
+
+		repo.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"gounter/internal/model"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// cursor is the decoded form of the opaque pagination cursor handed to clients.
+// It carries the sort key of the last counter on a page so the next page can
+// continue right after it, and the sort it was issued for so it cannot be
+// reused with a different ordering.
+type cursor struct {
+	SortBy     model.CounterSort `json:"s"`
+	Descending bool              `json:"d,omitempty"`
+	ID         uuid.UUID         `json:"i"`
+	Name       string            `json:"n,omitempty"`
+	Value      int64             `json:"v,omitempty"`
+	CreatedAt  time.Time         `json:"c,omitempty"`
+}
+
+// encodeCursor builds the cursor pointing right after the given counter
+func encodeCursor(last *model.Counter, sortBy model.CounterSort, descending bool) string {
+	c := cursor{SortBy: sortBy, Descending: descending, ID: last.ID}
+
+	switch sortBy {
+	case model.SortByName:
+		c.Name = last.Name
+	case model.SortByValue:
+		c.Value = last.Value
+	case model.SortByCreatedAt:
+		c.CreatedAt = last.CreatedAt
+	}
+
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor turns an opaque cursor back into the last counter of the previous page
+func decodeCursor(value string, sortBy model.CounterSort, descending bool) (*model.Counter, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if c.SortBy != sortBy || c.Descending != descending {
+		return nil, ErrInvalidCursor
+	}
+
+	return &model.Counter{ID: c.ID, Name: c.Name, Value: c.Value, CreatedAt: c.CreatedAt}, nil
+}
+
+// encodeEventCursor builds the cursor pointing right after the given event
+func encodeEventCursor(last *model.CounterEvent) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(last.ID, 10)))
+}
+
+// decodeEventCursor returns the id of the last event of the previous page
+func decodeEventCursor(value string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	id, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || id < 0 {
+		return 0, ErrInvalidCursor
+	}
+
+	return id, nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"errors"
+	"gounter/internal/validation"
+)
+
+// ErrorKind classifies the errors of the service by what the client can do
+// about them. The API answers every kind with its own status code.
+type ErrorKind int
+
+const (
+	// KindInternal is a failure the client cannot fix, like a storage error.
+	// It is the kind of every error outside the taxonomy.
+	KindInternal ErrorKind = iota
+	// KindValidation is a request with invalid arguments
+	KindValidation
+	// KindNotFound is a request for a counter that does not exist
+	KindNotFound
+	// KindConflict is a request conflicting with the state of the counters
+	KindConflict
+	// KindPreconditionFailed is a request based on an outdated version of a counter
+	KindPreconditionFailed
+	// KindUnsupported is a request the storage backend cannot serve
+	KindUnsupported
+)
+
+const (
+	// CodeInternal is the code of the errors outside the taxonomy
+	CodeInternal = "internal"
+	// CodeValidationFailed is the code of validation.Errors, which list the
+	// code of every invalid field
+	CodeValidationFailed = "validation_failed"
+)
+
+// ClassifiedError is implemented by the errors of the taxonomy. Code is a
+// stable identifier clients can branch on, and Error is safe to show them.
+type ClassifiedError interface {
+	error
+	Kind() ErrorKind
+	Code() string
+}
+
+// Error is an error of the taxonomy. The service returns its errors as
+// *Error sentinels, except for the ones carrying details like OutOfBoundsError.
+type Error struct {
+	kind    ErrorKind
+	code    string
+	message string
+}
+
+// newError returns an error of the given kind
+func newError(kind ErrorKind, code, message string) *Error {
+	return &Error{kind: kind, code: code, message: message}
+}
+
+func (e *Error) Error() string {
+	return e.message
+}
+
+// Kind returns the kind of the error
+func (e *Error) Kind() ErrorKind {
+	return e.kind
+}
+
+// Code returns the stable identifier of the error
+func (e *Error) Code() string {
+	return e.code
+}
+
+// Classify returns the kind and code of the first error of the taxonomy in the
+// chain of err. Invalid fields are validation errors, any other error is internal.
+func Classify(err error) (ErrorKind, string) {
+	var fields validation.Errors
+	if errors.As(err, &fields) {
+		return KindValidation, CodeValidationFailed
+	}
+
+	var classified ClassifiedError
+	if errors.As(err, &classified) {
+		return classified.Kind(), classified.Code()
+	}
+
+	return KindInternal, CodeInternal
+}
@@ -0,0 +1,53 @@
+package service_test
+
+import (
+	"database/sql"
+	"gounter/internal/model"
+	"gounter/internal/service"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		expectedKind service.ErrorKind
+		expectedCode string
+	}{
+		{
+			name:         "sentinel error",
+			err:          service.ErrCounterNotFound,
+			expectedKind: service.KindNotFound,
+			expectedCode: "counter_not_found",
+		},
+		{
+			name:         "error with details",
+			err:          &service.OutOfBoundsError{ID: uuid.New(), Delta: 1},
+			expectedKind: service.KindConflict,
+			expectedCode: "out_of_bounds",
+		},
+		{
+			name:         "wrapped error",
+			err:          &model.BatchError{Index: 2, Err: service.ErrVersionMismatch},
+			expectedKind: service.KindPreconditionFailed,
+			expectedCode: "version_mismatch",
+		},
+		{
+			name:         "storage error",
+			err:          sql.ErrConnDone,
+			expectedKind: service.KindInternal,
+			expectedCode: service.CodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, code := service.Classify(tt.err)
+			assert.Equal(t, tt.expectedKind, kind)
+			assert.Equal(t, tt.expectedCode, code)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"gounter/internal/model"
+	"time"
+)
+
+// DefaultIdempotencyWindow is how long the result of a request is replayed for its idempotency key
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// ErrIdempotencyKeyReused is returned when an idempotency key is sent again with a different request
+var ErrIdempotencyKeyReused = newError(KindConflict, "idempotency_key_reused", "idempotency key was already used for a different request")
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey returns a context making the mutations called with it
+// idempotent under the given client supplied key
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// idempotencyKeyFromContext returns the idempotency key of the request, if any
+func idempotencyKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idempotencyKey{}).(string)
+	return key, ok && key != ""
+}
+
+// idempotent runs op at most once per idempotency key of the authenticated
+// subject within the window.
+// Without a key in ctx op simply runs. With a key, the result of an earlier
+// identical request is replayed, otherwise op runs and storage saves its result
+// under the key in the same transaction as the change.
+func (s *CounterService) idempotent(ctx context.Context, request string, op func(ctx context.Context) (*model.Counter, error)) (*model.Counter, error) {
+	key, ok := idempotencyKeyFromContext(ctx)
+	if !ok {
+		return op(ctx)
+	}
+
+	since := time.Now().UTC().Add(-s.idempotencyWindow)
+	subject, _ := model.SubjectFromContext(ctx)
+
+	saved, err := s.replay(ctx, subject, key, request, since)
+	if err != nil || saved != nil {
+		return savedCounter(saved), err
+	}
+
+	record := &model.IdempotencyRecord{Subject: subject, Key: key, Request: request, Since: since}
+
+	counter, err := op(model.WithIdempotencyRecord(ctx, record))
+	if errors.Is(err, model.ErrDuplicateIdempotencyKey) {
+		// A concurrent request with the same key saved its result first
+		saved, err = s.replay(ctx, subject, key, request, since)
+		return savedCounter(saved), err
+	}
+
+	return counter, err
+}
+
+// idempotentBatch is idempotent like idempotent, for a batch whose record
+// holds the results of all its operations
+func (s *CounterService) idempotentBatch(ctx context.Context, request string, op func(ctx context.Context) ([]model.BatchResult, error)) ([]model.BatchResult, error) {
+	key, ok := idempotencyKeyFromContext(ctx)
+	if !ok {
+		return op(ctx)
+	}
+
+	since := time.Now().UTC().Add(-s.idempotencyWindow)
+	subject, _ := model.SubjectFromContext(ctx)
+
+	saved, err := s.replay(ctx, subject, key, request, since)
+	if err != nil || saved != nil {
+		return savedResults(saved), err
+	}
+
+	record := &model.IdempotencyRecord{Subject: subject, Key: key, Request: request, Since: since}
+
+	results, err := op(model.WithIdempotencyRecord(ctx, record))
+	if errors.Is(err, model.ErrDuplicateIdempotencyKey) {
+		// A concurrent request with the same key saved its results first
+		saved, err = s.replay(ctx, subject, key, request, since)
+		return savedResults(saved), err
+	}
+
+	return results, err
+}
+
+// replay returns the record of the request the subject made with key since
+// the given time, nil when there is none
+func (s *CounterService) replay(ctx context.Context, subject, key, request string, since time.Time) (*model.IdempotencyRecord, error) {
+	record, err := s.repo.GetIdempotencyRecord(ctx, subject, key, since)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if record.Request != request {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	return record, nil
+}
+
+// savedCounter returns the counter state of a replayed record, if any
+func savedCounter(record *model.IdempotencyRecord) *model.Counter {
+	if record == nil {
+		return nil
+	}
+
+	return record.Counter
+}
+
+// savedResults returns the batch results of a replayed record, if any
+func savedResults(record *model.IdempotencyRecord) []model.BatchResult {
+	if record == nil {
+		return nil
+	}
+
+	return record.Results
+}
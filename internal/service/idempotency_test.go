@@ -0,0 +1,148 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"gounter/internal/model"
+	"gounter/internal/service"
+	"gounter/test/mocks"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounterServiceIdempotentIncrement(t *testing.T) {
+	id := uuid.New()
+	request := "increment " + id.String() + " 5"
+	stored := &model.Counter{ID: id, Value: 5, Version: 2}
+
+	tests := []struct {
+		name          string
+		setupMock     func(repo *mocks.Repository)
+		expectedValue *model.Counter
+		expectedError error
+	}{
+		{
+			name: "first request saves its result under the key",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("GetIdempotencyRecord", mock.Anything, "alice", "key-1", mock.Anything).Return(nil, sql.ErrNoRows)
+				repo.On("IncrementCounter", mock.MatchedBy(func(ctx context.Context) bool {
+					record, ok := model.IdempotencyRecordFromContext(ctx)
+					return ok && record.Subject == "alice" && record.Key == "key-1" && record.Request == request
+				}), id, int64(5)).Return(stored, nil)
+			},
+			expectedValue: stored,
+		},
+		{
+			name: "retry replays the stored result",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("GetIdempotencyRecord", mock.Anything, "alice", "key-1", mock.Anything).
+					Return(&model.IdempotencyRecord{Key: "key-1", Request: request, Counter: stored}, nil)
+			},
+			expectedValue: stored,
+		},
+		{
+			name: "concurrent duplicate replays the winner's result",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("GetIdempotencyRecord", mock.Anything, "alice", "key-1", mock.Anything).Return(nil, sql.ErrNoRows).Once()
+				repo.On("IncrementCounter", mock.Anything, id, int64(5)).Return(nil, model.ErrDuplicateIdempotencyKey)
+				repo.On("GetIdempotencyRecord", mock.Anything, "alice", "key-1", mock.Anything).
+					Return(&model.IdempotencyRecord{Key: "key-1", Request: request, Counter: stored}, nil).Once()
+			},
+			expectedValue: stored,
+		},
+		{
+			name: "key reused for another request",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("GetIdempotencyRecord", mock.Anything, "alice", "key-1", mock.Anything).
+					Return(&model.IdempotencyRecord{Key: "key-1", Request: "delete " + id.String()}, nil)
+			},
+			expectedError: service.ErrIdempotencyKeyReused,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(mocks.Repository)
+			tt.setupMock(repo)
+
+			svc := service.NewCounterService(repo, service.WithIdempotencyWindow(time.Hour))
+
+			// Keys are looked up among those of the authenticated subject
+			ctx := service.WithIdempotencyKey(model.WithSubject(context.TODO(), "alice"), "key-1")
+			counter, err := svc.IncrementCounter(ctx, id, 5)
+
+			if tt.expectedError != nil {
+				require.Equal(t, tt.expectedError, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedValue, counter)
+			}
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCounterServiceIdempotentDelete(t *testing.T) {
+	id := uuid.New()
+
+	repo := new(mocks.Repository)
+	repo.On("GetIdempotencyRecord", mock.Anything, "", "key-1", mock.Anything).
+		Return(&model.IdempotencyRecord{Key: "key-1", Request: "delete " + id.String()}, nil)
+
+	svc := service.NewCounterService(repo)
+
+	// The counter is already gone, but the retry gets the original success back
+	rowsAffected, err := svc.SoftDeleteCounter(service.WithIdempotencyKey(context.TODO(), "key-1"), id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), rowsAffected)
+
+	repo.AssertExpectations(t)
+}
+
+func TestCounterServiceIdempotentBatch(t *testing.T) {
+	id := uuid.New()
+	ops := []model.BatchOperation{
+		{Type: model.BatchIncrement, CounterID: id, Delta: 5},
+		{Type: model.BatchSet, CounterID: id, Value: 3, ExpectedVersion: 1},
+	}
+	stored := []model.BatchResult{{Counter: &model.Counter{ID: id, Value: 5, Version: 2}}, {Err: model.ErrVersionMismatch}}
+
+	repo := new(mocks.Repository)
+	repo.On("GetIdempotencyRecord", mock.Anything, "", "key-1", mock.Anything).Return(nil, sql.ErrNoRows).Once()
+	repo.On("ApplyBatch", mock.MatchedBy(func(ctx context.Context) bool {
+		_, ok := model.IdempotencyRecordFromContext(ctx)
+		return ok
+	}), ops, false).Return(stored, nil).Once()
+
+	svc := service.NewCounterService(repo)
+	ctx := service.WithIdempotencyKey(context.TODO(), "key-1")
+
+	results, err := svc.ApplyBatch(ctx, ops, false)
+	require.NoError(t, err)
+	require.Equal(t, service.ErrVersionMismatch, results[1].Err)
+
+	// The retry replays the saved results instead of applying the batch again
+	request := repo.Calls[1].Arguments.Get(0).(context.Context)
+	record, _ := model.IdempotencyRecordFromContext(request)
+	repo.On("GetIdempotencyRecord", mock.Anything, "", "key-1", mock.Anything).
+		Return(&model.IdempotencyRecord{Key: "key-1", Request: record.Request, Results: stored}, nil).Once()
+
+	replayed, err := svc.ApplyBatch(ctx, ops, false)
+	require.NoError(t, err)
+	assert.Equal(t, results, replayed)
+
+	// The same key cannot be used for the batch in the other mode
+	repo.On("GetIdempotencyRecord", mock.Anything, "", "key-1", mock.Anything).
+		Return(&model.IdempotencyRecord{Key: "key-1", Request: record.Request, Results: stored}, nil).Once()
+
+	_, err = svc.ApplyBatch(ctx, ops, true)
+	require.Equal(t, service.ErrIdempotencyKeyReused, err)
+
+	repo.AssertExpectations(t)
+}
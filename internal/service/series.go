@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"gounter/internal/model"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultSeriesBuckets is the number of buckets returned when the client gives no start
+	DefaultSeriesBuckets = 60
+	// MaxSeriesBuckets is the largest number of buckets a series can span
+	MaxSeriesBuckets = 1440
+	// MaxRateWindow is the longest window a rate can be measured over
+	MaxRateWindow = 24 * time.Hour
+	// MaxAggregateCounters is the largest number of counters a selector can sum up
+	MaxAggregateCounters = 200
+	// DefaultMinuteBucketRetention is how long minute buckets are kept, enough
+	// for the longest rate window and a day of minute series before it
+	DefaultMinuteBucketRetention = 2 * MaxRateWindow
+)
+
+var (
+	// ErrInvalidGranularity is returned when a series is asked for with an unknown granularity
+	ErrInvalidGranularity = newError(KindValidation, "invalid_granularity", "granularity must be minute, hour or day")
+	// ErrSeriesTooLong is returned when a series would span more than MaxSeriesBuckets buckets
+	ErrSeriesTooLong = newError(KindValidation, "series_too_long", "series spans too many buckets")
+	// ErrInvalidWindow is returned when a rate is asked for over a window shorter than a minute or longer than MaxRateWindow
+	ErrInvalidWindow = newError(KindValidation, "invalid_window", "window must be between 1m and 24h")
+	// ErrTooManyCounters is returned when more than MaxAggregateCounters counters match a selector
+	ErrTooManyCounters = newError(KindValidation, "too_many_counters", fmt.Sprintf("label selector matches more than %d counters", MaxAggregateCounters))
+)
+
+// CounterSeries returns the tally of a counter in every bucket of the given
+// granularity between From and To, oldest first. Buckets without increments
+// are included with a zero tally. To defaults to now and From to
+// DefaultSeriesBuckets buckets before To.
+func (s *CounterService) CounterSeries(ctx context.Context, query model.CounterSeriesQuery) (*model.CounterSeries, error) {
+	from, to, err := seriesRange(query.Granularity, query.From, query.To)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.GetCounter(ctx, query.CounterID); err != nil {
+		return nil, err
+	}
+
+	stored, err := s.repo.ListCounterBuckets(ctx, query.CounterID, query.Granularity, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	series := &model.CounterSeries{
+		CounterID:   query.CounterID,
+		Granularity: query.Granularity,
+		Buckets:     fillBuckets(query.Granularity, from, to, stored),
+	}
+
+	return series, nil
+}
+
+// AggregateSeries returns the tally of the counters matching the selector,
+// summed per bucket, like CounterSeries does for a single counter
+func (s *CounterService) AggregateSeries(ctx context.Context, query model.AggregateSeriesQuery) (*model.AggregateSeries, error) {
+	from, to, err := seriesRange(query.Granularity, query.From, query.To)
+	if err != nil {
+		return nil, err
+	}
+
+	labels, counters, err := s.matchingCounters(ctx, query.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := s.repo.SumCounterBuckets(ctx, counterIDs(counters), query.Granularity, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	series := &model.AggregateSeries{
+		Labels:      labels,
+		Counters:    len(counters),
+		Granularity: query.Granularity,
+		Buckets:     fillBuckets(query.Granularity, from, to, stored),
+	}
+
+	return series, nil
+}
+
+// seriesRange checks the granularity and returns the range a series spans.
+// To defaults to now and From to DefaultSeriesBuckets buckets before To.
+func seriesRange(granularity model.Granularity, queryFrom, queryTo *time.Time) (time.Time, time.Time, error) {
+	width := granularity.Duration()
+	if width == 0 {
+		return time.Time{}, time.Time{}, ErrInvalidGranularity
+	}
+
+	to := time.Now().UTC()
+	if queryTo != nil {
+		to = queryTo.UTC()
+	}
+
+	from := to.Add(-DefaultSeriesBuckets * width)
+	if queryFrom != nil {
+		from = queryFrom.UTC()
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, ErrInvalidTimeRange
+	}
+
+	// A bucket belongs to the series when it overlaps the range
+	from = granularity.BucketStart(from)
+	if to.Sub(from) > MaxSeriesBuckets*width {
+		return time.Time{}, time.Time{}, ErrSeriesTooLong
+	}
+
+	return from, to, nil
+}
+
+// fillBuckets returns every bucket between from and to, taking the stored
+// ones, ordered by start, and adding empty ones where none is stored
+func fillBuckets(granularity model.Granularity, from, to time.Time, stored []*model.CounterBucket) []*model.CounterBucket {
+	buckets := []*model.CounterBucket{}
+
+	for start := from; start.Before(to); start = start.Add(granularity.Duration()) {
+		if len(stored) > 0 && stored[0].Start.Equal(start) {
+			buckets = append(buckets, stored[0])
+			stored = stored[1:]
+			continue
+		}
+
+		buckets = append(buckets, &model.CounterBucket{Start: start})
+	}
+
+	return buckets
+}
+
+// matchingCounters returns the parsed selector and the live counters matching it.
+// An empty selector matches every counter.
+func (s *CounterService) matchingCounters(ctx context.Context, selector string) (model.Labels, []*model.Counter, error) {
+	labels, err := parseLabelSelector(selector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	counters, err := s.repo.ListCounters(ctx, model.CounterFilter{
+		Labels: labels,
+		SortBy: model.SortByCreatedAt,
+		Limit:  MaxAggregateCounters + 1,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(counters) > MaxAggregateCounters {
+		return nil, nil, ErrTooManyCounters
+	}
+
+	if labels == nil {
+		labels = model.Labels{}
+	}
+
+	return labels, counters, nil
+}
+
+// counterIDs returns the ids of the counters
+func counterIDs(counters []*model.Counter) []uuid.UUID {
+	ids := make([]uuid.UUID, len(counters))
+	for i, counter := range counters {
+		ids[i] = counter.ID
+	}
+
+	return ids
+}
+
+// CounterRate returns the average number of increments and decrements per
+// second of a counter over the window ending now. The rate is measured on minute buckets, so the window is
+// extended back to the start of the minute it begins in.
+func (s *CounterService) CounterRate(ctx context.Context, id uuid.UUID, window time.Duration) (*model.CounterRate, error) {
+	if window < time.Minute || window > MaxRateWindow {
+		return nil, ErrInvalidWindow
+	}
+
+	if _, err := s.GetCounter(ctx, id); err != nil {
+		return nil, err
+	}
+
+	to := time.Now().UTC()
+	from := model.GranularityMinute.BucketStart(to.Add(-window))
+
+	buckets, err := s.repo.ListCounterBuckets(ctx, id, model.GranularityMinute, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	rate := &model.CounterRate{
+		CounterID: id,
+		Window:    window.String(),
+		From:      from,
+		To:        to,
+	}
+
+	for _, bucket := range buckets {
+		rate.Delta += bucket.Delta
+		rate.Increments += bucket.Increments
+	}
+	rate.PerSecond = float64(rate.Increments) / to.Sub(from).Seconds()
+
+	return rate, nil
+}
+
+// AggregateRate returns the average number of increments and decrements per
+// second of the counters matching the selector, summed up, over the window ending now
+func (s *CounterService) AggregateRate(ctx context.Context, selector string, window time.Duration) (*model.AggregateRate, error) {
+	if window < time.Minute || window > MaxRateWindow {
+		return nil, ErrInvalidWindow
+	}
+
+	labels, counters, err := s.matchingCounters(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	to := time.Now().UTC()
+	from := model.GranularityMinute.BucketStart(to.Add(-window))
+
+	rate := &model.AggregateRate{
+		Labels:   labels,
+		Counters: len(counters),
+		Window:   window.String(),
+		From:     from,
+		To:       to,
+	}
+
+	buckets, err := s.repo.SumCounterBuckets(ctx, counterIDs(counters), model.GranularityMinute, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, bucket := range buckets {
+		rate.Delta += bucket.Delta
+		rate.Increments += bucket.Increments
+	}
+	rate.PerSecond = float64(rate.Increments) / to.Sub(from).Seconds()
+
+	return rate, nil
+}
+
+// PruneMinuteBuckets removes the minute buckets older than the retention and
+// returns how many were removed. The hour and day buckets tally the same
+// changes, so older series are still answered at those granularities.
+func (s *CounterService) PruneMinuteBuckets(ctx context.Context) (int64, error) {
+	return s.repo.PruneCounterBuckets(ctx, model.GranularityMinute, time.Now().UTC().Add(-s.minuteBucketRetention))
+}
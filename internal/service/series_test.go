@@ -0,0 +1,297 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"gounter/internal/model"
+	"gounter/internal/service"
+	"gounter/test/mocks"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounterServiceCounterSeries(t *testing.T) {
+	id := uuid.New()
+	from := time.Date(2026, 10, 1, 0, 30, 0, 0, time.UTC)
+	to := time.Date(2026, 10, 1, 3, 0, 0, 0, time.UTC)
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("fills the buckets without increments", func(t *testing.T) {
+		repo := new(mocks.Repository)
+		repo.On("GetCounter", mock.Anything, id).Return(&model.Counter{ID: id}, nil)
+		repo.On("ListCounterBuckets", mock.Anything, id, model.GranularityHour, start, to).
+			Return([]*model.CounterBucket{{Start: start.Add(time.Hour), Delta: 5, Increments: 2}}, nil)
+
+		svc := service.NewCounterService(repo)
+
+		series, err := svc.CounterSeries(context.TODO(), model.CounterSeriesQuery{
+			CounterID:   id,
+			Granularity: model.GranularityHour,
+			From:        &from,
+			To:          &to,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []*model.CounterBucket{
+			{Start: start},
+			{Start: start.Add(time.Hour), Delta: 5, Increments: 2},
+			{Start: start.Add(2 * time.Hour)},
+		}, series.Buckets)
+
+		repo.AssertExpectations(t)
+	})
+
+	tooEarly := to.Add(-(service.MaxSeriesBuckets + 1) * time.Minute)
+
+	tests := []struct {
+		name          string
+		setupMock     func(repo *mocks.Repository)
+		query         model.CounterSeriesQuery
+		expectedError error
+	}{
+		{
+			name:          "unknown granularity",
+			setupMock:     func(*mocks.Repository) {},
+			query:         model.CounterSeriesQuery{CounterID: id, Granularity: "week"},
+			expectedError: service.ErrInvalidGranularity,
+		},
+		{
+			name:          "range ending before it starts",
+			setupMock:     func(*mocks.Repository) {},
+			query:         model.CounterSeriesQuery{CounterID: id, Granularity: model.GranularityHour, From: &to, To: &from},
+			expectedError: service.ErrInvalidTimeRange,
+		},
+		{
+			name:          "too many buckets",
+			setupMock:     func(*mocks.Repository) {},
+			query:         model.CounterSeriesQuery{CounterID: id, Granularity: model.GranularityMinute, From: &tooEarly, To: &to},
+			expectedError: service.ErrSeriesTooLong,
+		},
+		{
+			name: "counter not found",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("GetCounter", mock.Anything, id).Return(nil, sql.ErrNoRows)
+			},
+			query:         model.CounterSeriesQuery{CounterID: id, Granularity: model.GranularityDay},
+			expectedError: service.ErrCounterNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(mocks.Repository)
+			tt.setupMock(repo)
+			svc := service.NewCounterService(repo)
+
+			_, err := svc.CounterSeries(context.TODO(), tt.query)
+			require.Equal(t, tt.expectedError, err)
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCounterServiceCounterRate(t *testing.T) {
+	id := uuid.New()
+
+	t.Run("averages the minute buckets over the window", func(t *testing.T) {
+		var from, to time.Time
+
+		repo := new(mocks.Repository)
+		repo.On("GetCounter", mock.Anything, id).Return(&model.Counter{ID: id}, nil)
+		repo.On("ListCounterBuckets", mock.Anything, id, model.GranularityMinute, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				from, to = args.Get(3).(time.Time), args.Get(4).(time.Time)
+			}).
+			Return([]*model.CounterBucket{{Delta: 200, Increments: 250}, {Delta: -100, Increments: 50}}, nil)
+
+		svc := service.NewCounterService(repo)
+
+		// Decrements add to the rate, they do not cancel the increments out
+		rate, err := svc.CounterRate(context.TODO(), id, 5*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, "5m0s", rate.Window)
+		assert.Equal(t, int64(100), rate.Delta)
+		assert.Equal(t, int64(300), rate.Increments)
+		assert.Equal(t, model.GranularityMinute.BucketStart(from), from)
+		assert.InDelta(t, 300/to.Sub(from).Seconds(), rate.PerSecond, 1e-9)
+
+		repo.AssertExpectations(t)
+	})
+
+	tests := []struct {
+		name          string
+		setupMock     func(repo *mocks.Repository)
+		window        time.Duration
+		expectedError error
+	}{
+		{
+			name:          "window too short",
+			setupMock:     func(*mocks.Repository) {},
+			window:        time.Second,
+			expectedError: service.ErrInvalidWindow,
+		},
+		{
+			name:          "window too long",
+			setupMock:     func(*mocks.Repository) {},
+			window:        service.MaxRateWindow + time.Minute,
+			expectedError: service.ErrInvalidWindow,
+		},
+		{
+			name: "counter not found",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("GetCounter", mock.Anything, id).Return(nil, sql.ErrNoRows)
+			},
+			window:        time.Minute,
+			expectedError: service.ErrCounterNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(mocks.Repository)
+			tt.setupMock(repo)
+			svc := service.NewCounterService(repo)
+
+			_, err := svc.CounterRate(context.TODO(), id, tt.window)
+			require.Equal(t, tt.expectedError, err)
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCounterServiceAggregateSeries(t *testing.T) {
+	first, second := uuid.New(), uuid.New()
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 10, 1, 3, 0, 0, 0, time.UTC)
+	filter := model.CounterFilter{
+		Labels: model.Labels{"team": "payments"},
+		SortBy: model.SortByCreatedAt,
+		Limit:  service.MaxAggregateCounters + 1,
+	}
+
+	t.Run("sums the buckets of the matching counters", func(t *testing.T) {
+		repo := new(mocks.Repository)
+		repo.On("ListCounters", mock.Anything, filter).
+			Return([]*model.Counter{{ID: first}, {ID: second}}, nil)
+		repo.On("SumCounterBuckets", mock.Anything, []uuid.UUID{first, second}, model.GranularityHour, from, to).
+			Return([]*model.CounterBucket{{Start: from, Delta: 3, Increments: 1}, {Start: from.Add(time.Hour), Delta: 4, Increments: 3}}, nil).Once()
+
+		svc := service.NewCounterService(repo)
+
+		series, err := svc.AggregateSeries(context.TODO(), model.AggregateSeriesQuery{
+			Labels:      "team=payments",
+			Granularity: model.GranularityHour,
+			From:        &from,
+			To:          &to,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, model.Labels{"team": "payments"}, series.Labels)
+		assert.Equal(t, 2, series.Counters)
+		assert.Equal(t, []*model.CounterBucket{
+			{Start: from, Delta: 3, Increments: 1},
+			{Start: from.Add(time.Hour), Delta: 4, Increments: 3},
+			{Start: from.Add(2 * time.Hour)},
+		}, series.Buckets)
+
+		repo.AssertExpectations(t)
+	})
+
+	tests := []struct {
+		name          string
+		setupMock     func(repo *mocks.Repository)
+		query         model.AggregateSeriesQuery
+		expectedError error
+	}{
+		{
+			name:          "malformed selector",
+			setupMock:     func(*mocks.Repository) {},
+			query:         model.AggregateSeriesQuery{Labels: "team=payments,env", Granularity: model.GranularityHour},
+			expectedError: service.ErrInvalidLabelSelector,
+		},
+		{
+			name:          "unknown granularity",
+			setupMock:     func(*mocks.Repository) {},
+			query:         model.AggregateSeriesQuery{Labels: "team=payments", Granularity: "week"},
+			expectedError: service.ErrInvalidGranularity,
+		},
+		{
+			name: "too many matching counters",
+			setupMock: func(repo *mocks.Repository) {
+				repo.On("ListCounters", mock.Anything, filter).
+					Return(make([]*model.Counter, service.MaxAggregateCounters+1), nil)
+			},
+			query:         model.AggregateSeriesQuery{Labels: "team=payments", Granularity: model.GranularityHour},
+			expectedError: service.ErrTooManyCounters,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(mocks.Repository)
+			tt.setupMock(repo)
+			svc := service.NewCounterService(repo)
+
+			_, err := svc.AggregateSeries(context.TODO(), tt.query)
+			require.Equal(t, tt.expectedError, err)
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCounterServiceAggregateRate(t *testing.T) {
+	first, second := uuid.New(), uuid.New()
+
+	t.Run("sums the rates of the matching counters", func(t *testing.T) {
+		var from, to time.Time
+
+		repo := new(mocks.Repository)
+		repo.On("ListCounters", mock.Anything, model.CounterFilter{SortBy: model.SortByCreatedAt, Limit: service.MaxAggregateCounters + 1}).
+			Return([]*model.Counter{{ID: first}, {ID: second}}, nil)
+		repo.On("SumCounterBuckets", mock.Anything, []uuid.UUID{first, second}, model.GranularityMinute, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				from, to = args.Get(3).(time.Time), args.Get(4).(time.Time)
+			}).
+			Return([]*model.CounterBucket{{Delta: 200, Increments: 250}, {Delta: -100, Increments: 50}}, nil).Once()
+
+		svc := service.NewCounterService(repo)
+
+		rate, err := svc.AggregateRate(context.TODO(), "", 5*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, model.Labels{}, rate.Labels)
+		assert.Equal(t, 2, rate.Counters)
+		assert.Equal(t, int64(100), rate.Delta)
+		assert.Equal(t, int64(300), rate.Increments)
+		assert.InDelta(t, 300/to.Sub(from).Seconds(), rate.PerSecond, 1e-9)
+
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("window too short", func(t *testing.T) {
+		svc := service.NewCounterService(new(mocks.Repository))
+
+		_, err := svc.AggregateRate(context.TODO(), "team=payments", time.Second)
+		require.Equal(t, service.ErrInvalidWindow, err)
+	})
+}
+
+func TestCounterServicePruneMinuteBuckets(t *testing.T) {
+	repo := new(mocks.Repository)
+	repo.On("PruneCounterBuckets", mock.Anything, model.GranularityMinute, mock.MatchedBy(func(before time.Time) bool {
+		return time.Since(before) > 12*time.Hour && time.Since(before) < 13*time.Hour
+	})).Return(int64(42), nil).Once()
+
+	svc := service.NewCounterService(repo, service.WithMinuteBucketRetention(12*time.Hour))
+
+	pruned, err := svc.PruneMinuteBuckets(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), pruned)
+
+	repo.AssertExpectations(t)
+}
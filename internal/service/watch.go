@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"gounter/internal/model"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// WatchHistorySize is the number of recent changes kept for the watchers
+	// resuming after a disconnect
+	WatchHistorySize = 1024
+	// watcherBuffer is the number of changes a watcher can fall behind by
+	// before it is disconnected
+	watcherBuffer = 256
+)
+
+// changeFeed fans the changes of the counters out to their watchers. Changes
+// are numbered in the order they are published, and IDs carry the start time
+// of the feed so the IDs of a previous process are never taken for its own.
+type changeFeed struct {
+	epoch string
+
+	mu       sync.Mutex
+	sequence int64
+	// history holds the last WatchHistorySize changes, oldest first
+	history  []model.CounterChange
+	watchers map[chan model.CounterChange]struct{}
+}
+
+// newChangeFeed creates a feed without any change
+func newChangeFeed() *changeFeed {
+	return &changeFeed{
+		epoch:    strconv.FormatInt(time.Now().UnixNano(), 36),
+		watchers: map[chan model.CounterChange]struct{}{},
+	}
+}
+
+// publish sends the change of a counter to every watcher. A watcher too far
+// behind to take it is disconnected, it can resume from its last change.
+func (f *changeFeed) publish(counter *model.Counter, deleted bool) {
+	if counter == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sequence++
+	change := model.CounterChange{ID: f.id(f.sequence), Counter: counter, Deleted: deleted}
+
+	f.history = append(f.history, change)
+	if len(f.history) > WatchHistorySize {
+		f.history = f.history[len(f.history)-WatchHistorySize:]
+	}
+
+	for watcher := range f.watchers {
+		select {
+		case watcher <- change:
+		default:
+			delete(f.watchers, watcher)
+			close(watcher)
+		}
+	}
+}
+
+// subscribe registers a watcher. When the feed still holds every change after
+// lastEventID they are returned to be replayed and resumed is set, otherwise
+// the watcher needs the current state of the counters as of the returned ID.
+func (f *changeFeed) subscribe(lastEventID string) (watcher chan model.CounterChange, replay []model.CounterChange, resumed bool, current string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	watcher = make(chan model.CounterChange, watcherBuffer)
+	f.watchers[watcher] = struct{}{}
+
+	if sequence, ok := f.parse(lastEventID); ok {
+		first := f.sequence - int64(len(f.history)) + 1
+		if sequence >= first-1 && sequence <= f.sequence {
+			replay = append(replay, f.history[sequence-first+1:]...)
+			return watcher, replay, true, f.id(f.sequence)
+		}
+	}
+
+	return watcher, nil, false, f.id(f.sequence)
+}
+
+// unsubscribe removes a watcher, unless it was already disconnected
+func (f *changeFeed) unsubscribe(watcher chan model.CounterChange) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.watchers[watcher]; ok {
+		delete(f.watchers, watcher)
+		close(watcher)
+	}
+}
+
+// id returns the ID of the change with the given sequence
+func (f *changeFeed) id(sequence int64) string {
+	return fmt.Sprintf("%s-%d", f.epoch, sequence)
+}
+
+// snapshotID returns the ID of the position-th event of a snapshot taken as of
+// the change current. Only the last event of a snapshot carries current
+// itself, the ones before it cannot be parsed, so a client disconnected in
+// the middle of the snapshot gets the whole snapshot again.
+func snapshotID(current string, position int) string {
+	return fmt.Sprintf("%s.%d", current, position)
+}
+
+// parse returns the sequence of an ID of this feed
+func (f *changeFeed) parse(id string) (int64, bool) {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 || parts[0] != f.epoch {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(parts[1], 10, 64)
+	return n, err == nil && n >= 0
+}
+
+// watchedCounters returns the parsed selector and every live counter matching
+// it, read a page at a time. Unlike the aggregates, a watch takes any number of
+// counters. An empty selector matches every counter.
+func (s *CounterService) watchedCounters(ctx context.Context, selector string) (model.Labels, []*model.Counter, error) {
+	labels, err := parseLabelSelector(selector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filter := model.CounterFilter{Labels: labels, SortBy: model.SortByCreatedAt, Limit: MaxListLimit}
+
+	var counters []*model.Counter
+	for {
+		page, err := s.repo.ListCounters(ctx, filter)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		counters = append(counters, page...)
+		if len(page) < filter.Limit {
+			break
+		}
+		filter.After = page[len(page)-1]
+	}
+
+	if labels == nil {
+		labels = model.Labels{}
+	}
+
+	return labels, counters, nil
+}
+
+// WatchCounters streams the changes of a counter, or of the counters matching
+// a label selector, until ctx is done. The stream starts with the changes
+// missed since query.LastEventID when they are still known, and with the
+// current state of the counters otherwise, which is only resumed from once its
+// last counter was sent. It is closed early when the client
+// falls too far behind, and can then be resumed from the last change read.
+// Only the changes made through this service are seen.
+func (s *CounterService) WatchCounters(ctx context.Context, query model.WatchQuery) (<-chan model.CounterChange, error) {
+	filter := &watchFilter{id: query.CounterID, versions: map[uuid.UUID]int64{}}
+
+	// The watcher is registered before the counters are read, so no change
+	// made in between is missed
+	watcher, replay, resumed, current := s.changes.subscribe(query.LastEventID)
+
+	var counters []*model.Counter
+	if query.CounterID != uuid.Nil {
+		counter, err := s.GetCounter(ctx, query.CounterID)
+		if err != nil {
+			s.changes.unsubscribe(watcher)
+			return nil, err
+		}
+		counters = []*model.Counter{counter}
+	} else {
+		labels, matching, err := s.watchedCounters(ctx, query.Labels)
+		if err != nil {
+			s.changes.unsubscribe(watcher)
+			return nil, err
+		}
+		filter.labels, counters = labels, matching
+	}
+
+	var initial []model.CounterChange
+	if resumed {
+		for _, counter := range counters {
+			filter.versions[counter.ID] = 0
+		}
+		for _, change := range replay {
+			// The counters deleted while the client was away are gone from the
+			// selection, their deletes are sent in case the client saw them
+			if filter.matches(change) || (change.Deleted && filter.id == uuid.Nil) {
+				initial = append(initial, change)
+			}
+		}
+	} else {
+		for _, counter := range counters {
+			change := model.CounterChange{ID: current, Counter: counter}
+			if filter.matches(change) {
+				initial = append(initial, change)
+			}
+		}
+		for i := 0; i < len(initial)-1; i++ {
+			initial[i].ID = snapshotID(current, i)
+		}
+	}
+
+	out := make(chan model.CounterChange)
+	go func() {
+		defer close(out)
+		defer s.changes.unsubscribe(watcher)
+
+		for _, change := range initial {
+			select {
+			case out <- change:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		for {
+			select {
+			case change, ok := <-watcher:
+				if !ok {
+					return
+				}
+				if !filter.matches(change) {
+					continue
+				}
+
+				select {
+				case out <- change:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// watchFilter picks the changes of the watched counters. It remembers the last
+// version sent for each counter, to drop the changes published out of order by
+// concurrent writes, and to send the deletes and the changes taking a counter
+// out of the selector to the watchers which saw it.
+type watchFilter struct {
+	id       uuid.UUID
+	labels   model.Labels
+	versions map[uuid.UUID]int64
+}
+
+// matches reports whether the change is sent to the watcher
+func (f *watchFilter) matches(change model.CounterChange) bool {
+	counter := change.Counter
+	if f.id != uuid.Nil && counter.ID != f.id {
+		return false
+	}
+
+	version, seen := f.versions[counter.ID]
+	if change.Deleted {
+		delete(f.versions, counter.ID)
+		return seen || f.id != uuid.Nil
+	}
+
+	if counter.Version < version {
+		return false
+	}
+
+	if f.id == uuid.Nil && !counter.Labels.Matches(f.labels) {
+		// The counter left the selector, its watchers get this last change
+		delete(f.versions, counter.ID)
+		return seen
+	}
+
+	f.versions[counter.ID] = counter.Version
+	return true
+}
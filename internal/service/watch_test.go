@@ -0,0 +1,274 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"gounter/internal/model"
+	"gounter/internal/service"
+	"gounter/test/mocks"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// receive returns the next change of a watch, failing after a second
+func receive(t *testing.T, changes <-chan model.CounterChange) model.CounterChange {
+	t.Helper()
+
+	select {
+	case change, ok := <-changes:
+		require.True(t, ok, "watch closed")
+		return change
+	case <-time.After(time.Second):
+		require.FailNow(t, "no change received")
+		return model.CounterChange{}
+	}
+}
+
+// assertNoChange checks that a watch has nothing more to send
+func assertNoChange(t *testing.T, changes <-chan model.CounterChange) {
+	t.Helper()
+
+	select {
+	case change := <-changes:
+		assert.Failf(t, "unexpected change", "%+v", change)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestCounterServiceWatchCounter(t *testing.T) {
+	id, otherID := uuid.New(), uuid.New()
+
+	repo := new(mocks.Repository)
+	repo.On("GetCounter", mock.Anything, id).Return(&model.Counter{ID: id, Value: 1, Version: 1}, nil)
+	repo.On("IncrementCounter", mock.Anything, id, int64(2)).Return(&model.Counter{ID: id, Value: 3, Version: 2}, nil)
+	repo.On("IncrementCounter", mock.Anything, otherID, int64(1)).Return(&model.Counter{ID: otherID, Value: 1, Version: 2}, nil)
+	svc := service.NewCounterService(repo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := svc.WatchCounters(ctx, model.WatchQuery{CounterID: id})
+	require.NoError(t, err)
+
+	snapshot := receive(t, changes)
+	assert.Equal(t, int64(1), snapshot.Counter.Value)
+
+	_, err = svc.IncrementCounter(context.Background(), otherID, 1)
+	require.NoError(t, err)
+	_, err = svc.IncrementCounter(context.Background(), id, 2)
+	require.NoError(t, err)
+
+	change := receive(t, changes)
+	assert.Equal(t, int64(3), change.Counter.Value)
+	assert.Equal(t, int64(2), change.Counter.Version)
+	assert.NotEqual(t, snapshot.ID, change.ID)
+	assertNoChange(t, changes)
+
+	cancel()
+	_, ok := <-changes
+	assert.False(t, ok)
+}
+
+func TestCounterServiceWatchCounterNotFound(t *testing.T) {
+	id := uuid.New()
+
+	repo := new(mocks.Repository)
+	repo.On("GetCounter", mock.Anything, id).Return(nil, sql.ErrNoRows)
+	svc := service.NewCounterService(repo)
+
+	_, err := svc.WatchCounters(context.Background(), model.WatchQuery{CounterID: id})
+	assert.Equal(t, service.ErrCounterNotFound, err)
+}
+
+func TestCounterServiceWatchLabels(t *testing.T) {
+	seen, created, other := uuid.New(), uuid.New(), uuid.New()
+	payments := model.Labels{"team": "payments"}
+
+	repo := new(mocks.Repository)
+	repo.On("ListCounters", mock.Anything, mock.MatchedBy(func(filter model.CounterFilter) bool {
+		return filter.Labels["team"] == "payments"
+	})).Return([]*model.Counter{{ID: seen, Labels: payments, Version: 1}}, nil)
+	repo.On("CreateCounter", mock.Anything, mock.MatchedBy(func(params model.CreateCounterParams) bool { return params.Name == "refunds" })).
+		Return(&model.Counter{ID: created, Name: "refunds", Labels: payments, Version: 1}, nil)
+	repo.On("CreateCounter", mock.Anything, mock.MatchedBy(func(params model.CreateCounterParams) bool { return params.Name == "signups" })).
+		Return(&model.Counter{ID: other, Name: "signups", Version: 1}, nil)
+	repo.On("SoftDeleteCounter", mock.Anything, mock.Anything).Return(int64(1), nil)
+	svc := service.NewCounterService(repo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := svc.WatchCounters(ctx, model.WatchQuery{Labels: "team=payments"})
+	require.NoError(t, err)
+	snapshot := receive(t, changes)
+	assert.Equal(t, seen, snapshot.Counter.ID)
+
+	_, err = svc.CreateCounter(context.Background(), model.CreateCounterParams{Name: "signups"})
+	require.NoError(t, err)
+	_, err = svc.CreateCounter(context.Background(), model.CreateCounterParams{Name: "refunds", Labels: payments})
+	require.NoError(t, err)
+	_, err = svc.SoftDeleteCounter(context.Background(), other)
+	require.NoError(t, err)
+	_, err = svc.SoftDeleteCounter(context.Background(), seen)
+	require.NoError(t, err)
+
+	assert.Equal(t, created, receive(t, changes).Counter.ID)
+
+	deleted := receive(t, changes)
+	assert.Equal(t, seen, deleted.Counter.ID)
+	assert.True(t, deleted.Deleted)
+	assertNoChange(t, changes)
+
+	// A client resuming from the snapshot gets the delete of the counter it
+	// saw, even though the counter is no longer listed
+	resumed, err := svc.WatchCounters(ctx, model.WatchQuery{Labels: "team=payments", LastEventID: snapshot.ID})
+	require.NoError(t, err)
+	assert.Equal(t, created, receive(t, resumed).Counter.ID)
+	assert.True(t, receive(t, resumed).Deleted)
+	assert.True(t, receive(t, resumed).Deleted)
+	assertNoChange(t, resumed)
+}
+
+func TestCounterServiceWatchManyCounters(t *testing.T) {
+	counters := make([]*model.Counter, 2*service.MaxAggregateCounters+50)
+	for i := range counters {
+		counters[i] = &model.Counter{ID: uuid.New(), Version: 1}
+	}
+
+	// The counters are listed a page at a time, each page following the last counter of the previous one
+	repo := new(mocks.Repository)
+	repo.On("ListCounters", mock.Anything, mock.Anything).Return(func(ctx context.Context, filter model.CounterFilter) []*model.Counter {
+		start := 0
+		if filter.After != nil {
+			for i, counter := range counters {
+				if counter.ID == filter.After.ID {
+					start = i + 1
+				}
+			}
+		}
+
+		end := start + filter.Limit
+		if end > len(counters) {
+			end = len(counters)
+		}
+		return counters[start:end]
+	}, nil)
+	svc := service.NewCounterService(repo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := svc.WatchCounters(ctx, model.WatchQuery{})
+	require.NoError(t, err)
+
+	for _, counter := range counters {
+		assert.Equal(t, counter.ID, receive(t, changes).Counter.ID)
+	}
+	assertNoChange(t, changes)
+}
+
+func TestCounterServiceWatchResume(t *testing.T) {
+	id := uuid.New()
+
+	repo := new(mocks.Repository)
+	repo.On("GetCounter", mock.Anything, id).Return(&model.Counter{ID: id, Value: 1, Version: 1}, nil)
+	repo.On("IncrementCounter", mock.Anything, id, int64(1)).Return(&model.Counter{ID: id, Value: 2, Version: 2}, nil).Once()
+	repo.On("IncrementCounter", mock.Anything, id, int64(1)).Return(&model.Counter{ID: id, Value: 3, Version: 3}, nil).Once()
+	repo.On("IncrementCounter", mock.Anything, id, int64(1)).Return(&model.Counter{ID: id, Value: 4, Version: 4}, nil).Once()
+	svc := service.NewCounterService(repo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := svc.WatchCounters(ctx, model.WatchQuery{CounterID: id})
+	require.NoError(t, err)
+	receive(t, changes)
+
+	_, err = svc.IncrementCounter(context.Background(), id, 1)
+	require.NoError(t, err)
+	last := receive(t, changes)
+	cancel()
+
+	// The client is disconnected while the counter keeps changing
+	_, err = svc.IncrementCounter(context.Background(), id, 1)
+	require.NoError(t, err)
+	_, err = svc.IncrementCounter(context.Background(), id, 1)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		lastEventID    string
+		expectedValues []int64
+	}{
+		{
+			name:           "resumes after the last change",
+			lastEventID:    last.ID,
+			expectedValues: []int64{3, 4},
+		},
+		{
+			name:           "sends the current state for an unknown ID",
+			lastEventID:    "previous-process-7",
+			expectedValues: []int64{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			changes, err := svc.WatchCounters(ctx, model.WatchQuery{CounterID: id, LastEventID: tt.lastEventID})
+			require.NoError(t, err)
+
+			for _, value := range tt.expectedValues {
+				assert.Equal(t, value, receive(t, changes).Counter.Value)
+			}
+			assertNoChange(t, changes)
+		})
+	}
+}
+
+func TestCounterServiceWatchResumeSnapshot(t *testing.T) {
+	first, second, third := uuid.New(), uuid.New(), uuid.New()
+	payments := model.Labels{"team": "payments"}
+
+	repo := new(mocks.Repository)
+	repo.On("ListCounters", mock.Anything, mock.Anything).Return([]*model.Counter{
+		{ID: first, Labels: payments, Version: 1},
+		{ID: second, Labels: payments, Version: 1},
+		{ID: third, Labels: payments, Version: 1},
+	}, nil)
+	svc := service.NewCounterService(repo)
+
+	// The client is disconnected after the first counter of the snapshot
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := svc.WatchCounters(ctx, model.WatchQuery{Labels: "team=payments"})
+	require.NoError(t, err)
+	partial := receive(t, changes)
+	cancel()
+
+	// Resuming from it sends the whole snapshot again, each event with its own ID
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err = svc.WatchCounters(ctx, model.WatchQuery{Labels: "team=payments", LastEventID: partial.ID})
+	require.NoError(t, err)
+
+	ids := map[string]bool{}
+	var last model.CounterChange
+	for _, id := range []uuid.UUID{first, second, third} {
+		last = receive(t, changes)
+		assert.Equal(t, id, last.Counter.ID)
+		ids[last.ID] = true
+	}
+	assert.Len(t, ids, 3)
+	assertNoChange(t, changes)
+
+	// Once the snapshot was sent whole, the stream resumes after it
+	resumed, err := svc.WatchCounters(ctx, model.WatchQuery{Labels: "team=payments", LastEventID: last.ID})
+	require.NoError(t, err)
+	assertNoChange(t, resumed)
+}
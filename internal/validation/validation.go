@@ -0,0 +1,197 @@
+// Package validation checks the inputs of counter requests. The handlers and
+// the service share it, so every invalid field is reported at once with the
+// same codes whichever layer finds it.
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxNameLength is the longest counter name, in characters
+	MaxNameLength = 128
+	// MaxDelta bounds the change a single increment or decrement can make
+	MaxDelta = 1_000_000_000_000
+)
+
+// namePattern matches the supported counter names: words of letters, digits,
+// '.', '_', '-' or ':' separated by single spaces
+var namePattern = regexp.MustCompile(`^[\p{L}\p{N}._:-]+( [\p{L}\p{N}._:-]+)*$`)
+
+// Rule is a check a field can fail. Its code is stable, like the codes of the
+// service errors, and its message describes the field without naming it.
+type Rule struct {
+	code    string
+	message string
+}
+
+func (r *Rule) Error() string {
+	return r.message
+}
+
+// Code returns the stable identifier of the rule
+func (r *Rule) Code() string {
+	return r.code
+}
+
+var (
+	// ErrRequired is failed by a missing field
+	ErrRequired = &Rule{code: "required", message: "is required"}
+	// ErrNotPositive is failed by a number that must be above zero
+	ErrNotPositive = &Rule{code: "not_positive", message: "must be positive"}
+	// ErrUnknownField is failed by a field the request does not have
+	ErrUnknownField = &Rule{code: "unknown_field", message: "is not a known field"}
+	// ErrNameTooLong is failed by a name longer than MaxNameLength characters
+	ErrNameTooLong = &Rule{code: "too_long", message: fmt.Sprintf("must be at most %d characters", MaxNameLength)}
+	// ErrNameCharacters is failed by a name with unsupported characters
+	ErrNameCharacters = &Rule{code: "invalid_characters", message: "must be words of letters, digits, '.', '_', '-' or ':' separated by single spaces"}
+	// ErrDeltaRange is failed by a delta larger than MaxDelta either way
+	ErrDeltaRange = &Rule{code: "out_of_range", message: fmt.Sprintf("must be between -%d and %d", MaxDelta, MaxDelta)}
+)
+
+// FieldError is a field of a request that failed a check
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+// Errors lists every invalid field of a request
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, field := range e {
+		messages[i] = field.Error()
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Is lets errors.Is match the error of any of the fields
+func (e Errors) Is(target error) bool {
+	for _, field := range e {
+		if field.Err == target {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validator collects the invalid fields of a request
+type Validator struct {
+	errs Errors
+}
+
+// Field records that field is invalid when err is not nil
+func (v *Validator) Field(field string, err error) {
+	if err != nil {
+		v.errs = append(v.errs, FieldError{Field: field, Err: err})
+	}
+}
+
+// Check records that field failed err unless ok
+func (v *Validator) Check(ok bool, field string, err error) {
+	if !ok {
+		v.Field(field, err)
+	}
+}
+
+// Err returns the invalid fields as Errors, or nil when every field is valid
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+
+	return v.errs
+}
+
+// Name checks a counter name
+func Name(name string) error {
+	switch {
+	case name == "":
+		return ErrRequired
+	case utf8.RuneCountInString(name) > MaxNameLength:
+		return ErrNameTooLong
+	case !namePattern.MatchString(name):
+		return ErrNameCharacters
+	}
+
+	return nil
+}
+
+// Delta checks the range of a change. Zero is in range, whether it is
+// accepted depends on the request.
+func Delta(delta int64) error {
+	if delta > MaxDelta || delta < -MaxDelta {
+		return ErrDeltaRange
+	}
+
+	return nil
+}
+
+// UnknownFields returns the fields of a JSON object that v, a pointer to a
+// struct, does not have. It lists them all where a strict decoder stops at
+// the first one.
+func UnknownFields(data []byte, v interface{}) Errors {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil
+	}
+
+	known := map[string]bool{}
+	jsonFields(reflect.TypeOf(v).Elem(), known)
+
+	var errs Errors
+	for field := range object {
+		if !known[strings.ToLower(field)] {
+			errs = append(errs, FieldError{Field: field, Err: ErrUnknownField})
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+
+	return errs
+}
+
+// jsonFields adds the lower cased JSON names of the fields of t to known,
+// including the fields of its embedded structs, since encoding/json matches
+// names case insensitively
+func jsonFields(t reflect.Type, known map[string]bool) {
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tagName := strings.Split(tag, ",")[0]; tagName != "" {
+				name = tagName
+			} else if field.Anonymous {
+				jsonFields(field.Type, known)
+				continue
+			}
+		} else if field.Anonymous {
+			jsonFields(field.Type, known)
+			continue
+		}
+
+		if field.IsExported() {
+			known[strings.ToLower(name)] = true
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package validation_test
+
+import (
+	"errors"
+	"gounter/internal/model"
+	"gounter/internal/validation"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		expectedError error
+	}{
+		{name: "plain name", input: "checkout_completed"},
+		{name: "words and punctuation", input: "page views: v2.1-beta"},
+		{name: "letters of any script", input: "inscriptions été"},
+		{name: "longest name", input: strings.Repeat("é", validation.MaxNameLength)},
+		{name: "empty", input: "", expectedError: validation.ErrRequired},
+		{name: "too long", input: strings.Repeat("n", validation.MaxNameLength+1), expectedError: validation.ErrNameTooLong},
+		{name: "leading space", input: " signups", expectedError: validation.ErrNameCharacters},
+		{name: "double space", input: "page  views", expectedError: validation.ErrNameCharacters},
+		{name: "slash", input: "growth/eu", expectedError: validation.ErrNameCharacters},
+		{name: "control character", input: "signups\n", expectedError: validation.ErrNameCharacters},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedError, validation.Name(tt.input))
+		})
+	}
+}
+
+func TestDelta(t *testing.T) {
+	assert.NoError(t, validation.Delta(validation.MaxDelta))
+	assert.NoError(t, validation.Delta(-validation.MaxDelta))
+	assert.Equal(t, validation.ErrDeltaRange, validation.Delta(validation.MaxDelta+1))
+	assert.Equal(t, validation.ErrDeltaRange, validation.Delta(-validation.MaxDelta-1))
+}
+
+func TestValidator(t *testing.T) {
+	var v validation.Validator
+	require.NoError(t, v.Err())
+
+	v.Check(true, "id", validation.ErrRequired)
+	v.Check(false, "name", validation.ErrRequired)
+	v.Field("delta", nil)
+	v.Field("delta", validation.ErrDeltaRange)
+
+	err := v.Err()
+	require.Equal(t, validation.Errors{
+		{Field: "name", Err: validation.ErrRequired},
+		{Field: "delta", Err: validation.ErrDeltaRange},
+	}, err)
+	assert.Equal(t, "name: is required; delta: must be between -1000000000000 and 1000000000000", err.Error())
+	assert.True(t, errors.Is(err, validation.ErrDeltaRange))
+	assert.False(t, errors.Is(err, validation.ErrNameTooLong))
+}
+
+func TestUnknownFields(t *testing.T) {
+	type request struct {
+		ID uuid.UUID `json:"id"`
+		model.CreateCounterParams
+		Delta   *int64 `json:"delta"`
+		Ignored string `json:"-"`
+		NoTag   string
+	}
+
+	errs := validation.UnknownFields([]byte(`{"id":"x","NAME":"a","max":1,"delta":2,"notag":"","Ignored":"","nmae":"b","deltas":3}`), &request{})
+	assert.Equal(t, validation.Errors{
+		{Field: "Ignored", Err: validation.ErrUnknownField},
+		{Field: "deltas", Err: validation.ErrUnknownField},
+		{Field: "nmae", Err: validation.ErrUnknownField},
+	}, errs)
+
+	assert.Empty(t, validation.UnknownFields([]byte(`[1, 2]`), &request{}))
+}
@@ -0,0 +1,36 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterIntegrationV1(t *testing.T) {
+	// Generate a valid JWT token to use for the requests
+	token, err := generateValidJWT()
+	assert.NoError(t, err)
+
+	// Step 1: Create a new counter
+	createCounterBody := map[string]string{"name": "testCounterV1"}
+	createCounterResponse := sendRequest(t, "POST", "/v1/counters", createCounterBody, http.StatusCreated, token)
+
+	var createResponse CounterResponse
+	err = json.Unmarshal(createCounterResponse, &createResponse)
+	assert.NotEmpty(t, createResponse.ID)
+	assert.NoError(t, err)
+
+	counterID := createResponse.ID
+	assert.NotEmpty(t, counterID)
+
+	// Step 2: Increment the counter twice
+	incrementCounterURL := "/v1/counters/" + counterID + "/increment"
+	sendRequest(t, "POST", incrementCounterURL, nil, http.StatusOK, token)
+	sendRequest(t, "POST", incrementCounterURL, nil, http.StatusOK, token)
+
+	// Step 3: Delete the counter
+	deleteCounterURL := "/v1/counters/" + counterID
+	sendRequest(t, "DELETE", deleteCounterURL, nil, http.StatusOK, token)
+}
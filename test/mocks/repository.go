@@ -9,6 +9,8 @@ import (
 	mock "github.com/stretchr/testify/mock"
 
 	uuid "github.com/google/uuid"
+
+	time "time"
 )
 
 // Repository is an autogenerated mock type for the Repository type
@@ -16,13 +18,36 @@ type Repository struct {
 	mock.Mock
 }
 
-// CreateCounter provides a mock function with given fields: ctx, name
-func (_m *Repository) CreateCounter(ctx context.Context, name string) (*model.Counter, error) {
-	ret := _m.Called(ctx, name)
+// ApplyBatch provides a mock function with given fields: ctx, ops, atomic
+func (_m *Repository) ApplyBatch(ctx context.Context, ops []model.BatchOperation, atomic bool) ([]model.BatchResult, error) {
+	ret := _m.Called(ctx, ops, atomic)
+
+	var r0 []model.BatchResult
+	if rf, ok := ret.Get(0).(func(context.Context, []model.BatchOperation, bool) []model.BatchResult); ok {
+		r0 = rf(ctx, ops, atomic)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.BatchResult)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []model.BatchOperation, bool) error); ok {
+		r1 = rf(ctx, ops, atomic)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateCounter provides a mock function with given fields: ctx, params
+func (_m *Repository) CreateCounter(ctx context.Context, params model.CreateCounterParams) (*model.Counter, error) {
+	ret := _m.Called(ctx, params)
 
 	var r0 *model.Counter
-	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Counter); ok {
-		r0 = rf(ctx, name)
+	if rf, ok := ret.Get(0).(func(context.Context, model.CreateCounterParams) *model.Counter); ok {
+		r0 = rf(ctx, params)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*model.Counter)
@@ -30,8 +55,8 @@ func (_m *Repository) CreateCounter(ctx context.Context, name string) (*model.Co
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, name)
+	if rf, ok := ret.Get(1).(func(context.Context, model.CreateCounterParams) error); ok {
+		r1 = rf(ctx, params)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -39,9 +64,31 @@ func (_m *Repository) CreateCounter(ctx context.Context, name string) (*model.Co
 	return r0, r1
 }
 
+// FlushIncrements provides a mock function with given fields: ctx, increments
+func (_m *Repository) FlushIncrements(ctx context.Context, increments []model.CoalescedIncrement) ([]*model.Counter, error) {
+	ret := _m.Called(ctx, increments)
 
-// IncrementCounter provides a mock function with given fields: ctx, id
-func (_m *Repository) IncrementCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
+	var r0 []*model.Counter
+	if rf, ok := ret.Get(0).(func(context.Context, []model.CoalescedIncrement) []*model.Counter); ok {
+		r0 = rf(ctx, increments)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.Counter)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []model.CoalescedIncrement) error); ok {
+		r1 = rf(ctx, increments)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetCounter provides a mock function with given fields: ctx, id
+func (_m *Repository) GetCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
 	ret := _m.Called(ctx, id)
 
 	var r0 *model.Counter
@@ -63,6 +110,232 @@ func (_m *Repository) IncrementCounter(ctx context.Context, id uuid.UUID) (*mode
 	return r0, r1
 }
 
+// GetCounterByName provides a mock function with given fields: ctx, namespace, name
+func (_m *Repository) GetCounterByName(ctx context.Context, namespace string, name string) (*model.Counter, error) {
+	ret := _m.Called(ctx, namespace, name)
+
+	var r0 *model.Counter
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *model.Counter); ok {
+		r0 = rf(ctx, namespace, name)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Counter)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, namespace, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetIdempotencyRecord provides a mock function with given fields: ctx, subject, key, since
+func (_m *Repository) GetIdempotencyRecord(ctx context.Context, subject string, key string, since time.Time) (*model.IdempotencyRecord, error) {
+	ret := _m.Called(ctx, subject, key, since)
+
+	var r0 *model.IdempotencyRecord
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Time) *model.IdempotencyRecord); ok {
+		r0 = rf(ctx, subject, key, since)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.IdempotencyRecord)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, time.Time) error); ok {
+		r1 = rf(ctx, subject, key, since)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IncrementCounter provides a mock function with given fields: ctx, id, delta
+func (_m *Repository) IncrementCounter(ctx context.Context, id uuid.UUID, delta int64) (*model.Counter, error) {
+	ret := _m.Called(ctx, id, delta)
+
+	var r0 *model.Counter
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, int64) *model.Counter); ok {
+		r0 = rf(ctx, id, delta)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Counter)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, int64) error); ok {
+		r1 = rf(ctx, id, delta)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListCounterBuckets provides a mock function with given fields: ctx, id, granularity, from, to
+func (_m *Repository) ListCounterBuckets(ctx context.Context, id uuid.UUID, granularity model.Granularity, from time.Time, to time.Time) ([]*model.CounterBucket, error) {
+	ret := _m.Called(ctx, id, granularity, from, to)
+
+	var r0 []*model.CounterBucket
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, model.Granularity, time.Time, time.Time) []*model.CounterBucket); ok {
+		r0 = rf(ctx, id, granularity, from, to)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.CounterBucket)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, model.Granularity, time.Time, time.Time) error); ok {
+		r1 = rf(ctx, id, granularity, from, to)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListCounterEvents provides a mock function with given fields: ctx, filter
+func (_m *Repository) ListCounterEvents(ctx context.Context, filter model.CounterEventFilter) ([]*model.CounterEvent, error) {
+	ret := _m.Called(ctx, filter)
+
+	var r0 []*model.CounterEvent
+	if rf, ok := ret.Get(0).(func(context.Context, model.CounterEventFilter) []*model.CounterEvent); ok {
+		r0 = rf(ctx, filter)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.CounterEvent)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.CounterEventFilter) error); ok {
+		r1 = rf(ctx, filter)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListCounters provides a mock function with given fields: ctx, filter
+func (_m *Repository) ListCounters(ctx context.Context, filter model.CounterFilter) ([]*model.Counter, error) {
+	ret := _m.Called(ctx, filter)
+
+	var r0 []*model.Counter
+	if rf, ok := ret.Get(0).(func(context.Context, model.CounterFilter) []*model.Counter); ok {
+		r0 = rf(ctx, filter)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.Counter)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.CounterFilter) error); ok {
+		r1 = rf(ctx, filter)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PruneCounterBuckets provides a mock function with given fields: ctx, granularity, before
+func (_m *Repository) PruneCounterBuckets(ctx context.Context, granularity model.Granularity, before time.Time) (int64, error) {
+	ret := _m.Called(ctx, granularity, before)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, model.Granularity, time.Time) int64); ok {
+		r0 = rf(ctx, granularity, before)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.Granularity, time.Time) error); ok {
+		r1 = rf(ctx, granularity, before)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PurgeDeletedCounters provides a mock function with given fields: ctx, before
+func (_m *Repository) PurgeDeletedCounters(ctx context.Context, before time.Time) (int64, error) {
+	ret := _m.Called(ctx, before)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) int64); ok {
+		r0 = rf(ctx, before)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, before)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestoreCounter provides a mock function with given fields: ctx, id
+func (_m *Repository) RestoreCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.Counter
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) *model.Counter); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Counter)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetCounter provides a mock function with given fields: ctx, id, value, expectedVersion
+func (_m *Repository) SetCounter(ctx context.Context, id uuid.UUID, value int64, expectedVersion int64) (*model.Counter, error) {
+	ret := _m.Called(ctx, id, value, expectedVersion)
+
+	var r0 *model.Counter
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, int64, int64) *model.Counter); ok {
+		r0 = rf(ctx, id, value, expectedVersion)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Counter)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, int64, int64) error); ok {
+		r1 = rf(ctx, id, value, expectedVersion)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // SoftDeleteCounter provides a mock function with given fields: ctx, id
 func (_m *Repository) SoftDeleteCounter(ctx context.Context, id uuid.UUID) (int64, error) {
 	ret := _m.Called(ctx, id)
@@ -83,3 +356,49 @@ func (_m *Repository) SoftDeleteCounter(ctx context.Context, id uuid.UUID) (int6
 
 	return r0, r1
 }
+
+// SumCounterBuckets provides a mock function with given fields: ctx, ids, granularity, from, to
+func (_m *Repository) SumCounterBuckets(ctx context.Context, ids []uuid.UUID, granularity model.Granularity, from time.Time, to time.Time) ([]*model.CounterBucket, error) {
+	ret := _m.Called(ctx, ids, granularity, from, to)
+
+	var r0 []*model.CounterBucket
+	if rf, ok := ret.Get(0).(func(context.Context, []uuid.UUID, model.Granularity, time.Time, time.Time) []*model.CounterBucket); ok {
+		r0 = rf(ctx, ids, granularity, from, to)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.CounterBucket)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []uuid.UUID, model.Granularity, time.Time, time.Time) error); ok {
+		r1 = rf(ctx, ids, granularity, from, to)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateCounter provides a mock function with given fields: ctx, id, params
+func (_m *Repository) UpdateCounter(ctx context.Context, id uuid.UUID, params model.UpdateCounterParams) (*model.Counter, error) {
+	ret := _m.Called(ctx, id, params)
+
+	var r0 *model.Counter
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, model.UpdateCounterParams) *model.Counter); ok {
+		r0 = rf(ctx, id, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Counter)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, model.UpdateCounterParams) error); ok {
+		r1 = rf(ctx, id, params)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
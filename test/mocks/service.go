@@ -10,6 +10,8 @@ import (
 	model "gounter/internal/model"
 
 	uuid "github.com/google/uuid"
+
+	time "time"
 )
 
 // Service is an autogenerated mock type for the Service type
@@ -17,13 +19,197 @@ type Service struct {
 	mock.Mock
 }
 
-// CreateCounter provides a mock function with given fields: ctx, name
-func (_m *Service) CreateCounter(ctx context.Context, name string) (*model.Counter, error) {
-	ret := _m.Called(ctx, name)
+// AggregateRate provides a mock function with given fields: ctx, labels, window
+func (_m *Service) AggregateRate(ctx context.Context, labels string, window time.Duration) (*model.AggregateRate, error) {
+	ret := _m.Called(ctx, labels, window)
+
+	var r0 *model.AggregateRate
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Duration) *model.AggregateRate); ok {
+		r0 = rf(ctx, labels, window)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.AggregateRate)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Duration) error); ok {
+		r1 = rf(ctx, labels, window)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AggregateSeries provides a mock function with given fields: ctx, query
+func (_m *Service) AggregateSeries(ctx context.Context, query model.AggregateSeriesQuery) (*model.AggregateSeries, error) {
+	ret := _m.Called(ctx, query)
+
+	var r0 *model.AggregateSeries
+	if rf, ok := ret.Get(0).(func(context.Context, model.AggregateSeriesQuery) *model.AggregateSeries); ok {
+		r0 = rf(ctx, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.AggregateSeries)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.AggregateSeriesQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ApplyBatch provides a mock function with given fields: ctx, ops, atomic
+func (_m *Service) ApplyBatch(ctx context.Context, ops []model.BatchOperation, atomic bool) ([]model.BatchResult, error) {
+	ret := _m.Called(ctx, ops, atomic)
+
+	var r0 []model.BatchResult
+	if rf, ok := ret.Get(0).(func(context.Context, []model.BatchOperation, bool) []model.BatchResult); ok {
+		r0 = rf(ctx, ops, atomic)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.BatchResult)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []model.BatchOperation, bool) error); ok {
+		r1 = rf(ctx, ops, atomic)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CounterHistory provides a mock function with given fields: ctx, query
+func (_m *Service) CounterHistory(ctx context.Context, query model.CounterHistoryQuery) (*model.CounterEventPage, error) {
+	ret := _m.Called(ctx, query)
+
+	var r0 *model.CounterEventPage
+	if rf, ok := ret.Get(0).(func(context.Context, model.CounterHistoryQuery) *model.CounterEventPage); ok {
+		r0 = rf(ctx, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.CounterEventPage)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.CounterHistoryQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CounterRate provides a mock function with given fields: ctx, id, window
+func (_m *Service) CounterRate(ctx context.Context, id uuid.UUID, window time.Duration) (*model.CounterRate, error) {
+	ret := _m.Called(ctx, id, window)
+
+	var r0 *model.CounterRate
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, time.Duration) *model.CounterRate); ok {
+		r0 = rf(ctx, id, window)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.CounterRate)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, time.Duration) error); ok {
+		r1 = rf(ctx, id, window)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CounterSeries provides a mock function with given fields: ctx, query
+func (_m *Service) CounterSeries(ctx context.Context, query model.CounterSeriesQuery) (*model.CounterSeries, error) {
+	ret := _m.Called(ctx, query)
+
+	var r0 *model.CounterSeries
+	if rf, ok := ret.Get(0).(func(context.Context, model.CounterSeriesQuery) *model.CounterSeries); ok {
+		r0 = rf(ctx, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.CounterSeries)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.CounterSeriesQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateCounter provides a mock function with given fields: ctx, params
+func (_m *Service) CreateCounter(ctx context.Context, params model.CreateCounterParams) (*model.Counter, error) {
+	ret := _m.Called(ctx, params)
+
+	var r0 *model.Counter
+	if rf, ok := ret.Get(0).(func(context.Context, model.CreateCounterParams) *model.Counter); ok {
+		r0 = rf(ctx, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Counter)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.CreateCounterParams) error); ok {
+		r1 = rf(ctx, params)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetCounter provides a mock function with given fields: ctx, id
+func (_m *Service) GetCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.Counter
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID) *model.Counter); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Counter)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IncrementCounter provides a mock function with given fields: ctx, id, delta
+func (_m *Service) IncrementCounter(ctx context.Context, id uuid.UUID, delta int64) (*model.Counter, error) {
+	ret := _m.Called(ctx, id, delta)
 
 	var r0 *model.Counter
-	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Counter); ok {
-		r0 = rf(ctx, name)
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, int64) *model.Counter); ok {
+		r0 = rf(ctx, id, delta)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*model.Counter)
@@ -31,8 +217,75 @@ func (_m *Service) CreateCounter(ctx context.Context, name string) (*model.Count
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, name)
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, int64) error); ok {
+		r1 = rf(ctx, id, delta)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IncrementCounterByName provides a mock function with given fields: ctx, namespace, name, delta
+func (_m *Service) IncrementCounterByName(ctx context.Context, namespace string, name string, delta int64) (*model.Counter, error) {
+	ret := _m.Called(ctx, namespace, name, delta)
+
+	var r0 *model.Counter
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int64) *model.Counter); ok {
+		r0 = rf(ctx, namespace, name, delta)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Counter)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int64) error); ok {
+		r1 = rf(ctx, namespace, name, delta)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListCounters provides a mock function with given fields: ctx, query
+func (_m *Service) ListCounters(ctx context.Context, query model.ListCountersQuery) (*model.CounterPage, error) {
+	ret := _m.Called(ctx, query)
+
+	var r0 *model.CounterPage
+	if rf, ok := ret.Get(0).(func(context.Context, model.ListCountersQuery) *model.CounterPage); ok {
+		r0 = rf(ctx, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.CounterPage)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.ListCountersQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PurgeDeletedCounters provides a mock function with given fields: ctx, retention
+func (_m *Service) PurgeDeletedCounters(ctx context.Context, retention time.Duration) (int64, error) {
+	ret := _m.Called(ctx, retention)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, time.Duration) int64); ok {
+		r0 = rf(ctx, retention)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Duration) error); ok {
+		r1 = rf(ctx, retention)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -40,8 +293,8 @@ func (_m *Service) CreateCounter(ctx context.Context, name string) (*model.Count
 	return r0, r1
 }
 
-// IncrementCounter provides a mock function with given fields: ctx, id
-func (_m *Service) IncrementCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
+// RestoreCounter provides a mock function with given fields: ctx, id
+func (_m *Service) RestoreCounter(ctx context.Context, id uuid.UUID) (*model.Counter, error) {
 	ret := _m.Called(ctx, id)
 
 	var r0 *model.Counter
@@ -63,6 +316,29 @@ func (_m *Service) IncrementCounter(ctx context.Context, id uuid.UUID) (*model.C
 	return r0, r1
 }
 
+// SetCounter provides a mock function with given fields: ctx, id, value, expectedVersion
+func (_m *Service) SetCounter(ctx context.Context, id uuid.UUID, value int64, expectedVersion int64) (*model.Counter, error) {
+	ret := _m.Called(ctx, id, value, expectedVersion)
+
+	var r0 *model.Counter
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, int64, int64) *model.Counter); ok {
+		r0 = rf(ctx, id, value, expectedVersion)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Counter)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, int64, int64) error); ok {
+		r1 = rf(ctx, id, value, expectedVersion)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // SoftDeleteCounter provides a mock function with given fields: ctx, id
 func (_m *Service) SoftDeleteCounter(ctx context.Context, id uuid.UUID) (int64, error) {
 	ret := _m.Called(ctx, id)
@@ -83,3 +359,49 @@ func (_m *Service) SoftDeleteCounter(ctx context.Context, id uuid.UUID) (int64,
 
 	return r0, r1
 }
+
+// UpdateCounter provides a mock function with given fields: ctx, id, params
+func (_m *Service) UpdateCounter(ctx context.Context, id uuid.UUID, params model.UpdateCounterParams) (*model.Counter, error) {
+	ret := _m.Called(ctx, id, params)
+
+	var r0 *model.Counter
+	if rf, ok := ret.Get(0).(func(context.Context, uuid.UUID, model.UpdateCounterParams) *model.Counter); ok {
+		r0 = rf(ctx, id, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Counter)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, uuid.UUID, model.UpdateCounterParams) error); ok {
+		r1 = rf(ctx, id, params)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// WatchCounters provides a mock function with given fields: ctx, query
+func (_m *Service) WatchCounters(ctx context.Context, query model.WatchQuery) (<-chan model.CounterChange, error) {
+	ret := _m.Called(ctx, query)
+
+	var r0 <-chan model.CounterChange
+	if rf, ok := ret.Get(0).(func(context.Context, model.WatchQuery) <-chan model.CounterChange); ok {
+		r0 = rf(ctx, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(<-chan model.CounterChange)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.WatchQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -0,0 +1,673 @@
+// Package storagetest checks the behaviour the service expects from a
+// service.Repository, errors included, so the storage backends can be swapped
+// without the service or the handlers noticing. It runs against the memory,
+// sqlite, embedded and redis backends on every test run, and against Postgres
+// when POSTGRES_TEST_DSN points to a server.
+package storagetest
+
+import (
+	"context"
+	"database/sql"
+	"gounter/internal/model"
+	"gounter/internal/service"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Run runs the behaviour tests against fresh repositories made by newRepository
+func Run(t *testing.T, newRepository func(t *testing.T) service.Repository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo service.Repository)
+	}{
+		{name: "create and get", test: testCreateAndGet},
+		{name: "unknown counters", test: testUnknownCounters},
+		{name: "increment", test: testIncrement},
+		{name: "bounds", test: testBounds},
+		{name: "set", test: testSet},
+		{name: "delete, restore and purge", test: testDeleteRestorePurge},
+		{name: "list", test: testList},
+		{name: "names", test: testNames},
+		{name: "metadata", test: testMetadata},
+		{name: "idempotency", test: testIdempotency},
+		{name: "history", test: testHistory},
+		{name: "buckets", test: testBuckets},
+		{name: "concurrent increments", test: testConcurrentIncrements},
+		{name: "batch", test: testBatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepository(t))
+		})
+	}
+}
+
+// CounterParams returns the parameters of a plain counter as the service passes them
+func CounterParams(name string) model.CreateCounterParams {
+	return model.CreateCounterParams{Name: name, OverflowPolicy: model.OverflowReject, Shards: 1}
+}
+
+func createCounter(t *testing.T, repo service.Repository, params model.CreateCounterParams) *model.Counter {
+	if params.OverflowPolicy == "" {
+		params.OverflowPolicy = model.OverflowReject
+	}
+	if params.Shards == 0 {
+		params.Shards = 1
+	}
+
+	counter, err := repo.CreateCounter(context.TODO(), params)
+	require.NoError(t, err)
+
+	return counter
+}
+
+func testCreateAndGet(t *testing.T, repo service.Repository) {
+	min, max := int64(-5), int64(5)
+	created := createCounter(t, repo, model.CreateCounterParams{Name: "seats", Min: &min, Max: &max, OverflowPolicy: model.OverflowSaturate})
+
+	require.NotEqual(t, uuid.Nil, created.ID)
+	require.Equal(t, "seats", created.Name)
+	require.Equal(t, int64(0), created.Value)
+	require.Equal(t, int64(1), created.Version)
+	require.Equal(t, 1, created.Shards)
+	require.Equal(t, model.OverflowSaturate, created.OverflowPolicy)
+	require.False(t, created.CreatedAt.IsZero())
+	// A counter without labels has empty ones, as Postgres returns {}
+	require.NotNil(t, created.Labels)
+	require.Empty(t, created.Labels)
+
+	counter, err := repo.GetCounter(context.TODO(), created.ID)
+	require.NoError(t, err)
+	require.Equal(t, created.ID, counter.ID)
+	require.Equal(t, int64(-5), *counter.Min)
+	require.Equal(t, int64(5), *counter.Max)
+	require.Equal(t, created.Version, counter.Version)
+	require.True(t, created.CreatedAt.Equal(counter.CreatedAt))
+	require.Nil(t, counter.DeletedAt)
+	require.NotNil(t, counter.Labels)
+	require.Empty(t, counter.Labels)
+}
+
+func testUnknownCounters(t *testing.T, repo service.Repository) {
+	id := uuid.New()
+
+	_, err := repo.GetCounter(context.TODO(), id)
+	require.Equal(t, sql.ErrNoRows, err)
+
+	_, err = repo.IncrementCounter(context.TODO(), id, 1)
+	require.Equal(t, sql.ErrNoRows, err)
+
+	_, err = repo.SetCounter(context.TODO(), id, 1, 1)
+	require.Equal(t, sql.ErrNoRows, err)
+
+	_, err = repo.RestoreCounter(context.TODO(), id)
+	require.Equal(t, sql.ErrNoRows, err)
+
+	rowsAffected, err := repo.SoftDeleteCounter(context.TODO(), id)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), rowsAffected)
+
+	_, err = repo.GetIdempotencyRecord(context.TODO(), "alice", "unknown", time.Time{})
+	require.Equal(t, sql.ErrNoRows, err)
+}
+
+func testIncrement(t *testing.T, repo service.Repository) {
+	created := createCounter(t, repo, model.CreateCounterParams{Name: "requests"})
+
+	counter, err := repo.IncrementCounter(context.TODO(), created.ID, 5)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), counter.Value)
+	require.Equal(t, int64(2), counter.Version)
+
+	counter, err = repo.IncrementCounter(context.TODO(), created.ID, -7)
+	require.NoError(t, err)
+	require.Equal(t, int64(-2), counter.Value)
+	require.Equal(t, int64(3), counter.Version)
+
+	sharded := createCounter(t, repo, model.CreateCounterParams{Name: "page_views", Shards: 4})
+
+	// Increments of sharded counters bump the version like any other write
+	for i := 0; i < 8; i++ {
+		counter, err = repo.IncrementCounter(context.TODO(), sharded.ID, 1)
+		require.NoError(t, err)
+	}
+	require.Equal(t, int64(8), counter.Value)
+	require.Equal(t, int64(9), counter.Version)
+
+	counter, err = repo.GetCounter(context.TODO(), sharded.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(8), counter.Value)
+	require.Equal(t, int64(9), counter.Version)
+	require.Equal(t, 4, counter.Shards)
+
+	// A write based on the version read before the increments is stale
+	_, err = repo.SetCounter(context.TODO(), sharded.ID, 3, 1)
+	require.Equal(t, model.ErrVersionMismatch, err)
+
+	counter, err = repo.SetCounter(context.TODO(), sharded.ID, 3, 9)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), counter.Value)
+	require.Equal(t, int64(10), counter.Version)
+
+	counter, err = repo.IncrementCounter(context.TODO(), sharded.ID, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), counter.Value)
+}
+
+func testBounds(t *testing.T, repo service.Repository) {
+	min, max := int64(0), int64(3)
+	rejecting := createCounter(t, repo, model.CreateCounterParams{Name: "slots", Min: &min, Max: &max})
+	saturating := createCounter(t, repo, model.CreateCounterParams{Name: "seats", Min: &min, Max: &max, OverflowPolicy: model.OverflowSaturate})
+
+	_, err := repo.IncrementCounter(context.TODO(), rejecting.ID, 4)
+	require.Equal(t, model.ErrOutOfBounds, err)
+
+	_, err = repo.IncrementCounter(context.TODO(), rejecting.ID, -1)
+	require.Equal(t, model.ErrOutOfBounds, err)
+
+	_, err = repo.SetCounter(context.TODO(), rejecting.ID, 10, 1)
+	require.Equal(t, model.ErrOutOfBounds, err)
+
+	// Rejected changes leave the counter untouched
+	counter, err := repo.GetCounter(context.TODO(), rejecting.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), counter.Value)
+	require.Equal(t, int64(1), counter.Version)
+
+	counter, err = repo.IncrementCounter(context.TODO(), saturating.ID, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), counter.Value)
+
+	counter, err = repo.SetCounter(context.TODO(), saturating.ID, -10, counter.Version)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), counter.Value)
+}
+
+func testSet(t *testing.T, repo service.Repository) {
+	created := createCounter(t, repo, model.CreateCounterParams{Name: "queue"})
+
+	counter, err := repo.SetCounter(context.TODO(), created.ID, 42, created.Version)
+	require.NoError(t, err)
+	require.Equal(t, int64(42), counter.Value)
+	require.Equal(t, created.Version+1, counter.Version)
+
+	_, err = repo.SetCounter(context.TODO(), created.ID, 7, created.Version)
+	require.Equal(t, model.ErrVersionMismatch, err)
+
+	counter, err = repo.GetCounter(context.TODO(), created.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(42), counter.Value)
+}
+
+func testDeleteRestorePurge(t *testing.T, repo service.Repository) {
+	created := createCounter(t, repo, model.CreateCounterParams{Name: "temporary"})
+
+	_, err := repo.RestoreCounter(context.TODO(), created.ID)
+	require.Equal(t, sql.ErrNoRows, err, "live counters cannot be restored")
+
+	rowsAffected, err := repo.SoftDeleteCounter(context.TODO(), created.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), rowsAffected)
+
+	rowsAffected, err = repo.SoftDeleteCounter(context.TODO(), created.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), rowsAffected, "deleting twice affects nothing")
+
+	_, err = repo.GetCounter(context.TODO(), created.ID)
+	require.Equal(t, sql.ErrNoRows, err)
+
+	_, err = repo.IncrementCounter(context.TODO(), created.ID, 1)
+	require.Equal(t, sql.ErrNoRows, err)
+
+	_, err = repo.SetCounter(context.TODO(), created.ID, 1, created.Version+1)
+	require.Equal(t, sql.ErrNoRows, err)
+
+	counters, err := repo.ListCounters(context.TODO(), model.CounterFilter{SortBy: model.SortByName, Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, counters)
+
+	counter, err := repo.RestoreCounter(context.TODO(), created.ID)
+	require.NoError(t, err)
+	require.Equal(t, created.ID, counter.ID)
+	require.Equal(t, created.Version+2, counter.Version)
+
+	_, err = repo.GetCounter(context.TODO(), created.ID)
+	require.NoError(t, err)
+
+	// Only tombstones older than the cutoff are purged
+	rowsAffected, err = repo.SoftDeleteCounter(context.TODO(), created.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), rowsAffected)
+
+	purged, err := repo.PurgeDeletedCounters(context.TODO(), time.Now().UTC().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, int64(0), purged)
+
+	purged, err = repo.PurgeDeletedCounters(context.TODO(), time.Now().UTC().Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), purged)
+
+	_, err = repo.RestoreCounter(context.TODO(), created.ID)
+	require.Equal(t, sql.ErrNoRows, err)
+}
+
+func testNames(t *testing.T, repo service.Repository) {
+	created := createCounter(t, repo, model.CreateCounterParams{Name: "signups", Namespace: "growth"})
+	require.Equal(t, "growth", created.Namespace)
+
+	counter, err := repo.GetCounterByName(context.TODO(), "growth", "signups")
+	require.NoError(t, err)
+	require.Equal(t, created.ID, counter.ID)
+	require.Equal(t, "growth", counter.Namespace)
+
+	_, err = repo.CreateCounter(context.TODO(), model.CreateCounterParams{Name: "signups", Namespace: "growth", OverflowPolicy: model.OverflowReject, Shards: 1})
+	require.Equal(t, model.ErrNameTaken, err)
+
+	// Names are only unique within a namespace, counters without one can share them
+	createCounter(t, repo, model.CreateCounterParams{Name: "signups", Namespace: "marketing"})
+	createCounter(t, repo, model.CreateCounterParams{Name: "signups"})
+	createCounter(t, repo, model.CreateCounterParams{Name: "signups"})
+
+	_, err = repo.GetCounterByName(context.TODO(), "sales", "signups")
+	require.Equal(t, sql.ErrNoRows, err)
+
+	_, err = repo.GetCounterByName(context.TODO(), "", "signups")
+	require.Equal(t, sql.ErrNoRows, err, "counters without a namespace are not found by name")
+
+	// Deleting a counter frees its name, which keeps it from being restored once taken
+	_, err = repo.SoftDeleteCounter(context.TODO(), created.ID)
+	require.NoError(t, err)
+
+	_, err = repo.GetCounterByName(context.TODO(), "growth", "signups")
+	require.Equal(t, sql.ErrNoRows, err)
+
+	replacement := createCounter(t, repo, model.CreateCounterParams{Name: "signups", Namespace: "growth"})
+
+	_, err = repo.RestoreCounter(context.TODO(), created.ID)
+	require.Equal(t, model.ErrNameTaken, err)
+
+	_, err = repo.SoftDeleteCounter(context.TODO(), replacement.ID)
+	require.NoError(t, err)
+
+	counter, err = repo.RestoreCounter(context.TODO(), created.ID)
+	require.NoError(t, err)
+	require.Equal(t, "growth", counter.Namespace)
+
+	counter, err = repo.GetCounterByName(context.TODO(), "growth", "signups")
+	require.NoError(t, err)
+	require.Equal(t, created.ID, counter.ID)
+}
+
+func testList(t *testing.T, repo service.Repository) {
+	names := []string{"api_requests", "api_errors", "db_queries", "api_latency"}
+	ids := map[string]uuid.UUID{}
+	for i, name := range names {
+		counter := createCounter(t, repo, model.CreateCounterParams{Name: name})
+		ids[name] = counter.ID
+
+		_, err := repo.IncrementCounter(context.TODO(), counter.ID, int64(i))
+		require.NoError(t, err)
+	}
+
+	listNames := func(filter model.CounterFilter) []string {
+		counters, err := repo.ListCounters(context.TODO(), filter)
+		require.NoError(t, err)
+
+		listed := []string{}
+		for _, counter := range counters {
+			listed = append(listed, counter.Name)
+		}
+		return listed
+	}
+
+	require.Equal(t, []string{"api_errors", "api_latency", "api_requests"},
+		listNames(model.CounterFilter{NamePrefix: "api_", SortBy: model.SortByName, Limit: 10}))
+
+	require.Equal(t, []string{"api_latency", "db_queries"},
+		listNames(model.CounterFilter{SortBy: model.SortByValue, Descending: true, Limit: 2}))
+
+	require.Equal(t, []string{"db_queries", "api_requests"},
+		listNames(model.CounterFilter{IDs: []uuid.UUID{ids["db_queries"], ids["api_requests"], uuid.New()}, SortBy: model.SortByCreatedAt, Descending: true, Limit: 10}))
+
+	// The next page starts after the last counter of the previous one
+	page, err := repo.ListCounters(context.TODO(), model.CounterFilter{SortBy: model.SortByName, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+
+	require.Equal(t, []string{"api_requests", "db_queries"},
+		listNames(model.CounterFilter{SortBy: model.SortByName, After: page[1], Limit: 10}))
+
+	_, err = repo.ListCounters(context.TODO(), model.CounterFilter{SortBy: "color", Limit: 10})
+	require.Error(t, err)
+}
+
+func testMetadata(t *testing.T, repo service.Repository) {
+	created := createCounter(t, repo, model.CreateCounterParams{
+		Name:        "checkout",
+		Namespace:   "shop",
+		Labels:      model.Labels{"team": "payments", "env": "prod"},
+		Description: "Completed checkouts",
+		Unit:        "orders",
+	})
+	require.Equal(t, model.Labels{"team": "payments", "env": "prod"}, created.Labels)
+	require.Equal(t, "Completed checkouts", created.Description)
+	require.Equal(t, "orders", created.Unit)
+
+	createCounter(t, repo, model.CreateCounterParams{Name: "refunds", Namespace: "shop", Labels: model.Labels{"team": "payments", "env": "staging"}})
+	createCounter(t, repo, model.CreateCounterParams{Name: "signups", Labels: model.Labels{"team": "growth", "env": "prod"}})
+
+	listNames := func(labels model.Labels) []string {
+		counters, err := repo.ListCounters(context.TODO(), model.CounterFilter{Labels: labels, SortBy: model.SortByName, Limit: 10})
+		require.NoError(t, err)
+
+		listed := []string{}
+		for _, counter := range counters {
+			listed = append(listed, counter.Name)
+		}
+		return listed
+	}
+
+	require.Equal(t, []string{"checkout", "refunds"}, listNames(model.Labels{"team": "payments"}))
+	require.Equal(t, []string{"checkout", "signups"}, listNames(model.Labels{"env": "prod"}))
+	require.Equal(t, []string{"checkout"}, listNames(model.Labels{"team": "payments", "env": "prod"}))
+	require.Empty(t, listNames(model.Labels{"team": "ops"}))
+
+	// Only the given fields change, the labels are replaced as a whole
+	name, unit := "checkout_completed", ""
+	labels := model.Labels{"team": "payments"}
+	counter, err := repo.UpdateCounter(context.TODO(), created.ID, model.UpdateCounterParams{Name: &name, Unit: &unit, Labels: &labels})
+	require.NoError(t, err)
+	require.Equal(t, "checkout_completed", counter.Name)
+	require.Equal(t, "Completed checkouts", counter.Description)
+	require.Equal(t, "", counter.Unit)
+	require.Equal(t, model.Labels{"team": "payments"}, counter.Labels)
+	require.Equal(t, created.Version+1, counter.Version)
+
+	counter, err = repo.GetCounterByName(context.TODO(), "shop", "checkout_completed")
+	require.NoError(t, err)
+	require.Equal(t, created.ID, counter.ID)
+	require.Equal(t, model.Labels{"team": "payments"}, counter.Labels)
+
+	_, err = repo.GetCounterByName(context.TODO(), "shop", "checkout")
+	require.Equal(t, sql.ErrNoRows, err, "renaming frees the old name")
+
+	require.Equal(t, []string{"signups"}, listNames(model.Labels{"env": "prod"}))
+
+	name = "refunds"
+	_, err = repo.UpdateCounter(context.TODO(), created.ID, model.UpdateCounterParams{Name: &name})
+	require.Equal(t, model.ErrNameTaken, err)
+
+	events, err := repo.ListCounterEvents(context.TODO(), model.CounterEventFilter{CounterID: created.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, model.EventUpdate, events[1].Type)
+
+	_, err = repo.UpdateCounter(context.TODO(), uuid.New(), model.UpdateCounterParams{Name: &name})
+	require.Equal(t, sql.ErrNoRows, err)
+}
+
+func testIdempotency(t *testing.T, repo service.Repository) {
+	created := createCounter(t, repo, model.CreateCounterParams{Name: "payments"})
+	since := time.Now().UTC().Add(-time.Hour)
+
+	ctx := model.WithIdempotencyRecord(context.TODO(), &model.IdempotencyRecord{Subject: "alice", Key: "key-1", Request: "increment", Since: since})
+	counter, err := repo.IncrementCounter(ctx, created.ID, 3)
+	require.NoError(t, err)
+
+	record, err := repo.GetIdempotencyRecord(context.TODO(), "alice", "key-1", since)
+	require.NoError(t, err)
+	require.Equal(t, "alice", record.Subject)
+	require.Equal(t, "increment", record.Request)
+	require.Equal(t, counter.Value, record.Counter.Value)
+	require.Equal(t, counter.Version, record.Counter.Version)
+
+	// A taken key rolls the change back
+	_, err = repo.IncrementCounter(ctx, created.ID, 3)
+	require.Equal(t, model.ErrDuplicateIdempotencyKey, err)
+
+	counter, err = repo.GetCounter(context.TODO(), created.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), counter.Value)
+
+	// Another subject has its own keys
+	_, err = repo.GetIdempotencyRecord(context.TODO(), "bob", "key-1", since)
+	require.Equal(t, sql.ErrNoRows, err)
+
+	otherCtx := model.WithIdempotencyRecord(context.TODO(), &model.IdempotencyRecord{Subject: "bob", Key: "key-1", Request: "increment", Since: since})
+	counter, err = repo.IncrementCounter(otherCtx, created.ID, 3)
+	require.NoError(t, err)
+	require.Equal(t, int64(6), counter.Value)
+
+	record, err = repo.GetIdempotencyRecord(context.TODO(), "bob", "key-1", since)
+	require.NoError(t, err)
+	require.Equal(t, int64(6), record.Counter.Value)
+
+	// Records older than the window are not returned
+	_, err = repo.GetIdempotencyRecord(context.TODO(), "alice", "key-1", time.Now().UTC().Add(time.Hour))
+	require.Equal(t, sql.ErrNoRows, err)
+
+	deleteCtx := model.WithIdempotencyRecord(context.TODO(), &model.IdempotencyRecord{Subject: "alice", Key: "key-2", Request: "delete", Since: since})
+	rowsAffected, err := repo.SoftDeleteCounter(deleteCtx, created.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), rowsAffected)
+
+	record, err = repo.GetIdempotencyRecord(context.TODO(), "alice", "key-2", since)
+	require.NoError(t, err)
+	require.Nil(t, record.Counter)
+}
+
+func testHistory(t *testing.T, repo service.Repository) {
+	min := int64(0)
+	created := createCounter(t, repo, model.CreateCounterParams{Name: "stock", Min: &min, OverflowPolicy: model.OverflowSaturate})
+	ctx := model.WithSubject(context.TODO(), "warehouse")
+
+	_, err := repo.IncrementCounter(ctx, created.ID, 5)
+	require.NoError(t, err)
+	// Saturated changes record the delta actually applied
+	counter, err := repo.IncrementCounter(ctx, created.ID, -8)
+	require.NoError(t, err)
+	_, err = repo.SetCounter(context.TODO(), created.ID, 2, counter.Version)
+	require.NoError(t, err)
+	_, err = repo.SoftDeleteCounter(context.TODO(), created.ID)
+	require.NoError(t, err)
+	_, err = repo.RestoreCounter(context.TODO(), created.ID)
+	require.NoError(t, err)
+
+	events, err := repo.ListCounterEvents(context.TODO(), model.CounterEventFilter{CounterID: created.ID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, events, 6)
+
+	expected := []struct {
+		eventType    model.CounterEventType
+		delta, value int64
+		subject      string
+	}{
+		{model.EventCreate, 0, 0, ""},
+		{model.EventIncrement, 5, 5, "warehouse"},
+		{model.EventDecrement, -5, 0, "warehouse"},
+		{model.EventSet, 2, 2, ""},
+		{model.EventDelete, 0, 2, ""},
+		{model.EventRestore, 0, 2, ""},
+	}
+	for i, event := range events {
+		require.Equal(t, created.ID, event.CounterID)
+		require.Equal(t, expected[i].eventType, event.Type)
+		require.Equal(t, expected[i].delta, event.Delta)
+		require.Equal(t, expected[i].value, event.Value)
+		require.Equal(t, expected[i].subject, event.Subject)
+	}
+
+	page, err := repo.ListCounterEvents(context.TODO(), model.CounterEventFilter{CounterID: created.ID, AfterID: events[3].ID, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	require.Equal(t, events[4].ID, page[0].ID)
+
+	to := events[0].CreatedAt.Add(-time.Second)
+	page, err = repo.ListCounterEvents(context.TODO(), model.CounterEventFilter{CounterID: created.ID, To: &to, Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, page)
+
+	now := time.Now().UTC()
+	from := model.GranularityDay.BucketStart(now)
+	buckets, err := repo.ListCounterBuckets(context.TODO(), created.ID, model.GranularityDay, from, from.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, buckets, 1)
+	require.True(t, from.Equal(buckets[0].Start))
+	require.Equal(t, int64(0), buckets[0].Delta)
+	require.Equal(t, int64(2), buckets[0].Increments)
+
+	buckets, err = repo.ListCounterBuckets(context.TODO(), created.ID, model.GranularityDay, from.Add(24*time.Hour), from.Add(48*time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, buckets)
+}
+
+func testBuckets(t *testing.T, repo service.Repository) {
+	first := createCounter(t, repo, model.CreateCounterParams{Name: "first"})
+	second := createCounter(t, repo, model.CreateCounterParams{Name: "second"})
+	other := createCounter(t, repo, model.CreateCounterParams{Name: "other"})
+
+	for _, change := range []struct {
+		id    uuid.UUID
+		delta int64
+	}{{first.ID, 3}, {first.ID, 4}, {second.ID, 5}, {other.ID, 100}} {
+		_, err := repo.IncrementCounter(context.TODO(), change.id, change.delta)
+		require.NoError(t, err)
+	}
+
+	// The changes may fall on both sides of a bucket boundary, only their totals are certain
+	total := func(granularity model.Granularity, ids ...uuid.UUID) (delta, increments int64) {
+		now := time.Now().UTC()
+		buckets, err := repo.SumCounterBuckets(context.TODO(), ids, granularity, now.Add(-48*time.Hour), now.Add(time.Hour))
+		require.NoError(t, err)
+
+		for i, bucket := range buckets {
+			if i > 0 {
+				require.True(t, buckets[i-1].Start.Before(bucket.Start))
+			}
+			delta += bucket.Delta
+			increments += bucket.Increments
+		}
+
+		return delta, increments
+	}
+
+	delta, increments := total(model.GranularityMinute, first.ID, second.ID)
+	require.Equal(t, int64(12), delta)
+	require.Equal(t, int64(3), increments)
+
+	delta, increments = total(model.GranularityMinute)
+	require.Equal(t, int64(0), delta)
+	require.Equal(t, int64(0), increments)
+
+	// Only the minute buckets started before the given time are pruned
+	pruned, err := repo.PruneCounterBuckets(context.TODO(), model.GranularityMinute, time.Now().UTC().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, int64(0), pruned)
+
+	pruned, err = repo.PruneCounterBuckets(context.TODO(), model.GranularityMinute, time.Now().UTC().Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, pruned > 0)
+
+	delta, _ = total(model.GranularityMinute, first.ID, second.ID, other.ID)
+	require.Equal(t, int64(0), delta)
+
+	delta, increments = total(model.GranularityDay, first.ID, second.ID, other.ID)
+	require.Equal(t, int64(112), delta)
+	require.Equal(t, int64(4), increments)
+}
+
+func testConcurrentIncrements(t *testing.T, repo service.Repository) {
+	created := createCounter(t, repo, model.CreateCounterParams{Name: "hot"})
+
+	const workers, increments = 8, 25
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				_, err := repo.IncrementCounter(context.TODO(), created.ID, 1)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	counter, err := repo.GetCounter(context.TODO(), created.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(workers*increments), counter.Value)
+	require.Equal(t, int64(workers*increments+1), counter.Version)
+}
+
+// testBatch only runs against the storages able to apply batches
+func testBatch(t *testing.T, repo service.Repository) {
+	batchRepo, ok := repo.(service.BatchRepository)
+	if !ok {
+		t.Skip("storage does not support batches")
+	}
+
+	max := int64(10)
+	bounded := createCounter(t, repo, model.CreateCounterParams{Name: "bounded", Max: &max})
+	deleted := createCounter(t, repo, CounterParams("deleted"))
+
+	ops := []model.BatchOperation{
+		{Type: model.BatchCreate, Create: CounterParams("created")},
+		{Type: model.BatchIncrement, CounterID: bounded.ID, Delta: 4},
+		{Type: model.BatchDelete, CounterID: deleted.ID},
+		{Type: model.BatchIncrement, CounterID: bounded.ID, Delta: 20},
+	}
+
+	// The out of bounds increment rolls back the whole batch
+	_, err := batchRepo.ApplyBatch(context.TODO(), ops, true)
+	require.Equal(t, &model.BatchError{Index: 3, Err: model.ErrOutOfBounds}, err)
+
+	counter, err := repo.GetCounter(context.TODO(), bounded.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), counter.Value)
+
+	_, err = repo.GetCounter(context.TODO(), deleted.ID)
+	require.NoError(t, err)
+
+	counters, err := repo.ListCounters(context.TODO(), model.CounterFilter{NamePrefix: "created", SortBy: model.SortByName, Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, counters)
+
+	// Best effort keeps everything but the failed operation
+	results, err := batchRepo.ApplyBatch(context.TODO(), ops, false)
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+
+	require.NoError(t, results[0].Err)
+	require.Equal(t, "created", results[0].Counter.Name)
+	require.NoError(t, results[1].Err)
+	require.Equal(t, int64(4), results[1].Counter.Value)
+	require.NoError(t, results[2].Err)
+	require.Nil(t, results[2].Counter)
+	require.Equal(t, model.ErrOutOfBounds, results[3].Err)
+	require.Nil(t, results[3].Counter)
+
+	counter, err = repo.GetCounter(context.TODO(), bounded.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), counter.Value)
+	require.Equal(t, int64(2), counter.Version)
+
+	_, err = repo.GetCounter(context.TODO(), deleted.ID)
+	require.Equal(t, sql.ErrNoRows, err)
+
+	// Deleting it again fails on its own
+	results, err = batchRepo.ApplyBatch(context.TODO(), []model.BatchOperation{
+		{Type: model.BatchDelete, CounterID: deleted.ID},
+		{Type: model.BatchSet, CounterID: bounded.ID, Value: 7, ExpectedVersion: 2},
+	}, false)
+	require.NoError(t, err)
+	require.Equal(t, sql.ErrNoRows, results[0].Err)
+	require.NoError(t, results[1].Err)
+	require.Equal(t, int64(7), results[1].Counter.Value)
+}
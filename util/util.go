@@ -7,13 +7,28 @@ import (
 	"github.com/golang-jwt/jwt"
 )
 
+// TokenSubject is the subject of the tokens made by GenerateValidJWT
+const TokenSubject = "gounter"
+
 // Helper function to generate a valid JWT token
 func GenerateValidJWT() (string, error) {
-	claims := &jwt.MapClaims{
-		// this is the only thing we are validating
-		// Set expiration to 5 minutes from now
-		"exp": time.Now().Add(time.Minute * 5).Unix(),
-	}
+	return generateJWT(jwt.MapClaims{})
+}
+
+// GenerateAdminJWT generates a valid JWT token holding the admin role, which
+// the admin routes require
+func GenerateAdminJWT() (string, error) {
+	return generateJWT(jwt.MapClaims{"role": auth.AdminRole})
+}
+
+// generateJWT signs a token with the given claims, along with the expiry and
+// subject of every generated token
+func generateJWT(claims jwt.MapClaims) (string, error) {
+	// this is the only thing we are validating
+	// Set expiration to 5 minutes from now
+	claims["exp"] = time.Now().Add(time.Minute * 5).Unix()
+	// Changes made with the token are recorded under this subject
+	claims["sub"] = TokenSubject
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 